@@ -0,0 +1,197 @@
+package admin
+
+// 运维命令（在 backend 目录下执行）：
+//   go run main.go dlq list <queue> [-limit 20]      查看死信消息
+//   go run main.go dlq redrive <queue> [-limit 100]  将死信消息重新投递回业务队列
+//   go run main.go likes check                        对比 Redis 与 MySQL 的点赞数据，输出差异报告
+//   go run main.go likes repair [-settle 30s]         修复点赞数据差异
+//   go run main.go likes rebuild                      从 MySQL 重建 Redis 点赞数据（含评论点赞）
+//   go run main.go outbox status                      查看发件箱积压情况
+//   go run main.go storage orphans [-min-age 24h] [-delete]  扫描存储桶中没有所属视频的孤儿文件
+
+import (
+	"backend/services"
+	"backend/utils"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// usage 命令帮助信息
+const usage = `用法:
+  dlq list <queue> [-limit N]      查看死信消息（默认 20 条）
+  dlq redrive <queue> [-limit N]   重新投递死信消息（默认 100 条）
+  likes check                      对比 Redis 与 MySQL 的点赞数据，输出差异报告（不修改数据）
+  likes repair [-settle 30s]       对比两次（间隔 settle），修复两次都存在的差异；settle 为 0 时直接修复
+  likes rebuild                    从 MySQL 重建 Redis 视频点赞集合、排行榜和评论点赞集合（尚未落库的点赞会丢失）
+  outbox status                    查看发件箱待发送、重试中的消息数
+  storage orphans [-min-age 24h] [-delete]
+                                   扫描存储桶中没有所属视频的孤儿文件并输出报告；-delete 时同时删除
+                                   （修改时间在 min-age 之内的文件跳过，避免误删正在上传、转码的文件）
+
+queue: video_processing | video_like_processing | comment_like_processing | video_view_processing | video_cleanup`
+
+// Run 执行运维命令
+// 参数：命令行参数（不含程序名）
+func Run(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "dlq":
+		return runDLQ(args[1:])
+	case "likes":
+		return runLikes(args[1:])
+	case "outbox":
+		return runOutbox(args[1:])
+	case "storage":
+		return runStorage(args[1:])
+	default:
+		return fmt.Errorf("未知命令: %s\n%s", args[0], usage)
+	}
+}
+
+// runDLQ 死信队列相关命令
+func runDLQ(args []string) error {
+	if len(args) < 2 {
+		return errors.New(usage)
+	}
+	action, queue := args[0], args[1]
+
+	fs := flag.NewFlagSet("dlq "+action, flag.ContinueOnError)
+	limit := fs.Int("limit", 0, "最多处理的消息条数")
+	if err := fs.Parse(args[2:]); err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		if *limit <= 0 {
+			*limit = 20
+		}
+		messages, err := utils.ListDeadLetters(queue, *limit)
+		if err != nil {
+			return err
+		}
+		return printJSON(messages)
+	case "redrive":
+		if *limit <= 0 {
+			*limit = 100
+		}
+		count, err := utils.RedriveDeadLetters(queue, *limit)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已重新投递 %d 条消息到 %s\n", count, queue)
+		return nil
+	default:
+		return fmt.Errorf("未知的 dlq 操作: %s\n%s", action, usage)
+	}
+}
+
+// runLikes 点赞数据对账相关命令
+func runLikes(args []string) error {
+	if len(args) < 1 {
+		return errors.New(usage)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("likes "+action, flag.ContinueOnError)
+	settle := fs.Duration("settle", 30*time.Second, "两次对比的间隔（等待 MQ 中的点赞消息落库）")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	reconciler := services.LikeReconcileService{}
+	switch action {
+	case "check":
+		result, err := reconciler.Reconcile(services.LikeReconcileOptions{})
+		if err != nil {
+			return err
+		}
+		return printJSON(result.Report)
+	case "repair":
+		// Redis 被清空后以 Redis 为准修复会删除 MySQL 中的所有点赞
+		exists, err := utils.VideoLikeRankExists()
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("Redis 中没有点赞排行榜（数据可能已丢失），请先执行 likes rebuild 从 MySQL 重建")
+		}
+		opts := services.LikeReconcileOptions{Repair: true}
+		if *settle > 0 {
+			first, err := reconciler.Reconcile(services.LikeReconcileOptions{})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "发现 %d 处差异，%v 后再次对比并修复仍然存在的差异...\n", len(first.Report.Diffs), *settle)
+			time.Sleep(*settle)
+			opts.Confirmed = first.Pending
+		}
+		result, err := reconciler.Reconcile(opts)
+		if err != nil {
+			return err
+		}
+		return printJSON(result.Report)
+	case "rebuild":
+		count, err := reconciler.RebuildRedis()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已从 MySQL 重建 %d 个视频的 Redis 点赞数据\n", count)
+		count, err = reconciler.RebuildCommentLikes()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已从 MySQL 重建 %d 条评论的 Redis 点赞数据\n", count)
+		return nil
+	default:
+		return fmt.Errorf("未知的 likes 操作: %s\n%s", action, usage)
+	}
+}
+
+// runOutbox 发件箱相关命令
+func runOutbox(args []string) error {
+	if len(args) < 1 || args[0] != "status" {
+		return errors.New(usage)
+	}
+	stats, err := utils.GetOutboxStats()
+	if err != nil {
+		return err
+	}
+	return printJSON(stats)
+}
+
+// runStorage 存储相关命令
+func runStorage(args []string) error {
+	if len(args) < 1 || args[0] != "orphans" {
+		return errors.New(usage)
+	}
+
+	fs := flag.NewFlagSet("storage orphans", flag.ContinueOnError)
+	minAge := fs.Duration("min-age", 24*time.Hour, "只处理修改时间早于该时间之前的文件")
+	remove := fs.Bool("delete", false, "删除扫描到的孤儿文件")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	report, err := utils.ScanOrphanObjects(*minAge, *remove)
+	if report != nil {
+		if perr := printJSON(report); perr != nil {
+			return perr
+		}
+	}
+	return err
+}
+
+// printJSON 以缩进格式输出 JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -11,10 +11,13 @@ import (
 // 创建评论服务实例
 var commentService = services.CommentService{}
 
+// 创建评论点赞服务实例
+var commentLikeService = services.CommentLikeService{}
+
 // AddComment 添加评论
 // 请求：POST /api/video/comment/:videoid
 // Header: Authorization: Bearer <token>
-// Body: {"content": "评论内容"}
+// Body: {"content": "评论内容", "parent_id": 12}  parent_id 可选，回复某条评论时传入
 func AddComment(c *gin.Context) {
 	// 1. 获取当前用户（JWT已经验证过了）
 	username, exists := c.Get("username")
@@ -60,9 +63,10 @@ func AddComment(c *gin.Context) {
 	})
 }
 
-// GetComments 获取视频评论
-// 请求：GET /video/:videoid/comments
-// 不需要JWT验证
+// GetComments 获取视频评论（一级评论，回复通过 GetCommentReplies 按需加载）
+// 请求：GET /video/:videoid/comments?sort=newest|hot&cursor=&page_size=20
+// Header: Authorization: Bearer <token> (可选，如果提供则返回 is_liked 字段)
+// 返回：{ "message": "...", "comments": [...], "next_cursor": "..." }，next_cursor 为空表示没有更多
 func GetComments(c *gin.Context){
 	// 从路径参数获取视频ID
 	videoidStr := c.Param("videoid")
@@ -75,8 +79,12 @@ func GetComments(c *gin.Context){
 	}
 
 
+	// 获取排序和分页参数
+	sort := c.DefaultQuery("sort", "newest")
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
 	// 获取评论
-	comments, err := commentService.GetComments(uint(videoid))
+	resp, err := commentService.GetComments(uint(videoid), sort, c.Query("cursor"), pageSize, c.GetString("username"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
@@ -86,8 +94,9 @@ func GetComments(c *gin.Context){
 
 	// 返回响应
 	c.JSON(http.StatusOK, gin.H{
-		"message":	"获取评论成功",
-		"comments":	comments,
+		"message":     "获取评论成功",
+		"comments":    resp.Comments,
+		"next_cursor": resp.NextCursor,
 	})
 }
 
@@ -115,7 +124,7 @@ func DeleteComment(c *gin.Context) {
 	}
 
 	// 3. 调用服务层删除评论
-	err = commentService.DeleteComment(username.(string), uint(commentID))
+	commentCount, err := commentService.DeleteComment(username.(string), uint(commentID))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
@@ -125,6 +134,61 @@ func DeleteComment(c *gin.Context) {
 
 	// 4. 返回成功响应
 	c.JSON(http.StatusOK, gin.H{
-		"message": "删除评论成功",
+		"message":       "删除评论成功",
+		"comment_count": commentCount,
+	})
+}
+
+// GetCommentReplies 获取某条一级评论的回复
+// 请求：GET /api/comment/:commentid/replies?cursor=&page_size=20
+// Header: Authorization: Bearer <token> (可选，如果提供则返回 is_liked 字段)
+// 返回：{ "message": "...", "replies": [...], "next_cursor": "..." }
+func GetCommentReplies(c *gin.Context) {
+	commentID, err := strconv.ParseUint(c.Param("commentid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评论ID",
+		})
+		return
+	}
+
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	resp, err := commentService.GetReplies(uint(commentID), c.Query("cursor"), pageSize, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "获取回复成功",
+		"replies":     resp.Comments,
+		"next_cursor": resp.NextCursor,
 	})
 }
+
+// ToggleCommentLike 切换评论点赞状态
+// 请求：POST /api/comment/:commentid/toggle-like
+// Header: Authorization: Bearer <token>
+// 返回：{ "message": "...", "like_count": 10, "is_liked": true }
+func ToggleCommentLike(c *gin.Context) {
+	commentID, err := strconv.ParseUint(c.Param("commentid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评论ID",
+		})
+		return
+	}
+
+	resp, err := commentLikeService.ToggleLike(c.GetString("username"), uint(commentID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"backend/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// 创建关注服务实例
+var followService = services.FollowService{}
+
+// parseUserIDParam 解析路径中的 :userid
+func parseUserIDParam(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("userid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的用户ID",
+		})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// FollowUser 关注用户API（需要JWT认证）
+// 请求：POST /api/user/:userid/follow
+// 返回：关注成功的消息（重复关注也返回成功）
+func FollowUser(c *gin.Context) {
+	followeeID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := followService.Follow(c.GetString("username"), followeeID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "关注成功",
+		"is_following": true,
+	})
+}
+
+// UnfollowUser 取消关注API（需要JWT认证）
+// 请求：DELETE /api/user/:userid/follow
+// 返回：取消关注成功的消息（未关注也返回成功）
+func UnfollowUser(c *gin.Context) {
+	followeeID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := followService.Unfollow(c.GetString("username"), followeeID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "已取消关注",
+		"is_following": false,
+	})
+}
+
+// GetUserProfile 获取用户主页信息API
+// 请求：GET /api/user/:userid/profile
+// Header: Authorization: Bearer <token> (可选，如果提供则返回 is_following 字段)
+// 返回：{ "user": { "id": 1, "username": "...", "follower_count": 10, "following_count": 3, "is_following": true } }
+func GetUserProfile(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	profile, err := followService.GetProfile(userID, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": profile,
+	})
+}
+
+// GetFollowers 获取粉丝列表API
+// 请求：GET /api/user/:userid/followers?cursor=&page_size=20
+// 返回：{ "users": [...], "next_cursor": "..." }
+func GetFollowers(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	resp, err := followService.GetFollowers(userID, c.Query("cursor"), pageSize, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetFollowing 获取关注列表API
+// 请求：GET /api/user/:userid/following?cursor=&page_size=20
+// 返回：{ "users": [...], "next_cursor": "..." }
+func GetFollowing(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	resp, err := followService.GetFollowing(userID, c.Query("cursor"), pageSize, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
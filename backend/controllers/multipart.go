@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"backend/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitiateMultipartUpload 发起分片上传（大文件、可断点续传）
+// 请求：POST /api/video/multipart
+// Header: Authorization: Bearer <token>
+// Body: 与 /api/video/upload-url 相同 { "filename": "a.mp4", "filesize": 1073741824, "title": "...", "description": "...", "tags": [...] }
+// 返回：{ "video_id": 1, "upload_id": "...", "part_size": 16777216, "part_count": 64, "uploaded_parts": [], "parts": [{ "part_number": 1, "upload_url": "..." }], "expires_at": "..." }
+func InitiateMultipartUpload(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "未授权",
+		})
+		return
+	}
+
+	var req services.UploadURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的请求参数: " + err.Error(),
+		})
+		return
+	}
+
+	resp, err := videoService.InitiateMultipartUpload(username.(string), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetMultipartUploadStatus 查询分片上传进度（断点续传时调用，未上传的分片会重新签发上传URL）
+// 请求：GET /api/video/multipart/:videoid
+// Header: Authorization: Bearer <token>
+// 返回：同发起分片上传，uploaded_parts 为已上传完成的分片号，parts 只包含未上传的分片
+func GetMultipartUploadStatus(c *gin.Context) {
+	username, videoID, ok := multipartParams(c)
+	if !ok {
+		return
+	}
+
+	resp, err := videoService.GetMultipartUploadStatus(username, videoID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CompleteMultipartUpload 合并分片，完成上传（之后与 /api/video/upload-complete 相同，进入转码流程）
+// 请求：POST /api/video/multipart/:videoid/complete
+// Header: Authorization: Bearer <token>
+// 返回：{ "success": true, "video_url": "..." }
+func CompleteMultipartUpload(c *gin.Context) {
+	username, videoID, ok := multipartParams(c)
+	if !ok {
+		return
+	}
+
+	resp, err := videoService.CompleteMultipartUpload(username, videoID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// AbortMultipartUpload 取消分片上传（删除已上传的分片和视频记录）
+// 请求：DELETE /api/video/multipart/:videoid
+// Header: Authorization: Bearer <token>
+// 返回：{ "message": "已取消上传" }
+func AbortMultipartUpload(c *gin.Context) {
+	username, videoID, ok := multipartParams(c)
+	if !ok {
+		return
+	}
+
+	if err := videoService.AbortMultipartUpload(username, videoID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已取消上传",
+	})
+}
+
+// multipartParams 获取当前用户名和路径中的视频ID，失败时已写入错误响应
+func multipartParams(c *gin.Context) (string, uint, bool) {
+	username, exists := c.Get("username")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "未授权",
+		})
+		return "", 0, false
+	}
+
+	videoID, err := strconv.ParseUint(c.Param("videoid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的视频ID",
+		})
+		return "", 0, false
+	}
+	return username.(string), uint(videoID), true
+}
@@ -10,17 +10,17 @@ import (
 var randomFeedService = services.RandomFeedService{}
 
 type RandomFeedNextRequest struct {
-	Init bool `json:"init"`
-	Page int  `json:"page"`
+	Init   bool   `json:"init"`
+	Cursor string `json:"cursor"`
 }
 
 // RandomFeedNext 获取随机 Feed 下一批（MVP：每次返回 3 条）
 // 认证：必须登录（AuthMiddleware）
 // 请求体：
-//   { "init": true }                       // 初始化：随机起点
-//   { "init": false, "page": 2 }         // 后续：从 page 开始扫描
+//   { "init": true }                          // 初始化：随机起点
+//   { "init": false, "cursor": "..." }        // 后续：从上一次返回的 next_cursor 开始扫描
 // 响应：
-//   { "videos": [...], "next_page": 3, "has_more": true }
+//   { "videos": [...], "next_cursor": "...", "has_more": true }
 func RandomFeedNext(c *gin.Context) {
 	username, exists := c.Get("username")
 	if !exists {
@@ -31,12 +31,12 @@ func RandomFeedNext(c *gin.Context) {
 
 	var req RandomFeedNextRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		// 简化：body 解析失败则按 init=false&page=1 处理
+		// 简化：body 解析失败则从最新的视频开始扫描
 		req.Init = false
-		req.Page = 1
+		req.Cursor = ""
 	}
 
-	resp, err := randomFeedService.NextRandomFeed(usernameStr, req.Page, req.Init, 3)
+	resp, err := randomFeedService.NextRandomFeed(usernameStr, req.Cursor, req.Init, 3)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
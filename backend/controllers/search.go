@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"backend/services"
+	"backend/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 创建搜索服务实例（默认使用 MySQL FULLTEXT，接入外部搜索引擎时在这里替换 Searcher）
+var searchService = services.SearchService{Searcher: utils.MySQLSearcher{}}
+
+// SearchVideos 搜索视频（标题、描述、上传者用户名）
+// 请求：GET /api/search?q=关键词&uploader=&from=2024-01-01&to=2024-12-31&min_likes=10&cursor=&page_size=12
+// Header: Authorization: Bearer <token> (可选，如果提供则返回 is_liked 字段)
+// 返回：{ "videos": [{ ...视频列表项, "score": 1.23, "highlight": { "title": "...", "description": "...", "username": "..." } }], "next_cursor": "..." }
+// 结果按相关度排序，highlight 中命中的关键词用 <em></em> 包裹；next_cursor 为空表示没有更多
+func SearchVideos(c *gin.Context) {
+	// 1. 获取查询参数
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "12"))
+	req := services.SearchRequest{
+		Keyword:  c.Query("q"),
+		Uploader: c.Query("uploader"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+		Cursor:   c.Query("cursor"),
+		PageSize: pageSize,
+	}
+	if s := c.Query("min_likes"); s != "" {
+		minLikes, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的 min_likes",
+			})
+			return
+		}
+		req.MinLikes = uint(minLikes)
+	}
+
+	// 2. 尝试获取当前用户（可选）
+	usernameStr := ""
+	if username, exists := c.Get("username"); exists {
+		usernameStr = username.(string)
+	}
+
+	// 3. 调用服务层搜索
+	resp, err := searchService.Search(usernameStr, req)
+	if errors.Is(err, services.ErrSearchFailed) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
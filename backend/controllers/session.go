@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"backend/services"
+	"backend/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// 创建会话服务实例
+var sessionService = services.SessionService{}
+
+// ListSessions 获取当前用户的登录会话列表API（需要JWT认证）
+// 请求：GET /api/sessions
+// 返回：会话列表（设备、IP、登录时间、最近活跃时间，current 标记当前设备）
+func ListSessions(c *gin.Context) {
+	username := c.GetString("username")
+
+	sessions, err := sessionService.ListSessions(username, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+	})
+}
+
+// RevokeSession 撤销某个登录会话API（需要JWT认证）
+// 请求：DELETE /api/sessions/:sessionid
+// 返回：撤销成功的消息（撤销当前会话等同于登出）
+func RevokeSession(c *gin.Context) {
+	username := c.GetString("username")
+
+	err := sessionService.RevokeSession(username, c.Param("sessionid"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrSessionNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "会话已撤销",
+	})
+}
+
+// RevokeAllSessions 撤销全部登录会话API（需要JWT认证）
+// 请求：DELETE /api/sessions?keep_current=true
+// keep_current=true 时保留当前会话（退出其他所有设备），否则包括当前设备在内全部退出
+// 返回：撤销的会话数
+func RevokeAllSessions(c *gin.Context) {
+	username := c.GetString("username")
+
+	keepSessionID := ""
+	if c.Query("keep_current") == "true" {
+		keepSessionID = c.GetString("session_id")
+	}
+
+	count, err := sessionService.RevokeAllSessions(username, keepSessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "会话已撤销",
+		"revoked": count,
+	})
+}
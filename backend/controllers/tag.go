@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"backend/services"
+	"backend/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 创建话题服务实例
+var tagService = services.TagService{}
+
+// GetTagVideos 话题页：获取话题下的视频列表
+// 请求：GET /api/tag/:name/videos?sort=newest|hot&cursor=&page_size=12
+// Header: Authorization: Bearer <token> (可选，如果提供则返回 is_liked 字段)
+// 返回：{ "tag": { "id": 1, "name": "美食", "video_count": 10 }, "videos": [...], "next_cursor": "..." }
+// sort：newest 按发布时间倒序（默认），hot 按点赞数倒序；next_cursor 为空表示没有更多
+func GetTagVideos(c *gin.Context) {
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "12"))
+
+	// 尝试获取当前用户（可选）
+	usernameStr := ""
+	if username, exists := c.Get("username"); exists {
+		usernameStr = username.(string)
+	}
+
+	resp, err := tagService.GetTagVideos(c.Param("name"), c.Query("sort"), c.Query("cursor"), pageSize, usernameStr)
+	if errors.Is(err, services.ErrTagNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrInvalidCursor) || errors.Is(err, services.ErrInvalidTagSort) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetTrendingTags 获取热门话题
+// 请求：GET /api/tags/trending?window=24h|7d|all&limit=20
+// window：24h / 7d 按时间衰减的热度排序（话题下视频的点赞、评论、播放），all 按已发布的视频数排序；默认 24h
+// 返回：{ "tags": [{ "id": 1, "name": "美食", "video_count": 10 }] }
+func GetTrendingTags(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	window := c.DefaultQuery("window", utils.TrendingWindow24h)
+
+	resp, err := tagService.GetTrendingTags(window, limit)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if !utils.IsValidTrendingWindow(window) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
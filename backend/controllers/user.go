@@ -3,9 +3,9 @@ package controllers
 import (
 	"backend/services"
 	"backend/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"time"
 )
 
 // 创建用户服务实例
@@ -45,8 +45,8 @@ func Register(c *gin.Context) {
 
 // Login 登录API
 // 请求：POST /api/login
-// Body: {"username": "test", "password": "123456"}
-// 返回：登录成功的消息、用户信息和JWT令牌
+// Body: {"username": "test", "password": "123456", "device": "我的笔记本"}  device 可选
+// 返回：登录成功的消息、用户信息、访问令牌和刷新令牌
 func Login(c *gin.Context) {
 	var req services.LoginRequest
 
@@ -58,8 +58,8 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 调用服务层登录
-	user, err := userService.Login(req)
+	// 调用服务层登录（每次登录创建一个新会话）
+	user, tokens, err := userService.Login(req, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		// 401 Unauthorized 表示认证失败
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -70,13 +70,46 @@ func Login(c *gin.Context) {
 
 	// 返回成功响应
 	c.JSON(http.StatusOK, gin.H{
-		"message": "登录成功",
-		"user":    user,
-		"token":   user.Token,
+		"message":       "登录成功",
+		"user":          user,
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"session_id":    tokens.SessionID,
 	})
+}
 
-	// 将 token 保存到 Redis
-	_ = utils.SaveToken(user.Username, user.Token)
+// RefreshToken 刷新令牌API
+// 请求：POST /api/token/refresh
+// Body: {"refresh_token": "<登录或上次刷新返回的刷新令牌>"}
+// 返回：新的访问令牌和刷新令牌（旧刷新令牌作废）
+func RefreshToken(c *gin.Context) {
+	var req services.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的输入: " + err.Error(),
+		})
+		return
+	}
+
+	tokens, err := sessionService.Refresh(req)
+	if err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, utils.ErrRefreshRace) {
+			// 409：刷新令牌刚被其他请求轮换，客户端改用最新保存的令牌即可，无需重新登录
+			status = http.StatusConflict
+		} else if !errors.Is(err, utils.ErrSessionNotFound) &&
+			!errors.Is(err, utils.ErrInvalidRefreshToken) &&
+			!errors.Is(err, utils.ErrRefreshTokenReused) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
 }
 
 // GetUserInfo 获取用户信息API（需要JWT认证）
@@ -113,31 +146,27 @@ func GetUserInfo(c *gin.Context) {
 // 请求：POST /api/logout
 // Header: Authorization: Bearer <token>
 // 返回：登出成功的消息
+// 只撤销当前会话，其他设备不受影响
 func Logout(c *gin.Context) {
-	// 从上下文中获取 token
-	token, exists := c.Get("token")
-	if !exists {
+	// 从上下文中获取用户名和会话ID
+	username := c.GetString("username")
+	sessionID := c.GetString("session_id")
+	if username == "" || sessionID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "未授权",
 		})
 		return
 	}
 
-	// 从上下文中获取用户名
-	username, _ := c.Get("username")
-
-	// 将 token 加入黑名单（设置过期时间为 24 小时）
-	err := utils.AddToBlacklist(token.(string), 24*time.Hour)
-	if err != nil {
+	// 撤销当前会话，该会话的访问令牌和刷新令牌立即失效
+	err := sessionService.RevokeSession(username, sessionID)
+	if err != nil && !errors.Is(err, utils.ErrSessionNotFound) {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "登出失败",
 		})
 		return
 	}
 
-	// 删除 Redis 中保存的用户 token
-	_ = utils.DeleteUserToken(username.(string))
-
 	c.JSON(http.StatusOK, gin.H{
 		"message": "登出成功",
 	})
@@ -2,6 +2,8 @@ package controllers
 
 import (
 	"backend/services"
+	"backend/utils"
+	"errors"
 	"net/http"
 	"strconv"
 	"github.com/gin-gonic/gin"
@@ -11,13 +13,13 @@ import (
 var videoService = services.VideoService{}
 
 // GetVideoList 获取视频列表
-// 请求：GET /api/videos?page=1&page_size=10
+// 请求：GET /api/videos?cursor=&page_size=12&with_total=false
 // Header: Authorization: Bearer <token> (可选，如果提供则返回 is_liked 字段)
-// 返回：{ "videos": [...], "total": 100, "page": 1, "page_size": 10 }
+// 返回：{ "videos": [...], "next_cursor": "...", "total": 100 }，next_cursor 为空表示没有更多，total 仅在 with_total=true 时返回
 func GetVideoList(c *gin.Context) {
 	// 获取分页参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "12"))
+	withTotal, _ := strconv.ParseBool(c.DefaultQuery("with_total", "false"))
 
 	// 尝试获取当前用户（可选，未登录时为空字符串）
 	username, _ := c.Get("username")
@@ -27,7 +29,13 @@ func GetVideoList(c *gin.Context) {
 	}
 
 	// 调用服务层获取视频列表
-	resp, err := videoService.GetVideoList(page, pageSize, usernameStr)
+	resp, err := videoService.GetVideoList(c.Query("cursor"), pageSize, withTotal, usernameStr)
+	if errors.Is(err, utils.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -111,9 +119,9 @@ func ConfirmUpload(c *gin.Context) {
 }
 
 // GetUserVideoList 获取某个用户的视频列表
-// 请求：GET /api/user/:userid/videos?page=1&page_size=10
+// 请求：GET /api/user/:userid/videos?cursor=&page_size=12&with_total=false
 // Header: Authorization: Bearer <token>
-// 返回：{ "videos": [...], "total": 100, "page": 1, "page_size": 10 }
+// 返回：{ "videos": [...], "next_cursor": "...", "total": 100 }，total 仅在 with_total=true 时返回
 func GetUserVideoList(c *gin.Context) {
 	// 获取用户ID参数
 	userIDStr := c.Param("userid")
@@ -126,11 +134,24 @@ func GetUserVideoList(c *gin.Context) {
 	}
 
 	// 获取分页参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "12"))
+	withTotal, _ := strconv.ParseBool(c.DefaultQuery("with_total", "false"))
+
+	// 获取当前用户（作者本人查看时会返回未发布的视频）
+	username, _ := c.Get("username")
+	usernameStr := ""
+	if username != nil {
+		usernameStr = username.(string)
+	}
 
 	// 调用服务层获取用户视频列表
-	resp, err := videoService.GetUserVideoList(page, pageSize, uint(userID))
+	resp, err := videoService.GetUserVideoList(c.Query("cursor"), pageSize, withTotal, uint(userID), usernameStr)
+	if errors.Is(err, utils.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -182,23 +203,27 @@ func DeleteUserVideos(c *gin.Context){
 	})
 }
 
-// GetHotVideos 获取热门视频列表（按点赞数排序）
-// 请求：POST /api/videos/hot
+// GetHotVideos 获取热门视频列表
+// 请求：GET /api/videos/hot?window=24h&limit=20（兼容旧版 POST，Body: { "limit": 20 }）
 // Header: Authorization: Bearer <token> (可选)
-// Body: { "limit": 20 }
+// window：24h / 7d 按时间衰减的热度排序（点赞、评论、播放加权），all 按点赞总数排序；默认 24h
 // 返回：{ "videos": [...] }
 func GetHotVideos(c *gin.Context) {
-	// 绑定请求参数
+	// 绑定请求参数（query 优先，POST 时也可以放在 Body 中）
 	var req struct {
 		Limit int `json:"limit"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		req.Limit = 20 // 默认20个
+	if c.Request.Method == http.MethodPost {
+		_ = c.ShouldBindJSON(&req)
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil {
+		req.Limit = limit
 	}
+	window := c.DefaultQuery("window", utils.TrendingWindow24h)
 
 	// 限制最大数量
 	if req.Limit <= 0 || req.Limit > 100 {
-		req.Limit = 20
+		req.Limit = 20 // 默认20个
 	}
 
 	// 尝试获取当前用户（可选）
@@ -209,9 +234,13 @@ func GetHotVideos(c *gin.Context) {
 	}
 
 	// 调用服务层获取热门视频
-	resp, err := videoService.GetHotVideos(req.Limit, usernameStr)
+	resp, err := videoService.GetHotVideos(window, req.Limit, usernameStr)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		status := http.StatusInternalServerError
+		if !utils.IsValidTrendingWindow(window) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
 			"error": err.Error(),
 		})
 		return
@@ -219,3 +248,129 @@ func GetHotVideos(c *gin.Context) {
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// GetFollowingFeed 获取关注动态（关注的创作者发布的视频）
+// 请求：GET /api/feed/following?cursor=&page_size=12
+// Header: Authorization: Bearer <token>
+// 返回：{ "videos": [...], "next_cursor": "..." }，next_cursor 为空表示没有更多
+func GetFollowingFeed(c *gin.Context) {
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "12"))
+
+	resp, err := videoService.GetFollowingFeed(c.GetString("username"), c.Query("cursor"), pageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetVideoDetail 获取视频详情（分享链接、不公开的视频通过这里访问）
+// 请求：GET /api/video/:videoid
+// Header: Authorization: Bearer <token> (可选，作者本人可以看到私密视频，登录后返回 is_liked 字段)
+// 返回：与视频列表中的单个视频相同，视频地址是有效期2小时的预签名URL
+func GetVideoDetail(c *gin.Context) {
+	videoID, err := strconv.ParseUint(c.Param("videoid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的视频ID",
+		})
+		return
+	}
+
+	usernameStr := ""
+	if username, exists := c.Get("username"); exists {
+		usernameStr = username.(string)
+	}
+
+	video, err := videoService.GetVideoDetail(uint(videoID), usernameStr)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, video)
+}
+
+// SetVideoVisibility 修改视频可见性
+// 请求：PUT /api/video/:videoid/visibility
+// Header: Authorization: Bearer <token>
+// Body: { "visibility": "public|unlisted|private" }
+// 返回：{ "message": "修改成功", "visibility": "unlisted" }
+func SetVideoVisibility(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "未授权",
+		})
+		return
+	}
+
+	videoID, err := strconv.ParseUint(c.Param("videoid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的视频ID",
+		})
+		return
+	}
+
+	var req services.VisibilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的请求参数: " + err.Error(),
+		})
+		return
+	}
+
+	if err := videoService.SetVideoVisibility(username.(string), uint(videoID), req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "修改成功",
+		"visibility": req.Visibility,
+	})
+}
+
+// GetHLSPlaylist 获取 HLS 播放列表（播放器直接请求，地址由视频信息中的 hls_url 给出）
+// 请求：GET /api/video/:videoid/hls/*file?token=...
+// 返回：改写后的播放列表，子播放列表指向本接口，切片是预签名URL
+func GetHLSPlaylist(c *gin.Context) {
+	videoID, err := strconv.ParseUint(c.Param("videoid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的视频ID",
+		})
+		return
+	}
+
+	playlist, err := videoService.GetHLSPlaylist(uint(videoID), c.Param("file"), c.Query("token"))
+	switch {
+	case errors.Is(err, services.ErrPlaybackForbidden):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrPlaylistNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 播放列表中的预签名URL有有效期，只允许客户端短时间缓存
+	c.Header("Cache-Control", "private, max-age=60")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", playlist)
+}
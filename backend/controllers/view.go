@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"backend/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 创建播放量统计服务实例
+var viewService = services.ViewService{}
+
+// RecordWatch 上报观看事件（播放器在开始播放、播放过程中定时、播放到结尾时调用）
+// 请求：POST /api/video/:videoid/watch
+// Header: Authorization: Bearer <token> (可选，未登录时按 session_id 去重)
+// Body: { "event": "start|progress|complete", "session_id": "...", "position": 12.5 }
+// 返回：{ "message": "已记录", "counted": true }，counted 表示是否计为一次新的播放
+func RecordWatch(c *gin.Context) {
+	// 1. 从路径参数获取视频ID
+	videoID, err := strconv.ParseUint(c.Param("videoid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的视频ID",
+		})
+		return
+	}
+
+	// 2. 绑定请求参数
+	var req services.WatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的请求参数: " + err.Error(),
+		})
+		return
+	}
+
+	// 3. 尝试获取当前用户（可选）
+	usernameStr := ""
+	if username, exists := c.Get("username"); exists {
+		usernameStr = username.(string)
+	}
+
+	// 4. 调用服务层记录事件
+	resp, err := viewService.RecordWatch(usernameStr, uint(videoID), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -1,20 +1,37 @@
 package main
 
 import (
+	"backend/admin"
 	"backend/models"
 	"backend/routes"
+	"backend/services"
 	"backend/utils"
+	"common/config"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"log"
+	"os"
 )
 
 func main() {
+	// 加载配置（配置文件 + 环境变量），缺少必填项时直接退出
+	if _, err := config.Load((*config.Config).ValidateBackend); err != nil {
+		log.Fatal("加载配置失败:\n", err)
+	}
+
 	// 初始化 MySQL 连接
 	if err := utils.InitMySQL(); err != nil {
 		log.Fatal("MySQL 连接失败:", err)
 	}
 
+	// videos.comment_count 是后加的冗余计数列，首次添加时需要按 comments 表回填
+	backfillCommentCount := !utils.HasColumn(&models.Video{}, "comment_count")
+
+	// likes、comment_likes 后加了 (user_id, 目标ID) 唯一索引，首次建索引前需要清理重复记录
+	if err := utils.DedupeLikeTables(); err != nil {
+		log.Fatal(err)
+	}
+
 	// 自动迁移数据库表结构
 	// 会根据模型自动创建或更新表
 	err := utils.AutoMigrate(
@@ -22,17 +39,37 @@ func main() {
 		&models.Video{},
 		&models.Comment{},
 		&models.Like{},
+		&models.Follow{},
+		&models.CommentLike{},
+		&models.OutboxMessage{},
+		&models.ViewFlush{},
+		&models.Tag{},
+		&models.VideoTag{},
+		&models.MultipartUpload{},
+		&models.VideoPurge{},
 	)
 	if err != nil {
 		log.Fatal("模型迁移失败:", err)
 	}
 	log.Println("模型迁移完成")
 
+	if backfillCommentCount {
+		if err := utils.BackfillVideoCommentCounts(); err != nil {
+			log.Fatal("回填视频评论数失败:", err)
+		}
+		log.Println("视频评论数回填完成")
+	}
+
 	// 初始化 Redis 连接
 	if err := utils.InitRedis(); err != nil {
 		log.Fatal("Redis 连接失败:", err)
 	}
 
+	// Redis 中没有评论计数时从 MySQL 加载
+	if err := utils.InitVideoCommentRank(); err != nil {
+		log.Println("初始化评论计数失败:", err)
+	}
+
 	// 初始化 MinIO 连接
 	if err := utils.InitMinIO(); err != nil {
 		log.Fatal("MinIO 连接失败：", err)
@@ -45,6 +82,52 @@ func main() {
 	// 程序退出时关闭 RabbitMQ 连接
 	defer utils.CloseRabbitMQ()
 
+	// 带参数启动时执行运维命令（如 go run main.go dlq list video_processing），执行完退出
+	if len(os.Args) > 1 {
+		if err := admin.Run(os.Args[1:]); err != nil {
+			log.Println(err)
+			utils.CloseRabbitMQ()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 启动发件箱中继，投递写入 outbox_messages 表的任务
+	go utils.RunOutboxRelay()
+
+	// 启动播放量落库任务，定时把 Redis 中聚合的播放增量写入发件箱
+	go utils.RunViewFlusher()
+
+	// 启动分片上传清理任务，中止超时未完成的分片上传
+	go utils.RunMultipartSweeper()
+
+	// 启动被放弃的上传清理任务：超时未确认的上传，文件已上传则自动确认，否则删除
+	go utils.RunUploadSweeper()
+
+	// 订阅 MinIO 上传完成事件，文件上传后自动确认（不依赖客户端调用确认接口）
+	if config.Conf.Upload.BucketNotifications {
+		uploadEvents := services.UploadEventService{}
+		go uploadEvents.Run()
+	}
+
+	// Redis 中没有点赞数据时（如 Redis 被清空）从 MySQL 重建，之后定时对账
+	likeReconciler := services.LikeReconcileService{}
+	if _, err := likeReconciler.RebuildRedisIfMissing(); err != nil {
+		log.Println("重建 Redis 点赞数据失败:", err)
+	}
+	if _, err := likeReconciler.RebuildCommentLikesIfMissing(); err != nil {
+		log.Println("重建 Redis 评论点赞数据失败:", err)
+	}
+	if interval := config.Conf.Reconcile.Interval; interval > 0 {
+		go likeReconciler.RunPeriodic(interval)
+	}
+
+	// 热度分桶不存在时从 MySQL 重建最近 7 天的点赞、评论
+	trending := services.TrendingService{}
+	if err := trending.RebuildIfMissing(); err != nil {
+		log.Println("重建热度分桶失败:", err)
+	}
+
 	// 创建Gin路由引擎
 	router := gin.Default()
 
@@ -61,6 +144,6 @@ func main() {
 	// 设置路由
 	routes.SetupRoutes(router)
 
-	router.Run(":5000")
+	router.Run(config.Conf.Server.Addr)
 
 }
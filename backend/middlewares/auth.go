@@ -35,27 +35,28 @@ func AuthMiddleware() gin.HandlerFunc {
 		// 提取令牌
 		token := parts[1]
 
-		// 检查 token 是否在黑名单中
-		if utils.IsBlacklisted(token) {
+		// 验证JWT令牌
+		claims, err := utils.ValidateJWT(token)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "令牌已失效，请重新登录",
+				"error": "无效的认证令牌",
 			})
 			c.Abort()
 			return
 		}
 
-		// 验证JWT令牌
-		claims, err := utils.ValidateJWT(token)
-		if err != nil {
+		// 检查令牌所属会话是否仍然有效（登出、在其他设备上被撤销后立即失效）
+		if !utils.IsSessionActive(claims.Username, claims.SessionID) {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "无效的认证令牌",
+				"error": "令牌已失效，请重新登录",
 			})
 			c.Abort()
 			return
 		}
 
-		// 将用户名和 token 存入上下文，供后续处理函数使用
+		// 将用户名、会话ID和 token 存入上下文，供后续处理函数使用
 		c.Set("username", claims.Username)
+		c.Set("session_id", claims.SessionID)
 		c.Set("token", token)
 
 		// 继续处理请求
@@ -87,13 +88,6 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 		// 提取令牌
 		token := parts[1]
 
-		// 检查 token 是否在黑名单中
-		if utils.IsBlacklisted(token) {
-			// token已失效，继续处理请求（作为未登录用户）
-			c.Next()
-			return
-		}
-
 		// 验证JWT令牌
 		claims, err := utils.ValidateJWT(token)
 		if err != nil {
@@ -102,8 +96,15 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 会话已撤销，继续处理请求（作为未登录用户）
+		if !utils.IsSessionActive(claims.Username, claims.SessionID) {
+			c.Next()
+			return
+		}
+
 		// token有效，将用户名存入上下文
 		c.Set("username", claims.Username)
+		c.Set("session_id", claims.SessionID)
 		c.Set("token", token)
 
 		// 继续处理请求
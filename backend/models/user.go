@@ -1,24 +1,28 @@
 package models
 
 import (
-	"backend/config"
+	"common/config"
 	"fmt"
 	"gorm.io/gorm"
+	"time"
 )
 
 // User 用户模型
 type User struct {
 	gorm.Model                                                                                                           // 包含ID、CreatedAt、UpdatedAt、DeletedAt字段
-	Username  string `gorm:"unique;not null" json:"username"`                                                            // 用户名，唯一且不能为空
+	Username  string `gorm:"unique;not null;index:idx_users_username_ft,class:FULLTEXT,option:WITH PARSER ngram" json:"username"` // 用户名，唯一且不能为空（FULLTEXT 索引用于搜索）
 	Password  string `gorm:"not null" json:"-"`                                                                          // 密码，不能为空，json序列化时忽略
 	AvatarURL string `gorm:"default:'http://101.132.25.34:9000/cwatch/c.png'" json:"avatar_url"` // 头像URL
 	Email     string `json:"email"`
 	Phone     string `json:"phone"`
+
+	FollowerCount  uint `gorm:"default:0" json:"follower_count"`  // 粉丝数（与 follows 表在同一事务中维护）
+	FollowingCount uint `gorm:"default:0" json:"following_count"` // 关注数
 }
 
 // GetDefaultAvatarURL 获取默认头像URL
 func GetDefaultAvatarURL() string {
-	return fmt.Sprintf("http://%s:%s/cwatch/c.png", config.MinIOHost, config.MinIOPort)
+	return fmt.Sprintf("%s/cwatch/c.png", config.Conf.MinIO.BaseURL())
 }
 
 // 视频状态常量
@@ -26,41 +30,192 @@ const (
 	VideoStatusUploading  = 0 // 上传中
 	VideoStatusUploaded   = 1 // 上传完成
 	VideoStatusProcessing = 2 // 转码中
-	VideoStatusPublished  = 3 // 已发布
-	VideoStatusFailed     = 4 // 审核失败
+	VideoStatusPublished  = 3 // 已发布（转码完成，对所有人可见）
+	VideoStatusFailed     = 4 // 处理失败（重试耗尽，原因见 FailReason）
 )
 
+// 视频可见性
+// 所有视频文件都存放在私有存储桶中，客户端拿到的是按请求签发的短期URL（见 utils.PresignObjectURL），因此修改可见性立即生效
+const (
+	VisibilityPublic   = "public"   // 公开：出现在首页、推荐、热门、搜索、话题和关注动态中
+	VisibilityUnlisted = "unlisted" // 不公开：不出现在其他用户的任何列表中（视频列表和作者主页只有本人能看到），知道视频ID（链接）的人都可以观看
+	VisibilityPrivate  = "private"  // 私密：只有作者本人可以观看
+)
+
+// ValidVisibility 是否为有效的可见性
+func ValidVisibility(v string) bool {
+	return v == VisibilityPublic || v == VisibilityUnlisted || v == VisibilityPrivate
+}
+
 // Video 视频模型
 type Video struct {
 	gorm.Model
-	Title       string `gorm:"not null" json:"title"`              // 视频标题
-	Description string `json:"description"`                        // 视频描述
-	URL         string `json:"url"`                                // 视频文件URL（原视频）
-	URL720p     string `json:"url_720p"`                           // 720p视频URL
-	URL1080p    string `json:"url_1080p"`                          // 1080p视频URL
-	CoverURL    string `json:"cover_url"`                          // 视频封面图URL
-	UserID      uint   `json:"user_id"`                            // 视频所属用户ID
-	User        User   `gorm:"foreignKey:UserID" json:"-"`         // 与User模型建立关联
-	Status      int    `gorm:"default:0" json:"status"`            // 视频状态
-	FileName    string `json:"file_name"`                          // 存储的文件名（UUID生成）
-	LikeCount 	uint   `json:"like_count" gorm:"index"`			   // 视频的点赞量，添加普通索引
-}		
+	Title       string `gorm:"not null;index:idx_videos_search_ft,class:FULLTEXT,option:WITH PARSER ngram,priority:1;index:idx_videos_title_ft,class:FULLTEXT,option:WITH PARSER ngram" json:"title"` // 视频标题
+	Description string `gorm:"index:idx_videos_search_ft,class:FULLTEXT,option:WITH PARSER ngram,priority:2" json:"description"`                                                               // 视频描述（与标题组成搜索用的 FULLTEXT 索引）
+	URL         string `json:"url"`                           // 视频文件URL（原视频）
+	URL720p     string `json:"url_720p"`                      // 720p视频URL
+	URL1080p    string `json:"url_1080p"`                     // 1080p视频URL（旧版转码产物，新视频使用 HLSURL）
+	HLSURL      string `gorm:"column:hls_url" json:"hls_url"` // HLS 自适应码率主播放列表URL（master.m3u8）
+	CoverURL    string `json:"cover_url"`                     // 视频封面图URL
+	UserID      uint   `json:"user_id"`                       // 视频所属用户ID
+	User        User   `gorm:"foreignKey:UserID" json:"-"`    // 与User模型建立关联
+	Status      int    `gorm:"default:0;index" json:"status"` // 视频状态
+	Visibility  string `gorm:"size:16;default:public;index" json:"visibility"` // 可见性（见 VisibilityPublic 等常量）
+	FailReason  string `gorm:"size:512" json:"fail_reason"`   // 处理失败原因（仅 VideoStatusFailed 时有值）
+	FileName    string `gorm:"size:64;index" json:"file_name"` // 存储的文件名（UUID生成，上传完成事件按文件名查找视频）
+	FileSize    int64  `json:"file_size"`                     // 上传时声明的文件大小（字节），确认上传时与实际文件大小比对
+	LikeCount   uint   `json:"like_count" gorm:"index"`       // 视频的点赞量，添加普通索引
+	CommentCount uint  `json:"comment_count" gorm:"default:0"` // 评论数（含回复，与评论在同一事务中维护）
+	ViewCount     uint64  `json:"view_count" gorm:"default:0"`     // 播放量（Redis 聚合后经 MQ 异步落库）
+	CompletionSum float64 `json:"-" gorm:"default:0"`              // 每次播放的最大完播比例之和，平均完播率 = CompletionSum / ViewCount
+
+	// 源视频元数据（worker 使用 ffprobe 探测后写入）
+	Width      int     `json:"width"`       // 显示宽度（已按旋转角度交换宽高）
+	Height     int     `json:"height"`      // 显示高度
+	Duration   float64 `json:"duration"`    // 时长（秒）
+	VideoCodec string  `json:"video_codec"` // 源视频编码，如 h264、hevc
+	FrameRate  float64 `json:"frame_rate"`  // 帧率
+	Rotation   int     `json:"rotation"`    // 旋转角度（0/90/180/270）
+	HasAudio   bool    `json:"has_audio"`   // 是否包含音频
+	Renditions string  `json:"renditions"`  // 实际生成的清晰度，逗号分隔，如 "360p,720p"
+
+	Tags []Tag `gorm:"many2many:video_tags" json:"tags,omitempty"` // 话题（上传时显式指定 + 从描述中解析的 #话题），关联表见 VideoTag
+}
+
+// Tag 话题
+type Tag struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Name      string    `gorm:"size:64;not null;uniqueIndex" json:"name"` // 话题名（小写，不含 #）
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// VideoTag 视频与话题的关联（多对多关联表 video_tags）
+type VideoTag struct {
+	VideoID   uint      `gorm:"primaryKey"`
+	TagID     uint      `gorm:"primaryKey;index"` // 按话题查视频
+	CreatedAt time.Time
+}
 
 // Comment 评论模型
+// 一级评论 ParentID = RootID = 0；回复的 RootID 为所属一级评论ID，ParentID 为直接回复的评论ID
 type Comment struct {
 	gorm.Model
-	Content string `gorm:"not null"` // 评论内容
-	UserID  uint   // 评论用户ID
-	User    User   `gorm:"foreignKey:UserID"` // 与User模型建立关联
-	VideoID uint   // 评论的视频ID
-	Video   Video  `gorm:"foreignKey:VideoID"` // 与Video模型建立关联
+	Content       string `gorm:"not null"` // 评论内容
+	UserID        uint   // 评论用户ID
+	User          User   `gorm:"foreignKey:UserID"` // 与User模型建立关联
+	VideoID       uint   `gorm:"index:idx_comments_video_root,priority:1"` // 评论的视频ID
+	Video         Video  `gorm:"foreignKey:VideoID"`                       // 与Video模型建立关联
+	ParentID      uint   `gorm:"default:0"`                                // 直接回复的评论ID（一级评论为0）
+	RootID        uint   `gorm:"default:0;index:idx_comments_video_root,priority:2;index"` // 所属一级评论ID（一级评论为0）
+	ReplyToUserID uint   `gorm:"default:0"`                                // 被回复的用户ID（一级评论为0）
+	ReplyCount    uint   `gorm:"default:0"`                                // 回复数（仅一级评论，与回复在同一事务中维护）
+	LikeCount     uint   `gorm:"default:0;index"`                          // 点赞数（worker 异步落库）
+}
+
+// CommentLike 评论点赞模型
+// (user_id, comment_id) 唯一：取消点赞为软删除，再次点赞时恢复原记录（与 Like 相同）
+type CommentLike struct {
+	gorm.Model
+	UserID    uint    `gorm:"uniqueIndex:idx_comment_likes_user_comment,priority:1"`       // 点赞用户ID
+	User      User    `gorm:"foreignKey:UserID"`                                           // 与User模型建立关联
+	CommentID uint    `gorm:"uniqueIndex:idx_comment_likes_user_comment,priority:2;index"` // 被点赞的评论ID
+	Comment   Comment `gorm:"foreignKey:CommentID"`
+	LastTS    int64   `gorm:"not null;default:0"` // worker 最后落库的点赞/取消事件时间（毫秒），更早的消息会被丢弃（与 Like 相同）
 }
 
 // Like 点赞模型
+// (user_id, video_id) 唯一：取消点赞为软删除，再次点赞时恢复原记录（INSERT ... ON DUPLICATE KEY UPDATE），不会产生多条记录
 type Like struct {
 	gorm.Model
-	UserID  uint  // 点赞用户ID
-	User    User  `gorm:"foreignKey:UserID"` // 与User模型建立关联
-	VideoID uint  // 被点赞的视频ID
-	Video   Video `gorm:"foreignKey:VideoID"` // 与Video模型建立关联
-}
\ No newline at end of file
+	UserID  uint  `gorm:"uniqueIndex:idx_likes_user_video,priority:1"`       // 点赞用户ID
+	User    User  `gorm:"foreignKey:UserID"`                                 // 与User模型建立关联
+	VideoID uint  `gorm:"uniqueIndex:idx_likes_user_video,priority:2;index"` // 被点赞的视频ID
+	Video   Video `gorm:"foreignKey:VideoID"`                                // 与Video模型建立关联
+	LastTS  int64 `gorm:"not null;default:0"`                                // worker 最后落库的点赞/取消事件时间（毫秒），更早的消息会被丢弃
+}
+
+// Follow 关注关系模型
+// 取消关注直接删除记录（不使用软删除），(follower_id, followee_id) 唯一
+type Follow struct {
+	ID         uint      `gorm:"primarykey"`
+	FollowerID uint      `gorm:"not null;uniqueIndex:idx_follower_followee,priority:1"` // 关注者ID
+	FolloweeID uint      `gorm:"not null;uniqueIndex:idx_follower_followee,priority:2;index"` // 被关注者ID
+	CreatedAt  time.Time // 关注时间
+}
+
+// 发件箱消息状态
+const (
+	OutboxStatusPending = 0 // 待发送
+	OutboxStatusSent    = 1 // 已发送（broker 已确认）
+)
+
+// OutboxMessage 事务发件箱消息
+// 与业务数据在同一事务中写入，由发件箱中继投递到 RabbitMQ，broker 确认后标记为已发送
+type OutboxMessage struct {
+	ID            uint       `gorm:"primarykey"`
+	Queue         string     `gorm:"size:64;not null"`                                    // 目标队列
+	Payload       string     `gorm:"type:text;not null"`                                  // 消息体（JSON）
+	Status        int        `gorm:"default:0;index:idx_outbox_status_next,priority:1"`   // 状态
+	Attempts      int        `gorm:"default:0"`                                           // 已尝试投递次数
+	NextAttemptAt time.Time  `gorm:"index:idx_outbox_status_next,priority:2"`             // 下次投递时间（失败后指数退避）
+	LastError     string     `gorm:"size:512"`                                            // 最近一次投递失败原因
+	SentAt        *time.Time `gorm:"index"`                                               // 投递成功时间
+	CreatedAt     time.Time
+}
+
+// ViewFlush 已落库的播放量批次（worker 按 FlushID 去重，重复投递的批次不会重复累加）
+type ViewFlush struct {
+	FlushID   string    `gorm:"primarykey;size:64"` // <快照ID>-<分片序号>
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// 分片上传状态
+const (
+	MultipartStatusActive    = 0 // 上传中
+	MultipartStatusCompleted = 1 // 已合并为完整文件
+	MultipartStatusAborted   = 2 // 已中止（用户取消或超时放弃）
+)
+
+// MultipartUpload 大文件分片上传会话（每个视频最多一个）
+// 客户端按分片号把文件的各个分片 PUT 到预签名URL，中断后查询已完成的分片继续上传，全部完成后由后端合并
+type MultipartUpload struct {
+	ID        uint      `gorm:"primarykey"`
+	VideoID   uint      `gorm:"not null;uniqueIndex"`                                    // 视频ID
+	UploadID  string    `gorm:"size:255;not null"`                                       // MinIO 分片上传ID
+	FileSize  int64     `gorm:"not null"`                                                // 文件总大小（字节）
+	PartSize  int64     `gorm:"not null"`                                                // 分片大小（字节），最后一个分片可以更小
+	PartCount int       `gorm:"not null"`                                                // 分片数量
+	Status    int       `gorm:"default:0;index:idx_multipart_status_expires,priority:1"` // 状态
+	ExpiresAt time.Time `gorm:"index:idx_multipart_status_expires,priority:2"`           // 超过该时间未完成视为放弃，自动中止
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// 视频清理状态
+const (
+	PurgeStatusPending   = 0 // 待清理（清理失败等待重试时原因见 LastError）
+	PurgeStatusCompleted = 1 // 已清理
+)
+
+// 视频清理原因
+const (
+	PurgeReasonUserDeleted     = "user_deleted"     // 用户删除
+	PurgeReasonUploadAborted   = "upload_aborted"   // 分片上传被取消或超时中止
+	PurgeReasonUploadAbandoned = "upload_abandoned" // 单次上传超时未确认且文件不存在
+	PurgeReasonUploadRejected  = "upload_rejected"  // 上传的文件未通过校验（大小与声明不符、不是有效的视频等）
+)
+
+// VideoPurge 视频删除后的清理记录（删除视频时写入，worker 清理完成后更新，用于审计）
+type VideoPurge struct {
+	VideoID        uint       `gorm:"primarykey;autoIncrement:false"` // 被删除的视频ID
+	UserID         uint       `gorm:"index"`                          // 执行删除的用户ID（系统清理时为 0）
+	Reason         string     `gorm:"size:32"`                        // 清理原因
+	FileName       string     `gorm:"size:255"`                       // 原视频文件名
+	Status         int        `gorm:"default:0;index"`                // 清理状态
+	Attempts       int        `gorm:"default:0"`                      // 已尝试清理次数
+	LastError      string     `gorm:"size:512"`                       // 最近一次清理失败原因
+	ObjectsRemoved int        `gorm:"default:0"`                      // 删除的 MinIO 对象数
+	RowsRemoved    int64      `gorm:"default:0"`                      // 删除的关联记录数（评论、评论点赞、点赞、话题关联、分片上传会话）
+	CreatedAt      time.Time  // 删除时间
+	CompletedAt    *time.Time // 清理完成时间
+}
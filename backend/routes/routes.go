@@ -15,7 +15,7 @@ func SetupRoutes(router *gin.Engine) {
 	{
 		api.POST("/register", controllers.Register)      // 注册
 		api.POST("/login", controllers.Login)            // 登录
-		api.GET("/video/:videoid/comments", controllers.GetComments) // 获取视频评论（公开）
+		api.POST("/token/refresh", controllers.RefreshToken) // 刷新令牌
 	}
 
 	// 可选认证路由（登录后有额外功能）
@@ -23,7 +23,26 @@ func SetupRoutes(router *gin.Engine) {
 		// 获取视频列表：未登录可访问，登录后返回 is_liked 字段
 		api.GET("/videos", middlewares.OptionalAuthMiddleware(), controllers.GetVideoList)
 		// 获取热门视频列表：未登录可访问，登录后返回 is_liked 字段
-		api.POST("/videos/hot", middlewares.OptionalAuthMiddleware(), controllers.GetHotVideos)
+		api.GET("/videos/hot", middlewares.OptionalAuthMiddleware(), controllers.GetHotVideos)
+		api.POST("/videos/hot", middlewares.OptionalAuthMiddleware(), controllers.GetHotVideos) // 兼容旧版客户端
+		// 话题页、热门话题：未登录可访问，登录后返回 is_liked 字段
+		api.GET("/tag/:name/videos", middlewares.OptionalAuthMiddleware(), controllers.GetTagVideos)
+		api.GET("/tags/trending", controllers.GetTrendingTags)
+		// 搜索视频：未登录可访问，登录后返回 is_liked 字段
+		api.GET("/search", middlewares.OptionalAuthMiddleware(), controllers.SearchVideos)
+		// 获取视频评论、评论回复：未登录可访问，登录后返回 is_liked 字段
+		api.GET("/video/:videoid/comments", middlewares.OptionalAuthMiddleware(), controllers.GetComments)
+		api.GET("/comment/:commentid/replies", middlewares.OptionalAuthMiddleware(), controllers.GetCommentReplies)
+		// 视频详情：未登录可访问不公开的视频（知道链接即可），作者本人可以访问私密视频
+		api.GET("/video/:videoid", middlewares.OptionalAuthMiddleware(), controllers.GetVideoDetail)
+		// HLS 播放列表：播放器直接请求，使用视频信息中签发的播放令牌（token 参数）鉴权
+		api.GET("/video/:videoid/hls/*file", controllers.GetHLSPlaylist)
+		// 上报观看事件：未登录按播放器会话去重，登录后按用户去重
+		api.POST("/video/:videoid/watch", middlewares.OptionalAuthMiddleware(), controllers.RecordWatch)
+		// 用户主页、关注/粉丝列表：登录后返回 is_following 字段
+		api.GET("/user/:userid/profile", middlewares.OptionalAuthMiddleware(), controllers.GetUserProfile)
+		api.GET("/user/:userid/followers", middlewares.OptionalAuthMiddleware(), controllers.GetFollowers)
+		api.GET("/user/:userid/following", middlewares.OptionalAuthMiddleware(), controllers.GetFollowing)
 	}
 
 	// 需要认证的路由
@@ -34,12 +53,22 @@ func SetupRoutes(router *gin.Engine) {
 		protected.GET("/user/info", controllers.GetUserInfo) // 获取用户信息
 		protected.POST("/logout", controllers.Logout)        // 登出
 
+		// 登录会话（多设备）
+		protected.GET("/sessions", controllers.ListSessions)                 // 会话列表
+		protected.DELETE("/sessions/:sessionid", controllers.RevokeSession) // 撤销某个会话
+		protected.DELETE("/sessions", controllers.RevokeAllSessions)        // 撤销全部会话
+
 		// 随机 Feed（需要登录，用布隆过滤器去重）
 		protected.POST("/random-feed/next", controllers.RandomFeedNext)
 
 		// 视频相关路由
 		protected.POST("/video/upload-url", controllers.GetUploadURL)      // 获取上传URL
 		protected.POST("/video/upload-complete", controllers.ConfirmUpload) // 确认上传完成
+		protected.POST("/video/multipart", controllers.InitiateMultipartUpload)                   // 发起分片上传（大文件、断点续传）
+		protected.GET("/video/multipart/:videoid", controllers.GetMultipartUploadStatus)          // 查询分片上传进度
+		protected.POST("/video/multipart/:videoid/complete", controllers.CompleteMultipartUpload) // 合并分片，完成上传
+		protected.DELETE("/video/multipart/:videoid", controllers.AbortMultipartUpload)           // 取消分片上传
+		protected.PUT("/video/:videoid/visibility", controllers.SetVideoVisibility)               // 修改可见性
 		 
 		// 点赞相关路由
 		protected.POST("/video/like", controllers.AddLike)           // 点赞视频
@@ -49,6 +78,12 @@ func SetupRoutes(router *gin.Engine) {
 		// 评论相关路由
 		protected.POST("/video/comment/:videoid", controllers.AddComment) // 添加评论
 		protected.DELETE("/video/comment/:commentid", controllers.DeleteComment) // 删除评论
+		protected.POST("/comment/:commentid/toggle-like", controllers.ToggleCommentLike) // 切换评论点赞状态
+
+		// 关注相关路由
+		protected.POST("/user/:userid/follow", controllers.FollowUser)     // 关注
+		protected.DELETE("/user/:userid/follow", controllers.UnfollowUser) // 取消关注
+		protected.GET("/feed/following", controllers.GetFollowingFeed)      // 关注动态
 
 		// 获取某个用户的视频列表
 		protected.GET("/user/:userid/videos", controllers.GetUserVideoList)
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"backend/utils"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// CommentLikeService 评论点赞服务层（与视频点赞相同：Redis 主 + 发件箱 + MQ 异步落库）
+type CommentLikeService struct{}
+
+// CommentLikeResponse 评论点赞响应
+type CommentLikeResponse struct {
+	Message   string `json:"message"`    // 响应消息
+	LikeCount int64  `json:"like_count"` // 当前点赞数
+	IsLiked   bool   `json:"is_liked"`   // 是否已点赞
+}
+
+// ToggleLike 切换评论点赞状态（点赞/取消点赞）
+// 参数：用户名、评论ID
+func (s *CommentLikeService) ToggleLike(username string, commentID uint) (*CommentLikeResponse, error) {
+	// 1. 获取用户信息
+	user, err := utils.GetUserByUsername(username)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	// 2. 检查评论是否存在（私密视频的评论只有作者本人可以点赞）
+	comment, err := utils.GetCommentByID(commentID)
+	if err != nil {
+		return nil, errors.New("评论不存在")
+	}
+	if _, err := viewableVideo(comment.VideoID, user.ID); err != nil {
+		return nil, errors.New("评论不存在")
+	}
+
+	// 3. 使用 Redis SET 检查当前点赞状态
+	isLiked, err := utils.IsUserLikedComment(commentID, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("检查点赞状态失败: %v", err)
+	}
+
+	if isLiked {
+		return s.unlike(user.ID, commentID)
+	}
+	return s.like(user.ID, commentID)
+}
+
+// like 点赞评论
+func (s *CommentLikeService) like(userID, commentID uint) (*CommentLikeResponse, error) {
+	// 1. 添加用户点赞记录到 Redis SET
+	added, count, err := utils.AddUserLikeComment(commentID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("添加点赞记录失败: %v", err)
+	}
+	if !added {
+		// 并发情况下已被添加（幂等）
+		return &CommentLikeResponse{Message: "已点赞", LikeCount: count, IsLiked: true}, nil
+	}
+
+	// 2. 写入发件箱，由中继投递 MQ 消息异步更新 MySQL（失败时回滚 Redis）
+	if err := utils.EnqueueCommentLikeTask(commentID, userID, 1); err != nil {
+		utils.RemoveUserLikeComment(commentID, userID)
+		log.Printf("写入评论点赞任务失败: CommentID=%d, UserID=%d, Error=%v", commentID, userID, err)
+		return nil, errors.New("点赞失败，请稍后重试")
+	}
+
+	return &CommentLikeResponse{Message: "点赞成功", LikeCount: count, IsLiked: true}, nil
+}
+
+// unlike 取消点赞评论
+func (s *CommentLikeService) unlike(userID, commentID uint) (*CommentLikeResponse, error) {
+	// 1. 从 Redis SET 移除用户点赞记录
+	removed, count, err := utils.RemoveUserLikeComment(commentID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("移除点赞记录失败: %v", err)
+	}
+	if !removed {
+		// 并发情况下已被移除（幂等）
+		return &CommentLikeResponse{Message: "未点赞", LikeCount: count, IsLiked: false}, nil
+	}
+
+	// 2. 写入发件箱，由中继投递 MQ 消息异步更新 MySQL（失败时回滚 Redis）
+	if err := utils.EnqueueCommentLikeTask(commentID, userID, -1); err != nil {
+		utils.AddUserLikeComment(commentID, userID)
+		log.Printf("写入取消评论点赞任务失败: CommentID=%d, UserID=%d, Error=%v", commentID, userID, err)
+		return nil, errors.New("取消点赞失败，请稍后重试")
+	}
+
+	return &CommentLikeResponse{Message: "取消点赞成功", LikeCount: count, IsLiked: false}, nil
+}
@@ -13,7 +13,8 @@ type CommentService struct{}
 
 // CommentRequest 视频评论请求参数（用于添加评论）
 type CommentRequest struct {
-	Content string `json:"content" binding:"required"` // 评论内容，1-500字符
+	Content  string `json:"content" binding:"required"` // 评论内容，1-500字符
+	ParentID uint   `json:"parent_id"`                  // 回复的评论ID（可选，为空表示发表一级评论）
 }
 
 // CommentResponse 视频评论返回请求
@@ -31,9 +32,8 @@ func (s *CommentService) AddComment(username string, videoID uint, req CommentRe
 		return nil, err
 	}
 
-	// 2. 检查视频是否存在
-	_, err = utils.GetVideoByID(videoID)
-	if err != nil {
+	// 2. 检查视频是否存在（私密视频只有作者本人可以评论）
+	if _, err := viewableVideo(videoID, user.ID); err != nil {
 		return nil, err
 	}
 
@@ -50,6 +50,20 @@ func (s *CommentService) AddComment(username string, videoID uint, req CommentRe
 		VideoID: videoID,
 	}
 
+	// 回复：挂到被回复评论所在的一级评论下（楼中楼只有两层）
+	if req.ParentID != 0 {
+		parent, err := utils.GetCommentByID(req.ParentID)
+		if err != nil || parent.VideoID != videoID {
+			return nil, errors.New("回复的评论不存在")
+		}
+		comment.ParentID = parent.ID
+		comment.RootID = parent.RootID
+		if comment.RootID == 0 {
+			comment.RootID = parent.ID
+		}
+		comment.ReplyToUserID = parent.UserID
+	}
+
 	// 5. 检查是否重复评论
 	isRepetition, err := utils.CheckCommentIsRepetition(comment)
 	if err != nil {
@@ -60,13 +74,17 @@ func (s *CommentService) AddComment(username string, videoID uint, req CommentRe
 		return nil, errors.New("请勿重复发表相同内容的评论")
 	}
 
-	// 6. 将评论添加到数据库
-	if err := utils.CreateComment(comment); err != nil {
+	// 6. 将评论添加到数据库（同一事务中更新视频的评论数）
+	commentCount, err := utils.CreateComment(comment)
+	if err != nil {
 		return nil, err
 	}
 
-	// 7. 获取该视频的评论总数
-	commentCount := utils.GetVideoCommentCount(videoID)
+	// 7. 同步 Redis 中的评论计数和视频热度（失败只记录日志，以 MySQL 为准）
+	if _, err := utils.IncrVideoCommentCount(videoID, 1); err != nil {
+		log.Printf("更新 Redis 评论计数失败: %v", err)
+	}
+	recordTrending(videoID, utils.TrendingWeightComment)
 
 	// 8. 返回响应
 	return &CommentResponse{
@@ -75,48 +93,137 @@ func (s *CommentService) AddComment(username string, videoID uint, req CommentRe
 	}, nil
 }
 
-// GetComments 获取视频所有评论内容
-func (s *CommentService)GetComments(videoid uint)([]utils.CommentListItem, error){
-	// 检查视频是否存在
-	if _, err := utils.GetVideoByID(videoid); err != nil {
-		return nil, errors.New("视频不存在")
+// CommentListResponse 评论列表响应（游标分页）
+type CommentListResponse struct {
+	Comments   []utils.CommentListItem `json:"comments"`    // 评论列表
+	NextCursor string                  `json:"next_cursor"` // 下一页游标，为空表示没有更多
+}
+
+// GetComments 获取视频的一级评论（游标分页）
+// 参数：视频ID、排序方式（newest/hot）、游标（第一页为空）、每页数量、当前用户名（可选，用于 is_liked）
+func (s *CommentService) GetComments(videoid uint, sort, cursorStr string, pageSize int, username string) (*CommentListResponse, error) {
+	// 检查视频是否存在（私密视频的评论只有作者本人可以查看）
+	viewerID := viewerIDByUsername(username)
+	if _, err := viewableVideo(videoid, viewerID); err != nil {
+		return nil, err
+	}
+
+	if sort != utils.CommentSortHot {
+		sort = utils.CommentSortNewest
+	}
+	cursor, err := utils.DecodeCursor(cursorStr)
+	if err != nil {
+		return nil, err
 	}
 
 	// 获取视频评论
-	commentList, err := utils.GetVideoComments(videoid)
+	commentList, nextCursor, err := utils.GetVideoComments(videoid, sort, cursor, normalizeCommentPageSize(pageSize))
 	if err != nil {
 		return nil, errors.New("获取评论失败：" + err.Error())
 	}
-	
+
+	// 查询点赞状态
+	fillCommentIsLiked(commentList, viewerID)
+
 	// 返回信息
-	return commentList, nil
+	return &CommentListResponse{
+		Comments:   commentList,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// GetReplies 获取某条一级评论下的回复（按时间正序，游标分页）
+// 参数：一级评论ID、游标（第一页为空）、每页数量、当前用户名（可选，用于 is_liked）
+func (s *CommentService) GetReplies(commentid uint, cursorStr string, pageSize int, username string) (*CommentListResponse, error) {
+	comment, err := utils.GetCommentByID(commentid)
+	if err != nil {
+		return nil, errors.New("评论不存在")
+	}
+	if comment.RootID != 0 {
+		return nil, errors.New("只能查看一级评论的回复")
+	}
+	viewerID := viewerIDByUsername(username)
+	if _, err := viewableVideo(comment.VideoID, viewerID); err != nil {
+		return nil, errors.New("评论不存在")
+	}
+	cursor, err := utils.DecodeCursor(cursorStr)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, nextCursor, err := utils.GetCommentReplies(comment.ID, cursor, normalizeCommentPageSize(pageSize))
+	if err != nil {
+		return nil, errors.New("获取回复失败：" + err.Error())
+	}
+
+	fillCommentIsLiked(replies, viewerID)
+	return &CommentListResponse{
+		Comments:   replies,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// normalizeCommentPageSize 限制评论每页数量
+func normalizeCommentPageSize(pageSize int) int {
+	if pageSize < 1 || pageSize > 50 {
+		pageSize = 20
+	}
+	return pageSize
 }
 
-// DeleteComment 删除评论
-func (s *CommentService) DeleteComment(username string, commentid uint) error {
+// fillCommentIsLiked 为评论列表设置当前用户的点赞状态（未登录时不处理）
+func fillCommentIsLiked(comments []utils.CommentListItem, viewerID uint) {
+	if viewerID == 0 || len(comments) == 0 {
+		return
+	}
+	ids := make([]uint, 0, len(comments))
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	liked, err := utils.GetUserLikedComments(viewerID, ids)
+	if err != nil {
+		return
+	}
+	for i := range comments {
+		comments[i].IsLiked = liked[comments[i].ID]
+	}
+}
+
+// DeleteComment 删除评论（删除一级评论会同时删除其下的回复）
+// 返回：删除后该视频的评论数
+func (s *CommentService) DeleteComment(username string, commentid uint) (int64, error) {
 	// 1. 检查评论是否存在
 	comment, err := utils.GetCommentByID(commentid)
 	if err != nil {
-		return errors.New("评论不存在")
+		return 0, errors.New("评论不存在")
 	}
 
 	// 2. 获取当前用户信息
 	user, err := utils.GetUserByUsername(username)
 	if err != nil {
-		return errors.New("用户不存在")
+		return 0, errors.New("用户不存在")
 	}
 
 	// 3. 验证权限：只能删除自己的评论
 	if comment.UserID != user.ID {
-		return errors.New("无权删除他人的评论")
+		return 0, errors.New("无权删除他人的评论")
 	}
 
-	// 4. 删除评论
-	if err := utils.DeleteComment(commentid); err != nil {
+	// 4. 删除评论（同一事务中更新视频的评论数）
+	deleted, commentCount, err := utils.DeleteComment(comment)
+	if err != nil {
 		log.Printf("删除评论失败: %v", err)
-		return errors.New("删除评论失败")
+		return 0, errors.New("删除评论失败")
+	}
+
+	// 5. 同步 Redis 中的评论计数和视频热度（从每条评论发表时所在小时的分桶中扣除）
+	if len(deleted) > 0 {
+		if _, err := utils.IncrVideoCommentCount(comment.VideoID, -int64(len(deleted))); err != nil {
+			log.Printf("更新 Redis 评论计数失败: %v", err)
+		}
+		retractTrending(comment.VideoID, deleted, utils.TrendingWeightComment)
 	}
 
-	// 5. 返回成功
-	return nil
+	// 6. 返回删除后的评论数
+	return commentCount, nil
 }
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"backend/utils"
+	"errors"
+)
+
+// FollowService 关注服务层
+type FollowService struct{}
+
+// UserProfileResponse 用户主页信息
+type UserProfileResponse struct {
+	UserResponse
+	IsFollowing bool `json:"is_following"` // 当前用户是否已关注（需要登录）
+}
+
+// FollowListResponse 关注/粉丝列表响应
+type FollowListResponse struct {
+	Users      []utils.FollowUserItem `json:"users"`       // 用户列表
+	NextCursor string                 `json:"next_cursor"` // 下一页游标，为空表示没有更多
+}
+
+// Follow 关注用户
+// 参数：当前用户名、被关注的用户ID
+func (s *FollowService) Follow(username string, followeeID uint) error {
+	user, err := utils.GetUserByUsername(username)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+	if user.ID == followeeID {
+		return errors.New("不能关注自己")
+	}
+	if _, err := utils.GetUserByID(followeeID); err != nil {
+		return errors.New("关注的用户不存在")
+	}
+
+	// 重复关注视为成功（幂等）
+	if _, err := utils.CreateFollow(user.ID, followeeID); err != nil {
+		return errors.New("关注失败")
+	}
+	return nil
+}
+
+// Unfollow 取消关注
+// 参数：当前用户名、被关注的用户ID
+func (s *FollowService) Unfollow(username string, followeeID uint) error {
+	user, err := utils.GetUserByUsername(username)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+
+	// 未关注时取消视为成功（幂等）
+	if _, err := utils.DeleteFollow(user.ID, followeeID); err != nil {
+		return errors.New("取消关注失败")
+	}
+	return nil
+}
+
+// GetProfile 获取用户主页信息（含关注数、粉丝数）
+// 参数：用户ID、当前用户名（可选）
+func (s *FollowService) GetProfile(userID uint, username string) (*UserProfileResponse, error) {
+	user, err := utils.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	resp := &UserProfileResponse{
+		UserResponse: UserResponse{
+			ID:             user.ID,
+			Username:       user.Username,
+			AvatarURL:      user.AvatarURL,
+			FollowerCount:  user.FollowerCount,
+			FollowingCount: user.FollowingCount,
+		},
+	}
+	if viewerID := viewerIDByUsername(username); viewerID != 0 && viewerID != user.ID {
+		resp.IsFollowing = utils.IsFollowing(viewerID, user.ID)
+	}
+	return resp, nil
+}
+
+// GetFollowers 获取用户的粉丝列表
+// 参数：用户ID、游标、每页数量、当前用户名（可选，用于 is_following）
+func (s *FollowService) GetFollowers(userID uint, cursor string, pageSize int, username string) (*FollowListResponse, error) {
+	return s.list(utils.GetFollowers, userID, cursor, pageSize, username)
+}
+
+// GetFollowing 获取用户关注的人列表
+// 参数：用户ID、游标、每页数量、当前用户名（可选，用于 is_following）
+func (s *FollowService) GetFollowing(userID uint, cursor string, pageSize int, username string) (*FollowListResponse, error) {
+	return s.list(utils.GetFollowing, userID, cursor, pageSize, username)
+}
+
+func (s *FollowService) list(
+	query func(uint, *utils.Cursor, int) ([]utils.FollowUserItem, string, error),
+	userID uint, cursorStr string, pageSize int, username string,
+) (*FollowListResponse, error) {
+	if pageSize < 1 || pageSize > 50 {
+		pageSize = 20
+	}
+	cursor, err := utils.DecodeCursor(cursorStr)
+	if err != nil {
+		return nil, err
+	}
+
+	users, nextCursor, err := query(userID, cursor, pageSize)
+	if err != nil {
+		return nil, errors.New("获取用户列表失败")
+	}
+
+	// 标记当前用户是否已关注列表中的用户
+	if viewerID := viewerIDByUsername(username); viewerID != 0 && len(users) > 0 {
+		ids := make([]uint, 0, len(users))
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+		if followed, err := utils.GetFollowingSet(viewerID, ids); err == nil {
+			for i := range users {
+				users[i].IsFollowing = followed[users[i].ID]
+			}
+		}
+	}
+
+	return &FollowListResponse{
+		Users:      users,
+		NextCursor: nextCursor,
+	}, nil
+}
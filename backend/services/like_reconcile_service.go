@@ -0,0 +1,419 @@
+package services
+
+import (
+	"backend/utils"
+	"common/config"
+	"fmt"
+	"log"
+	"time"
+)
+
+// LikeReconcileService 点赞数据对账（Redis ↔ MySQL）
+//
+// 点赞先写 Redis（like:video:<id> 集合 + rank:video:like 排行榜），再经发件箱和 MQ 异步落库到 likes 表和 videos.like_count。
+// 消息进入死信、发件箱写入失败且 Redis 回滚失败、Redis 数据丢失都会让两边悄悄不一致。对账按视频ID分批比较：
+//   - Redis 点赞集合 vs likes 表：以 Redis 为准（反映用户最近的操作）修复 MySQL；
+//     视频的点赞集合和排行榜成员都不存在（如 key 被淘汰）时 Redis 数据已丢失，改为以 likes 表为准恢复 Redis
+//   - 排行榜分数 vs 点赞集合大小：以集合为准修复排行榜
+//   - videos.like_count vs likes 表行数：以 likes 表为准修复计数
+//   - 排行榜中已删除的视频：从 Redis 移除
+//
+// 差异可能只是 MQ 消息还没消费完，因此只修复“上一轮对账也发现了”的差异（见 LikeReconcileOptions.Confirmed）。
+// Redis 整体丢失（排行榜不存在）时不能对账（会删除 MySQL 中的所有点赞），定时对账每轮先检查，必要时用 RebuildRedis 从 MySQL 重建。
+// 评论点赞集合（like:comment:<id>）同样是 is_liked 和点赞数的来源，Redis 被清空后（标记 like:comment:ready 不存在）用 RebuildCommentLikes 从 comment_likes 表重建。
+type LikeReconcileService struct{}
+
+// 差异类型
+const (
+	LikeDiffRedisOnly  = "redis_only"  // Redis 中已点赞，likes 表中没有记录
+	LikeDiffRedisLost  = "redis_lost"  // 视频的 Redis 点赞集合和排行榜成员都不存在，likes 表中有记录（以 likes 表为准恢复 Redis）
+	LikeDiffMySQLOnly  = "mysql_only"  // likes 表中有记录，Redis 中未点赞
+	LikeDiffRank       = "rank"        // 排行榜分数与点赞集合大小不一致
+	LikeDiffLikeCount  = "like_count"  // videos.like_count 与 likes 表行数不一致
+	LikeDiffOrphanRank = "orphan_rank" // 排行榜中的视频已不存在
+)
+
+// LikeDiff 一处差异
+type LikeDiff struct {
+	Kind     string `json:"kind"`
+	VideoID  uint   `json:"video_id"`
+	UserID   uint   `json:"user_id,omitempty"` // 仅 redis_only / mysql_only
+	Expected int64  `json:"expected"`          // 期望值（以哪一方为准见差异类型说明）
+	Actual   int64  `json:"actual"`            // 实际值
+	Repaired bool   `json:"repaired"`
+}
+
+// key 差异的唯一标识（用于跨轮次确认，不包含具体数值）
+func (d LikeDiff) key() string {
+	return fmt.Sprintf("%s:%d:%d", d.Kind, d.VideoID, d.UserID)
+}
+
+// LikeReconcileReport 对账报告
+type LikeReconcileReport struct {
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    time.Time  `json:"finished_at"`
+	VideosScanned int        `json:"videos_scanned"`
+	Repaired      int        `json:"repaired"` // 已修复的差异数
+	Deferred      int        `json:"deferred"` // 首次发现、等待下一轮确认的差异数
+	Diffs         []LikeDiff `json:"diffs"`
+}
+
+// LikeReconcileOptions 对账选项
+type LikeReconcileOptions struct {
+	Repair    bool            // 是否修复（false 只输出报告）
+	Confirmed map[string]bool // 上一轮发现的差异（LikeReconcileResult.Pending），只修复其中仍然存在的；为 nil 时不做确认直接修复
+}
+
+// LikeReconcileResult 对账结果
+type LikeReconcileResult struct {
+	Report  *LikeReconcileReport
+	Pending map[string]bool // 本轮发现的所有差异，作为下一轮的 Confirmed
+}
+
+// Reconcile 对比 Redis 与 MySQL 的点赞数据，按选项修复差异
+func (s *LikeReconcileService) Reconcile(opts LikeReconcileOptions) (*LikeReconcileResult, error) {
+	report := &LikeReconcileReport{StartedAt: time.Now(), Diffs: []LikeDiff{}}
+	pending := make(map[string]bool)
+
+	// shouldRepair 判断某处差异本轮是否修复
+	shouldRepair := func(d LikeDiff) bool {
+		pending[d.key()] = true
+		if !opts.Repair {
+			return false
+		}
+		if opts.Confirmed != nil && !opts.Confirmed[d.key()] {
+			report.Deferred++
+			return false
+		}
+		return true
+	}
+	record := func(d LikeDiff, repaired bool) {
+		d.Repaired = repaired
+		if repaired {
+			report.Repaired++
+		}
+		report.Diffs = append(report.Diffs, d)
+	}
+
+	var afterID uint
+	for {
+		rows, err := utils.ListVideoLikeCounts(afterID, config.Conf.Reconcile.BatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("读取视频失败: %v", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		afterID = rows[len(rows)-1].ID
+		report.VideosScanned += len(rows)
+
+		ids := make([]uint, 0, len(rows))
+		for _, r := range rows {
+			ids = append(ids, r.ID)
+		}
+		mysqlUsers, err := utils.GetLikeUsersByVideos(ids)
+		if err != nil {
+			return nil, fmt.Errorf("读取点赞记录失败: %v", err)
+		}
+		redisStates, err := utils.GetVideoLikeStates(ids)
+		if err != nil {
+			return nil, fmt.Errorf("读取 Redis 点赞数据失败: %v", err)
+		}
+
+		for _, row := range rows {
+			if err := s.reconcileVideo(row, mysqlUsers[row.ID], redisStates[row.ID], shouldRepair, record); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 排行榜中已不存在的视频
+	ranks, err := utils.GetAllVideoLikeRanks()
+	if err != nil {
+		return nil, fmt.Errorf("读取点赞排行榜失败: %v", err)
+	}
+	rankIDs := make([]uint, 0, len(ranks))
+	for id := range ranks {
+		rankIDs = append(rankIDs, id)
+	}
+	existing, err := utils.GetExistingVideoIDs(rankIDs)
+	if err != nil {
+		return nil, fmt.Errorf("查询视频失败: %v", err)
+	}
+	for _, id := range rankIDs {
+		if existing[id] {
+			continue
+		}
+		d := LikeDiff{Kind: LikeDiffOrphanRank, VideoID: id, Expected: 0, Actual: ranks[id]}
+		repaired := false
+		if shouldRepair(d) {
+			if err := utils.RemoveVideoLikeState(id); err != nil {
+				return nil, fmt.Errorf("移除视频 %d 的点赞数据失败: %v", id, err)
+			}
+			repaired = true
+		}
+		record(d, repaired)
+	}
+
+	report.FinishedAt = time.Now()
+	return &LikeReconcileResult{Report: report, Pending: pending}, nil
+}
+
+// reconcileVideo 对比单个视频的点赞数据
+func (s *LikeReconcileService) reconcileVideo(
+	row utils.VideoLikeCountRow,
+	mysqlUserIDs []uint,
+	state utils.VideoLikeState,
+	shouldRepair func(LikeDiff) bool,
+	record func(LikeDiff, bool),
+) error {
+	// 0. 视频的 Redis 数据丢失：以 likes 表为准恢复 Redis，不能按 Redis 删除 likes 表中的记录
+	if !state.InRank && len(state.UserIDs) == 0 && len(mysqlUserIDs) > 0 {
+		d := LikeDiff{Kind: LikeDiffRedisLost, VideoID: row.ID, Expected: int64(len(mysqlUserIDs)), Actual: 0}
+		repaired := false
+		if shouldRepair(d) {
+			if err := utils.ReplaceVideoLikeState(row.ID, mysqlUserIDs); err != nil {
+				return fmt.Errorf("恢复视频 %d 的 Redis 点赞数据失败: %v", row.ID, err)
+			}
+			repaired = true
+		}
+		record(d, repaired)
+		// 其余比较以 likes 表为准，点赞集合和排行榜不再产生差异
+		state = utils.VideoLikeState{UserIDs: mysqlUserIDs, Rank: int64(len(mysqlUserIDs)), InRank: true}
+	}
+
+	inMySQL := make(map[uint]bool, len(mysqlUserIDs))
+	for _, id := range mysqlUserIDs {
+		inMySQL[id] = true
+	}
+	inRedis := make(map[uint]bool, len(state.UserIDs))
+	for _, id := range state.UserIDs {
+		inRedis[id] = true
+	}
+
+	// 1. 点赞集合 vs likes 表（以 Redis 为准）
+	var addUsers, removeUsers []uint
+	var userDiffs []LikeDiff
+	for _, userID := range state.UserIDs {
+		if inMySQL[userID] {
+			continue
+		}
+		d := LikeDiff{Kind: LikeDiffRedisOnly, VideoID: row.ID, UserID: userID, Expected: 1, Actual: 0}
+		if shouldRepair(d) {
+			addUsers = append(addUsers, userID)
+			d.Repaired = true
+		}
+		userDiffs = append(userDiffs, d)
+	}
+	for _, userID := range mysqlUserIDs {
+		if inRedis[userID] {
+			continue
+		}
+		d := LikeDiff{Kind: LikeDiffMySQLOnly, VideoID: row.ID, UserID: userID, Expected: 0, Actual: 1}
+		if shouldRepair(d) {
+			removeUsers = append(removeUsers, userID)
+			d.Repaired = true
+		}
+		userDiffs = append(userDiffs, d)
+	}
+
+	mysqlCount := int64(len(mysqlUserIDs))
+	if len(addUsers) > 0 || len(removeUsers) > 0 {
+		// 修复点赞记录时会同时按 likes 表重新计算 like_count
+		count, err := utils.RepairVideoLikes(row.ID, addUsers, removeUsers)
+		if err != nil {
+			return fmt.Errorf("修复视频 %d 的点赞记录失败: %v", row.ID, err)
+		}
+		mysqlCount = count
+		row.LikeCount = count
+	}
+	for _, d := range userDiffs {
+		record(d, d.Repaired)
+	}
+
+	// 2. videos.like_count vs likes 表行数
+	if row.LikeCount != mysqlCount {
+		d := LikeDiff{Kind: LikeDiffLikeCount, VideoID: row.ID, Expected: mysqlCount, Actual: row.LikeCount}
+		repaired := false
+		if shouldRepair(d) {
+			if err := utils.SetVideoLikeCount(row.ID, mysqlCount); err != nil {
+				return fmt.Errorf("修复视频 %d 的点赞数失败: %v", row.ID, err)
+			}
+			repaired = true
+		}
+		record(d, repaired)
+	}
+
+	// 3. 排行榜分数 vs 点赞集合大小
+	if expected := int64(len(state.UserIDs)); state.Rank != expected {
+		d := LikeDiff{Kind: LikeDiffRank, VideoID: row.ID, Expected: expected, Actual: state.Rank}
+		repaired := false
+		if shouldRepair(d) {
+			if err := utils.SetVideoLikeRank(row.ID, expected); err != nil {
+				return fmt.Errorf("修复视频 %d 的排行榜分数失败: %v", row.ID, err)
+			}
+			repaired = true
+		}
+		record(d, repaired)
+	}
+	return nil
+}
+
+// RebuildRedis 从 MySQL 重建 Redis 中的点赞集合和排行榜
+// 注意：尚未落库（MQ 中）的点赞会丢失，适用于 Redis 数据丢失后的恢复
+// 返回：重建的视频数、错误
+func (s *LikeReconcileService) RebuildRedis() (int, error) {
+	var afterID uint
+	rebuilt := 0
+	for {
+		rows, err := utils.ListVideoLikeCounts(afterID, config.Conf.Reconcile.BatchSize)
+		if err != nil {
+			return rebuilt, fmt.Errorf("读取视频失败: %v", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		afterID = rows[len(rows)-1].ID
+
+		ids := make([]uint, 0, len(rows))
+		for _, r := range rows {
+			ids = append(ids, r.ID)
+		}
+		users, err := utils.GetLikeUsersByVideos(ids)
+		if err != nil {
+			return rebuilt, fmt.Errorf("读取点赞记录失败: %v", err)
+		}
+		for _, id := range ids {
+			if err := utils.ReplaceVideoLikeState(id, users[id]); err != nil {
+				return rebuilt, fmt.Errorf("重建视频 %d 的点赞数据失败: %v", id, err)
+			}
+			rebuilt++
+		}
+	}
+	return rebuilt, nil
+}
+
+// RebuildRedisIfMissing Redis 中没有点赞排行榜时（如 Redis 数据被清空）从 MySQL 重建
+// 返回：是否重建、错误
+func (s *LikeReconcileService) RebuildRedisIfMissing() (bool, error) {
+	exists, err := utils.VideoLikeRankExists()
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+	count, err := s.RebuildRedis()
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Redis 点赞数据不存在，已从 MySQL 重建 %d 个视频的点赞数据", count)
+	return true, nil
+}
+
+// RebuildCommentLikes 从 MySQL 重建所有评论的 Redis 点赞集合，完成后设置标记（尚未落库的评论点赞会丢失）
+// 返回：重建的评论数、错误
+func (s *LikeReconcileService) RebuildCommentLikes() (int, error) {
+	var afterID uint
+	rebuilt := 0
+	for {
+		ids, err := utils.ListLikedCommentIDs(afterID, config.Conf.Reconcile.BatchSize)
+		if err != nil {
+			return rebuilt, fmt.Errorf("读取评论点赞记录失败: %v", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+		afterID = ids[len(ids)-1]
+
+		users, err := utils.GetLikeUsersByComments(ids)
+		if err != nil {
+			return rebuilt, fmt.Errorf("读取评论点赞记录失败: %v", err)
+		}
+		for _, id := range ids {
+			if err := utils.ReplaceCommentLikeState(id, users[id]); err != nil {
+				return rebuilt, fmt.Errorf("重建评论 %d 的点赞数据失败: %v", id, err)
+			}
+			rebuilt++
+		}
+	}
+	return rebuilt, utils.MarkCommentLikeSetsReady()
+}
+
+// RebuildCommentLikesIfMissing Redis 中没有评论点赞集合的标记时（如 Redis 数据被清空）从 MySQL 重建
+// 返回：是否重建、错误
+func (s *LikeReconcileService) RebuildCommentLikesIfMissing() (bool, error) {
+	ready, err := utils.CommentLikeSetsReady()
+	if err != nil {
+		return false, err
+	}
+	if ready {
+		return false, nil
+	}
+	count, err := s.RebuildCommentLikes()
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Redis 评论点赞数据不存在，已从 MySQL 重建 %d 条评论的点赞数据", count)
+	return true, nil
+}
+
+// reconcileRound 执行一轮定时对账
+// Redis 点赞排行榜不存在时（运行期间 Redis 被清空）先从 MySQL 重建，本轮不对账；否则对账并修复上一轮也发现了的差异
+// 参数：上一轮发现的差异（第一轮或上一轮重建时为 nil，只记录不修复）
+// 返回：对账结果（重建时为 nil）、错误
+func (s *LikeReconcileService) reconcileRound(confirmed map[string]bool) (*LikeReconcileResult, error) {
+	if _, err := s.RebuildCommentLikesIfMissing(); err != nil {
+		return nil, fmt.Errorf("重建 Redis 评论点赞数据失败: %v", err)
+	}
+	rebuilt, err := s.RebuildRedisIfMissing()
+	if err != nil {
+		return nil, fmt.Errorf("重建 Redis 点赞数据失败: %v", err)
+	}
+	if rebuilt {
+		return nil, nil
+	}
+	return s.Reconcile(LikeReconcileOptions{Repair: confirmed != nil, Confirmed: confirmed})
+}
+
+// RunPeriodic 定时对账（阻塞运行，在 goroutine 中调用）
+// 多个 backend 实例通过分布式锁保证同一时间只有一个实例对账
+func (s *LikeReconcileService) RunPeriodic(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var confirmed map[string]bool
+	for range ticker.C {
+		release, ok, err := utils.TryLock(utils.ReconcileLockKey, interval)
+		if err != nil {
+			log.Printf("获取对账锁失败: %v", err)
+			continue
+		}
+		if !ok {
+			// 其他实例正在对账，本实例的待确认差异作废
+			confirmed = nil
+			continue
+		}
+
+		// 第一轮只记录差异，不修复
+		result, err := s.reconcileRound(confirmed)
+		release()
+		if err != nil {
+			log.Printf("点赞对账失败: %v", err)
+			confirmed = nil
+			continue
+		}
+		if result == nil {
+			// 刚从 MySQL 重建，之前记录的差异作废
+			confirmed = nil
+			continue
+		}
+		confirmed = result.Pending
+
+		r := result.Report
+		if len(r.Diffs) > 0 {
+			log.Printf("点赞对账完成: 扫描 %d 个视频，发现 %d 处差异，修复 %d 处，待确认 %d 处，耗时 %v",
+				r.VideosScanned, len(r.Diffs), r.Repaired, r.Deferred, r.FinishedAt.Sub(r.StartedAt))
+		}
+	}
+}
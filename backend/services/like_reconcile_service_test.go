@@ -0,0 +1,151 @@
+package services
+
+// 点赞对账的集成测试：需要真实的 MySQL 和 Redis，默认跳过。
+// 使用专门的测试库运行（测试会删除 Redis 中所有视频的点赞数据再从 MySQL 重建，并在 MySQL 中留下测试用户和视频）：
+//
+//	CWATCH_INTEGRATION_TEST=1 CWATCH_CONFIG=/path/to/test-config.yaml go test ./services -run LikeReconcile
+
+import (
+	"backend/models"
+	"backend/utils"
+	"common/config"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+var integrationOnce sync.Once
+
+// setupIntegration 连接测试用的 MySQL 和 Redis（未设置 CWATCH_INTEGRATION_TEST 时跳过）
+func setupIntegration(t *testing.T) {
+	t.Helper()
+	if os.Getenv("CWATCH_INTEGRATION_TEST") == "" {
+		t.Skip("未设置 CWATCH_INTEGRATION_TEST，跳过集成测试")
+	}
+	var err error
+	integrationOnce.Do(func() {
+		if _, err = config.Load((*config.Config).ValidateBackend); err != nil {
+			return
+		}
+		if err = utils.InitMySQL(); err != nil {
+			return
+		}
+		if err = utils.AutoMigrate(&models.User{}, &models.Video{}, &models.Like{}); err != nil {
+			return
+		}
+		err = utils.InitRedis()
+	})
+	if err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+}
+
+// createLikedVideo 创建一个已发布的视频和 n 个点赞用户，MySQL 和 Redis 中的点赞数据一致
+func createLikedVideo(t *testing.T, n int) (uint, []uint) {
+	t.Helper()
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	author := &models.User{Username: "reconcile_author_" + suffix, Password: "x"}
+	if err := utils.CreateUser(author); err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	video := &models.Video{Title: "reconcile", UserID: author.ID, Status: models.VideoStatusPublished, FileName: suffix + ".mp4"}
+	if err := utils.CreateVideo(video); err != nil {
+		t.Fatalf("创建视频失败: %v", err)
+	}
+
+	userIDs := make([]uint, 0, n)
+	for i := 0; i < n; i++ {
+		u := &models.User{Username: fmt.Sprintf("reconcile_fan_%s_%d", suffix, i), Password: "x"}
+		if err := utils.CreateUser(u); err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+		userIDs = append(userIDs, u.ID)
+	}
+	if _, err := utils.RepairVideoLikes(video.ID, userIDs, nil); err != nil {
+		t.Fatalf("写入点赞记录失败: %v", err)
+	}
+	if err := utils.ReplaceVideoLikeState(video.ID, userIDs); err != nil {
+		t.Fatalf("写入 Redis 点赞数据失败: %v", err)
+	}
+
+	t.Cleanup(func() {
+		utils.RepairVideoLikes(video.ID, nil, userIDs)
+		utils.RemoveVideoLikeState(video.ID)
+	})
+	return video.ID, userIDs
+}
+
+// runRounds 模拟定时对账连续执行 n 轮（上一轮的差异作为下一轮的确认）
+func runRounds(t *testing.T, s *LikeReconcileService, n int) {
+	t.Helper()
+	var confirmed map[string]bool
+	for i := 0; i < n; i++ {
+		result, err := s.reconcileRound(confirmed)
+		if err != nil {
+			t.Fatalf("第 %d 轮对账失败: %v", i+1, err)
+		}
+		confirmed = nil
+		if result != nil {
+			confirmed = result.Pending
+		}
+	}
+}
+
+// assertLikes MySQL 和 Redis 中的点赞用户数都为 want
+func assertLikes(t *testing.T, videoID uint, want int) {
+	t.Helper()
+	mysqlUsers, err := utils.GetLikeUsersByVideos([]uint{videoID})
+	if err != nil {
+		t.Fatalf("读取点赞记录失败: %v", err)
+	}
+	if got := len(mysqlUsers[videoID]); got != want {
+		t.Errorf("likes 表中有 %d 条点赞，期望 %d 条", got, want)
+	}
+	states, err := utils.GetVideoLikeStates([]uint{videoID})
+	if err != nil {
+		t.Fatalf("读取 Redis 点赞数据失败: %v", err)
+	}
+	state := states[videoID]
+	if len(state.UserIDs) != want || state.Rank != int64(want) {
+		t.Errorf("Redis 点赞集合 %d 人、排行榜分数 %d，期望都为 %d", len(state.UserIDs), state.Rank, want)
+	}
+}
+
+// Redis 被清空后连续两轮对账：应从 MySQL 重建，不能删除 likes 表中的点赞
+func TestLikeReconcileAfterRedisFlush(t *testing.T) {
+	setupIntegration(t)
+	videoID, users := createLikedVideo(t, 3)
+
+	// 清空所有视频的点赞数据（排行榜随最后一个成员删除而消失）
+	ranks, err := utils.GetAllVideoLikeRanks()
+	if err != nil {
+		t.Fatalf("读取排行榜失败: %v", err)
+	}
+	for id := range ranks {
+		if err := utils.RemoveVideoLikeState(id); err != nil {
+			t.Fatalf("删除 Redis 点赞数据失败: %v", err)
+		}
+	}
+	if exists, _ := utils.VideoLikeRankExists(); exists {
+		t.Fatal("排行榜仍然存在")
+	}
+
+	runRounds(t, &LikeReconcileService{}, 2)
+	assertLikes(t, videoID, len(users))
+}
+
+// 单个视频的点赞集合和排行榜成员被淘汰后连续两轮对账：应以 MySQL 为准恢复 Redis
+func TestLikeReconcileAfterVideoKeysEvicted(t *testing.T) {
+	setupIntegration(t)
+	videoID, users := createLikedVideo(t, 3)
+	createLikedVideo(t, 1) // 保证排行榜存在，只丢失一个视频的数据
+
+	if err := utils.RemoveVideoLikeState(videoID); err != nil {
+		t.Fatalf("删除 Redis 点赞数据失败: %v", err)
+	}
+
+	runRounds(t, &LikeReconcileService{}, 2)
+	assertLikes(t, videoID, len(users))
+}
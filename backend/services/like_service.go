@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 )
 
 // LikeService 点赞服务层
@@ -22,7 +23,7 @@ type LikeResponse struct {
 	IsLiked   bool   `json:"is_liked"`   // 是否已点赞
 }
 
-// AddLike 添加点赞（Redis 主 + MQ 异步落库）
+// AddLike 添加点赞（Redis 主 + 发件箱 + MQ 异步落库）
 func (s *LikeService) AddLike(username string, req LikeRequest) (*LikeResponse, error) {
 	
 	// 1. 获取用户信息
@@ -31,10 +32,9 @@ func (s *LikeService) AddLike(username string, req LikeRequest) (*LikeResponse,
 		return nil, errors.New("用户不存在")
 	}
 
-	// 2. 检查视频是否存在
-	_, err = utils.GetVideoByID(req.VideoID)
-	if err != nil {
-		return nil, errors.New("视频不存在")
+	// 2. 检查视频是否存在（私密视频只有作者本人可以点赞）
+	if _, err := viewableVideo(req.VideoID, user.ID); err != nil {
+		return nil, err
 	}
 
 	// 3. 使用 Redis SET 检查是否已点赞（幂等性）
@@ -77,14 +77,18 @@ func (s *LikeService) AddLike(username string, req LikeRequest) (*LikeResponse,
 		return nil, fmt.Errorf("更新排行榜失败: %v", err)
 	}
 
-	// 6. 发送 MQ 消息异步更新 MySQL
-	err = utils.PublishLikeTask(req.VideoID, user.ID, 1)
-	if err != nil {
-		// MQ 发送失败只记录日志，不影响用户体验
-		// 可以通过定时任务或其他方式补偿
-		log.Printf("发送点赞 MQ 消息失败: VideoID=%d, UserID=%d, Error=%v", req.VideoID, user.ID, err)
+	// 6. 写入发件箱，由中继投递 MQ 消息异步更新 MySQL
+	// Redis 不在 MySQL 事务中，写入失败时回滚 Redis，保证点赞要么完整生效、要么不生效
+	if err := utils.EnqueueLikeTask(req.VideoID, user.ID, 1); err != nil {
+		utils.RemoveUserLikeVideo(req.VideoID, user.ID)
+		utils.IncrVideoLikeRank(req.VideoID, -1)
+		log.Printf("写入点赞任务失败: VideoID=%d, UserID=%d, Error=%v", req.VideoID, user.ID, err)
+		return nil, errors.New("点赞失败，请稍后重试")
 	}
 
+	// 7. 计入视频热度
+	recordTrending(req.VideoID, utils.TrendingWeightLike)
+
 	return &LikeResponse{
 		Message:   "点赞成功",
 		LikeCount: newCount,
@@ -92,7 +96,7 @@ func (s *LikeService) AddLike(username string, req LikeRequest) (*LikeResponse,
 	}, nil
 }
 
-// RemoveLike 取消点赞（Redis 主 + MQ 异步落库）
+// RemoveLike 取消点赞（Redis 主 + 发件箱 + MQ 异步落库）
 func (s *LikeService) RemoveLike(username string, req LikeRequest) (*LikeResponse, error) {
 	// 1. 获取用户信息
 	user, err := utils.GetUserByUsername(username)
@@ -122,6 +126,12 @@ func (s *LikeService) RemoveLike(username string, req LikeRequest) (*LikeRespons
 		}, nil
 	}
 
+	// 点赞时间（用于从点赞所在小时的热度分桶中扣除），需要在取消点赞落库前查询；尚未落库时按当前时间
+	likedAt := time.Now()
+	if t, err := utils.GetLikeTime(user.ID, req.VideoID); err == nil {
+		likedAt = t
+	}
+
 	// 4. 从 Redis SET 移除用户点赞记录
 	removed, err := utils.RemoveUserLikeVideo(req.VideoID, user.ID)
 	if err != nil {
@@ -146,13 +156,17 @@ func (s *LikeService) RemoveLike(username string, req LikeRequest) (*LikeRespons
 		return nil, fmt.Errorf("更新排行榜失败: %v", err)
 	}
 
-	// 6. 发送 MQ 消息异步更新 MySQL
-	err = utils.PublishLikeTask(req.VideoID, user.ID, -1)
-	if err != nil {
-		// MQ 发送失败只记录日志，不影响用户体验
-		log.Printf("发送取消点赞 MQ 消息失败: VideoID=%d, UserID=%d, Error=%v", req.VideoID, user.ID, err)
+	// 6. 写入发件箱，由中继投递 MQ 消息异步更新 MySQL（失败时回滚 Redis）
+	if err := utils.EnqueueLikeTask(req.VideoID, user.ID, -1); err != nil {
+		utils.AddUserLikeVideo(req.VideoID, user.ID)
+		utils.IncrVideoLikeRank(req.VideoID, 1)
+		log.Printf("写入取消点赞任务失败: VideoID=%d, UserID=%d, Error=%v", req.VideoID, user.ID, err)
+		return nil, errors.New("取消点赞失败，请稍后重试")
 	}
 
+	// 7. 扣除视频热度
+	retractTrending(req.VideoID, []time.Time{likedAt}, utils.TrendingWeightLike)
+
 	return &LikeResponse{
 		Message:   "取消点赞成功",
 		LikeCount: newCount,
@@ -168,10 +182,9 @@ func (s *LikeService) ToggleLike(username string, req LikeRequest) (*LikeRespons
 		return nil, errors.New("用户不存在")
 	}
 
-	// 2. 检查视频是否存在
-	_, err = utils.GetVideoByID(req.VideoID)
-	if err != nil {
-		return nil, errors.New("视频不存在")
+	// 2. 检查视频是否存在（私密视频只有作者本人可以点赞）
+	if _, err := viewableVideo(req.VideoID, user.ID); err != nil {
+		return nil, err
 	}
 
 	// 3. 使用 Redis 检查当前点赞状态并切换
@@ -12,16 +12,17 @@ import (
 // 规则：
 // - 每次返回 pageSize=3 条
 // - 返回之前通过 Redis BloomFilter（用户维度 + 每日轮转）去重
-// - 扫描候选页时按 created_at DESC 顺序取候选，然后用 Bloom 过滤
+// - 从游标位置开始按 created_at DESC 顺序取候选，然后用 Bloom 过滤
+// - 初始化时在可见视频的发布时间范围内随机取一个时间点作为起始游标
 type RandomFeedService struct{}
 
 type RandomFeedNextResponse struct {
-	Videos   []utils.VideoListItem `json:"videos"`
-	NextPage int                    `json:"next_page"`
-	HasMore bool                   `json:"has_more"`
+	Videos     []utils.VideoListItem `json:"videos"`
+	NextCursor string                `json:"next_cursor"`
+	HasMore    bool                  `json:"has_more"`
 }
 
-func (s *RandomFeedService) NextRandomFeed(username string, page int, init bool, pageSize int) (*RandomFeedNextResponse, error) {
+func (s *RandomFeedService) NextRandomFeed(username string, cursorStr string, init bool, pageSize int) (*RandomFeedNextResponse, error) {
 	if username == "" {
 		return nil, errors.New("未登录")
 	}
@@ -38,46 +39,30 @@ func (s *RandomFeedService) NextRandomFeed(username string, page int, init bool,
 	dayKey := time.Now().Format("20060102")
 	ctx := context.Background()
 
-	// likedMap：给返回的视频补齐 is_liked（前端点赞按钮需要）
-	likedVideoIDs, err := utils.GetUserLikedVideoIDs(userID)
-	if err != nil {
-		return nil, errors.New("获取点赞信息失败")
-	}
-	likedMap := make(map[uint]bool, len(likedVideoIDs))
-	for _, vid := range likedVideoIDs {
-		likedMap[vid] = true
-	}
-
-	// 计算最大页数：用于 has_more 的粗略判断
-	totalCount, err := utils.GetUploadedVideoCount()
-	if err != nil {
-		return nil, errors.New("获取视频总数失败")
-	}
-
-	if totalCount == 0 {
-		return &RandomFeedNextResponse{
-			Videos:   []utils.VideoListItem{},
-			NextPage: 1,
-			HasMore: false,
-		}, nil
-	}
-
-	maxPage := int((totalCount + int64(pageSize) - 1) / int64(pageSize))
-	if maxPage <= 0 {
-		maxPage = 1
-	}
-
-	// init：随机起点 page
+	// 起始游标
+	var start *utils.Cursor
 	if init {
-		if maxPage == 1 {
-			page = 1
-		} else {
+		// init：在可见视频的发布时间范围内随机取一个时间点（游标取该时间点之前的视频）
+		oldest, newest, ok, err := utils.GetPublicVideoTimeRange()
+		if err != nil {
+			return nil, errors.New("获取视频时间范围失败")
+		}
+		if !ok {
+			return &RandomFeedNextResponse{
+				Videos:  []utils.VideoListItem{},
+				HasMore: false,
+			}, nil
+		}
+		at := newest
+		if span := newest.Sub(oldest); span > 0 {
 			rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-			page = rng.Intn(maxPage) + 1
+			at = oldest.Add(time.Duration(rng.Int63n(int64(span) + 1)))
 		}
+		start = &utils.Cursor{CreatedAt: at.Add(time.Microsecond)}
 	} else {
-		if page < 1 {
-			page = 1
+		start, err = utils.DecodeCursor(cursorStr)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -86,16 +71,24 @@ func (s *RandomFeedService) NextRandomFeed(username string, page int, init bool,
 
 	collected := make([]utils.VideoListItem, 0, pageSize)
 	collectedIDs := make(map[uint]struct{}, pageSize)
-	curPage := page
-	nextPage := curPage + 1
 
-	for scan := 0; scan < maxScanPages && curPage <= maxPage; scan++ {
-		candidates, err := utils.GetVideoListPage(curPage, pageSize)
+	// last：最后一个被检查过的候选的位置，下一次请求从这里继续
+	last := start
+	exhausted := false
+
+	// 随机推荐只包含已发布的公开视频（不传当前用户，作者本人未发布的视频不参与推荐）
+	for scan := 0; scan < maxScanPages && !exhausted && len(collected) < pageSize; scan++ {
+		candidates, next, err := utils.GetVideoList(last, pageSize, 0)
 		if err != nil {
 			return nil, errors.New("获取视频候选失败")
 		}
+		if next == "" {
+			exhausted = true
+		}
+
+		for i, cand := range candidates {
+			last = &utils.Cursor{CreatedAt: cand.CursorTime, ID: cand.ID}
 
-		for _, cand := range candidates {
 			might, err := utils.BloomMightContain(ctx, userID, dayKey, cand.ID)
 			if err != nil {
 				return nil, errors.New("布隆过滤器查询失败")
@@ -115,42 +108,34 @@ func (s *RandomFeedService) NextRandomFeed(username string, page int, init bool,
 				return nil, errors.New("布隆过滤器写入失败")
 			}
 
-			// 补齐点赞状态，保证前端按钮正确
-			cand.IsLiked = likedMap[cand.ID]
-
 			collected = append(collected, cand)
 			collectedIDs[cand.ID] = struct{}{}
 			if len(collected) >= pageSize {
-				nextPage = curPage + 1
+				// 本页剩余的候选留给下一次请求
+				if i < len(candidates)-1 {
+					exhausted = false
+				}
 				break
 			}
 		}
-
-		if len(collected) >= pageSize {
-			break
-		}
-
-		curPage++
-		nextPage = curPage + 1
 	}
 
-	// 粗略 has_more：
-	// 如果 nextPage 已经超过 maxPage，说明没候选页了。
-	// 如果本次收集为空，MVP 直接认为“已无可用内容/已看完”，避免前端死循环请求空结果。
 	// 如果 Bloom 去重后仍然为 0，为了避免前端“空白”，做一个 MVP 兜底：
-	// 第二阶段：允许“可能存在”的视频补齐列表（同时仍写入 Bloom）。
-	if len(collected) == 0 && maxPage > 0 {
-		curPageFallback := page
-		if curPageFallback < 1 {
-			curPageFallback = 1
-		}
+	// 第二阶段：从起始游标重新扫描，允许“可能存在”的视频补齐列表（同时仍写入 Bloom）。
+	if len(collected) == 0 {
+		last = start
+		exhausted = false
 
-		for fallbackScan := 0; fallbackScan < maxScanPages && curPageFallback <= maxPage && len(collected) < pageSize; fallbackScan++ {
-			candidates, err := utils.GetVideoListPage(curPageFallback, pageSize)
+		for fallbackScan := 0; fallbackScan < maxScanPages && !exhausted && len(collected) < pageSize; fallbackScan++ {
+			candidates, next, err := utils.GetVideoList(last, pageSize, 0)
 			if err != nil {
 				return nil, errors.New("获取视频候选失败（fallback）")
 			}
-			for _, cand := range candidates {
+			if next == "" {
+				exhausted = true
+			}
+			for i, cand := range candidates {
+				last = &utils.Cursor{CreatedAt: cand.CursorTime, ID: cand.ID}
 				if _, ok := collectedIDs[cand.ID]; ok {
 					continue
 				}
@@ -158,37 +143,31 @@ func (s *RandomFeedService) NextRandomFeed(username string, page int, init bool,
 				// fallback 也写入 Bloom，保证后续不会重复太明显
 				_ = utils.BloomAdd(ctx, userID, dayKey, cand.ID)
 
-				cand.IsLiked = likedMap[cand.ID]
 				collected = append(collected, cand)
 				collectedIDs[cand.ID] = struct{}{}
 				if len(collected) >= pageSize {
-					nextPage = curPageFallback + 1
+					if i < len(candidates)-1 {
+						exhausted = false
+					}
 					break
 				}
 			}
-			if len(collected) >= pageSize {
-				break
-			}
-			curPageFallback++
-			nextPage = curPageFallback + 1
 		}
 	}
 
-	hasMore := nextPage <= maxPage && len(collected) > 0
-	if len(collected) < pageSize {
-		// 扫描页数不足/误判导致数量不满时，MVP 直接认为“可能还有”，但为避免死循环，
-		// 仍按 nextPage<=maxPage 返回 has_more。
-		hasMore = nextPage <= maxPage
+	// has_more：游标之后还有视频，且本次取到了内容（避免前端死循环请求空结果）
+	hasMore := !exhausted && len(collected) > 0
+	nextCursor := ""
+	if hasMore && last != nil {
+		nextCursor = utils.EncodeCursor(last.CreatedAt, last.ID)
 	}
 
-	if len(collected) == 0 {
-		hasMore = false
-	}
+	// 补齐 is_liked（前端点赞按钮需要），只查询本页视频的 Redis 点赞集合
+	fillIsLiked(collected, userID)
 
 	return &RandomFeedNextResponse{
-		Videos:   collected,
-		NextPage: nextPage,
-		HasMore: hasMore,
+		Videos:     collected,
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
 	}, nil
 }
-
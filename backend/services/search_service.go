@@ -0,0 +1,148 @@
+package services
+
+import (
+	"backend/utils"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SearchService 视频搜索服务层
+type SearchService struct {
+	Searcher utils.Searcher // 搜索引擎实现，为空时使用 MySQL FULLTEXT（utils.MySQLSearcher）
+}
+
+// ErrSearchFailed 搜索引擎查询失败（区别于参数错误）
+var ErrSearchFailed = errors.New("搜索失败")
+
+// 搜索参数限制
+const (
+	searchKeywordMaxRunes = 64 // 关键词最大长度
+	searchSnippetMaxRunes = 80 // 描述高亮摘要的长度
+	searchDateLayout      = "2006-01-02"
+)
+
+// SearchRequest 搜索请求参数
+type SearchRequest struct {
+	Keyword  string // 关键词（必填）
+	Uploader string // 上传者用户名（可选，精确匹配）
+	From     string // 发布日期下限，格式 2006-01-02（可选，含当天）
+	To       string // 发布日期上限，格式 2006-01-02（可选，含当天）
+	MinLikes uint   // 最少点赞数（可选）
+	Cursor   string // 游标（第一页为空）
+	PageSize int    // 每页数量
+}
+
+// SearchHighlight 命中关键词的高亮片段（HTML，关键词用 <em></em> 包裹，其余内容已转义）
+type SearchHighlight struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"` // 描述摘要（描述中没有命中时为空）
+	Username    string `json:"username,omitempty"`    // 上传者用户名（没有命中时为空）
+}
+
+// SearchVideoItem 搜索结果（视频列表项 + 高亮片段 + 排序分数）
+type SearchVideoItem struct {
+	utils.VideoListItem
+	Score     float64         `json:"score"`
+	Highlight SearchHighlight `json:"highlight"`
+}
+
+// SearchResponse 搜索响应（游标分页）
+type SearchResponse struct {
+	Videos     []SearchVideoItem `json:"videos"`
+	NextCursor string            `json:"next_cursor"` // 下一页游标，为空表示没有更多
+}
+
+// Search 搜索视频（标题、描述、上传者用户名），按相关度排序
+// 参数：当前用户名（未登录为空，用于返回点赞状态）、搜索参数
+func (s *SearchService) Search(username string, req SearchRequest) (*SearchResponse, error) {
+	// 1. 校验参数
+	keyword := strings.TrimSpace(req.Keyword)
+	if keyword == "" {
+		return nil, errors.New("请输入搜索关键词")
+	}
+	if utf8.RuneCountInString(keyword) > searchKeywordMaxRunes {
+		return nil, errors.New("搜索关键词过长")
+	}
+	query := utils.SearchQuery{
+		Keyword:  keyword,
+		Uploader: strings.TrimSpace(req.Uploader),
+		MinLikes: req.MinLikes,
+		Cursor:   req.Cursor,
+		Limit:    normalizeVideoPageSize(req.PageSize),
+	}
+	if req.From != "" {
+		from, err := time.ParseInLocation(searchDateLayout, req.From, time.Local)
+		if err != nil {
+			return nil, errors.New("无效的开始日期，格式为 YYYY-MM-DD")
+		}
+		query.From = from
+	}
+	if req.To != "" {
+		to, err := time.ParseInLocation(searchDateLayout, req.To, time.Local)
+		if err != nil {
+			return nil, errors.New("无效的结束日期，格式为 YYYY-MM-DD")
+		}
+		query.To = to.AddDate(0, 0, 1) // 含结束当天
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return nil, errors.New("开始日期不能晚于结束日期")
+	}
+
+	// 2. 查询搜索引擎
+	searcher := s.Searcher
+	if searcher == nil {
+		searcher = utils.MySQLSearcher{}
+	}
+	hits, nextCursor, err := searcher.Search(query)
+	if errors.Is(err, utils.ErrInvalidCursor) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("搜索失败: Keyword=%q, Error=%v", keyword, err)
+		return nil, ErrSearchFailed
+	}
+	if len(hits) == 0 {
+		return &SearchResponse{Videos: []SearchVideoItem{}, NextCursor: nextCursor}, nil
+	}
+
+	// 3. 按搜索结果的顺序查询视频详情和点赞状态
+	ids := make([]uint, len(hits))
+	scores := make(map[uint]float64, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.VideoID
+		scores[hit.VideoID] = hit.Score
+	}
+	viewerID := viewerIDByUsername(username)
+	videos, err := utils.GetVideosByIDs(ids, 0) // 搜索结果只包含已发布的公开视频
+	if err != nil {
+		return nil, errors.New("获取视频详情失败")
+	}
+	fillIsLiked(videos, viewerID)
+
+	// 4. 高亮命中的关键词
+	terms := utils.SearchTerms(keyword)
+	items := make([]SearchVideoItem, len(videos))
+	for i, v := range videos {
+		title, _ := utils.Highlight(v.Title, terms, 0)
+		item := SearchVideoItem{
+			VideoListItem: v,
+			Score:         scores[v.ID],
+			Highlight:     SearchHighlight{Title: title},
+		}
+		if desc, ok := utils.Highlight(v.Description, terms, searchSnippetMaxRunes); ok {
+			item.Highlight.Description = desc
+		}
+		if name, ok := utils.Highlight(v.Username, terms, 0); ok {
+			item.Highlight.Username = name
+		}
+		items[i] = item
+	}
+
+	return &SearchResponse{
+		Videos:     items,
+		NextCursor: nextCursor,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"backend/utils"
+	"common/config"
+	"errors"
+)
+
+// SessionService 登录会话服务层
+// 负责刷新令牌轮换、会话列表和撤销会话
+type SessionService struct{}
+
+// RefreshRequest 刷新令牌请求结构
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"` // 登录或上次刷新时返回的刷新令牌
+}
+
+// TokenPair 登录/刷新后返回的令牌
+type TokenPair struct {
+	Token        string `json:"token"`         // 访问令牌（JWT），放在 Authorization: Bearer <token> 中
+	RefreshToken string `json:"refresh_token"` // 刷新令牌，只能使用一次，刷新后返回新的刷新令牌
+	ExpiresIn    int64  `json:"expires_in"`    // 访问令牌有效期（秒）
+	SessionID    string `json:"session_id"`    // 会话ID
+}
+
+// SessionItem 会话列表项
+type SessionItem struct {
+	utils.Session
+	Current bool `json:"current"` // 是否为当前请求所在的会话
+}
+
+// issueTokens 为会话签发访问令牌
+func issueTokens(session *utils.Session, refreshToken string) (*TokenPair, error) {
+	token, err := utils.GenerateJWT(session.Username, session.ID)
+	if err != nil {
+		return nil, errors.New("令牌生成失败")
+	}
+	return &TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(config.Conf.JWT.TTL.Seconds()),
+		SessionID:    session.ID,
+	}, nil
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌和刷新令牌（旧刷新令牌作废）
+// 返回的错误为 utils.ErrRefreshRace 时，说明同一刷新令牌刚被其他请求使用，客户端应改用最新保存的令牌
+func (s *SessionService) Refresh(req RefreshRequest) (*TokenPair, error) {
+	session, refreshToken, err := utils.RotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrSessionNotFound),
+			errors.Is(err, utils.ErrInvalidRefreshToken),
+			errors.Is(err, utils.ErrRefreshTokenReused),
+			errors.Is(err, utils.ErrRefreshRace):
+			return nil, err
+		default:
+			return nil, errors.New("刷新令牌失败")
+		}
+	}
+	return issueTokens(session, refreshToken)
+}
+
+// ListSessions 获取用户的所有登录会话
+// 参数：用户名、当前会话ID（用于标记当前设备）
+func (s *SessionService) ListSessions(username, currentSessionID string) ([]SessionItem, error) {
+	sessions, err := utils.ListSessions(username)
+	if err != nil {
+		return nil, errors.New("获取会话列表失败")
+	}
+
+	items := make([]SessionItem, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, SessionItem{
+			Session: session,
+			Current: session.ID == currentSessionID,
+		})
+	}
+	return items, nil
+}
+
+// RevokeSession 撤销用户的某个会话（该设备需要重新登录）
+func (s *SessionService) RevokeSession(username, sessionID string) error {
+	deleted, err := utils.DeleteSession(username, sessionID)
+	if err != nil {
+		return errors.New("撤销会话失败")
+	}
+	if !deleted {
+		return utils.ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAllSessions 撤销用户的所有会话
+// 参数：用户名、需要保留的会话ID（为空则包括当前会话在内全部撤销）
+// 返回：撤销的会话数
+func (s *SessionService) RevokeAllSessions(username, keepSessionID string) (int, error) {
+	count, err := utils.DeleteAllSessions(username, keepSessionID)
+	if err != nil {
+		return 0, errors.New("撤销会话失败")
+	}
+	return count, nil
+}
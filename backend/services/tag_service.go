@@ -0,0 +1,99 @@
+package services
+
+import (
+	"backend/utils"
+	"errors"
+)
+
+// TagService 话题服务层
+type TagService struct{}
+
+// 话题页的错误
+var (
+	ErrTagNotFound    = errors.New("话题不存在")
+	ErrInvalidTagSort = errors.New("无效的排序方式，可选值：newest、hot")
+)
+
+// TagVideoListResponse 话题页响应（游标分页）
+type TagVideoListResponse struct {
+	Tag        utils.TagSummary      `json:"tag"`
+	Videos     []utils.VideoListItem `json:"videos"`
+	NextCursor string                `json:"next_cursor"` // 下一页游标，为空表示没有更多
+}
+
+// TrendingTagsResponse 热门话题响应
+type TrendingTagsResponse struct {
+	Tags []utils.TagSummary `json:"tags"`
+}
+
+// GetTagVideos 获取话题下的视频
+// 参数：话题名（可以带 #）、排序方式（newest / hot）、游标（第一页为空）、每页数量、当前用户名（未登录为空）
+func (s *TagService) GetTagVideos(name, sort, cursorStr string, pageSize int, username string) (*TagVideoListResponse, error) {
+	if sort == "" {
+		sort = utils.TagSortNewest
+	}
+	if sort != utils.TagSortNewest && sort != utils.TagSortHot {
+		return nil, ErrInvalidTagSort
+	}
+	tagName, ok := utils.NormalizeTag(name)
+	if !ok {
+		return nil, ErrTagNotFound
+	}
+	cursor, err := utils.DecodeCursor(cursorStr)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := utils.GetTagByName(tagName)
+	if err != nil {
+		return nil, ErrTagNotFound
+	}
+	summary := utils.TagSummary{ID: tag.ID, Name: tag.Name}
+	if summaries, err := utils.GetTagSummaries([]uint{tag.ID}); err == nil && len(summaries) > 0 {
+		summary = summaries[0]
+	}
+
+	viewerID := viewerIDByUsername(username)
+	videos, nextCursor, err := utils.GetTagVideoList(tag.ID, sort, cursor, normalizeVideoPageSize(pageSize))
+	if err != nil {
+		return nil, errors.New("获取话题视频失败")
+	}
+	fillIsLiked(videos, viewerID)
+
+	return &TagVideoListResponse{
+		Tag:        summary,
+		Videos:     videos,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// GetTrendingTags 获取热门话题
+// window：24h / 7d 按时间衰减的热度排序（与热门视频共用分桶机制），all 按已发布的视频数排序
+func (s *TagService) GetTrendingTags(window string, limit int) (*TrendingTagsResponse, error) {
+	if !utils.IsValidTrendingWindow(window) {
+		return nil, errors.New("无效的时间窗口，可选值：24h、7d、all")
+	}
+
+	var tags []utils.TagSummary
+	if window == utils.TrendingWindowAll {
+		var err error
+		tags, err = utils.GetTopTagsByVideoCount(limit)
+		if err != nil {
+			return nil, errors.New("获取热门话题失败")
+		}
+	} else {
+		tagIDs, err := utils.GetTrendingTagIDs(window, limit)
+		if err != nil {
+			return nil, errors.New("获取热门话题失败")
+		}
+		tags, err = utils.GetTagSummaries(tagIDs)
+		if err != nil {
+			return nil, errors.New("获取热门话题失败")
+		}
+	}
+
+	if tags == nil {
+		tags = []utils.TagSummary{}
+	}
+	return &TrendingTagsResponse{Tags: tags}, nil
+}
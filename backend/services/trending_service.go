@@ -0,0 +1,119 @@
+package services
+
+import (
+	"backend/utils"
+	"log"
+	"time"
+)
+
+// TrendingService 热度榜分桶维护（视频榜和话题榜，分桶结构见 utils/trending.go）
+type TrendingService struct{}
+
+// trendingRebuildRange 从 MySQL 重建的时间范围（与最长窗口 7d 一致）
+const trendingRebuildRange = 7 * 24 * time.Hour
+
+// Rebuild 按 MySQL 中最近 7 天的点赞、评论重建视频和话题的热度分桶
+// 播放量不落库到按小时的明细，重建后的分桶只包含点赞和评论
+// 返回：写入的 (视频, 小时) 条数、错误
+func (s *TrendingService) Rebuild() (int, error) {
+	since := time.Now().Add(-trendingRebuildRange).Truncate(time.Hour)
+
+	likes, err := utils.GetHourlyLikeActivity(since)
+	if err != nil {
+		return 0, err
+	}
+	comments, err := utils.GetHourlyCommentActivity(since)
+	if err != nil {
+		return 0, err
+	}
+
+	videoScores := make([]utils.TrendingBucketScore, 0, len(likes)+len(comments))
+	for _, row := range likes {
+		videoScores = append(videoScores, utils.TrendingBucketScore{
+			ID:     row.VideoID,
+			Bucket: row.Hour,
+			Score:  float64(row.Count) * utils.TrendingWeightLike,
+		})
+	}
+	for _, row := range comments {
+		videoScores = append(videoScores, utils.TrendingBucketScore{
+			ID:     row.VideoID,
+			Bucket: row.Hour,
+			Score:  float64(row.Count) * utils.TrendingWeightComment,
+		})
+	}
+
+	// 视频的热度同时计入它的每个话题
+	videoIDs := make([]uint, 0, len(videoScores))
+	seen := make(map[uint]bool)
+	for _, vs := range videoScores {
+		if !seen[vs.ID] {
+			seen[vs.ID] = true
+			videoIDs = append(videoIDs, vs.ID)
+		}
+	}
+	videoTags, err := utils.GetVideoTagMap(videoIDs)
+	if err != nil {
+		return 0, err
+	}
+	var tagScores []utils.TrendingBucketScore
+	for _, vs := range videoScores {
+		for _, tagID := range videoTags[vs.ID] {
+			tagScores = append(tagScores, utils.TrendingBucketScore{ID: tagID, Bucket: vs.Bucket, Score: vs.Score})
+		}
+	}
+
+	if err := utils.RebuildTrendingBuckets(videoScores, tagScores); err != nil {
+		return 0, err
+	}
+	return len(videoScores), nil
+}
+
+// RebuildIfMissing 最近 7 天的视频分桶全部不存在时（如 Redis 被清空、首次部署）从 MySQL 重建
+func (s *TrendingService) RebuildIfMissing() error {
+	exists, err := utils.TrendingBucketsExist()
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	count, err := s.Rebuild()
+	if err != nil {
+		return err
+	}
+	log.Printf("热度分桶不存在，已从 MySQL 重建: %d 条", count)
+	return nil
+}
+
+// recordTrending 记录一次互动到视频及其话题的热度分桶（失败只记录日志，不影响主流程）
+func recordTrending(videoID uint, weight float64) {
+	if err := utils.RecordTrendingEvent(videoID, weight); err != nil {
+		log.Printf("记录视频热度失败: VideoID=%d, Error=%v", videoID, err)
+	}
+
+	tagIDs, err := utils.GetVideoTagIDs(videoID)
+	if err != nil {
+		log.Printf("查询视频话题失败: VideoID=%d, Error=%v", videoID, err)
+		return
+	}
+	if err := utils.RecordTagTrendingEvent(tagIDs, weight); err != nil {
+		log.Printf("记录话题热度失败: VideoID=%d, Error=%v", videoID, err)
+	}
+}
+
+// retractTrending 撤销视频及其话题的互动热度（at 为每次互动发生的时间，失败只记录日志，不影响主流程）
+func retractTrending(videoID uint, at []time.Time, weight float64) {
+	if err := utils.RetractTrendingEvents(videoID, at, weight); err != nil {
+		log.Printf("扣除视频热度失败: VideoID=%d, Error=%v", videoID, err)
+	}
+
+	tagIDs, err := utils.GetVideoTagIDs(videoID)
+	if err != nil {
+		log.Printf("查询视频话题失败: VideoID=%d, Error=%v", videoID, err)
+		return
+	}
+	if err := utils.RetractTagTrendingEvents(tagIDs, at, weight); err != nil {
+		log.Printf("扣除话题热度失败: VideoID=%d, Error=%v", videoID, err)
+	}
+}
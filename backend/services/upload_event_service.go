@@ -0,0 +1,107 @@
+package services
+
+import (
+	"backend/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UploadEventService 上传完成事件
+//
+// 订阅 MinIO 存储桶的 s3:ObjectCreated:* 事件，单次上传的文件 PUT 完成后自动执行与 ConfirmUpload 相同的确认逻辑
+// （校验文件、更新状态、写入视频处理任务），浏览器在上传后关闭也不会停留在"上传中"。
+//   - 确认接口保留，作为事件丢失时的兜底，已确认的视频再次确认直接返回成功
+//   - 分片上传合并后同样会产生事件，由合并接口确认，这里跳过
+//   - 每个 backend 实例都会收到同一个事件，按视频加锁只由一个实例确认
+//   - 订阅断开期间错过的事件由被放弃的上传清理任务（RunUploadSweeper）兜底
+type UploadEventService struct{}
+
+const (
+	uploadEventRetryMin  = time.Second     // 订阅断开后重新订阅的最小间隔
+	uploadEventRetryMax  = time.Minute     // 订阅断开后重新订阅的最大间隔
+	uploadConfirmLockTTL = 2 * time.Minute // 自动确认锁的过期时间（校验文件需要读取 MinIO）
+)
+
+// Run 订阅上传完成事件并自动确认（阻塞运行，需在 goroutine 中调用），断开后按指数退避重新订阅
+func (s *UploadEventService) Run() {
+	backoff := uploadEventRetryMin
+	for {
+		start := time.Now()
+		err := s.listen()
+		log.Printf("上传完成事件订阅断开: %v，%s 后重新订阅", err, backoff)
+
+		time.Sleep(backoff)
+		if time.Since(start) > uploadEventRetryMax {
+			backoff = uploadEventRetryMin // 订阅正常运行过一段时间，重新计算退避
+		} else {
+			backoff = min(backoff*2, uploadEventRetryMax)
+		}
+	}
+}
+
+// listen 订阅一次，直到连接出错
+func (s *UploadEventService) listen() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log.Println("上传完成事件订阅中...")
+	for info := range utils.ListenUploadEvents(ctx) {
+		if info.Err != nil {
+			return info.Err
+		}
+		for _, record := range info.Records {
+			// 分片上传合并产生的事件由合并接口确认
+			if record.EventName == "s3:ObjectCreated:CompleteMultipartUpload" {
+				continue
+			}
+			// 事件中的对象名经过 URL 编码
+			key, err := url.QueryUnescape(record.S3.Object.Key)
+			if err != nil {
+				continue
+			}
+			s.handleObjectCreated(key)
+		}
+	}
+	return errors.New("订阅已关闭")
+}
+
+// handleObjectCreated 文件上传完成：是上传中的视频文件则自动确认
+func (s *UploadEventService) handleObjectCreated(fileName string) {
+	// 封面、HLS 文件等不是视频扩展名或不在根目录，不需要查询；转码产物（如 _720p.mp4）查询不到上传中的视频
+	if strings.Contains(fileName, "/") || !allowedVideoFormats[strings.ToLower(filepath.Ext(fileName))] {
+		return
+	}
+	video, err := utils.GetUploadingVideoByFileName(fileName)
+	if err != nil {
+		log.Printf("上传完成事件查询视频失败: file=%s, err=%v", fileName, err)
+		return
+	}
+	if video == nil {
+		return // 不是上传中的视频，或已被确认
+	}
+	if _, err := utils.GetMultipartUpload(video.ID); err == nil {
+		return
+	}
+
+	release, ok, err := utils.TryLock(fmt.Sprintf("%s%d", utils.UploadConfirmLockPrefix, video.ID), uploadConfirmLockTTL)
+	if err != nil {
+		log.Printf("获取视频 %d 的确认锁失败: %v", video.ID, err)
+		return
+	}
+	if !ok {
+		return // 其他实例正在确认
+	}
+	defer release()
+
+	if _, err := confirmUploadedVideo(video); err != nil {
+		log.Printf("上传完成事件自动确认视频 %d 失败: %v", video.ID, err)
+		return
+	}
+	log.Printf("上传完成事件已自动确认视频 %d", video.ID)
+}
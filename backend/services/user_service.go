@@ -21,14 +21,16 @@ type RegisterRequest struct {
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"` // 用户名，必填
 	Password string `json:"password" binding:"required"` // 密码，必填
+	Device   string `json:"device" binding:"max=64"`     // 设备名称（可选），用于在会话列表中区分设备
 }
 
 // UserResponse 用户响应结构（不包含密码）
 type UserResponse struct {
-	ID        uint   `json:"id"`              // 用户ID
-	Username  string `json:"username"`        // 用户名
-	AvatarURL string `json:"avatar_url"`      // 头像URL
-	Token     string `json:"token,omitempty"` // JWT令牌（仅登录时返回）
+	ID             uint   `json:"id"`              // 用户ID
+	Username       string `json:"username"`        // 用户名
+	AvatarURL      string `json:"avatar_url"`      // 头像URL
+	FollowerCount  uint   `json:"follower_count"`  // 粉丝数
+	FollowingCount uint   `json:"following_count"` // 关注数
 }
 
 // Register 注册新用户
@@ -76,40 +78,51 @@ func (s *UserService) Register(req RegisterRequest) (*UserResponse, error) {
 	}, nil
 }
 
-// Login 用户登录
-// 参数：登录请求
-// 返回：用户信息（包含JWT令牌）和错误
-func (s *UserService) Login(req LoginRequest) (*UserResponse, error) {
+// Login 用户登录，每次登录创建一个新的会话（多设备同时在线互不影响）
+// 参数：登录请求、客户端 User-Agent、客户端 IP
+// 返回：用户信息、令牌和错误
+func (s *UserService) Login(req LoginRequest, userAgent, ip string) (*UserResponse, *TokenPair, error) {
 	// 验证输入
 	username := strings.TrimSpace(req.Username)
 	if username == "" || req.Password == "" {
-		return nil, errors.New("用户名和密码不能为空")
+		return nil, nil, errors.New("用户名和密码不能为空")
 	}
 
 	// 查找用户
 	user, err := utils.GetUserByUsername(username)
 	if err != nil {
-		return nil, errors.New("用户不存在")
+		return nil, nil, errors.New("用户不存在")
 	}
 
 	// 验证密码
 	if !utils.CheckPasswordHash(req.Password, user.Password) {
-		return nil, errors.New("密码错误")
+		return nil, nil, errors.New("密码错误")
 	}
 
-	// 生成JWT令牌
-	token, err := utils.GenerateJWT(user.Username)
+	// 创建会话并签发访问令牌、刷新令牌
+	session := &utils.Session{
+		Username:  user.Username,
+		Device:    strings.TrimSpace(req.Device),
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+	refreshToken, err := utils.CreateSession(session)
+	if err != nil {
+		return nil, nil, errors.New("创建登录会话失败")
+	}
+	tokens, err := issueTokens(session, refreshToken)
 	if err != nil {
-		return nil, errors.New("令牌生成失败")
+		return nil, nil, err
 	}
 
 	// 返回用户信息和令牌
 	return &UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		AvatarURL: user.AvatarURL,
-		Token:     token,
-	}, nil
+		ID:             user.ID,
+		Username:       user.Username,
+		AvatarURL:      user.AvatarURL,
+		FollowerCount:  user.FollowerCount,
+		FollowingCount: user.FollowingCount,
+	}, tokens, nil
 }
 
 // GetUserByUsername 根据用户名获取用户信息
@@ -122,8 +135,22 @@ func (s *UserService) GetUserByUsername(username string) (*UserResponse, error)
 	}
 
 	return &UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		AvatarURL: user.AvatarURL,
+		ID:             user.ID,
+		Username:       user.Username,
+		AvatarURL:      user.AvatarURL,
+		FollowerCount:  user.FollowerCount,
+		FollowingCount: user.FollowingCount,
 	}, nil
 }
+
+// viewerIDByUsername 当前用户ID（未登录或用户不存在时为0）
+func viewerIDByUsername(username string) uint {
+	if username == "" {
+		return 0
+	}
+	user, err := utils.GetUserByUsername(username)
+	if err != nil {
+		return 0
+	}
+	return user.ID
+}
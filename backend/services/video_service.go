@@ -3,12 +3,18 @@ package services
 import (
 	"backend/models"
 	"backend/utils"
+	"common/config"
 	"errors"
+	"fmt"
 	"log"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
 )
 
 // VideoService 视频服务层
@@ -26,17 +32,30 @@ var allowedVideoFormats = map[string]bool{
 // 文件大小限制（500MB）
 const MaxFileSize = 500 * 1024 * 1024
 
+// MaxDescriptionLength 视频描述最大长度（字符）
+const MaxDescriptionLength = 2000
+
+// hotVideoMaxScan 热门视频过滤不公开、私密视频时最多读取的榜单成员数
+const hotVideoMaxScan = 1000
+
+// ErrPlaybackForbidden 播放令牌无效或已过期（需要重新获取视频信息）
+var ErrPlaybackForbidden = errors.New("播放令牌无效或已过期")
+
 // UploadURLRequest 获取上传URL请求
 type UploadURLRequest struct {
 	Filename string `json:"filename" binding:"required"` // 原始文件名
 	Filesize int64  `json:"filesize" binding:"required"` // 文件大小（字节）
 	Title    string `json:"title"`                       // 视频标题（可选）
+	Description string   `json:"description"` // 视频描述（可选，其中的 #话题 会自动关联到视频）
+	Tags        []string `json:"tags"`        // 话题（可选，不需要带 #，与描述中的 #话题 合并，最多 10 个）
+	Visibility  string   `json:"visibility"`  // 可见性（可选，public/unlisted/private，默认 public）
 }
 
 // UploadURLResponse 获取上传URL响应
 type UploadURLResponse struct {
-	UploadURL string `json:"upload_url"` // 预签名上传URL
-	VideoID   uint   `json:"video_id"`   // 视频ID
+	UploadURL     string            `json:"upload_url"`     // 预签名上传URL
+	UploadHeaders map[string]string `json:"upload_headers"` // 上传时必须携带的请求头（参与签名，如 Content-Type）
+	VideoID       uint              `json:"video_id"`       // 视频ID
 }
 
 // ConfirmUploadRequest 确认上传完成请求
@@ -47,15 +66,37 @@ type ConfirmUploadRequest struct {
 // ConfirmUploadResponse 确认上传完成响应
 type ConfirmUploadResponse struct {
 	Success  bool   `json:"success"`   // 是否成功
-	VideoURL string `json:"video_url"` // 视频访问URL
+	VideoURL string `json:"video_url"` // 视频访问URL（预签名URL，有效期2小时）
+}
+
+// VisibilityRequest 修改视频可见性请求
+type VisibilityRequest struct {
+	Visibility string `json:"visibility" binding:"required"` // public/unlisted/private
+}
+
+// MultipartPart 待上传的分片
+type MultipartPart struct {
+	PartNumber int    `json:"part_number"` // 分片号（从1开始）
+	UploadURL  string `json:"upload_url"`  // 预签名上传URL（PUT，有效期1小时）
+}
+
+// MultipartUploadResponse 分片上传会话（发起和查询时返回）
+// 分片 n 对应文件的 [(n-1)*part_size, n*part_size) 字节，最后一个分片到文件末尾
+type MultipartUploadResponse struct {
+	VideoID       uint            `json:"video_id"`       // 视频ID
+	UploadID      string          `json:"upload_id"`      // 分片上传ID
+	PartSize      int64           `json:"part_size"`      // 分片大小（字节）
+	PartCount     int             `json:"part_count"`     // 分片数量
+	UploadedParts []int           `json:"uploaded_parts"` // 已上传完成的分片号
+	Parts         []MultipartPart `json:"parts"`          // 尚未上传的分片及其上传URL
+	ExpiresAt     time.Time       `json:"expires_at"`     // 超过该时间未完成将被自动中止
 }
 
-// VideoListResponse 视频列表响应
+// VideoListResponse 视频列表响应（游标分页）
 type VideoListResponse struct {
-	Videos   []utils.VideoListItem `json:"videos"`    // 视频列表
-	Total    int64                 `json:"total"`     // 总数
-	Page     int                   `json:"page"`      // 当前页
-	PageSize int                   `json:"page_size"` // 每页数量
+	Videos     []utils.VideoListItem `json:"videos"`          // 视频列表
+	NextCursor string                `json:"next_cursor"`     // 下一页游标，为空表示没有更多
+	Total      *int64                `json:"total,omitempty"` // 总数（仅在请求 with_total=true 时返回）
 }
 
 // GetUploadURL 获取上传凭证
@@ -68,27 +109,68 @@ func (s *VideoService) GetUploadURL(username string, req UploadURLRequest) (*Upl
 		return nil, errors.New("用户不存在")
 	}
 
+	// 1. 校验参数，生成视频记录（状态：上传中）
+	video, tags, err := newUploadVideo(user.ID, req, MaxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 生成预签名上传URL（文件大小和类型参与签名）
+	uploadURL, uploadHeaders, err := utils.GenerateUploadURL(video.FileName, video.FileSize)
+	if err != nil {
+		return nil, errors.New("生成上传URL失败")
+	}
+
+	// 3. 创建视频记录并关联话题
+	if err := utils.CreateVideoWithTags(video, tags); err != nil {
+		return nil, errors.New("创建视频记录失败")
+	}
+
+	return &UploadURLResponse{
+		UploadURL:     uploadURL,
+		UploadHeaders: uploadHeaders,
+		VideoID:       video.ID,
+	}, nil
+}
+
+// newUploadVideo 校验上传参数，生成待创建的视频记录（状态：上传中）和要关联的话题
+// 参数：上传者ID、请求参数、允许的最大文件大小（字节）
+func newUploadVideo(userID uint, req UploadURLRequest, maxSize int64) (*models.Video, []string, error) {
 	// 1. 验证文件格式
 	ext := strings.ToLower(filepath.Ext(req.Filename))
 	if !allowedVideoFormats[ext] {
-		return nil, errors.New("不支持的视频格式，仅支持 mp4, webm, mov, avi, mkv")
+		return nil, nil, errors.New("不支持的视频格式，仅支持 mp4, webm, mov, avi, mkv")
 	}
 
 	// 2. 验证文件大小
 	if req.Filesize <= 0 {
-		return nil, errors.New("文件大小无效")
+		return nil, nil, errors.New("文件大小无效")
 	}
-	if req.Filesize > MaxFileSize {
-		return nil, errors.New("文件大小超过限制（最大500MB）")
+	if req.Filesize > maxSize {
+		return nil, nil, fmt.Errorf("文件大小超过限制（最大%dMB）", maxSize>>20)
 	}
 
-	// 3. 生成唯一文件名：UUID + 原始扩展名
-	uniqueFilename := uuid.New().String() + ext
+	// 3. 校验描述和话题（显式指定的话题必须有效，与描述中的 #话题 合并去重）
+	if utf8.RuneCountInString(req.Description) > MaxDescriptionLength {
+		return nil, nil, fmt.Errorf("视频描述不能超过%d个字符", MaxDescriptionLength)
+	}
+	if len(req.Tags) > utils.MaxVideoTags {
+		return nil, nil, fmt.Errorf("话题最多%d个", utils.MaxVideoTags)
+	}
+	for _, tag := range req.Tags {
+		if _, ok := utils.NormalizeTag(tag); !ok {
+			return nil, nil, fmt.Errorf("无效的话题: %s", tag)
+		}
+	}
+	tags := utils.MergeTags(req.Tags, utils.ParseHashtags(req.Description))
 
-	// 4. 生成预签名上传URL
-	uploadURL, err := utils.GenerateUploadURL(uniqueFilename)
-	if err != nil {
-		return nil, errors.New("生成上传URL失败")
+	// 4. 校验可见性
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = models.VisibilityPublic
+	}
+	if !models.ValidVisibility(visibility) {
+		return nil, nil, errors.New("无效的可见性，可选值：public、unlisted、private")
 	}
 
 	// 5. 设置视频标题（如果未提供，使用原始文件名）
@@ -97,22 +179,16 @@ func (s *VideoService) GetUploadURL(username string, req UploadURLRequest) (*Upl
 		title = strings.TrimSuffix(req.Filename, ext)
 	}
 
-	// 6. 创建视频记录（状态：上传中）
-	video := &models.Video{
-		Title:    title,
-		UserID:   user.ID,
-		Status:   models.VideoStatusUploading,
-		FileName: uniqueFilename,
-	}
-
-	if err := utils.CreateVideo(video); err != nil {
-		return nil, errors.New("创建视频记录失败")
-	}
-
-	return &UploadURLResponse{
-		UploadURL: uploadURL,
-		VideoID:   video.ID,
-	}, nil
+	// 6. 生成唯一文件名：UUID + 原始扩展名
+	return &models.Video{
+		Title:       title,
+		Description: req.Description,
+		UserID:      userID,
+		Status:      models.VideoStatusUploading,
+		Visibility:  visibility,
+		FileName:    uuid.New().String() + ext,
+		FileSize:    req.Filesize,
+	}, tags, nil
 }
 
 // ConfirmUpload 确认上传完成
@@ -136,12 +212,26 @@ func (s *VideoService) ConfirmUpload(username string, req ConfirmUploadRequest)
 		return nil, errors.New("无权操作此视频")
 	}
 
-	// 3. 验证视频状态（只有"上传中"状态才能确认）
+	// 3. 已确认的视频（如上传完成事件已自动确认）直接返回成功，确认接口可以重复调用
+	if uploadConfirmed(video) {
+		return &ConfirmUploadResponse{
+			Success:  true,
+			VideoURL: utils.PresignObjectURL(video.FileName),
+		}, nil
+	}
+
+	// 4. 验证视频状态（只有"上传中"状态才能确认）
 	if video.Status != models.VideoStatusUploading {
 		return nil, errors.New("视频状态异常")
 	}
 
-	// 4. 检查文件是否真的上传到了MinIO
+	return confirmUploadedVideo(video)
+}
+
+// confirmUploadedVideo 确认上传中的视频：检查并校验文件，更新状态和URL并写入视频处理任务
+// 确认接口和上传完成事件共用；两者同时确认时只有一方更新成功，另一方同样返回成功
+func confirmUploadedVideo(video *models.Video) (*ConfirmUploadResponse, error) {
+	// 1. 检查文件是否真的上传到了MinIO
 	exists, err := utils.CheckFileExists(video.FileName)
 	if err != nil {
 		return nil, errors.New("检查文件失败")
@@ -150,108 +240,376 @@ func (s *VideoService) ConfirmUpload(username string, req ConfirmUploadRequest)
 		return nil, errors.New("文件未上传成功，请重新上传")
 	}
 
-	// 5. 生成永久视频访问URL
+	// 2. 校验文件大小和内容，未通过的文件和视频记录一并删除
+	if err := verifyUploadedVideo(video, uploadSizeLimit(video.ID)); err != nil {
+		return nil, err
+	}
+
+	// 3. 生成永久视频访问URL
 	videoURL, err := utils.GenerateDownloadURL(video.FileName)
 	if err != nil {
 		return nil, errors.New("生成视频URL失败")
 	}
 
-	// 6. 更新视频状态和URL
-	err = utils.UpdateVideo(video.ID, map[string]interface{}{
-		"status": models.VideoStatusUploaded,
-		"url":    videoURL,
-	})
+	// 4. 更新视频状态和URL，并在同一事务中写入视频处理任务（生成封面、转码）
+	// 任务由发件箱中继投递到 RabbitMQ，broker 暂时不可用时会自动重试
+	updated, err := utils.ConfirmVideoUpload(video.ID, videoURL, video.FileName)
 	if err != nil {
 		return nil, errors.New("更新视频状态失败")
 	}
+	if !updated {
+		// 期间已被另一方确认
+		if current, err := utils.GetVideoByID(video.ID); err != nil || !uploadConfirmed(current) {
+			return nil, errors.New("视频状态异常")
+		}
+	}
+
+	return &ConfirmUploadResponse{
+		Success:  true,
+		VideoURL: utils.PresignObjectURL(video.FileName),
+	}, nil
+}
+
+// uploadConfirmed 视频是否已确认上传（上传完成、转码中或已发布）
+func uploadConfirmed(video *models.Video) bool {
+	switch video.Status {
+	case models.VideoStatusUploaded, models.VideoStatusProcessing, models.VideoStatusPublished:
+		return true
+	}
+	return false
+}
+
+// InitiateMultipartUpload 发起分片上传（大文件、可断点续传）
+// 参数：用户名、请求参数（与 GetUploadURL 相同，文件大小上限为 upload.max_size_mb）
+// 返回：分片上传会话，包含每个分片的上传URL
+func (s *VideoService) InitiateMultipartUpload(username string, req UploadURLRequest) (*MultipartUploadResponse, error) {
+	user, err := utils.GetUserByUsername(username)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	// 1. 校验参数，生成视频记录（状态：上传中）
+	cfg := config.Conf.Upload
+	video, tags, err := newUploadVideo(user.ID, req, int64(cfg.MaxSizeMB)<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 在 MinIO 中发起分片上传
+	uploadID, err := utils.NewMultipartUpload(video.FileName)
+	if err != nil {
+		return nil, errors.New("发起分片上传失败")
+	}
+
+	// 3. 创建视频记录、关联话题并保存分片上传会话
+	partSize := int64(cfg.PartSizeMB) << 20
+	upload := &models.MultipartUpload{
+		UploadID:  uploadID,
+		FileSize:  req.Filesize,
+		PartSize:  partSize,
+		PartCount: int((req.Filesize + partSize - 1) / partSize),
+		Status:    models.MultipartStatusActive,
+		ExpiresAt: time.Now().Add(cfg.MultipartTTL),
+	}
+	if err := utils.CreateMultipartVideo(video, tags, upload); err != nil {
+		utils.AbortMultipartUpload(video.FileName, uploadID)
+		return nil, errors.New("创建视频记录失败")
+	}
 
-	// 7. 发送消息到 RabbitMQ 触发视频处理任务（生成封面）
-	err = utils.PublishVideoTask(video.ID, video.FileName)
+	// 4. 签发所有分片的上传URL
+	return buildMultipartResponse(video, upload, nil)
+}
+
+// GetMultipartUploadStatus 查询分片上传进度（断点续传）
+// 返回：已上传的分片号，以及未上传分片的新上传URL
+func (s *VideoService) GetMultipartUploadStatus(username string, videoID uint) (*MultipartUploadResponse, error) {
+	video, upload, err := activeMultipartUpload(username, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 以 MinIO 中实际存在的分片为准
+	parts, err := utils.ListUploadedParts(video.FileName, upload.UploadID)
 	if err != nil {
-		// 发送消息失败不影响视频上传成功，只记录日志
-		// 可以后续手动触发或通过定时任务重试
-		log.Printf("发送视频处理任务失败，video_service.go - ConfirmUpload函数")
-		return nil, errors.New("发送视频处理任务失败")
+		if errors.Is(err, utils.ErrUploadNotFound) {
+			return nil, errors.New("分片上传已失效，请重新上传")
+		}
+		return nil, errors.New("查询已上传分片失败")
+	}
+	return buildMultipartResponse(video, upload, parts)
+}
+
+// CompleteMultipartUpload 合并分片，完成上传
+// 所有分片都上传完成且大小正确时才合并，之后与 ConfirmUpload 相同：更新视频状态并写入视频处理任务
+func (s *VideoService) CompleteMultipartUpload(username string, videoID uint) (*ConfirmUploadResponse, error) {
+	video, upload, err := activeMultipartUpload(username, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. 从 MinIO 列出已上传的分片，检查是否齐全
+	parts, err := utils.ListUploadedParts(video.FileName, upload.UploadID)
+	if err != nil {
+		if errors.Is(err, utils.ErrUploadNotFound) {
+			return nil, errors.New("分片上传已失效，请重新上传")
+		}
+		return nil, errors.New("查询已上传分片失败")
+	}
+	byNumber := make(map[int]minio.ObjectPart, len(parts))
+	for _, part := range parts {
+		byNumber[part.PartNumber] = part
+	}
+	complete := make([]minio.ObjectPart, 0, upload.PartCount)
+	missing := 0
+	for n := 1; n <= upload.PartCount; n++ {
+		part, ok := byNumber[n]
+		if !ok {
+			missing++
+			continue
+		}
+		if part.Size != expectedPartSize(upload, n) {
+			return nil, fmt.Errorf("分片%d大小不正确，请重新上传该分片", n)
+		}
+		complete = append(complete, part)
+	}
+	if missing > 0 {
+		return nil, fmt.Errorf("还有%d个分片未上传", missing)
+	}
+
+	// 2. 标记会话为已合并（与取消、超时清理互斥），合并失败时恢复为上传中，客户端可以重试
+	claimed, err := utils.ClaimMultipartCompletion(upload.ID)
+	if err != nil {
+		return nil, errors.New("更新上传状态失败")
+	}
+	if !claimed {
+		return nil, errors.New("分片上传已完成、已取消或已过期")
+	}
+	if err := utils.CompleteMultipartUpload(video.FileName, upload.UploadID, complete); err != nil {
+		utils.SetMultipartUploadStatus(upload.ID, models.MultipartStatusCompleted, models.MultipartStatusActive)
+		if errors.Is(err, utils.ErrUploadNotFound) {
+			return nil, errors.New("分片上传已失效，请重新上传")
+		}
+		return nil, errors.New("合并分片失败")
+	}
+
+	// 3. 校验合并后的文件内容，未通过的文件和视频记录一并删除
+	if err := verifyUploadedVideo(video, int64(config.Conf.Upload.MaxSizeMB)<<20); err != nil {
+		return nil, err
+	}
+
+	// 4. 更新视频状态和URL，并在同一事务中写入视频处理任务
+	// 失败时文件已合并，客户端可以调用 /video/upload-complete 重新确认
+	videoURL, err := utils.GenerateDownloadURL(video.FileName)
+	if err != nil {
+		return nil, errors.New("生成视频URL失败")
+	}
+	updated, err := utils.ConfirmVideoUpload(video.ID, videoURL, video.FileName)
+	if err != nil {
+		return nil, errors.New("更新视频状态失败")
+	}
+	if !updated {
+		return nil, errors.New("视频状态异常")
 	}
 
 	return &ConfirmUploadResponse{
 		Success:  true,
-		VideoURL: videoURL,
+		VideoURL: utils.PresignObjectURL(video.FileName),
 	}, nil
 }
 
-// GetVideoList 获取视频列表
-// 参数：页码、每页数量、用户名（可选）
+// AbortMultipartUpload 取消分片上传：MinIO 删除已上传的分片，视频记录一并删除
+func (s *VideoService) AbortMultipartUpload(username string, videoID uint) error {
+	video, upload, err := activeMultipartUpload(username, videoID)
+	if err != nil {
+		return err
+	}
+
+	if err := utils.AbortMultipartUpload(video.FileName, upload.UploadID); err != nil {
+		return errors.New("取消分片上传失败")
+	}
+	aborted, err := utils.AbortMultipartVideo(upload, video.UserID)
+	if err != nil {
+		return errors.New("取消分片上传失败")
+	}
+	if !aborted {
+		return errors.New("分片上传已完成或已取消")
+	}
+	return nil
+}
+
+// activeMultipartUpload 获取当前用户进行中的分片上传（校验所有权、状态和有效期）
+func activeMultipartUpload(username string, videoID uint) (*models.Video, *models.MultipartUpload, error) {
+	user, err := utils.GetUserByUsername(username)
+	if err != nil {
+		return nil, nil, errors.New("用户不存在")
+	}
+	video, err := utils.GetVideoByID(videoID)
+	if err != nil {
+		return nil, nil, errors.New("视频不存在")
+	}
+	if video.UserID != user.ID {
+		return nil, nil, errors.New("无权操作此视频")
+	}
+	upload, err := utils.GetMultipartUpload(videoID)
+	if err != nil {
+		return nil, nil, errors.New("该视频不是分片上传")
+	}
+	if upload.Status != models.MultipartStatusActive || video.Status != models.VideoStatusUploading {
+		return nil, nil, errors.New("分片上传已完成或已取消")
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, nil, errors.New("分片上传已过期，请重新上传")
+	}
+	return video, upload, nil
+}
+
+// uploadSizeLimit 视频允许的最大文件大小：分片上传的视频为 upload.max_size_mb，单次上传为 MaxFileSize
+func uploadSizeLimit(videoID uint) int64 {
+	if _, err := utils.GetMultipartUpload(videoID); err == nil {
+		return int64(config.Conf.Upload.MaxSizeMB) << 20
+	}
+	return MaxFileSize
+}
+
+// verifyUploadedVideo 校验已上传的视频文件，未通过校验时删除文件和视频记录
+// 返回：未通过校验时返回原因，校验出错时返回通用错误（文件保留，客户端可以重试确认）
+func verifyUploadedVideo(video *models.Video, maxSize int64) error {
+	err := utils.VerifyUploadedFile(video.FileName, video.FileSize, maxSize)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, utils.ErrUploadRejected) {
+		log.Printf("校验视频 %d 的文件失败: %v", video.ID, err)
+		return errors.New("检查文件失败")
+	}
+	if _, rerr := utils.RejectVideoUpload(*video, video.UserID); rerr != nil {
+		log.Printf("删除未通过校验的视频 %d 失败: %v", video.ID, rerr)
+	}
+	return fmt.Errorf("%v，请重新上传", err)
+}
+
+// expectedPartSize 分片的应有大小（最后一个分片为剩余部分）
+func expectedPartSize(upload *models.MultipartUpload, partNumber int) int64 {
+	if partNumber < upload.PartCount {
+		return upload.PartSize
+	}
+	return upload.FileSize - upload.PartSize*int64(upload.PartCount-1)
+}
+
+// buildMultipartResponse 生成分片上传会话响应：大小正确的已上传分片跳过，其余分片签发新的上传URL
+func buildMultipartResponse(video *models.Video, upload *models.MultipartUpload, uploaded []minio.ObjectPart) (*MultipartUploadResponse, error) {
+	done := make(map[int]bool, len(uploaded))
+	for _, part := range uploaded {
+		if part.PartNumber <= upload.PartCount && part.Size == expectedPartSize(upload, part.PartNumber) {
+			done[part.PartNumber] = true
+		}
+	}
+
+	resp := &MultipartUploadResponse{
+		VideoID:       video.ID,
+		UploadID:      upload.UploadID,
+		PartSize:      upload.PartSize,
+		PartCount:     upload.PartCount,
+		UploadedParts: []int{},
+		Parts:         []MultipartPart{},
+		ExpiresAt:     upload.ExpiresAt,
+	}
+	for n := 1; n <= upload.PartCount; n++ {
+		if done[n] {
+			resp.UploadedParts = append(resp.UploadedParts, n)
+			continue
+		}
+		partURL, err := utils.GeneratePartUploadURL(video.FileName, upload.UploadID, n, expectedPartSize(upload, n))
+		if err != nil {
+			return nil, errors.New("生成上传URL失败")
+		}
+		resp.Parts = append(resp.Parts, MultipartPart{PartNumber: n, UploadURL: partURL})
+	}
+	return resp, nil
+}
+
+// GetVideoList 获取视频列表（按发布时间倒序，游标分页）
+// 参数：游标（第一页为空）、每页数量、是否返回总数、用户名（可选）
 // 返回：视频列表响应
-func (s *VideoService) GetVideoList(page, pageSize int, username string) (*VideoListResponse, error) {
+func (s *VideoService) GetVideoList(cursorStr string, pageSize int, withTotal bool, username string) (*VideoListResponse, error) {
 	// 限制每页数量
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 || pageSize > 50 {
-		pageSize = 12
+	pageSize = normalizeVideoPageSize(pageSize)
+	cursor, err := utils.DecodeCursor(cursorStr)
+	if err != nil {
+		return nil, err
 	}
 
+	// 如果用户已登录，获取当前用户ID（用于可见性过滤和点赞状态）
+	viewerID := viewerIDByUsername(username)
+
 	// 调用工具层获取视频列表
-	videos, total, err := utils.GetVideoList(page, pageSize)
+	videos, nextCursor, err := utils.GetVideoList(cursor, pageSize, viewerID)
 	if err != nil {
 		return nil, errors.New("获取视频列表失败")
 	}
 
 	// 如果用户已登录，查询点赞状态
-	if username != "" {
-		// 获取用户信息
-		user, err := utils.GetUserByUsername(username)
-		if err == nil {
-			// 获取当前用户点赞的所有视频ID
-			likedVideoIDs, err := utils.GetUserLikedVideoIDs(user.ID)
-			if err == nil {
-				// 为每个视频设置 is_liked 字段
-				likedMap := make(map[uint]bool)
-				for _, videoID := range likedVideoIDs {
-					likedMap[videoID] = true
-				}
-
-				// 更新视频列表的 is_liked 字段
-				for i := range videos {
-					videos[i].IsLiked = likedMap[videos[i].ID]
-				}
-			}
+	fillIsLiked(videos, viewerID)
+
+	resp := &VideoListResponse{
+		Videos:     videos,
+		NextCursor: nextCursor,
+	}
+
+	// 总数需要额外的 COUNT 查询，只在客户端需要时计算
+	if withTotal {
+		total, err := utils.GetVisibleVideoCount(viewerID)
+		if err != nil {
+			return nil, errors.New("获取视频总数失败")
 		}
+		resp.Total = &total
 	}
 
-	return &VideoListResponse{
-		Videos:   videos,
-		Total:    total,
-		Page:     page,
-		PageSize: pageSize,
-	}, nil
+	return resp, nil
 }
 
-// GetUserVideoList	获取某个用户的视频列表
-// 参数：页码、每页数量、用户ID
-// 返回：视频列表响应
-func (s *VideoService) GetUserVideoList(page, pageSize int, userID uint) (*VideoListResponse, error) {
+// GetUserVideoList	获取某个用户的视频列表（按发布时间倒序，游标分页）
+// 参数：游标（第一页为空）、每页数量、是否返回总数、用户ID、当前用户名
+// 返回：视频列表响应（作者本人查看时包含未发布的视频及其状态）
+func (s *VideoService) GetUserVideoList(cursorStr string, pageSize int, withTotal bool, userID uint, username string) (*VideoListResponse, error) {
 	// 限制每页数量
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 || pageSize > 50 {
-		pageSize = 12
+	pageSize = normalizeVideoPageSize(pageSize)
+	cursor, err := utils.DecodeCursor(cursorStr)
+	if err != nil {
+		return nil, err
 	}
 
+	// 获取当前用户ID（用于可见性过滤）
+	viewerID := viewerIDByUsername(username)
+
 	// 调用工具层获取某个用户的视频列表
-	videos, total, err := utils.GetUserVideoList(userID, page, pageSize)
+	videos, nextCursor, err := utils.GetUserVideoList(userID, cursor, pageSize, viewerID)
 	if err != nil {
 		return nil, errors.New("获取用户视频列表失败")
 	}
 
-	return &VideoListResponse{
-		Videos:   videos,
-		Total:    total,
-		Page:     page,
-		PageSize: pageSize,
-	}, nil
+	resp := &VideoListResponse{
+		Videos:     videos,
+		NextCursor: nextCursor,
+	}
+
+	if withTotal {
+		total, err := utils.GetUserVideoCount(userID, viewerID)
+		if err != nil {
+			return nil, errors.New("获取用户视频总数失败")
+		}
+		resp.Total = &total
+	}
+
+	return resp, nil
+}
+
+// normalizeVideoPageSize 限制视频列表每页数量
+func normalizeVideoPageSize(pageSize int) int {
+	if pageSize < 1 || pageSize > 50 {
+		pageSize = 12
+	}
+	return pageSize
 }
 
 // DeleteUserVideos 删除某个用户的视频列表
@@ -278,57 +636,174 @@ func (s *VideoService) DeleteUserVideos(username string, videoids []uint) error
 	return nil
 }
 
-// GetHotVideos 获取热门视频列表（按点赞数排序）
-// 参数：数量限制、用户名（可选）
+// GetHotVideos 获取热门视频列表
+// 参数：时间窗口（24h / 7d 按时间衰减的热度排序，all 按点赞总数排序）、数量限制、用户名（可选）
 // 返回：视频列表响应
-func (s *VideoService) GetHotVideos(limit int, username string) (*VideoListResponse, error) {
-	// 从 Redis 获取热门视频ID列表（按点赞数降序）
-	videoIDs, err := utils.GetTopLikedVideos(limit)
-	if err != nil {
-		return nil, errors.New("获取热门视频失败")
+func (s *VideoService) GetHotVideos(window string, limit int, username string) (*VideoListResponse, error) {
+	if !utils.IsValidTrendingWindow(window) {
+		return nil, errors.New("无效的时间窗口，可选值：24h、7d、all")
 	}
 
-	if len(videoIDs) == 0 {
-		// 没有热门视频，返回空列表
-		return &VideoListResponse{
-			Videos:   []utils.VideoListItem{},
-			Total:    0,
-			Page:     1,
-			PageSize: limit,
-		}, nil
+	// 从 Redis 按热度降序分批读取榜单，只保留已发布的公开视频，直到凑满 limit 个：
+	// 不公开、私密的视频仍留在榜单中（点赞排行榜同时保存视频的点赞数，不能移除），
+	// 每批多读一些，最多读取 hotVideoMaxScan 个成员
+	videos := make([]utils.VideoListItem, 0, limit)
+	seen := make(map[uint]bool, limit)
+	batch := limit * 2
+	for offset := 0; len(videos) < limit && offset < hotVideoMaxScan; offset += batch {
+		videoIDs, err := utils.GetTrendingVideoIDs(window, offset, batch)
+		if err != nil {
+			return nil, errors.New("获取热门视频失败")
+		}
+		if len(videoIDs) == 0 {
+			break
+		}
+
+		// 从 MySQL 批量查询视频详情（不公开、私密、已删除的视频被过滤）
+		items, err := utils.GetVideosByIDs(videoIDs, 0)
+		if err != nil {
+			return nil, errors.New("获取视频详情失败")
+		}
+		for _, item := range items {
+			// 分批读取期间榜单缓存可能重新计算，排名变化时跳过已经取到的视频
+			if len(videos) < limit && !seen[item.ID] {
+				seen[item.ID] = true
+				videos = append(videos, item)
+			}
+		}
+		if len(videoIDs) < batch {
+			break
+		}
 	}
 
-	// 从 MySQL 批量查询视频详情
-	videos, err := utils.GetVideosByIDs(videoIDs)
+	// 如果用户已登录，查询点赞状态
+	fillIsLiked(videos, viewerIDByUsername(username))
+
+	return &VideoListResponse{
+		Videos: videos,
+	}, nil
+}
+
+// GetFollowingFeed 获取关注的创作者发布的视频（按发布时间倒序）
+// 参数：当前用户名、游标（第一页为空）、每页数量
+// 返回：视频列表和下一页游标
+func (s *VideoService) GetFollowingFeed(username, cursorStr string, pageSize int) (*VideoListResponse, error) {
+	pageSize = normalizeVideoPageSize(pageSize)
+	cursor, err := utils.DecodeCursor(cursorStr)
 	if err != nil {
-		return nil, errors.New("获取视频详情失败")
+		return nil, err
 	}
 
-	// 如果用户已登录，查询点赞状态
-	if username != "" {
-		user, err := utils.GetUserByUsername(username)
-		if err == nil {
-			// 获取当前用户点赞的所有视频ID
-			likedVideoIDs, err := utils.GetUserLikedVideoIDs(user.ID)
-			if err == nil {
-				// 为每个视频设置 is_liked 字段
-				likedMap := make(map[uint]bool)
-				for _, videoID := range likedVideoIDs {
-					likedMap[videoID] = true
-				}
-
-				// 更新视频列表的 is_liked 字段
-				for i := range videos {
-					videos[i].IsLiked = likedMap[videos[i].ID]
-				}
-			}
-		}
+	viewerID := viewerIDByUsername(username)
+	if viewerID == 0 {
+		return nil, errors.New("用户不存在")
 	}
 
+	videos, nextCursor, err := utils.GetFollowingFeed(viewerID, cursor, pageSize)
+	if err != nil {
+		return nil, errors.New("获取关注动态失败")
+	}
+
+	// 查询点赞状态
+	fillIsLiked(videos, viewerID)
+
 	return &VideoListResponse{
-		Videos:   videos,
-		Total:    int64(len(videos)),
-		Page:     1,
-		PageSize: limit,
+		Videos:     videos,
+		NextCursor: nextCursor,
 	}, nil
 }
+
+// GetVideoDetail 获取视频详情（不公开的视频只能通过这里访问）
+// 参数：视频ID、当前用户名（可选，用于可见性检查和点赞状态）
+func (s *VideoService) GetVideoDetail(videoID uint, username string) (*utils.VideoListItem, error) {
+	viewerID := viewerIDByUsername(username)
+	video, err := utils.GetVideoItem(videoID, viewerID)
+	if err != nil {
+		return nil, errors.New("视频不存在")
+	}
+
+	// 查询点赞状态
+	videos := []utils.VideoListItem{*video}
+	fillIsLiked(videos, viewerID)
+	return &videos[0], nil
+}
+
+// SetVideoVisibility 修改视频的可见性（只有作者本人可以修改），立即生效：
+// 视频地址都是按请求签发的短期URL，改为私密后其他用户拿到的地址最多在有效期（2小时）内继续可用
+func (s *VideoService) SetVideoVisibility(username string, videoID uint, req VisibilityRequest) error {
+	if !models.ValidVisibility(req.Visibility) {
+		return errors.New("无效的可见性，可选值：public、unlisted、private")
+	}
+
+	user, err := utils.GetUserByUsername(username)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+	video, err := utils.GetVideoByID(videoID)
+	if err != nil {
+		return errors.New("视频不存在")
+	}
+	if video.UserID != user.ID {
+		return errors.New("无权操作此视频")
+	}
+
+	if err := utils.UpdateVideoVisibility(video.ID, req.Visibility); err != nil {
+		return errors.New("修改可见性失败")
+	}
+	return nil
+}
+
+// GetHLSPlaylist 获取改写后的 HLS 播放列表（见 utils.RenderHLSPlaylist）
+// 参数：视频ID、播放列表相对 HLS 目录的路径、播放令牌（返回视频信息时签发）
+func (s *VideoService) GetHLSPlaylist(videoID uint, name, token string) ([]byte, error) {
+	if err := utils.ValidatePlaybackToken(token, videoID); err != nil {
+		return nil, ErrPlaybackForbidden
+	}
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || strings.HasPrefix(name, "..") || path.Ext(name) != ".m3u8" {
+		return nil, utils.ErrPlaylistNotFound
+	}
+
+	video, err := utils.GetVideoByID(videoID)
+	if err != nil || video.HLSURL == "" {
+		return nil, utils.ErrPlaylistNotFound
+	}
+	playlist, err := utils.RenderHLSPlaylist(video, name, token)
+	if err != nil {
+		if errors.Is(err, utils.ErrPlaylistNotFound) {
+			return nil, err
+		}
+		log.Printf("读取视频 %d 的播放列表 %s 失败: %v", video.ID, name, err)
+		return nil, errors.New("读取播放列表失败")
+	}
+	return playlist, nil
+}
+
+// viewableVideo 查询当前用户可以观看的视频（评论、点赞等操作前检查），无权观看时同样返回"视频不存在"
+func viewableVideo(videoID, viewerID uint) (*models.Video, error) {
+	video, err := utils.GetVideoByID(videoID)
+	if err != nil || !utils.CanViewVideo(video, viewerID) {
+		return nil, errors.New("视频不存在")
+	}
+	return video, nil
+}
+
+// fillIsLiked 为视频列表设置当前用户的点赞状态（未登录时不处理）
+func fillIsLiked(videos []utils.VideoListItem, viewerID uint) {
+	if viewerID == 0 || len(videos) == 0 {
+		return
+	}
+
+	// 只查询当前页视频的点赞状态（Redis 点赞集合，与点赞接口一致）
+	ids := make([]uint, 0, len(videos))
+	for _, v := range videos {
+		ids = append(ids, v.ID)
+	}
+	likedMap, err := utils.GetUserLikedVideoSet(viewerID, ids)
+	if err != nil {
+		return
+	}
+	for i := range videos {
+		videos[i].IsLiked = likedMap[videos[i].ID]
+	}
+}
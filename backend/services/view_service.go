@@ -0,0 +1,83 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"fmt"
+)
+
+// ViewService 播放量统计服务层（计数方式见 utils/views.go）
+type ViewService struct{}
+
+// 观看事件类型
+const (
+	WatchEventStart    = "start"    // 开始播放
+	WatchEventProgress = "progress" // 播放进度心跳
+	WatchEventComplete = "complete" // 播放到结尾
+)
+
+// WatchRequest 观看事件请求参数
+type WatchRequest struct {
+	Event     string  `json:"event" binding:"required,oneof=start progress complete"` // 事件类型
+	SessionID string  `json:"session_id" binding:"max=64"`                            // 播放器会话ID（未登录时必填，用于去重）
+	Position  float64 `json:"position" binding:"min=0"`                               // 当前播放进度（秒）
+}
+
+// WatchResponse 观看事件响应
+type WatchResponse struct {
+	Message string `json:"message"`
+	Counted bool   `json:"counted"` // 是否计为一次新的播放
+}
+
+// RecordWatch 记录一次观看事件
+// 同一用户（未登录时为同一会话）在 view.dedup_window 内的多次事件只计一次播放
+// 参数：当前用户名（未登录为空）、视频ID、事件
+func (s *ViewService) RecordWatch(username string, videoID uint, req WatchRequest) (*WatchResponse, error) {
+	// 1. 确定观看者：登录用户按用户去重，未登录按播放器会话去重
+	var viewer string
+	var viewerID uint
+	if username != "" {
+		user, err := utils.GetUserByUsername(username)
+		if err != nil {
+			return nil, errors.New("用户不存在")
+		}
+		viewerID = user.ID
+		viewer = fmt.Sprintf("u:%d", user.ID)
+	} else {
+		if req.SessionID == "" {
+			return nil, errors.New("未登录时需要提供 session_id")
+		}
+		viewer = "s:" + req.SessionID
+	}
+
+	// 2. 没有进行中的播放时才查询视频（心跳事件不查 MySQL）
+	exists, err := utils.WatchStateExists(videoID, viewer)
+	if err != nil {
+		return nil, fmt.Errorf("查询观看状态失败: %v", err)
+	}
+	duration := 0.0
+	if !exists {
+		video, err := utils.GetVideoByID(videoID)
+		if err != nil || video.Status != models.VideoStatusPublished || !utils.CanViewVideo(video, viewerID) {
+			return nil, errors.New("视频不存在")
+		}
+		duration = video.Duration
+	}
+
+	// 3. 记录事件（新的播放计数、完播比例均在 Redis 中聚合，定时经 MQ 落库）
+	counted, err := utils.RecordWatchEvent(videoID, viewer, duration, req.Position, req.Event == WatchEventComplete)
+	if err != nil {
+		return nil, fmt.Errorf("记录观看事件失败: %v", err)
+	}
+
+	// 4. 新的播放计入视频热度
+	if counted {
+		recordTrending(videoID, utils.TrendingWeightView)
+	}
+
+	return &WatchResponse{
+		Message: "已记录",
+		Counted: counted,
+	}, nil
+}
@@ -2,7 +2,7 @@ package utils
 
 import (
 	"context"
-	"backend/config"
+	"common/config"
 	"fmt"
 )
 
@@ -13,7 +13,7 @@ import (
 // key 组织：
 //   bf:randomfeed:<userID>:<YYYYMMDD>
 func bloomKey(userID uint, dayKey string) string {
-	return fmt.Sprintf("%s%d:%s", config.BloomRandomFeedKeyPrefix, userID, dayKey)
+	return fmt.Sprintf("%s%d:%s", config.Conf.Bloom.KeyPrefix, userID, dayKey)
 }
 
 func fnv1a64(s string) uint64 {
@@ -33,12 +33,13 @@ func bloomIndexes(key string) []uint32 {
 	h1 := fnv1a64(key)
 	h2 := fnv1a64(key + "|salt")
 
-	m := uint32(config.BloomRandomFeedBitsM)
+	m := config.Conf.Bloom.BitsM
 	if m == 0 {
 		m = 1
 	}
-	idxs := make([]uint32, config.BloomRandomFeedHashK)
-	for i := 0; i < config.BloomRandomFeedHashK; i++ {
+	k := config.Conf.Bloom.HashK
+	idxs := make([]uint32, k)
+	for i := 0; i < k; i++ {
 		// 避免溢出：使用 uint64 再取模
 		idx := (uint64(h1) + uint64(i)*uint64(h2)) % uint64(m)
 		idxs[i] = uint32(idx)
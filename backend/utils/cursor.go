@@ -0,0 +1,111 @@
+package utils
+
+// 游标分页
+//
+// 按 created_at DESC, id DESC 排序的列表使用 (created_at, id) 作为游标：
+// 下一页只取位置在游标之后的记录，翻页过程中有新数据插入也不会重复或遗漏。
+// 按分数排序的列表（如评论按点赞数“最热”）使用 (score, id) 作为游标，分数在翻页过程中
+// 发生变化时可能出现少量重复或遗漏。
+// 游标对客户端不透明（base64 编码），客户端只需把上一页返回的 next_cursor 原样传回。
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor 游标格式错误
+var ErrInvalidCursor = errors.New("无效的游标")
+
+// Cursor 列表游标：上一页最后一条记录的创建时间（或分数）和ID
+type Cursor struct {
+	CreatedAt time.Time
+	Score     int64
+	ID        uint
+}
+
+// EncodeCursor 生成游标字符串
+func EncodeCursor(createdAt time.Time, id uint) string {
+	return encodeCursor(createdAt.UnixMicro(), 0, id)
+}
+
+// EncodeScoreCursor 生成按分数排序的列表的游标字符串
+func EncodeScoreCursor(score int64, id uint) string {
+	return encodeCursor(0, score, id)
+}
+
+func encodeCursor(micro, score int64, id uint) string {
+	raw := fmt.Sprintf("%d:%d:%d", micro, score, id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor 解析游标字符串，空字符串表示第一页（返回 nil）
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var micro, score int64
+	var id uint
+	if _, err := fmt.Sscanf(string(raw), "%d:%d:%d", &micro, &score, &id); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: time.UnixMicro(micro), Score: score, ID: id}, nil
+}
+
+// cursorScope 取游标之后的记录（table 为排序字段所在的表名）
+func cursorScope(table string, cursor *Cursor) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if cursor == nil {
+			return tx
+		}
+		return tx.Where(
+			fmt.Sprintf("(%[1]s.created_at < ? OR (%[1]s.created_at = ? AND %[1]s.id < ?))", table),
+			cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+}
+
+// cursorOrder 与 cursorScope 配套的排序
+func cursorOrder(table string) string {
+	return fmt.Sprintf("%[1]s.created_at DESC, %[1]s.id DESC", table)
+}
+
+// cursorScopeAsc 正序列表（created_at ASC, id ASC）取游标之后的记录
+func cursorScopeAsc(table string, cursor *Cursor) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if cursor == nil {
+			return tx
+		}
+		return tx.Where(
+			fmt.Sprintf("(%[1]s.created_at > ? OR (%[1]s.created_at = ? AND %[1]s.id > ?))", table),
+			cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+}
+
+// cursorOrderAsc 与 cursorScopeAsc 配套的排序
+func cursorOrderAsc(table string) string {
+	return fmt.Sprintf("%[1]s.created_at ASC, %[1]s.id ASC", table)
+}
+
+// scoreCursorScope 按分数倒序的列表取游标之后的记录（column 为分数列）
+func scoreCursorScope(table, column string, cursor *Cursor) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if cursor == nil {
+			return tx
+		}
+		return tx.Where(
+			fmt.Sprintf("(%[1]s.%[2]s < ? OR (%[1]s.%[2]s = ? AND %[1]s.id < ?))", table, column),
+			cursor.Score, cursor.Score, cursor.ID)
+	}
+}
+
+// scoreCursorOrder 与 scoreCursorScope 配套的排序
+func scoreCursorOrder(table, column string) string {
+	return fmt.Sprintf("%[1]s.%[2]s DESC, %[1]s.id DESC", table, column)
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	createdAt := time.UnixMicro(1_700_000_000_123_456)
+	enc := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name    string
+		in      string
+		want    *Cursor
+		wantErr bool
+	}{
+		{name: "空字符串表示第一页", in: "", want: nil},
+		{name: "时间游标往返", in: EncodeCursor(createdAt, 42), want: &Cursor{CreatedAt: createdAt, ID: 42}},
+		{name: "分数游标往返", in: EncodeScoreCursor(15, 7), want: &Cursor{CreatedAt: time.UnixMicro(0), Score: 15, ID: 7}},
+		{name: "非 base64", in: "!!!", wantErr: true},
+		{name: "带填充的 base64", in: base64.URLEncoding.EncodeToString([]byte("1:0:1")), wantErr: true},
+		{name: "字段缺失", in: enc("1700000000:5"), wantErr: true},
+		{name: "字段不是数字", in: enc("a:b:c"), wantErr: true},
+		{name: "负数ID", in: enc("1:0:-1"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCursor(tt.in)
+			if tt.wantErr {
+				if err != ErrInvalidCursor {
+					t.Fatalf("DecodeCursor(%q) err = %v, want ErrInvalidCursor", tt.in, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeCursor(%q) err = %v", tt.in, err)
+			}
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("DecodeCursor(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+			if got != nil && (!got.CreatedAt.Equal(tt.want.CreatedAt) || got.Score != tt.want.Score || got.ID != tt.want.ID) {
+				t.Errorf("DecodeCursor(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,29 +1,33 @@
 package utils
 
 import (
+	"common/config"
 	"github.com/golang-jwt/jwt/v5"
 	"time"
 )
 
-// JWT密钥，用于签名和验证令牌
-// 生产环境应该使用环境变量或配置文件管理
-var secretKey = []byte("cwatch-secret-key-2026")
+// secretKey JWT密钥，用于签名和验证令牌（来自配置 jwt.secret）
+func secretKey() []byte {
+	return []byte(config.Conf.JWT.Secret)
+}
 
 // MyClaims 自定义JWT声明
 type MyClaims struct {
-	Username string `json:"username"` // 用户名
-	jwt.RegisteredClaims            // 标准声明（过期时间、签发者等）
+	Username  string `json:"username"` // 用户名
+	SessionID string `json:"sid"`      // 登录会话ID，会话被撤销后令牌立即失效
+	jwt.RegisteredClaims               // 标准声明（过期时间、签发者等）
 }
 
-// GenerateJWT 生成JWT令牌
-// 参数：用户名
+// GenerateJWT 生成访问令牌（短期有效，过期后用刷新令牌换取新的访问令牌）
+// 参数：用户名、会话ID
 // 返回：JWT令牌字符串和错误
-func GenerateJWT(username string) (string, error) {
+func GenerateJWT(username, sessionID string) (string, error) {
 	// 创建声明
 	claims := MyClaims{
-		Username: username,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),      // 令牌24h后过期
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.Conf.JWT.TTL)), // 令牌过期时间（配置 jwt.ttl）
 			IssuedAt:  jwt.NewNumericDate(time.Now()),                          // 签发时间
 			Issuer:    "cwatch",                                                 // 签发者
 		},
@@ -33,7 +37,7 @@ func GenerateJWT(username string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// 使用密钥签名生成最终的令牌字符串
-	return token.SignedString(secretKey)
+	return token.SignedString(secretKey())
 }
 
 // ValidateJWT 验证JWT令牌
@@ -44,7 +48,7 @@ func ValidateJWT(tokenString string) (*MyClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &MyClaims{},
 		func(token *jwt.Token) (interface{}, error) {
 			// 返回用于验证的密钥
-			return secretKey, nil
+			return secretKey(), nil
 		})
 
 	// 检查解析是否出错
@@ -66,3 +70,46 @@ func ValidateJWT(tokenString string) (*MyClaims, error) {
 	// 返回解析成功的声明数据
 	return claims, nil
 }
+
+// playbackAudience HLS 播放令牌的受众（与访问令牌区分，播放令牌不能用于调用其他接口）
+const playbackAudience = "playback"
+
+// PlaybackClaims HLS 播放令牌声明（绑定视频，只签发给有权观看该视频的用户）
+type PlaybackClaims struct {
+	VideoID              uint `json:"vid"` // 视频ID
+	jwt.RegisteredClaims      // 标准声明（过期时间、受众等）
+}
+
+// GeneratePlaybackToken 生成 HLS 播放令牌（有效期与预签名URL相同）
+// 参数：视频ID
+// 返回：令牌字符串和错误
+func GeneratePlaybackToken(videoID uint) (string, error) {
+	claims := PlaybackClaims{
+		VideoID: videoID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(PlaybackURLExpiry)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "cwatch",
+			Audience:  jwt.ClaimStrings{playbackAudience},
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secretKey())
+}
+
+// ValidatePlaybackToken 验证 HLS 播放令牌是否有效且属于该视频
+func ValidatePlaybackToken(tokenString string, videoID uint) error {
+	claims := &PlaybackClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return secretKey(), nil
+		},
+		jwt.WithAudience(playbackAudience),
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return err
+	}
+	if claims.VideoID != videoID {
+		return jwt.ErrTokenInvalidClaims
+	}
+	return nil
+}
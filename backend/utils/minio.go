@@ -1,15 +1,19 @@
 package utils
 
 import (
-	"backend/config"
+	"common/config"
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
 
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/notification"
 )
 
 var mc *minio.Client
@@ -19,17 +23,22 @@ const (
 	MinioBucket       = "cwatch"             // 存储桶名称
 	UploadURLExpiry   = 15 * time.Minute     // 上传URL有效期
 	DownloadURLExpiry = 24 * time.Hour       // 下载URL有效期
+	PlaybackURLExpiry = 2 * time.Hour        // 播放URL（视频、封面、HLS 切片的预签名URL，以及 HLS 播放令牌）有效期
+	HLSPrefix         = "hls/"               // HLS 文件的前缀：hls/<视频文件名（不含扩展名）>/...（由 worker 上传）
+
+	UploadConfirmLockPrefix = "lock:upload:confirm:" // 上传完成事件自动确认视频的锁（多实例都会收到同一个事件，只由一个实例确认）
 )
 
+// PublicObjectKeys 允许匿名读取的对象（存储桶其余文件都是私有的）
+var PublicObjectKeys = []string{"c.png"} // 默认头像（models.GetDefaultAvatarURL）
+
 // InitMinIO 初始化MinIO
 func InitMinIO() error {
-	// 构建 MinIO 服务地址
-	minioEndpoint := fmt.Sprintf("%s:%s", config.MinIOHost, config.MinIOPort)
-	
 	// 创建 MinIO 客户端实例
-	client, err := minio.New(minioEndpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(config.MinIOAccessKey, config.MinIOSecretKey, ""),
-		Secure: false,
+	cfg := config.Conf.MinIO
+	client, err := minio.New(cfg.Endpoint(), &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
 	})
 	if err != nil {
 		return err
@@ -53,7 +62,12 @@ func InitMinIO() error {
 		log.Printf("MinIO 存储桶 '%s' 创建成功", MinioBucket)
 	}
 
-	// 设置存储桶策略为公开读取（允许匿名下载）
+	// 设置存储桶策略：只有公开资源（默认头像）允许匿名读取，视频、封面、HLS 文件都需要预签名URL（见 PresignObjectURL）
+	// 覆盖旧版本设置的整个存储桶公开读取策略，之前返回给客户端的永久URL随之失效
+	resources := make([]string, len(PublicObjectKeys))
+	for i, key := range PublicObjectKeys {
+		resources[i] = fmt.Sprintf("%q", fmt.Sprintf("arn:aws:s3:::%s/%s", MinioBucket, key))
+	}
 	policy := fmt.Sprintf(`{
 		"Version": "2012-10-17",
 		"Statement": [
@@ -61,17 +75,17 @@ func InitMinIO() error {
 				"Effect": "Allow",
 				"Principal": {"AWS": ["*"]},
 				"Action": ["s3:GetObject"],
-				"Resource": ["arn:aws:s3:::%s/*"]
+				"Resource": [%s]
 			}
 		]
-	}`, MinioBucket)
+	}`, strings.Join(resources, ", "))
 
 	err = mc.SetBucketPolicy(ctx, MinioBucket, policy)
 	if err != nil {
-		log.Printf("设置存储桶公开策略失败: %v", err)
+		log.Printf("设置存储桶策略失败: %v", err)
 		// 不返回错误，因为这不是致命错误
 	} else {
-		log.Printf("存储桶 '%s' 已设置为公开读取", MinioBucket)
+		log.Printf("存储桶 '%s' 已设置为私有（公开资源: %s）", MinioBucket, strings.Join(PublicObjectKeys, ", "))
 	}
 
 	log.Println("MinIO 连接成功")
@@ -79,28 +93,35 @@ func InitMinIO() error {
 }
 
 // GenerateUploadURL 生成预签名上传URL
-// 参数：文件名（应该是UUID生成的唯一文件名）
-// 返回：预签名URL和错误
-func GenerateUploadURL(filename string) (string, error) {
+// 参数：文件名（应该是UUID生成的唯一文件名）、声明的文件大小（字节）
+// 返回：预签名URL、上传时必须携带的请求头和错误
+// Content-Type 和 Content-Length 参与签名，上传的文件大小或类型与声明不一致时 MinIO 拒绝上传（签名不匹配）
+// Content-Length 由浏览器按实际文件大小自动设置，因此只需要返回 Content-Type
+func GenerateUploadURL(filename string, size int64) (string, map[string]string, error) {
 	ctx := context.Background()
 
+	contentType := VideoContentType(filename)
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Length", strconv.FormatInt(size, 10))
+
 	// 生成预签名PUT URL
-	presignedURL, err := mc.PresignedPutObject(ctx, MinioBucket, filename, UploadURLExpiry)
+	presignedURL, err := mc.PresignHeader(ctx, http.MethodPut, MinioBucket, filename, UploadURLExpiry, nil, headers)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return presignedURL.String(), nil
+	return presignedURL.String(), map[string]string{"Content-Type": contentType}, nil
 }
 
 // GenerateDownloadURL 生成永久下载URL
 // 参数：文件名
 // 返回：永久URL和错误
+// 存储桶是私有的，永久URL只保存在数据库中作为文件的标识，返回给客户端前需要换成预签名URL（见 PresignURL）
 func GenerateDownloadURL(filename string) (string, error) {
 	// 方案1：生成永久的公开URL（推荐用于视频播放）
 	// 格式：http://minio-server:port/bucket-name/filename
-	minioEndpoint := fmt.Sprintf("%s:%s", config.MinIOHost, config.MinIOPort)
-	permanentURL := fmt.Sprintf("http://%s/%s/%s", minioEndpoint, MinioBucket, filename)
+	permanentURL := fmt.Sprintf("%s/%s/%s", config.Conf.MinIO.BaseURL(), MinioBucket, filename)
 	return permanentURL, nil
 	
 	// 方案2：如果需要预签名URL，可以设置更长的过期时间
@@ -114,6 +135,39 @@ func GenerateDownloadURL(filename string) (string, error) {
 	// return presignedURL.String(), nil
 }
 
+// PresignObjectURL 生成对象的预签名下载URL（有效期 PlaybackURLExpiry），签名失败时返回空字符串
+// 只在本地计算签名，不访问 MinIO（存储桶所在区域第一次查询后会缓存）
+func PresignObjectURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	u, err := mc.PresignedGetObject(context.Background(), MinioBucket, key, PlaybackURLExpiry, nil)
+	if err != nil {
+		log.Printf("生成 %s 的预签名URL失败: %v", key, err)
+		return ""
+	}
+	return u.String()
+}
+
+// PresignURL 把数据库中保存的永久URL（GenerateDownloadURL 生成）换成预签名URL
+// 不是本存储桶的URL（如外部地址）原样返回
+func PresignURL(storedURL string) string {
+	key := ObjectKeyFromURL(storedURL)
+	if key == "" {
+		return storedURL
+	}
+	return PresignObjectURL(key)
+}
+
+// ObjectKeyFromURL 从永久URL中取出对象名（<MinIO 地址>/<存储桶>/<对象名>），不是本存储桶的URL时返回空字符串
+func ObjectKeyFromURL(storedURL string) string {
+	key, ok := strings.CutPrefix(storedURL, fmt.Sprintf("%s/%s/", config.Conf.MinIO.BaseURL(), MinioBucket))
+	if !ok {
+		return ""
+	}
+	return key
+}
+
 // CheckFileExists 检查文件是否存在于MinIO中
 // 参数：文件名
 // 返回：是否存在和错误
@@ -134,3 +188,8 @@ func CheckFileExists(filename string) (bool, error) {
 	return true, nil // 文件存在
 }
 
+// ListenUploadEvents 订阅存储桶的文件创建事件（MinIO 扩展 API，不需要在服务端配置通知目标）
+// 连接出错时返回的通道会收到 Err 并关闭，需要调用方重新订阅；ctx 取消时停止订阅
+func ListenUploadEvents(ctx context.Context) <-chan notification.Info {
+	return mc.ListenBucketNotification(ctx, MinioBucket, "", "", []string{"s3:ObjectCreated:*"})
+}
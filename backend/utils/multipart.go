@@ -0,0 +1,243 @@
+package utils
+
+// 大文件分片上传
+//
+// 流程（对应 MinIO/S3 的 Multipart Upload）：
+//   1. 发起：创建视频记录（上传中）和分片上传会话，返回每个分片的预签名 PUT URL
+//   2. 上传：客户端把文件按 part_size 切片，分片 n 上传到 ?partNumber=n&uploadId=... 的预签名URL
+//   3. 续传：中断后查询会话，MinIO 中已存在的分片跳过，未完成的分片重新签发URL
+//   4. 合并：后端从 MinIO 列出已上传的分片（不信任客户端提交的 ETag），校验分片数量和大小后合并为完整文件，再校验文件内容（见 VerifyUploadedFile）
+// 超过 upload.multipart_ttl 仍未合并的会话视为放弃，由 RunMultipartSweeper 中止（MinIO 删除已上传的分片）并删除视频记录（经清理任务删除话题关联等）。
+
+import (
+	"backend/models"
+	"common/config"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
+)
+
+const (
+	PartURLExpiry = time.Hour // 分片上传URL有效期（过期后查询会话重新签发）
+
+	MultipartSweepLockKey = "lock:multipart:sweep" // 多实例只由一个实例清理
+	multipartSweepBatch   = 100                    // 每轮最多清理的会话数
+	listPartsPageSize     = 1000                   // 列出分片时每页数量（S3 上限）
+)
+
+// ErrUploadNotFound 分片上传会话不存在（或已被 MinIO 清理）
+var ErrUploadNotFound = errors.New("分片上传不存在")
+
+// multipartCore MinIO 底层 API（分片上传相关接口只在 Core 中提供）
+func multipartCore() minio.Core {
+	return minio.Core{Client: mc}
+}
+
+// NewMultipartUpload 在 MinIO 中发起分片上传（合并后的文件 Content-Type 按扩展名设置）
+// 返回：MinIO 分片上传ID
+func NewMultipartUpload(fileName string) (string, error) {
+	opts := minio.PutObjectOptions{ContentType: VideoContentType(fileName)}
+	return multipartCore().NewMultipartUpload(context.Background(), MinioBucket, fileName, opts)
+}
+
+// GeneratePartUploadURL 生成某个分片的预签名上传URL（分片号从1开始）
+// 分片大小（Content-Length）参与签名，大小不对的分片 MinIO 直接拒绝
+func GeneratePartUploadURL(fileName, uploadID string, partNumber int, size int64) (string, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	params.Set("uploadId", uploadID)
+	headers := http.Header{}
+	headers.Set("Content-Length", strconv.FormatInt(size, 10))
+	u, err := mc.PresignHeader(context.Background(), http.MethodPut, MinioBucket, fileName, PartURLExpiry, params, headers)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// ListUploadedParts 列出 MinIO 中已上传完成的分片（按分片号升序）
+func ListUploadedParts(fileName, uploadID string) ([]minio.ObjectPart, error) {
+	ctx := context.Background()
+	var parts []minio.ObjectPart
+	marker := 0
+	for {
+		result, err := multipartCore().ListObjectParts(ctx, MinioBucket, fileName, uploadID, marker, listPartsPageSize)
+		if err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+				return nil, ErrUploadNotFound
+			}
+			return nil, err
+		}
+		parts = append(parts, result.ObjectParts...)
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// CompleteMultipartUpload 按分片号顺序把已上传的分片合并为完整文件
+func CompleteMultipartUpload(fileName, uploadID string, parts []minio.ObjectPart) error {
+	complete := make([]minio.CompletePart, len(parts))
+	for i, p := range parts {
+		complete[i] = minio.CompletePart{PartNumber: p.PartNumber, ETag: p.ETag}
+	}
+	_, err := multipartCore().CompleteMultipartUpload(context.Background(), MinioBucket, fileName, uploadID, complete, minio.PutObjectOptions{})
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return ErrUploadNotFound
+	}
+	return err
+}
+
+// AbortMultipartUpload 中止分片上传，MinIO 删除已上传的分片（上传已不存在时视为成功）
+func AbortMultipartUpload(fileName, uploadID string) error {
+	err := multipartCore().AbortMultipartUpload(context.Background(), MinioBucket, fileName, uploadID)
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return nil
+	}
+	return err
+}
+
+// CreateMultipartVideo 在一个事务中创建视频记录（关联话题）和分片上传会话
+func CreateMultipartVideo(video *models.Video, tagNames []string, upload *models.MultipartUpload) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Create(video).Error; err != nil {
+			return err
+		}
+		if err := txSetVideoTags(tx, video.ID, tagNames); err != nil {
+			return err
+		}
+		upload.VideoID = video.ID
+		return tx.Create(upload).Error
+	})
+}
+
+// GetMultipartUpload 获取视频的分片上传会话
+func GetMultipartUpload(videoID uint) (*models.MultipartUpload, error) {
+	var upload models.MultipartUpload
+	if err := db.Where("video_id = ?", videoID).First(&upload).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// ClaimMultipartCompletion 合并前把未过期的会话标记为已合并（与取消、超时清理互斥，只有一方能成功）
+// 返回：是否标记成功
+func ClaimMultipartCompletion(id uint) (bool, error) {
+	result := db.Model(&models.MultipartUpload{}).
+		Where("id = ? AND status = ? AND expires_at > ?", id, models.MultipartStatusActive, time.Now()).
+		Update("status", models.MultipartStatusCompleted)
+	return result.RowsAffected > 0, result.Error
+}
+
+// SetMultipartUploadStatus 按状态条件更新分片上传会话（合并失败时恢复为上传中）
+// 返回：是否更新成功（当前状态不是 from 时返回 false）
+func SetMultipartUploadStatus(id uint, from, to int) (bool, error) {
+	result := db.Model(&models.MultipartUpload{}).
+		Where("id = ? AND status = ?", id, from).
+		Update("status", to)
+	return result.RowsAffected > 0, result.Error
+}
+
+// AbortMultipartVideo 把上传中的会话标记为已中止，删除仍处于上传中的视频记录并写入清理任务（清理话题关联等）
+// 参数：分片上传会话、执行取消的用户ID（超时清理时为 0）
+// 返回：是否中止成功（会话已合并或已中止时返回 false）
+func AbortMultipartVideo(upload *models.MultipartUpload, userID uint) (bool, error) {
+	aborted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.MultipartUpload{}).
+			Where("id = ? AND status = ?", upload.ID, models.MultipartStatusActive).
+			Update("status", models.MultipartStatusAborted)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		aborted = true
+
+		var video models.Video
+		err := tx.Select("id", "file_name").
+			Where("id = ? AND status = ?", upload.VideoID, models.VideoStatusUploading).
+			Take(&video).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&video).Error; err != nil {
+			return err
+		}
+		return txPurgeVideo(tx, video, userID, models.PurgeReasonUploadAborted)
+	})
+	if err != nil {
+		return false, err
+	}
+	if aborted {
+		NotifyOutbox()
+	}
+	return aborted, nil
+}
+
+// RunMultipartSweeper 定时中止超时未完成的分片上传（阻塞运行，需在 goroutine 中调用）
+func RunMultipartSweeper() {
+	ticker := time.NewTicker(config.Conf.Upload.SweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := sweepMultipartUploads()
+		if err != nil {
+			log.Printf("清理超时分片上传失败: %v", err)
+		}
+		if n > 0 {
+			log.Printf("已中止 %d 个超时未完成的分片上传", n)
+		}
+	}
+}
+
+// sweepMultipartUploads 中止一批已过期的分片上传
+// 先在 MinIO 中止（删除已上传的分片），成功后再标记会话并删除视频记录；MinIO 失败的会话留到下一轮重试
+func sweepMultipartUploads() (int, error) {
+	release, ok, err := TryLock(MultipartSweepLockKey, 5*time.Minute)
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer release()
+
+	var uploads []models.MultipartUpload
+	err = db.Where("status = ? AND expires_at < ?", models.MultipartStatusActive, time.Now()).
+		Order("expires_at").
+		Limit(multipartSweepBatch).
+		Find(&uploads).Error
+	if err != nil {
+		return 0, err
+	}
+
+	swept := 0
+	for i := range uploads {
+		upload := &uploads[i]
+		var video models.Video
+		if err := db.Unscoped().Select("id", "file_name").First(&video, upload.VideoID).Error; err != nil {
+			log.Printf("分片上传 %d 对应的视频 %d 查询失败: %v", upload.ID, upload.VideoID, err)
+			continue
+		}
+		if err := AbortMultipartUpload(video.FileName, upload.UploadID); err != nil {
+			log.Printf("中止视频 %d 的分片上传失败: %v", upload.VideoID, err)
+			continue
+		}
+		aborted, err := AbortMultipartVideo(upload, 0)
+		if err != nil {
+			log.Printf("标记视频 %d 的分片上传为已中止失败: %v", upload.VideoID, err)
+			continue
+		}
+		if aborted {
+			swept++
+		}
+	}
+	return swept, nil
+}
@@ -2,12 +2,17 @@ package utils
 
 import (
 	"backend/models"
-	"backend/config"
+	"common/config"
+	"database/sql"
 	"fmt"
 	"log"
+	"math"
 	"errors"
+	"strings"
+	"time"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // 数据库实例（私有）
@@ -17,12 +22,7 @@ var db *gorm.DB
 func InitMySQL() error {
 	// 配置MySQL连接字符串
 	// 格式：用户名:密码@tcp(主机:端口)/数据库名?参数
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		config.MySQLUsername,
-		config.MySQLPassword,
-		config.MySQLHost,
-		config.MySQLPort,
-		config.MySQLDatabase)
+	dsn := config.Conf.MySQL.DSN()
 
 	// 连接数据库
 	conn, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
@@ -37,9 +37,59 @@ func InitMySQL() error {
 
 // AutoMigrate 自动迁移数据库表结构
 func AutoMigrate(m ...interface{}) error {
+	// 视频与话题的多对多关联使用自定义的关联表模型（带 tag_id 索引）
+	if err := db.SetupJoinTable(&models.Video{}, "Tags", &models.VideoTag{}); err != nil {
+		return err
+	}
 	return db.AutoMigrate(m...)
 }
 
+// DedupeLikeTables 为 likes、comment_likes 添加唯一索引前清理重复记录，并重新计算点赞数
+// 每组 (user_id, 目标ID) 只保留一条：优先保留未删除的记录，其次保留ID最小的；唯一索引已存在的表跳过。
+// 需要在 AutoMigrate 之前调用（否则建唯一索引会因重复数据失败）
+func DedupeLikeTables() error {
+	tables := []struct {
+		model       interface{}
+		index       string
+		table       string
+		target      string // 被点赞对象的ID列
+		targetTable string // 被点赞对象所在的表（维护 like_count）
+	}{
+		{&models.Like{}, "idx_likes_user_video", "likes", "video_id", "videos"},
+		{&models.CommentLike{}, "idx_comment_likes_user_comment", "comment_likes", "comment_id", "comments"},
+	}
+
+	migrator := db.Migrator()
+	for _, t := range tables {
+		if !migrator.HasTable(t.model) || migrator.HasIndex(t.model, t.index) {
+			continue
+		}
+		var removed int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Exec(fmt.Sprintf(`DELETE l FROM %[1]s l JOIN (
+	SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id, %[2]s ORDER BY deleted_at IS NULL DESC, id ASC) AS rn FROM %[1]s
+) d ON l.id = d.id WHERE d.rn > 1`, t.table, t.target))
+			if result.Error != nil {
+				return result.Error
+			}
+			removed = result.RowsAffected
+			return tx.Exec(fmt.Sprintf(`UPDATE %[1]s t SET like_count = (
+	SELECT COUNT(*) FROM %[2]s l WHERE l.%[3]s = t.id AND l.deleted_at IS NULL
+)`, t.targetTable, t.table, t.target)).Error
+		})
+		if err != nil {
+			return fmt.Errorf("清理 %s 重复记录失败: %v", t.table, err)
+		}
+		log.Printf("%s 重复记录清理完成: 删除 %d 条，已重新计算 %s.like_count", t.table, removed, t.targetTable)
+	}
+	return nil
+}
+
+// HasColumn 检查模型对应的表是否已有某列（用于判断新增列是否需要回填）
+func HasColumn(model interface{}, column string) bool {
+	return db.Migrator().HasColumn(model, column)
+}
+
 // ============================================ 用户相关数据库操作 =====================================================
 
 // GetUserByUsername 根据用户名查询用户
@@ -52,6 +102,15 @@ func GetUserByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
+// GetUserByID 根据ID查询用户
+func GetUserByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // CreateUser 创建用户
 func CreateUser(user *models.User) error {
 	return db.Create(user).Error
@@ -80,6 +139,20 @@ func GetVideoByID(id uint) (*models.Video, error) {
 	return &video, nil
 }
 
+// GetUploadingVideoByFileName 根据存储的文件名获取上传中的视频
+// 返回：视频（没有该文件名的上传中视频时为 nil）和错误
+func GetUploadingVideoByFileName(fileName string) (*models.Video, error) {
+	var video models.Video
+	err := db.Where("file_name = ? AND status = ?", fileName, models.VideoStatusUploading).First(&video).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
 // UpdateVideoStatus 更新视频状态
 func UpdateVideoStatus(id uint, status int) error {
 	return db.Model(&models.Video{}).Where("id = ?", id).Update("status", status).Error
@@ -95,56 +168,97 @@ func UpdateVideo(id uint, updates map[string]interface{}) error {
 	return db.Model(&models.Video{}).Where("id = ?", id).Updates(updates).Error
 }
 
+// ConfirmVideoUpload 将视频标记为上传完成，并在同一事务中写入视频处理任务（发件箱）
+// 返回：是否更新成功（false 表示视频不是"上传中"状态，可能已被并发确认）、错误
+func ConfirmVideoUpload(videoID uint, videoURL, fileName string) (bool, error) {
+	updated := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Video{}).
+			Where("id = ? AND status = ?", videoID, models.VideoStatusUploading).
+			Updates(map[string]interface{}{
+				"status": models.VideoStatusUploaded,
+				"url":    videoURL,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		updated = true
+		return enqueueOutbox(tx, QueueVideoName, VideoTask{VideoID: videoID, FileName: fileName})
+	})
+	if err != nil {
+		return false, err
+	}
+	if updated {
+		NotifyOutbox()
+	}
+	return updated, nil
+}
+
 // VideoListItem 视频列表项（包含作者信息）
 type VideoListItem struct {
-	ID          uint   `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	URL         string `json:"url"`          // 原视频URL
-	URL720p     string `json:"url_720p"`     // 720p视频URL
-	URL1080p    string `json:"url_1080p"`    // 1080p视频URL
-	CoverURL    string `json:"cover_url"`
-	UserID      uint   `json:"user_id"`
-	Username    string `json:"username"`
-	AvatarURL   string `json:"avatar_url"`
-	CreatedAt   string `json:"created_at"`
-	Likes       int64  `json:"likes"`
-	Comments    int64  `json:"comments"`
-	IsLiked     bool   `json:"is_liked"` // 当前用户是否点赞（需要登录）
-}
-
-// GetVideoList 获取视频列表（分页）
-// page: 页码（从1开始）
-// pageSize: 每页数量
-func GetVideoList(page, pageSize int) ([]VideoListItem, int64, error) {
-	var total int64
-	var videos []models.Video
+	ID          uint      `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	URL         string    `json:"url"`       // 原视频URL
+	URL720p     string    `json:"url_720p"`  // 720p视频URL
+	URL1080p    string    `json:"url_1080p"` // 1080p视频URL
+	HLSURL      string    `json:"hls_url"`   // HLS 主播放列表URL（自适应码率）
+	Qualities   []string  `json:"qualities"` // HLS 中实际可用的清晰度，如 ["360p", "720p"]
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Duration    float64   `json:"duration"` // 时长（秒）
+	CoverURL    string    `json:"cover_url"`
+	UserID      uint      `json:"user_id"`
+	Username    string    `json:"username"`
+	AvatarURL   string    `json:"avatar_url"`
+	CreatedAt   string    `json:"created_at"`
+	CursorTime  time.Time `json:"-"` // 创建时间（用于生成游标，不返回给客户端）
+	Likes       int64     `json:"likes"`
+	Comments    int64     `json:"comments"`
+	Views       int64     `json:"views"`           // 播放量（异步落库，可能比实际稍有延迟）
+	CompletionRate float64 `json:"completion_rate"` // 平均完播率（0~1）
+	Tags        []string  `json:"tags"`            // 话题名
+	IsLiked     bool      `json:"is_liked"`              // 当前用户是否点赞（需要登录）
+	Status      int       `json:"status"`                // 视频状态（非已发布状态只有作者本人能看到）
+	Visibility  string    `json:"visibility"`            // 可见性（public/unlisted/private）
+	FailReason  string    `json:"fail_reason,omitempty"` // 处理失败原因
+}
 
-	// 只查询已上传完成的视频
-	query := db.Model(&models.Video{}).Where("status = ?", models.VideoStatusUploaded)
+// splitRenditions 将逗号分隔的清晰度字符串转换为列表
+func splitRenditions(renditions string) []string {
+	if renditions == "" {
+		return []string{}
+	}
+	return strings.Split(renditions, ",")
+}
 
-	// 获取总数
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
+// completionRate 平均完播率（保留3位小数）
+func completionRate(v models.Video) float64 {
+	if v.ViewCount == 0 {
+		return 0
 	}
+	rate := math.Min(v.CompletionSum/float64(v.ViewCount), 1)
+	return math.Round(rate*1000) / 1000
+}
 
-	// 分页查询，按创建时间倒序
-	offset := (page - 1) * pageSize
-	if err := query.Preload("User").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&videos).Error; err != nil {
-		return nil, 0, err
+// tagNames 话题名列表
+func tagNames(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Name
 	}
+	return names
+}
 
-	// 组装返回数据
+// buildVideoListItems 将视频记录组装为列表项（所有视频列表共用）
+// 作者信息、话题需要调用方预加载（Preload("User")、Preload("Tags")），点赞数、评论数直接使用 videos 表上的计数列，
+// 组装过程不再产生额外查询
+func buildVideoListItems(videos []models.Video) []VideoListItem {
 	result := make([]VideoListItem, 0, len(videos))
 	for _, v := range videos {
-
-		// 直接使用 Video 模型中的 LikeCount 字段
-		likeCount := int64(v.LikeCount)
-
-		// 获取评论数
-		var commentCount int64
-		db.Model(&models.Comment{}).Where("video_id = ?", v.ID).Count(&commentCount)
-
 		result = append(result, VideoListItem{
 			ID:          v.ID,
 			Title:       v.Title,
@@ -152,154 +266,251 @@ func GetVideoList(page, pageSize int) ([]VideoListItem, int64, error) {
 			URL:         v.URL,      // 原视频URL
 			URL720p:     v.URL720p,  // 720p视频URL
 			URL1080p:    v.URL1080p, // 1080p视频URL
+			HLSURL:      v.HLSURL,
+			Qualities:   splitRenditions(v.Renditions),
+			Width:       v.Width,
+			Height:      v.Height,
+			Duration:    v.Duration,
 			CoverURL:    v.CoverURL,
 			UserID:      v.UserID,
 			Username:    v.User.Username,
 			AvatarURL:   v.User.AvatarURL,
 			CreatedAt:   v.CreatedAt.Format("2006-01-02 15:04"),
-			Likes:       likeCount,
-			Comments:    commentCount,
+			CursorTime:  v.CreatedAt,
+			Likes:       int64(v.LikeCount),
+			Comments:    int64(v.CommentCount),
+			Views:       int64(v.ViewCount),
+			CompletionRate: completionRate(v),
+			Tags:        tagNames(v.Tags),
+			Status:      v.Status,
+			FailReason:  v.FailReason,
+			Visibility:  v.Visibility,
 		})
+		signPlaybackURLs(&result[len(result)-1])
 	}
-
-	return result, total, nil
+	return result
 }
 
-// GetVideoListPage 获取视频列表（分页），不计算 total
-// 用于随机 feed 等“可能多次翻页”的场景，减少 COUNT 开销。
-func GetVideoListPage(page, pageSize int) ([]VideoListItem, error) {
-	var videos []models.Video
+// publicVideoScope 公开列表（随机推荐、热门、搜索、话题、关注动态）的可见性条件：只包含已发布的公开视频
+// 作者本人的未发布、不公开、私密视频也不出现在这些列表中，只出现在视频列表和作者主页（visibleVideoScope）
+func publicVideoScope(tx *gorm.DB) *gorm.DB {
+	return tx.Where("videos.status = ? AND videos.visibility = ?", models.VideoStatusPublished, models.VisibilityPublic)
+}
 
-	// 只查询已上传完成的视频
-	query := db.Model(&models.Video{}).Where("status = ?", models.VideoStatusUploaded)
+// visibleVideoScope 视频列表和作者主页视频列表的可见性条件
+// 所有人都能看到已发布的公开视频；作者本人额外能看到自己 待处理/转码中/处理失败 的视频（带状态），以及不公开、私密的视频
+// 不公开的视频不出现在列表中，只能通过视频详情（链接）访问，见 CanViewVideo
+// viewerID 为 0 表示未登录
+func visibleVideoScope(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return publicVideoScope(tx)
+		}
+		return tx.Where("((videos.status = ? AND videos.visibility = ?) OR (videos.user_id = ? AND videos.status IN ?))",
+			models.VideoStatusPublished,
+			models.VisibilityPublic,
+			viewerID,
+			[]int{models.VideoStatusUploaded, models.VideoStatusProcessing, models.VideoStatusPublished, models.VideoStatusFailed})
+	}
+}
 
-	// 分页查询，按创建时间倒序
-	offset := (page - 1) * pageSize
-	if err := query.Preload("User").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&videos).Error; err != nil {
-		return nil, err
+// listVideos 按发布时间倒序、游标分页查询视频
+// 参数：查询条件、游标（第一页为 nil）、每页数量
+// 返回：视频列表（已预加载作者）、下一页游标（没有更多时为空）、错误
+func listVideos(query *gorm.DB, cursor *Cursor, limit int) ([]models.Video, string, error) {
+	var videos []models.Video
+	err := query.Scopes(cursorScope("videos", cursor)).
+		Preload("User").
+		Preload("Tags").
+		Order(cursorOrder("videos")).
+		Limit(limit + 1). // 多取一条判断是否还有下一页
+		Find(&videos).Error
+	if err != nil {
+		return nil, "", err
 	}
 
-	// 组装返回数据
-	result := make([]VideoListItem, 0, len(videos))
-	for _, v := range videos {
-		likeCount := int64(v.LikeCount)
+	nextCursor := ""
+	if len(videos) > limit {
+		videos = videos[:limit]
+		last := videos[len(videos)-1]
+		nextCursor = EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return videos, nextCursor, nil
+}
 
-		// 获取评论数
-		var commentCount int64
-		db.Model(&models.Comment{}).Where("video_id = ?", v.ID).Count(&commentCount)
+// GetVideoList 获取视频列表（按发布时间倒序，游标分页）
+// cursor: 游标（第一页为 nil）
+// limit: 每页数量
+// viewerID: 当前用户ID（为0时只返回已发布的公开视频）
+// 返回：视频列表、下一页游标（没有更多时为空）、错误
+func GetVideoList(cursor *Cursor, limit int, viewerID uint) ([]VideoListItem, string, error) {
+	// 只查询已发布的公开视频（作者本人可以看到自己未发布的视频）
+	query := db.Model(&models.Video{}).Scopes(visibleVideoScope(viewerID))
 
-		result = append(result, VideoListItem{
-			ID:          v.ID,
-			Title:       v.Title,
-			Description: v.Description,
-			URL:         v.URL,
-			URL720p:     v.URL720p,
-			URL1080p:    v.URL1080p,
-			CoverURL:    v.CoverURL,
-			UserID:      v.UserID,
-			Username:    v.User.Username,
-			AvatarURL:   v.User.AvatarURL,
-			CreatedAt:   v.CreatedAt.Format("2006-01-02 15:04"),
-			Likes:       likeCount,
-			Comments:    commentCount,
-		})
+	videos, nextCursor, err := listVideos(query, cursor, limit)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return result, nil
+	return buildVideoListItems(videos), nextCursor, nil
 }
 
-// GetUploadedVideoCount 获取已上传完成的视频总数
-func GetUploadedVideoCount() (int64, error) {
+// GetVisibleVideoCount 获取对当前用户可见的视频总数
+func GetVisibleVideoCount(viewerID uint) (int64, error) {
 	var total int64
-	err := db.Model(&models.Video{}).Where("status = ?", models.VideoStatusUploaded).Count(&total).Error
+	err := db.Model(&models.Video{}).Scopes(visibleVideoScope(viewerID)).Count(&total).Error
 	return total, err
 }
 
-
-// GetUserVideoList 获取 某个用户 的视频列表（分页）
-// page: 页码（从1开始）
-// pageSize: 每页数量
-func GetUserVideoList(user_id uint, page, pageSize int) ([]VideoListItem, int64, error){
-	var total int64
-	var videos []models.Video
-	
-	// 只查询该用户已上传完成的视频
-	query := db.Model(&models.Video{}).Where("user_id = ? and status = ?",user_id, models.VideoStatusUploaded)
-
-	// 获取该用户的视频总是
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
+// GetPublicVideoTimeRange 获取已发布的公开视频中最早和最晚的发布时间
+// 返回：最早时间、最晚时间、是否有公开视频、错误
+func GetPublicVideoTimeRange() (time.Time, time.Time, bool, error) {
+	var row struct {
+		Oldest sql.NullTime
+		Newest sql.NullTime
 	}
-
-	// 分页查询，按照时间倒叙
-	offset := (page - 1)*pageSize
-	if err := query.Preload("User").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&videos).Error; err != nil {
-		return nil, 0, err
+	err := db.Model(&models.Video{}).Scopes(publicVideoScope).
+		Select("MIN(videos.created_at) AS oldest, MAX(videos.created_at) AS newest").
+		Scan(&row).Error
+	if err != nil {
+		return time.Time{}, time.Time{}, false, err
 	}
+	if !row.Oldest.Valid || !row.Newest.Valid {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	return row.Oldest.Time, row.Newest.Time, true, nil
+}
 
-	// 组装返回数据
-	result := make([]VideoListItem, 0, len(videos))
-	for _, v := range videos {
-
-		// 直接使用 Video 模型中的 LikeCount 字段
-		likeCount := int64(v.LikeCount)
-
-		// 获取评论数
-		var commentCount int64
-		db.Model(&models.Comment{}).Where("video_id = ?", v.ID).Count(&commentCount)
+// GetUserVideoList 获取 某个用户 的视频列表（按发布时间倒序，游标分页）
+// cursor: 游标（第一页为 nil）
+// limit: 每页数量
+// viewerID: 当前用户ID，等于 user_id 时会额外返回未发布的视频
+// 返回：视频列表、下一页游标（没有更多时为空）、错误
+func GetUserVideoList(user_id uint, cursor *Cursor, limit int, viewerID uint) ([]VideoListItem, string, error) {
+	// 只查询该用户已发布的视频（本人查看时包含未发布的视频）
+	query := db.Model(&models.Video{}).Where("videos.user_id = ?", user_id).Scopes(visibleVideoScope(viewerID))
 
-		result = append(result, VideoListItem{
-			ID:          v.ID,
-			Title:       v.Title,
-			Description: v.Description,
-			URL:         v.URL,      // 原视频URL
-			URL720p:     v.URL720p,  // 720p视频URL
-			URL1080p:    v.URL1080p, // 1080p视频URL
-			CoverURL:    v.CoverURL,
-			UserID:      v.UserID,
-			Username:    v.User.Username,
-			AvatarURL:   v.User.AvatarURL,
-			CreatedAt:   v.CreatedAt.Format("2006-01-02 15:04"),
-			Likes:       likeCount,
-			Comments:    commentCount,
-		})
+	videos, nextCursor, err := listVideos(query, cursor, limit)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return result, total, nil
-	
+	return buildVideoListItems(videos), nextCursor, nil
+}
+
+// GetUserVideoCount 获取某个用户对当前用户可见的视频总数
+func GetUserVideoCount(user_id uint, viewerID uint) (int64, error) {
+	var total int64
+	err := db.Model(&models.Video{}).Where("videos.user_id = ?", user_id).
+		Scopes(visibleVideoScope(viewerID)).Count(&total).Error
+	return total, err
 }
 
 // DeleteUserVideos 删除 某个用户 的 视频列表
 // user_id, videoids : 用户id，视频id列表
+// 视频记录软删除，并在同一事务中为每个视频写入清理记录和清理任务：
+// worker 异步删除 MinIO 中的原视频和转码文件、Redis 中的排行榜和缓存、以及评论、点赞等关联记录
 func DeleteUserVideos(user_id uint, videoids []uint) error {
-    result := db.Where("user_id = ? AND id IN ?", user_id, videoids).Delete(&models.Video{})
-    
+    var videos []models.Video
+    err := db.Transaction(func(tx *gorm.DB) error {
+        // 1. 锁定要删除的视频（只能删除自己的视频，已删除的视频不会重复删除）
+        err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+            Select("id", "file_name").
+            Where("user_id = ? AND id IN ?", user_id, videoids).
+            Find(&videos).Error
+        if err != nil || len(videos) == 0 {
+            return err
+        }
+
+        ids := make([]uint, len(videos))
+        for i, v := range videos {
+            ids[i] = v.ID
+        }
+        if err := tx.Where("id IN ?", ids).Delete(&models.Video{}).Error; err != nil {
+            return err
+        }
+
+        // 2. 写入清理记录和清理任务
+        for _, v := range videos {
+            if err := txPurgeVideo(tx, v, user_id, models.PurgeReasonUserDeleted); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+
     // 1. 检查系统错误
-    if result.Error != nil {
-        log.Printf("删除视频失败: %v", result.Error)
+    if err != nil {
+        log.Printf("删除视频失败: %v", err)
         return errors.New("数据库操作失败")
     }
     
     // 2. 检查是否真的删除了记录
-    if result.RowsAffected == 0 {
+    if len(videos) == 0 {
         return errors.New("视频不存在或无权删除")
     }
-    
+
+    NotifyOutbox()
     return nil
 }
 
 
+// txPurgeVideo 为已软删除的视频写入清理记录和清理任务（worker 异步删除文件、缓存和关联记录）
+// 参数：事务、视频（需要 ID 和 FileName）、执行删除的用户ID（系统清理时为 0）、清理原因
+func txPurgeVideo(tx *gorm.DB, video models.Video, userID uint, reason string) error {
+	purge := models.VideoPurge{VideoID: video.ID, UserID: userID, Reason: reason, FileName: video.FileName}
+	if err := tx.Create(&purge).Error; err != nil {
+		return err
+	}
+	return enqueueOutbox(tx, QueueVideoCleanupName, VideoCleanupTask{VideoID: video.ID, FileName: video.FileName})
+}
+
+// DeleteUploadingVideo 删除仍处于上传中的视频记录，并写入清理任务
+// 参数：视频（需要 ID、FileName）、执行删除的用户ID（系统清理时为 0）、清理原因
+// 返回：是否删除（期间已被确认或删除时返回 false）
+func DeleteUploadingVideo(video models.Video, userID uint, reason string) (bool, error) {
+	deleted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND status = ?", video.ID, models.VideoStatusUploading).Delete(&models.Video{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+		return txPurgeVideo(tx, video, userID, reason)
+	})
+	if err != nil {
+		return false, err
+	}
+	if deleted {
+		NotifyOutbox()
+	}
+	return deleted, nil
+}
+
 // ====================================== 点赞相关数据库操作 ===============================================
 
-// CreateLike 创建点赞记录
-func CreateLike(like *models.Like) error {
-	
-	result := db.Create(like)
+// upsertLikeSQL 点赞：记录不存在时插入，已软删除时恢复（依赖 (user_id, video_id) 唯一索引）
+// 先根据旧的 deleted_at 决定是否更新 updated_at，已点赞时不修改任何列，影响行数为0
+// 影响行数：1 新插入；2 恢复了软删除的记录；0 原本就已点赞
+const upsertLikeSQL = `INSERT INTO likes(user_id, video_id, created_at, updated_at) VALUES (?, ?, NOW(), NOW())
+ON DUPLICATE KEY UPDATE updated_at = IF(deleted_at IS NULL, updated_at, NOW()), deleted_at = NULL`
+
+// upsertLike 写入点赞记录（幂等）
+// 返回：点赞状态是否发生变化、错误
+func upsertLike(tx *gorm.DB, userID, videoID uint) (bool, error) {
+	result := tx.Exec(upsertLikeSQL, userID, videoID)
 	if result.Error != nil {
-		log.Printf("插入点赞记录失败: %v", result.Error)
-		return result.Error
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CreateLike 创建点赞记录（已软删除的记录会被恢复）
+func CreateLike(like *models.Like) error {
+	if _, err := upsertLike(db, like.UserID, like.VideoID); err != nil {
+		log.Printf("插入点赞记录失败: %v", err)
+		return err
 	}
-	
 	return nil
 }
 
@@ -345,6 +556,175 @@ func MGetVideoLikeCount(videoID uint) int64 {
 	return count
 }
 
+// VideoLikeCountRow 视频ID及其 videos.like_count（点赞对账使用）
+type VideoLikeCountRow struct {
+	ID        uint
+	LikeCount int64
+}
+
+// ListVideoLikeCounts 按ID正序分批读取视频的点赞数
+// 参数：上一批最后一个视频ID（第一批为0）、每批数量
+func ListVideoLikeCounts(afterID uint, limit int) ([]VideoLikeCountRow, error) {
+	var rows []VideoLikeCountRow
+	err := db.Model(&models.Video{}).Select("id", "like_count").
+		Where("id > ?", afterID).Order("id ASC").Limit(limit).
+		Find(&rows).Error
+	return rows, err
+}
+
+// GetLikeTime 查询用户点赞视频的时间（likes 表中未删除记录的 updated_at，即最近一次变为已点赞的时间）
+// 点赞尚未落库时返回 gorm.ErrRecordNotFound
+func GetLikeTime(userID, videoID uint) (time.Time, error) {
+	var like models.Like
+	err := db.Select("updated_at").Where("user_id = ? AND video_id = ?", userID, videoID).First(&like).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+	return like.UpdatedAt, nil
+}
+
+// GetLikeUsersByVideos 批量查询视频的点赞用户（likes 表中未删除的记录）
+// 返回：视频ID到点赞用户ID列表的映射
+func GetLikeUsersByVideos(videoIDs []uint) (map[uint][]uint, error) {
+	users := make(map[uint][]uint, len(videoIDs))
+	if len(videoIDs) == 0 {
+		return users, nil
+	}
+	var likes []models.Like
+	err := db.Select("video_id", "user_id").Where("video_id IN ?", videoIDs).Find(&likes).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range likes {
+		users[l.VideoID] = append(users[l.VideoID], l.UserID)
+	}
+	return users, nil
+}
+
+// ListLikedCommentIDs 按ID正序分批读取有点赞的评论ID（comment_likes 表中未删除的记录）
+// 参数：上一批最后一个评论ID（第一批为0）、每批数量
+func ListLikedCommentIDs(afterID uint, limit int) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&models.CommentLike{}).Distinct().
+		Where("comment_id > ?", afterID).Order("comment_id ASC").Limit(limit).
+		Pluck("comment_id", &ids).Error
+	return ids, err
+}
+
+// GetLikeUsersByComments 批量查询评论的点赞用户（comment_likes 表中未删除的记录）
+// 返回：评论ID到点赞用户ID列表的映射
+func GetLikeUsersByComments(commentIDs []uint) (map[uint][]uint, error) {
+	users := make(map[uint][]uint, len(commentIDs))
+	if len(commentIDs) == 0 {
+		return users, nil
+	}
+	var likes []models.CommentLike
+	err := db.Select("comment_id", "user_id").Where("comment_id IN ?", commentIDs).Find(&likes).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range likes {
+		users[l.CommentID] = append(users[l.CommentID], l.UserID)
+	}
+	return users, nil
+}
+
+// GetExistingVideoIDs 批量查询哪些视频仍然存在（未删除）
+func GetExistingVideoIDs(videoIDs []uint) (map[uint]bool, error) {
+	existing := make(map[uint]bool, len(videoIDs))
+	if len(videoIDs) == 0 {
+		return existing, nil
+	}
+	var ids []uint
+	if err := db.Model(&models.Video{}).Where("id IN ?", videoIDs).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		existing[id] = true
+	}
+	return existing, nil
+}
+
+// RepairVideoLikes 修复视频的点赞记录，并按 likes 表重新计算 videos.like_count（同一事务）
+// 参数：视频ID、需要补录点赞的用户、需要取消点赞的用户
+// 返回：修复后的点赞数、错误
+func RepairVideoLikes(videoID uint, addUserIDs, removeUserIDs []uint) (int64, error) {
+	var likeCount int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, userID := range addUserIDs {
+			if _, err := upsertLike(tx, userID, videoID); err != nil {
+				return err
+			}
+		}
+		if len(removeUserIDs) > 0 {
+			if err := tx.Where("video_id = ? AND user_id IN ?", videoID, removeUserIDs).
+				Delete(&models.Like{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.Like{}).Where("video_id = ?", videoID).Count(&likeCount).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Video{}).Where("id = ?", videoID).
+			UpdateColumn("like_count", likeCount).Error
+	})
+	if err != nil {
+		log.Printf("修复点赞记录失败: VideoID=%d, Error=%v", videoID, err)
+		return 0, err
+	}
+	return likeCount, nil
+}
+
+// SetVideoLikeCount 直接设置 videos.like_count
+func SetVideoLikeCount(videoID uint, count int64) error {
+	return db.Model(&models.Video{}).Where("id = ?", videoID).UpdateColumn("like_count", count).Error
+}
+
+// HourlyActivityRow 视频在某个小时内的互动次数（重建热度分桶使用）
+type HourlyActivityRow struct {
+	VideoID uint
+	Hour    time.Time // 所在小时（本地时间，分钟和秒为0）
+	Count   int64
+}
+
+// GetHourlyLikeActivity 按视频和小时统计 since 之后的点赞数（未取消的点赞，按最近一次点赞时间 updated_at 计）
+func GetHourlyLikeActivity(since time.Time) ([]HourlyActivityRow, error) {
+	return hourlyActivity("likes", "updated_at", since)
+}
+
+// GetHourlyCommentActivity 按视频和小时统计 since 之后的评论数（含回复，不含已删除的评论）
+func GetHourlyCommentActivity(since time.Time) ([]HourlyActivityRow, error) {
+	return hourlyActivity("comments", "created_at", since)
+}
+
+// hourlyActivity 按 video_id 和小时分组统计表中未删除的记录数
+func hourlyActivity(table, timeColumn string, since time.Time) ([]HourlyActivityRow, error) {
+	var rows []struct {
+		VideoID uint
+		Hour    string
+		Count   int64
+	}
+	err := db.Raw(fmt.Sprintf(
+		"SELECT video_id, DATE_FORMAT(%[2]s, '%%Y%%m%%d%%H') AS hour, COUNT(*) AS count FROM %[1]s "+
+			"WHERE deleted_at IS NULL AND %[2]s >= ? GROUP BY video_id, hour", table, timeColumn),
+		since,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]HourlyActivityRow, 0, len(rows))
+	for _, r := range rows {
+		hour, err := time.ParseInLocation("2006010215", r.Hour, time.Local)
+		if err != nil {
+			continue
+		}
+		result = append(result, HourlyActivityRow{VideoID: r.VideoID, Hour: hour, Count: r.Count})
+	}
+	return result, nil
+}
+
 // GetUserLikedVideoIDs 获取用户点赞的所有视频ID列表
 // 参数：用户ID
 // 返回：视频ID列表
@@ -366,9 +746,76 @@ func GetUserLikedVideoIDs(userID uint) ([]uint, error) {
 }
 
 // ===================================     ======= 评论相关数据库操作 ==================================================
+// 评论排序方式
+const (
+	CommentSortNewest = "newest" // 最新
+	CommentSortHot    = "hot"    // 最多点赞
+)
+
 // CreateComment 添加评论信息
-func CreateComment(comment *models.Comment) error {
-	return db.Create(comment).Error
+// 同一事务中增加视频的评论数；回复（RootID 不为0）还会增加所属一级评论的回复数
+// 返回：添加后视频的评论数、错误
+func CreateComment(comment *models.Comment) (int64, error) {
+	var commentCount int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(comment).Error; err != nil {
+			return err
+		}
+		if comment.RootID != 0 {
+			err := tx.Model(&models.Comment{}).Where("id = ?", comment.RootID).
+				UpdateColumn("reply_count", gorm.Expr("reply_count + 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+		var err error
+		commentCount, err = incrVideoCommentCount(tx, comment.VideoID, 1)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return commentCount, nil
+}
+
+// incrVideoCommentCount 在事务中修改视频的评论数（不会减到负数）
+// 返回：修改后的评论数、错误
+func incrVideoCommentCount(tx *gorm.DB, videoID uint, delta int64) (int64, error) {
+	err := tx.Exec(
+		"UPDATE videos SET comment_count = GREATEST(CAST(comment_count AS SIGNED) + ?, 0) WHERE id = ?",
+		delta, videoID).Error
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = tx.Model(&models.Video{}).Unscoped().Select("comment_count").Where("id = ?", videoID).Scan(&count).Error
+	return count, err
+}
+
+// BackfillVideoCommentCounts 按 comments 表重新计算所有视频的评论数
+// 用于 comment_count 列首次添加后的回填，以及计数出现偏差时的修复
+func BackfillVideoCommentCounts() error {
+	return db.Exec(`UPDATE videos SET comment_count = (
+		SELECT COUNT(*) FROM comments WHERE comments.video_id = videos.id AND comments.deleted_at IS NULL
+	)`).Error
+}
+
+// GetAllVideoCommentCounts 获取所有有评论的视频的评论数（用于初始化 Redis 评论计数）
+func GetAllVideoCommentCounts() (map[uint]int64, error) {
+	var rows []struct {
+		ID           uint
+		CommentCount int64
+	}
+	err := db.Model(&models.Video{}).Select("id", "comment_count").
+		Where("comment_count > 0").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, r := range rows {
+		counts[r.ID] = r.CommentCount
+	}
+	return counts, nil
 }
 
 
@@ -398,53 +845,130 @@ func CheckCommentIsRepetition(comment *models.Comment) (bool, error) {
 	return true, nil
 }
 
-// 获取某个视频的评论数
-func GetVideoCommentCount(videoid uint) int64 {
-	var count int64
-	err := db.Model(&models.Comment{}).Where("video_id = ?", videoid).Count(&count).Error
+// CommentListItem 评论列表项
+type CommentListItem struct {
+	ID              uint   `json:"id"`
+	Content         string `json:"content"`
+	UserID          uint   `json:"user_id"`
+	Username        string `json:"username"`
+	AvatarURL       string `json:"avatar_url"`
+	VideoID         uint   `json:"video_id"`
+	ParentID        uint   `json:"parent_id"`                   // 直接回复的评论ID（一级评论为0）
+	RootID          uint   `json:"root_id"`                     // 所属一级评论ID（一级评论为0）
+	ReplyToUserID   uint   `json:"reply_to_user_id,omitempty"`  // 被回复的用户ID
+	ReplyToUsername string `json:"reply_to_username,omitempty"` // 被回复的用户名
+	ReplyCount      uint   `json:"reply_count"`                 // 回复数（一级评论）
+	Likes           int64  `json:"likes"`                       // 点赞数
+	IsLiked         bool   `json:"is_liked"`                    // 当前用户是否点赞（需要登录）
+	CreatedAt       string `json:"created_at"`
+}
 
-	if err != nil {
-		log.Printf("统计评论数失败：%v", err)
-		return 0
+// GetVideoComments 获取某个视频的一级评论（游标分页），回复通过 GetCommentReplies 按需加载
+// 参数：视频ID、排序方式（newest/hot）、游标（第一页为 nil）、每页数量
+// 返回：评论列表、下一页游标（没有更多时为空）、错误
+func GetVideoComments(videoid uint, sort string, cursor *Cursor, limit int) ([]CommentListItem, string, error) {
+	var comments []models.Comment
+
+	query := db.Preload("User").Where("comments.video_id = ? AND comments.root_id = 0", videoid)
+	if sort == CommentSortHot {
+		query = query.Scopes(scoreCursorScope("comments", "like_count", cursor)).
+			Order(scoreCursorOrder("comments", "like_count"))
+	} else {
+		query = query.Scopes(cursorScope("comments", cursor)).Order(cursorOrder("comments"))
 	}
-	
-	return count
-}
 
-// 某个视频的评论列表
-type CommentListItem struct {
-	ID          uint   `json:"id"`
-	Content		string `json:"content"`
-	UserID      uint   `json:"user_id"`
-	Username    string `json:"username"`
-	AvatarURL   string `json:"avatar_url"`
-	VideoID		uint   `json:"video_id"`
-	CreatedAt   string `json:"created_at"`
+	// 多取一条判断是否还有下一页
+	if err := query.Limit(limit + 1).Find(&comments).Error; err != nil {
+		log.Printf("查找评论信息错误：%v", err)
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(comments) > limit {
+		comments = comments[:limit]
+		last := comments[len(comments)-1]
+		if sort == CommentSortHot {
+			nextCursor = EncodeScoreCursor(int64(last.LikeCount), last.ID)
+		} else {
+			nextCursor = EncodeCursor(last.CreatedAt, last.ID)
+		}
+	}
+
+	result, err := buildCommentList(comments)
+	if err != nil {
+		return nil, "", err
+	}
+	return result, nextCursor, nil
 }
 
-// 获取某个视频的所有评论信息
-func GetVideoComments(videoid uint) ([]CommentListItem , error){
+// GetCommentReplies 获取某条一级评论下的回复（按时间正序，游标分页）
+// 参数：一级评论ID、游标（第一页为 nil）、每页数量
+// 返回：回复列表、下一页游标（没有更多时为空）、错误
+func GetCommentReplies(rootID uint, cursor *Cursor, limit int) ([]CommentListItem, string, error) {
 	var comments []models.Comment
 
-	// 查找所有该视频的评论信息
-	if err := db.Preload("User").Where("video_id = ?", videoid).Find(&comments).Error; err != nil {
-		log.Printf("查找评论信息错误：%v", err)
-		return nil, err
+	err := db.Preload("User").
+		Where("comments.root_id = ?", rootID).
+		Scopes(cursorScopeAsc("comments", cursor)).
+		Order(cursorOrderAsc("comments")).
+		Limit(limit + 1).
+		Find(&comments).Error
+	if err != nil {
+		log.Printf("查找回复信息错误：%v", err)
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(comments) > limit {
+		comments = comments[:limit]
+		last := comments[len(comments)-1]
+		nextCursor = EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	result, err := buildCommentList(comments)
+	if err != nil {
+		return nil, "", err
+	}
+	return result, nextCursor, nil
+}
+
+// buildCommentList 组装评论列表（批量查询被回复的用户名）
+func buildCommentList(comments []models.Comment) ([]CommentListItem, error) {
+	replyToIDs := make([]uint, 0)
+	for _, v := range comments {
+		if v.ReplyToUserID != 0 {
+			replyToIDs = append(replyToIDs, v.ReplyToUserID)
+		}
+	}
+	replyToNames := make(map[uint]string)
+	if len(replyToIDs) > 0 {
+		var users []models.User
+		if err := db.Select("id", "username").Where("id IN ?", replyToIDs).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			replyToNames[u.ID] = u.Username
+		}
 	}
 
 	result := make([]CommentListItem, 0, len(comments))
-	for _, v := range comments{
+	for _, v := range comments {
 		result = append(result, CommentListItem{
-			ID: 		v.ID,
-			Content:	v.Content,
-			UserID:		v.UserID,
-			Username:	v.User.Username,
-			AvatarURL:	v.User.AvatarURL,
-			VideoID:	v.VideoID,
-			CreatedAt:	v.CreatedAt.Format("2006-01-02 15:04"),
+			ID:              v.ID,
+			Content:         v.Content,
+			UserID:          v.UserID,
+			Username:        v.User.Username,
+			AvatarURL:       v.User.AvatarURL,
+			VideoID:         v.VideoID,
+			ParentID:        v.ParentID,
+			RootID:          v.RootID,
+			ReplyToUserID:   v.ReplyToUserID,
+			ReplyToUsername: replyToNames[v.ReplyToUserID],
+			ReplyCount:      v.ReplyCount,
+			Likes:           int64(v.LikeCount),
+			CreatedAt:       v.CreatedAt.Format("2006-01-02 15:04"),
 		})
 	}
-
 	return result, nil
 }
 
@@ -458,21 +982,61 @@ func GetCommentByID(commentid uint) (*models.Comment, error) {
 	return &comment, nil
 }
 
-// 删除某个视频某用户的评论
-func DeleteComment(commentid uint) error {
-	result := db.Where("id = ?", commentid).Delete(&models.Comment{})
-	if result.Error != nil {
-		log.Printf("删除评论错误：%v", result.Error)
-		return result.Error
+// DeleteComment 删除评论
+// 删除一级评论时同时删除其下所有回复；删除回复时减少所属一级评论的回复数
+// 同一事务中按删除的条数减少视频的评论数
+// 返回：删除的评论（含回复）的发表时间、删除后视频的评论数、错误
+func DeleteComment(comment *models.Comment) ([]time.Time, int64, error) {
+	var deleted []time.Time
+	var commentCount int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", comment.ID).Delete(&models.Comment{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		deleted = append(deleted, comment.CreatedAt)
+
+		if comment.RootID == 0 {
+			var replies []models.Comment
+			if err := tx.Select("id", "created_at").Where("root_id = ?", comment.ID).Find(&replies).Error; err != nil {
+				return err
+			}
+			if len(replies) > 0 {
+				ids := make([]uint, len(replies))
+				for i, r := range replies {
+					ids[i] = r.ID
+					deleted = append(deleted, r.CreatedAt)
+				}
+				if err := tx.Where("id IN ?", ids).Delete(&models.Comment{}).Error; err != nil {
+					return err
+				}
+			}
+		} else {
+			err := tx.Model(&models.Comment{}).Where("id = ? AND reply_count > 0", comment.RootID).
+				UpdateColumn("reply_count", gorm.Expr("reply_count - 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+		commentCount, err = incrVideoCommentCount(tx, comment.VideoID, -int64(len(deleted)))
+		return err
+	})
+	if err != nil {
+		log.Printf("删除评论错误：%v", err)
+		return nil, 0, err
 	}
-	
-	return nil
+	return deleted, commentCount, nil
 }
 
 // GetVideosByIDs 根据视频ID列表批量查询视频（保持顺序）
-// 参数：视频ID列表
+// 参数：视频ID列表、当前用户ID（为0时只返回已发布的公开视频，热门榜和搜索结果传0）
 // 返回：视频列表
-func GetVideosByIDs(videoIDs []uint) ([]VideoListItem, error) {
+func GetVideosByIDs(videoIDs []uint, viewerID uint) ([]VideoListItem, error) {
 	if len(videoIDs) == 0 {
 		return []VideoListItem{}, nil
 	}
@@ -480,50 +1044,219 @@ func GetVideosByIDs(videoIDs []uint) ([]VideoListItem, error) {
 	var videos []models.Video
 	
 	// 批量查询视频
-	err := db.Where("id IN ? AND status = ?", videoIDs, models.VideoStatusUploaded).
+	err := db.Where("id IN ?", videoIDs).
+		Scopes(visibleVideoScope(viewerID)).
 		Preload("User").
+		Preload("Tags").
 		Find(&videos).Error
 	if err != nil {
 		return nil, err
 	}
 
-	// 创建ID到视频的映射
-	videoMap := make(map[uint]models.Video)
+	// 按照传入的ID顺序排列（视频不存在、未发布或不公开的跳过）
+	videoMap := make(map[uint]models.Video, len(videos))
 	for _, v := range videos {
 		videoMap[v.ID] = v
 	}
-
-	// 按照传入的ID顺序组装结果
-	result := make([]VideoListItem, 0, len(videoIDs))
+	ordered := make([]models.Video, 0, len(videos))
 	for _, id := range videoIDs {
-		v, exists := videoMap[id]
-		if !exists {
-			continue // 视频不存在或未上传完成，跳过
+		if v, exists := videoMap[id]; exists {
+			ordered = append(ordered, v)
 		}
+	}
 
-		// 直接使用 Video 模型中的 LikeCount 字段
-		likeCount := int64(v.LikeCount)
+	return buildVideoListItems(ordered), nil
+}
 
-		// 获取评论数
-		var commentCount int64
-		db.Model(&models.Comment{}).Where("video_id = ?", v.ID).Count(&commentCount)
+// GetVideoItem 查询单个视频的详情（视频详情页、不公开视频的链接）
+// 参数：视频ID、当前用户ID（未登录为0）
+// 返回：视频列表项，视频不存在或当前用户无权观看（见 CanViewVideo）时返回 gorm.ErrRecordNotFound
+func GetVideoItem(videoID, viewerID uint) (*VideoListItem, error) {
+	var video models.Video
+	if err := db.Preload("User").Preload("Tags").First(&video, videoID).Error; err != nil {
+		return nil, err
+	}
+	if !CanViewVideo(&video, viewerID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &buildVideoListItems([]models.Video{video})[0], nil
+}
 
-		result = append(result, VideoListItem{
-			ID:          v.ID,
-			Title:       v.Title,
-			Description: v.Description,
-			URL:         v.URL,
-			URL720p:     v.URL720p,
-			URL1080p:    v.URL1080p,
-			CoverURL:    v.CoverURL,
-			UserID:      v.UserID,
-			Username:    v.User.Username,
-			AvatarURL:   v.User.AvatarURL,
-			CreatedAt:   v.CreatedAt.Format("2006-01-02 15:04"),
-			Likes:       likeCount,
-			Comments:    commentCount,
+// UpdateVideoVisibility 修改视频的可见性（调用方负责检查所有权）
+func UpdateVideoVisibility(videoID uint, visibility string) error {
+	return db.Model(&models.Video{}).Where("id = ?", videoID).Update("visibility", visibility).Error
+}
+
+// ====================================== 关注相关数据库操作 ===============================================
+
+// FollowUserItem 关注/粉丝列表项
+type FollowUserItem struct {
+	ID             uint   `json:"id"`
+	Username       string `json:"username"`
+	AvatarURL      string `json:"avatar_url"`
+	FollowerCount  uint   `json:"follower_count"`
+	FollowingCount uint   `json:"following_count"`
+	FollowedAt     string `json:"followed_at"`  // 关注时间
+	IsFollowing    bool   `json:"is_following"` // 当前用户是否关注了该用户（需要登录）
+}
+
+// CreateFollow 关注用户，同一事务中更新双方的关注数/粉丝数
+// 返回：是否新建了关注关系（false 表示之前已关注）、错误
+func CreateFollow(followerID, followeeID uint) (bool, error) {
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		follow := models.Follow{FollowerID: followerID, FolloweeID: followeeID}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // 已关注
+		}
+		created = true
+
+		if err := tx.Model(&models.User{}).Where("id = ?", followerID).
+			UpdateColumn("following_count", gorm.Expr("following_count + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", followeeID).
+			UpdateColumn("follower_count", gorm.Expr("follower_count + 1")).Error
+	})
+	if err != nil {
+		log.Printf("关注失败: follower=%d followee=%d err=%v", followerID, followeeID, err)
+		return false, err
+	}
+	return created, nil
+}
+
+// DeleteFollow 取消关注，同一事务中更新双方的关注数/粉丝数
+// 返回：是否删除了关注关系（false 表示之前未关注）、错误
+func DeleteFollow(followerID, followeeID uint) (bool, error) {
+	deleted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&models.Follow{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // 未关注
+		}
+		deleted = true
+
+		if err := tx.Model(&models.User{}).Where("id = ? AND following_count > 0", followerID).
+			UpdateColumn("following_count", gorm.Expr("following_count - 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ? AND follower_count > 0", followeeID).
+			UpdateColumn("follower_count", gorm.Expr("follower_count - 1")).Error
+	})
+	if err != nil {
+		log.Printf("取消关注失败: follower=%d followee=%d err=%v", followerID, followeeID, err)
+		return false, err
+	}
+	return deleted, nil
+}
+
+// IsFollowing 检查 followerID 是否关注了 followeeID
+func IsFollowing(followerID, followeeID uint) bool {
+	var count int64
+	err := db.Model(&models.Follow{}).
+		Where("follower_id = ? AND followee_id = ?", followerID, followeeID).
+		Count(&count).Error
+	if err != nil {
+		log.Printf("查询关注关系失败: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// GetFollowingSet 批量查询 followerID 关注了 userIDs 中的哪些用户
+func GetFollowingSet(followerID uint, userIDs []uint) (map[uint]bool, error) {
+	set := make(map[uint]bool)
+	if followerID == 0 || len(userIDs) == 0 {
+		return set, nil
+	}
+	var ids []uint
+	err := db.Model(&models.Follow{}).
+		Where("follower_id = ? AND followee_id IN ?", followerID, userIDs).
+		Pluck("followee_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set, nil
+}
+
+// followUserRow 关注列表查询结果
+type followUserRow struct {
+	models.User
+	FollowID   uint
+	FollowedAt time.Time
+}
+
+// listFollowUsers 查询关注/粉丝列表（按关注时间倒序，游标分页）
+// matchColumn: 作为过滤条件的列；userColumn: 需要返回的用户所在的列
+// 返回：用户列表、下一页游标（没有更多时为空）、错误
+func listFollowUsers(matchColumn, userColumn string, userID uint, cursor *Cursor, limit int) ([]FollowUserItem, string, error) {
+	var rows []followUserRow
+	err := db.Table("follows").
+		Select("users.*, follows.id AS follow_id, follows.created_at AS followed_at").
+		Joins("JOIN users ON users.id = follows."+userColumn+" AND users.deleted_at IS NULL").
+		Where("follows."+matchColumn+" = ?", userID).
+		Scopes(cursorScope("follows", cursor)).
+		Order(cursorOrder("follows")).
+		Limit(limit + 1). // 多取一条判断是否还有下一页
+		Scan(&rows).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		nextCursor = EncodeCursor(last.FollowedAt, last.FollowID)
+	}
+
+	result := make([]FollowUserItem, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, FollowUserItem{
+			ID:             r.User.ID,
+			Username:       r.Username,
+			AvatarURL:      r.AvatarURL,
+			FollowerCount:  r.FollowerCount,
+			FollowingCount: r.FollowingCount,
+			FollowedAt:     r.FollowedAt.Format("2006-01-02 15:04"),
 		})
 	}
+	return result, nextCursor, nil
+}
 
-	return result, nil
+// GetFollowers 获取用户的粉丝列表
+func GetFollowers(userID uint, cursor *Cursor, limit int) ([]FollowUserItem, string, error) {
+	return listFollowUsers("followee_id", "follower_id", userID, cursor, limit)
+}
+
+// GetFollowing 获取用户关注的人列表
+func GetFollowing(userID uint, cursor *Cursor, limit int) ([]FollowUserItem, string, error) {
+	return listFollowUsers("follower_id", "followee_id", userID, cursor, limit)
+}
+
+// GetFollowingFeed 获取关注的创作者发布的视频（按发布时间倒序，游标分页）
+// 参数：当前用户ID、游标（第一页为 nil）、每页数量
+// 返回：视频列表、下一页游标（没有更多时为空）、错误
+func GetFollowingFeed(followerID uint, cursor *Cursor, limit int) ([]VideoListItem, string, error) {
+	followees := db.Model(&models.Follow{}).Select("followee_id").Where("follower_id = ?", followerID)
+	query := db.Model(&models.Video{}).
+		Where("videos.user_id IN (?)", followees).
+		Scopes(publicVideoScope)
+
+	videos, nextCursor, err := listVideos(query, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return buildVideoListItems(videos), nextCursor, nil
 }
@@ -0,0 +1,252 @@
+package utils
+
+// 事务发件箱（Transactional Outbox）
+//
+// 需要交给 worker 处理的任务不直接发送到 RabbitMQ，而是先写入 outbox_messages 表：
+//   - 视频处理任务与视频状态更新在同一个 MySQL 事务中写入（ConfirmVideoUpload）；
+//   - 点赞任务在 Redis 更新成功后写入，写入失败时由调用方回滚 Redis 并返回错误；
+//   - 播放量由 views.go 定时从 Redis 取出聚合后的增量写入。
+// 发件箱中继（RunOutboxRelay）轮询到期的待发送消息，通过带 publisher confirms 的生产者投递，
+// broker 确认后标记为已发送；投递失败按指数退避重试，任务不会在 API 与 worker 之间丢失。
+// 投递语义为“至少一次”，worker 需要容忍重复消息（MessageId 为 outbox-<id>）。
+
+import (
+	"backend/models"
+	"common/mq"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 发件箱中继参数
+const (
+	outboxPollInterval    = time.Second     // 轮询间隔（写入新消息时会立即唤醒中继）
+	outboxBatchSize       = 100             // 每批投递的消息数
+	outboxMaxBackoff      = 5 * time.Minute // 重试退避上限
+	outboxRetention       = 24 * time.Hour  // 已发送消息的保留时间
+	outboxCleanupInterval = time.Hour       // 清理已发送消息的间隔
+)
+
+// outboxWakeup 唤醒中继的信号（容量为 1，多次通知合并为一次）
+var outboxWakeup = make(chan struct{}, 1)
+
+// OutboxStats 发件箱状态
+type OutboxStats struct {
+	Pending         int64      `json:"pending"`           // 待发送消息数
+	Retrying        int64      `json:"retrying"`          // 其中投递失败过、正在退避重试的消息数
+	OldestPendingAt *time.Time `json:"oldest_pending_at"` // 最早一条待发送消息的写入时间
+}
+
+// enqueueOutbox 写入一条发件箱消息（tx 为所在事务）
+func enqueueOutbox(tx *gorm.DB, queue string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboxMessage{
+		Queue:         queue,
+		Payload:       string(body),
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// NotifyOutbox 通知中继有新消息（事务提交后调用，不阻塞）
+func NotifyOutbox() {
+	select {
+	case outboxWakeup <- struct{}{}:
+	default:
+	}
+}
+
+// EnqueueLikeTask 写入视频点赞处理任务
+func EnqueueLikeTask(videoID uint, userID uint, delta int) error {
+	err := enqueueOutbox(db, QueueVideoLikeName, LikeTask{
+		VideoID: videoID,
+		UserID:  userID,
+		Delta:   delta,
+		TS:      time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+	NotifyOutbox()
+	return nil
+}
+
+// EnqueueCommentLikeTask 写入评论点赞处理任务
+func EnqueueCommentLikeTask(commentID uint, userID uint, delta int) error {
+	err := enqueueOutbox(db, QueueCommentLikeName, CommentLikeTask{
+		CommentID: commentID,
+		UserID:    userID,
+		Delta:     delta,
+		TS:        time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+	NotifyOutbox()
+	return nil
+}
+
+// GetOutboxStats 获取发件箱状态（运维命令使用）
+func GetOutboxStats() (*OutboxStats, error) {
+	var stats OutboxStats
+	pending := db.Model(&models.OutboxMessage{}).Where("status = ?", models.OutboxStatusPending)
+	if err := pending.Session(&gorm.Session{}).Count(&stats.Pending).Error; err != nil {
+		return nil, err
+	}
+	if stats.Pending == 0 {
+		return &stats, nil
+	}
+	if err := pending.Session(&gorm.Session{}).Where("attempts > 0").Count(&stats.Retrying).Error; err != nil {
+		return nil, err
+	}
+	var oldest models.OutboxMessage
+	if err := pending.Session(&gorm.Session{}).Order("id ASC").First(&oldest).Error; err != nil {
+		return nil, err
+	}
+	stats.OldestPendingAt = &oldest.CreatedAt
+	return &stats, nil
+}
+
+// RunOutboxRelay 发件箱中继：持续投递待发送消息并定期清理已发送消息（阻塞运行，需在 goroutine 中调用）
+func RunOutboxRelay() {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-outboxWakeup:
+		}
+
+		// 积压较多时连续投递，直到取不满一批
+		for {
+			count, err := relayOutboxBatch()
+			if err != nil {
+				log.Printf("发件箱投递失败: %v", err)
+				break
+			}
+			if count < outboxBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) >= outboxCleanupInterval {
+			lastCleanup = time.Now()
+			if err := purgeSentOutbox(); err != nil {
+				log.Printf("清理已发送的发件箱消息失败: %v", err)
+			}
+		}
+	}
+}
+
+// relayOutboxBatch 投递一批到期的待发送消息
+// 使用 FOR UPDATE SKIP LOCKED 锁定消息，多个后端实例同时运行中继时不会重复投递同一批消息
+// 返回：本批取到的消息数、错误
+func relayOutboxBatch() (int, error) {
+	count := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var messages []models.OutboxMessage
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, time.Now()).
+			Order("id ASC").
+			Limit(outboxBatchSize).
+			Find(&messages).Error
+		if err != nil {
+			return err
+		}
+		count = len(messages)
+		if count == 0 {
+			return nil
+		}
+
+		results := publishOutboxMessages(messages)
+
+		now := time.Now()
+		sentIDs := make([]uint, 0, count)
+		for i, msg := range messages {
+			if results[i] == nil {
+				sentIDs = append(sentIDs, msg.ID)
+				continue
+			}
+			attempts := msg.Attempts + 1
+			reason := results[i].Error()
+			if len(reason) > 512 {
+				reason = reason[:512]
+			}
+			err := tx.Model(&models.OutboxMessage{}).Where("id = ?", msg.ID).Updates(map[string]interface{}{
+				"attempts":        attempts,
+				"next_attempt_at": now.Add(outboxBackoff(attempts)),
+				"last_error":      reason,
+			}).Error
+			if err != nil {
+				return err
+			}
+			log.Printf("发件箱消息投递失败，稍后重试: ID=%d, Queue=%s, Attempts=%d, Error=%v", msg.ID, msg.Queue, attempts, results[i])
+		}
+
+		if len(sentIDs) == 0 {
+			return nil
+		}
+		return tx.Model(&models.OutboxMessage{}).Where("id IN ?", sentIDs).Updates(map[string]interface{}{
+			"status":   models.OutboxStatusSent,
+			"sent_at":  now,
+			"attempts": gorm.Expr("attempts + 1"),
+		}).Error
+	})
+	// 标记失败时已投递的消息会在下一轮再次投递（至少一次），由 worker 保证幂等
+	return count, err
+}
+
+// publishOutboxMessages 投递一批消息并等待 broker 确认（按 ID 顺序在同一通道上发布）
+// 返回：与 messages 一一对应的投递结果（nil 表示 broker 已确认）
+func publishOutboxMessages(messages []models.OutboxMessage) []error {
+	batch := make([]mq.Message, len(messages))
+	for i, msg := range messages {
+		batch[i] = mq.Message{
+			Key: msg.Queue, // 默认交换机，routing key 为队列名称
+			Publishing: amqp.Publishing{
+				DeliveryMode: amqp.Persistent, // 持久化消息
+				ContentType:  "application/json",
+				MessageId:    fmt.Sprintf("outbox-%d", msg.ID),
+				Timestamp:    msg.CreatedAt,
+				Body:         []byte(msg.Payload),
+			},
+		}
+	}
+	return rabbitPublisher.PublishBatch(context.Background(), batch)
+}
+
+// outboxBackoff 第 attempts 次投递失败后的退避时间：1s、2s、4s ... 最长 outboxMaxBackoff
+func outboxBackoff(attempts int) time.Duration {
+	if attempts > 20 {
+		return outboxMaxBackoff
+	}
+	backoff := time.Second << (attempts - 1)
+	if backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return backoff
+}
+
+// purgeSentOutbox 删除超过保留时间的已发送消息
+func purgeSentOutbox() error {
+	result := db.Where("status = ? AND sent_at < ?", models.OutboxStatusSent, time.Now().Add(-outboxRetention)).
+		Delete(&models.OutboxMessage{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已清理 %d 条已发送的发件箱消息", result.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package utils
+
+// 视频播放地址
+//
+// 存储桶是私有的（只有默认头像等公开资源允许匿名读取），返回给客户端的视频、封面地址都是按请求签发的预签名URL，有效期 PlaybackURLExpiry。
+// HLS 播放列表中的相对地址无法携带签名，因此播放列表经 backend 转发，转发时改写其中的地址：
+//   GET /api/video/:id/hls/master.m3u8?token=...       子播放列表地址改写为同一接口（携带同一个令牌）
+//   GET /api/video/:id/hls/720p/index.m3u8?token=...   切片地址改写为预签名URL
+// 令牌绑定视频ID（见 GeneratePlaybackToken），只在返回视频信息时签发给有权观看该视频的用户，过期后需要重新获取视频信息。
+
+import (
+	"backend/models"
+	"common/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	HLSMasterPlaylist = "master.m3u8" // HLS 主播放列表文件名（与 worker 保持一致）
+	maxPlaylistSize   = 1 << 20       // 转发的播放列表最大字节数
+)
+
+// ErrPlaylistNotFound 播放列表不存在
+var ErrPlaylistNotFound = errors.New("播放列表不存在")
+
+// playlistURIAttr 播放列表标签中的 URI 属性（如 #EXT-X-MEDIA、#EXT-X-KEY、#EXT-X-MAP）
+var playlistURIAttr = regexp.MustCompile(`URI="([^"]*)"`)
+
+// CanViewVideo 用户能否观看视频（视频详情、播放、评论、点赞等直接访问视频的操作）
+// 已发布的公开和不公开视频所有人都可以观看；私密视频和未发布的视频只有作者本人可以观看
+// viewerID 为 0 表示未登录
+func CanViewVideo(video *models.Video, viewerID uint) bool {
+	if viewerID != 0 && video.UserID == viewerID {
+		return true
+	}
+	return video.Status == models.VideoStatusPublished && video.Visibility != models.VisibilityPrivate
+}
+
+// HLSPlaylistURL 经 backend 转发的 HLS 播放列表地址
+// 参数：视频ID、播放令牌、播放列表相对 HLS 目录的路径（如 master.m3u8、720p/index.m3u8）
+func HLSPlaylistURL(videoID uint, token, name string) string {
+	return fmt.Sprintf("%s/api/video/%d/hls/%s?token=%s", config.Conf.Server.BaseURL(), videoID, name, url.QueryEscape(token))
+}
+
+// signPlaybackURLs 把列表项中的文件地址换成预签名URL，HLS 地址换成带播放令牌的转发地址
+func signPlaybackURLs(item *VideoListItem) {
+	item.URL = PresignURL(item.URL)
+	item.URL720p = PresignURL(item.URL720p)
+	item.URL1080p = PresignURL(item.URL1080p)
+	item.CoverURL = PresignURL(item.CoverURL)
+	if item.HLSURL == "" {
+		return
+	}
+	token, err := GeneratePlaybackToken(item.ID)
+	if err != nil {
+		item.HLSURL = "" // 客户端回退到 MP4 播放
+		return
+	}
+	item.HLSURL = HLSPlaylistURL(item.ID, token, HLSMasterPlaylist)
+}
+
+// RenderHLSPlaylist 读取视频的 HLS 播放列表，并改写其中的地址：
+// 子播放列表改写为带同一令牌的转发地址，切片等其他文件改写为预签名URL，绝对地址保持不变
+// 参数：视频（需要 ID、FileName）、播放列表相对 HLS 目录的路径、播放令牌
+func RenderHLSPlaylist(video *models.Video, name, token string) ([]byte, error) {
+	dir := HLSPrefix + strings.TrimSuffix(video.FileName, filepath.Ext(video.FileName)) + "/"
+
+	obj, err := mc.GetObject(context.Background(), MinioBucket, dir+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(io.LimitReader(obj, maxPlaylistSize))
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrPlaylistNotFound
+		}
+		return nil, err
+	}
+
+	// 地址相对于当前播放列表所在目录
+	resolve := func(uri string) string {
+		if uri == "" || strings.Contains(uri, "://") {
+			return uri
+		}
+		rel := path.Join(path.Dir(name), uri)
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			return uri // 不允许引用 HLS 目录之外的文件
+		}
+		if strings.HasSuffix(rel, ".m3u8") {
+			return HLSPlaylistURL(video.ID, token, rel)
+		}
+		return PresignObjectURL(dir + rel)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			lines[i] = playlistURIAttr.ReplaceAllStringFunc(trimmed, func(attr string) string {
+				return fmt.Sprintf(`URI="%s"`, resolve(playlistURIAttr.FindStringSubmatch(attr)[1]))
+			})
+		default:
+			lines[i] = resolve(trimmed)
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
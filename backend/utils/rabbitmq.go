@@ -1,24 +1,26 @@
 package utils
 
-// RabbitMQ 生产者
+// RabbitMQ 生产者（任务经事务发件箱投递，见 outbox.go）
 
 import (
-	"backend/config"
-	"encoding/json"
-	"fmt"
+	"common/config"
+	"common/mq"
+	"context"
 	"log"
-	"time"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// RabbitMQ 连接实例
-var rabbitConn *amqp.Connection
-var rabbitChannel *amqp.Channel
+// RabbitMQ 连接实例（断线自动重连）和生产者（通道池 + publisher confirms）
+var rabbitConn *mq.Connection
+var rabbitPublisher *mq.Publisher
 
-// RabbitMQ 配置
+// RabbitMQ 配置（队列拓扑与 worker 共用 common/mq 中的定义）
 const (
-	QueueVideoName = "video_processing" // 视频封面，转码处理 队列名称
-	QueueVideoLikeName = "video_like_processing"   // 新增：点赞处理队列
+	QueueVideoName        = mq.QueueVideoName        // 视频封面，转码处理 队列名称
+	QueueVideoLikeName    = mq.QueueVideoLikeName    // 点赞处理队列
+	QueueCommentLikeName  = mq.QueueCommentLikeName  // 评论点赞处理队列
+	QueueVideoViewName    = mq.QueueVideoViewName    // 播放量落库队列
+	QueueVideoCleanupName = mq.QueueVideoCleanupName // 视频删除后的级联清理队列
 )
 
 // VideoTask 视频处理任务结构
@@ -32,139 +34,90 @@ type LikeTask struct {
 	VideoID uint  `json:"video_id"`
 	UserID  uint  `json:"user_id"`
 	Delta   int   `json:"delta"` // +1 点赞；-1 取消
-	TS      int64 `json:"ts"`    // TS: time.Now().Unix() 时间戳
+	TS      int64 `json:"ts"`    // TS: 事件时间（time.Now().UnixMilli() 毫秒时间戳）
 }
 
-// InitRabbitMQ 初始化 RabbitMQ 连接
-func InitRabbitMQ() error {
-	// 构建 RabbitMQ 连接地址
-	rabbitMQURL := fmt.Sprintf("amqp://%s:%s@%s:%s/",
-		config.RabbitMQUsername,
-		config.RabbitMQPassword,
-		config.RabbitMQHost,
-		config.RabbitMQPort)
-
-	// 连接到 RabbitMQ 服务器
-	conn, err := amqp.Dial(rabbitMQURL)
-	if err != nil {
-		return err
-	}
-	rabbitConn = conn
-
-	// 创建一个通道
-	ch, err := conn.Channel()
-	if err != nil {
-		return err
-	}
-	rabbitChannel = ch
-
-	// 声明视频处理队列（如果队列不存在则创建）
-	_, err = ch.QueueDeclare(
-		QueueVideoName, // 队列名称
-		true,           // durable: 持久化队列
-		false,          // autoDelete: 不自动删除
-		false,          // exclusive: 非独占队列
-		false,          // noWait: 不等待服务器确认
-		nil,            // arguments: 额外参数
-	)
-	if err != nil {
-		return err
-	}
+// CommentLikeTask 评论点赞处理任务结构
+type CommentLikeTask struct {
+	CommentID uint  `json:"comment_id"`
+	UserID    uint  `json:"user_id"`
+	Delta     int   `json:"delta"` // +1 点赞；-1 取消
+	TS        int64 `json:"ts"`    // TS: 事件时间（time.Now().UnixMilli() 毫秒时间戳）
+}
 
-	// 声明点赞处理队列（如果队列不存在则创建）
-	_, err = ch.QueueDeclare(
-		QueueVideoLikeName, // 队列名称
-		true,               // durable: 持久化队列
-		false,              // autoDelete: 不自动删除
-		false,              // exclusive: 非独占队列
-		false,              // noWait: 不等待服务器确认
-		nil,                // arguments: 额外参数
-	)
-	if err != nil {
-		return err
-	}
+// ViewTask 播放量落库任务结构（一批聚合后的播放增量）
+type ViewTask struct {
+	FlushID string      `json:"flush_id"` // 批次ID，worker 按它去重
+	Videos  []ViewDelta `json:"videos"`
+}
 
-	log.Println("RabbitMQ 连接成功")
-	return nil
+// ViewDelta 单个视频的播放增量
+type ViewDelta struct {
+	VideoID    uint    `json:"video_id"`
+	Views      int64   `json:"views"`      // 新增播放次数
+	Completion float64 `json:"completion"` // 新增的完播比例之和
 }
 
-// PublishVideoTask 发送视频处理任务到队列
-// 参数：视频ID、文件名
-// 返回：错误
-func PublishVideoTask(videoID uint, filename string) error {
-	// 构造任务消息
-	task := VideoTask{
-		VideoID:  videoID,
-		FileName: filename,
-	}
+// VideoCleanupTask 视频删除后的清理任务结构
+type VideoCleanupTask struct {
+	VideoID  uint   `json:"video_id"`  // 视频ID
+	FileName string `json:"file_name"` // 原视频文件名（派生文件按它的前缀查找）
+}
 
-	// 序列化为JSON，JSON字符串在内存中就是[]byte类型的
-	body, err := json.Marshal(task)
-	if err != nil {
-		return err
-	}
+// InitRabbitMQ 初始化 RabbitMQ 连接
+func InitRabbitMQ() error {
+	cfg := config.Conf.RabbitMQ
 
-	// 发送消息到队列
-	err = rabbitChannel.Publish(
-		"",        // exchange: 使用默认交换机
-		QueueVideoName, // routing key: 队列名称
-		false,     // mandatory: 不强制
-		false,     // immediate: 不立即
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent, // 持久化消息
-			ContentType:  "application/json",
-			Body:         body,
-		},
-	)
+	// 连接到 RabbitMQ 服务器；每次（重新）连接后声明视频处理、点赞处理队列以及对应的重试队列和死信队列
+	// （幂等，worker 启动时也会声明）
+	conn, err := mq.Dial(cfg.URL(), cfg.ReconnectMaxBackoff, mq.DeclareTopology)
 	if err != nil {
 		return err
 	}
+	rabbitConn = conn
+	rabbitPublisher = mq.NewPublisher(conn, cfg.ChannelPoolSize, cfg.PublishTimeout)
 
-	log.Printf("视频处理任务已发送到队列: VideoID=%d, FileName=%s", videoID, filename)
+	log.Println("RabbitMQ 连接成功")
 	return nil
 }
 
-// PublishLikeTask 发送点赞处理任务到队列
-func PublishLikeTask(videoID uint, userID uint, delta int) error {
-	// 构造任务消息
-	task := LikeTask{
-		VideoID: videoID,
-		UserID:  userID,
-		Delta:   delta,
-		TS:      time.Now().Unix(),
-	}
+// openRabbitChannel 打开一个临时通道（运维命令使用，用完需关闭）
+func openRabbitChannel() (*amqp.Channel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Conf.RabbitMQ.PublishTimeout)
+	defer cancel()
+	return rabbitConn.Channel(ctx)
+}
 
-	// 序列化为JSON
-	body, err := json.Marshal(task)
+// ListDeadLetters 查看某个队列的死信消息（不会移除消息）
+// 参数：业务队列名称、最多返回条数
+func ListDeadLetters(queue string, limit int) ([]mq.DeadLetterMessage, error) {
+	ch, err := openRabbitChannel()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer ch.Close()
+	return mq.PeekDeadLetters(ch, queue, limit)
+}
 
-	// 发送消息到队列
-	err = rabbitChannel.Publish(
-		"",                // exchange: 使用默认交换机
-		QueueVideoLikeName, // routing key: 队列名称
-		false,             // mandatory: 不强制
-		false,             // immediate: 不立即
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent, // 持久化消息
-			ContentType:  "application/json",
-			Body:         body,
-		},
-	)
+// RedriveDeadLetters 将某个队列的死信消息重新投递回业务队列
+// 参数：业务队列名称、最多投递条数
+// 返回：实际投递的消息数量
+func RedriveDeadLetters(queue string, limit int) (int, error) {
+	ch, err := openRabbitChannel()
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer ch.Close()
 
-	log.Printf("点赞处理任务已发送到队列: VideoID=%d, UserID=%d, Delta=%d", videoID, userID, delta)
-	return nil
+	count, err := mq.Redrive(ch, queue, limit)
+	if count > 0 {
+		log.Printf("死信消息已重新投递: Queue=%s, Count=%d", queue, count)
+	}
+	return count, err
 }
 
 // CloseRabbitMQ 关闭 RabbitMQ 连接
 func CloseRabbitMQ() {
-	if rabbitChannel != nil {
-		rabbitChannel.Close()
-	}
 	if rabbitConn != nil {
 		rabbitConn.Close()
 	}
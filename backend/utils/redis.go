@@ -1,7 +1,7 @@
 package utils
 
 import (
-	"backend/config"
+	"common/config"
 	"context"
 	"fmt"
 	"github.com/redis/go-redis/v9"
@@ -12,21 +12,12 @@ import (
 // Redis 客户端实例
 var rdb *redis.Client
 
-// Redis Key 前缀
-const (
-	TokenPrefix     = "token:"     // 有效 token 前缀
-	BlacklistPrefix = "blacklist:" // 黑名单 token 前缀
-)
-
-// Token 过期时间（与 JWT 过期时间一致）
-const TokenExpiration = 24 * time.Hour
-
 // InitRedis 初始化 Redis 连接
 func InitRedis() error {
 	rdb = redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", config.RedisHost, config.RedisPort),
-		Password: config.RedisPassword,
-		DB:       0,
+		Addr:     config.Conf.Redis.Addr(),
+		Password: config.Conf.Redis.Password,
+		DB:       config.Conf.Redis.DB,
 	})
 
 	// 测试连接
@@ -40,43 +31,6 @@ func InitRedis() error {
 	return nil
 }
 
-// SaveToken 保存 token 到 Redis
-// 参数：用户名、token
-func SaveToken(username, token string) error {
-	ctx := context.Background()
-	key := TokenPrefix + username
-	return rdb.Set(ctx, key, token, TokenExpiration).Err()
-}
-
-// AddToBlacklist 将 token 加入黑名单
-// 参数：token、剩余过期时间
-func AddToBlacklist(token string, expiration time.Duration) error {
-	ctx := context.Background()
-	key := BlacklistPrefix + token
-	// 黑名单中的 token 只需要保存到原 token 过期即可
-	return rdb.Set(ctx, key, "1", expiration).Err()
-}
-
-// IsBlacklisted 检查 token 是否在黑名单中
-// 参数：token
-// 返回：是否在黑名单中
-func IsBlacklisted(token string) bool {
-	ctx := context.Background()
-	key := BlacklistPrefix + token
-	exists, err := rdb.Exists(ctx, key).Result()
-	if err != nil {
-		return false
-	}
-	return exists > 0
-}
-
-// DeleteUserToken 删除用户的 token（用于登出时清理）
-func DeleteUserToken(username string) error {
-	ctx := context.Background()
-	key := TokenPrefix + username
-	return rdb.Del(ctx, key).Err()
-}
-
 // ============================= 点赞排行榜相关 =====================================
 
 // Redis Key 常量
@@ -103,14 +57,14 @@ func IncrVideoLikeRank(videoID uint, delta int) (int64, error) {
 }
 
 
-// GetTopLikedVideos 获取点赞排行榜前N个视频
-// 参数：数量限制
+// GetTopLikedVideos 获取点赞排行榜中从第 offset 名开始的 limit 个视频
+// 参数：偏移量（从0开始）、数量限制
 // 返回：视频ID列表（按点赞数降序）、错误
-func GetTopLikedVideos(limit int) ([]uint, error) {
+func GetTopLikedVideos(offset, limit int) ([]uint, error) {
 	ctx := context.Background()
 	
-	// ZREVRANGE rank:video:like 0 limit-1
-	results, err := rdb.ZRevRange(ctx, VideoLikeRankKey, 0, int64(limit-1)).Result()
+	// ZREVRANGE rank:video:like offset offset+limit-1
+	results, err := rdb.ZRevRange(ctx, VideoLikeRankKey, int64(offset), int64(offset+limit-1)).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -214,6 +168,51 @@ func GetAllVideoLikeRanks() (map[uint]int64, error) {
 	return videoScores, nil
 }
 
+// ======================================评论计数zset操作
+
+// VideoCommentRankKey 视频评论数 ZSET（score 为评论数，与点赞排行榜结构相同）
+const VideoCommentRankKey = "rank:video:comment"
+
+// IncrVideoCommentCount 修改视频的评论数（评论事务提交后调用）
+// 参数：视频ID、增量（发表评论 +1，删除评论为负的删除条数）
+// 返回：新的评论数、错误
+func IncrVideoCommentCount(videoID uint, delta int64) (int64, error) {
+	ctx := context.Background()
+	newScore, err := rdb.ZIncrBy(ctx, VideoCommentRankKey, float64(delta), fmt.Sprintf("%d", videoID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	return int64(newScore), nil
+}
+
+// InitVideoCommentRank 初始化视频评论数 ZSET（Redis 中不存在时从 MySQL 的 videos.comment_count 加载）
+func InitVideoCommentRank() error {
+	ctx := context.Background()
+	exists, err := rdb.Exists(ctx, VideoCommentRankKey).Result()
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	counts, err := GetAllVideoCommentCounts()
+	if err != nil {
+		return err
+	}
+	members := make([]redis.Z, 0, len(counts))
+	for videoID, count := range counts {
+		members = append(members, redis.Z{
+			Score:  float64(count),
+			Member: fmt.Sprintf("%d", videoID),
+		})
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return rdb.ZAdd(ctx, VideoCommentRankKey, members...).Err()
+}
+
 // =====================================防重复点赞set操作
 
 // IsUserLikedVideo 检查用户是否已点赞该视频
@@ -232,6 +231,35 @@ func IsUserLikedVideo(videoID uint, userID uint) (bool, error) {
 	return exists, nil
 }
 
+// GetUserLikedVideoSet 批量查询用户点赞了 videoIDs 中的哪些视频（视频列表的 is_liked）
+// 以 Redis 点赞集合为准：likes 表经发件箱和 MQ 异步落库，刚点赞后还查不到
+// 参数：用户ID、视频ID列表
+// 返回：已点赞的视频ID集合、错误
+func GetUserLikedVideoSet(userID uint, videoIDs []uint) (map[uint]bool, error) {
+	liked := make(map[uint]bool)
+	if userID == 0 || len(videoIDs) == 0 {
+		return liked, nil
+	}
+
+	// 每个视频一次 SISMEMBER，在一个 pipeline 中发送
+	ctx := context.Background()
+	member := fmt.Sprintf("%d", userID)
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.BoolCmd, len(videoIDs))
+	for i, videoID := range videoIDs {
+		cmds[i] = pipe.SIsMember(ctx, fmt.Sprintf("%s%d", VideoLikeSetKey, videoID), member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	for i, videoID := range videoIDs {
+		if cmds[i].Val() {
+			liked[videoID] = true
+		}
+	}
+	return liked, nil
+}
+
 // AddUserLikeVideo 添加用户点赞记录
 // 参数：视频ID、用户ID
 // 返回：是否成功添加（false表示已存在）、错误
@@ -265,3 +293,238 @@ func RemoveUserLikeVideo(videoID uint, userID uint) (bool, error) {
 	// removed > 0 表示成功移除，= 0 表示不存在
 	return removed > 0, nil
 }
+
+// =====================================点赞对账
+
+// ReconcileLockKey 点赞对账分布式锁（多个 backend 实例只有一个执行定时对账）
+const ReconcileLockKey = "lock:reconcile:like"
+
+// VideoLikeState 视频在 Redis 中的点赞状态
+type VideoLikeState struct {
+	UserIDs []uint // like:video:<id> 集合中的用户ID
+	Rank    int64  // rank:video:like 中的分数（不在排行榜中为0）
+	InRank  bool   // 是否在排行榜中（取消最后一个点赞后仍保留分数为0的成员，集合和成员都不存在说明该视频的数据丢失）
+}
+
+// VideoLikeRankExists 检查点赞排行榜是否存在（Redis 数据丢失后不存在）
+func VideoLikeRankExists() (bool, error) {
+	ctx := context.Background()
+	n, err := rdb.Exists(ctx, VideoLikeRankKey).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetVideoLikeStates 批量读取视频在 Redis 中的点赞用户集合和排行榜分数
+// 参数：视频ID列表
+// 返回：视频ID到点赞状态的映射、错误
+func GetVideoLikeStates(videoIDs []uint) (map[uint]VideoLikeState, error) {
+	ctx := context.Background()
+	pipe := rdb.Pipeline()
+	setCmds := make([]*redis.StringSliceCmd, len(videoIDs))
+	rankCmds := make([]*redis.FloatCmd, len(videoIDs))
+	for i, id := range videoIDs {
+		setCmds[i] = pipe.SMembers(ctx, fmt.Sprintf("%s%d", VideoLikeSetKey, id))
+		rankCmds[i] = pipe.ZScore(ctx, VideoLikeRankKey, fmt.Sprintf("%d", id))
+	}
+	// 不在排行榜中的视频 ZSCORE 返回 redis.Nil，不算错误
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	states := make(map[uint]VideoLikeState, len(videoIDs))
+	for i, id := range videoIDs {
+		members := setCmds[i].Val()
+		userIDs := make([]uint, 0, len(members))
+		for _, m := range members {
+			var userID uint
+			if _, err := fmt.Sscanf(m, "%d", &userID); err == nil {
+				userIDs = append(userIDs, userID)
+			}
+		}
+		states[id] = VideoLikeState{
+			UserIDs: userIDs,
+			Rank:    int64(rankCmds[i].Val()),
+			InRank:  rankCmds[i].Err() == nil,
+		}
+	}
+	return states, nil
+}
+
+// ReplaceVideoLikeState 用给定的点赞用户覆盖视频在 Redis 中的点赞集合和排行榜分数
+// 没有点赞的视频会从排行榜中移除
+func ReplaceVideoLikeState(videoID uint, userIDs []uint) error {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s%d", VideoLikeSetKey, videoID)
+	member := fmt.Sprintf("%d", videoID)
+
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(userIDs) > 0 {
+		members := make([]interface{}, 0, len(userIDs))
+		for _, userID := range userIDs {
+			members = append(members, fmt.Sprintf("%d", userID))
+		}
+		pipe.SAdd(ctx, key, members...)
+		pipe.ZAdd(ctx, VideoLikeRankKey, redis.Z{Score: float64(len(userIDs)), Member: member})
+	} else {
+		pipe.ZRem(ctx, VideoLikeRankKey, member)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SetVideoLikeRank 设置视频在排行榜中的点赞数（为0时从排行榜移除）
+func SetVideoLikeRank(videoID uint, count int64) error {
+	ctx := context.Background()
+	member := fmt.Sprintf("%d", videoID)
+	if count <= 0 {
+		return rdb.ZRem(ctx, VideoLikeRankKey, member).Err()
+	}
+	return rdb.ZAdd(ctx, VideoLikeRankKey, redis.Z{Score: float64(count), Member: member}).Err()
+}
+
+// RemoveVideoLikeState 删除视频的点赞集合并从排行榜移除（视频已不存在时使用）
+func RemoveVideoLikeState(videoID uint) error {
+	ctx := context.Background()
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, fmt.Sprintf("%s%d", VideoLikeSetKey, videoID))
+	pipe.ZRem(ctx, VideoLikeRankKey, fmt.Sprintf("%d", videoID))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// releaseLockScript 只有锁的持有者才能释放锁
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// TryLock 尝试获取分布式锁
+// 参数：锁的key、锁的过期时间（持有者异常退出时自动释放）
+// 返回：释放锁的函数、是否获取成功、错误
+func TryLock(key string, ttl time.Duration) (func(), bool, error) {
+	ctx := context.Background()
+	token, err := randomToken(16)
+	if err != nil {
+		return nil, false, err
+	}
+	ok, err := rdb.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	release := func() {
+		releaseLockScript.Run(context.Background(), rdb, []string{key}, token)
+	}
+	return release, true, nil
+}
+
+// =====================================评论点赞set操作
+
+// CommentLikeSetKey 评论点赞用户集合 SET 前缀（like:comment:<commentID>）
+const CommentLikeSetKey = "like:comment:"
+
+// IsUserLikedComment 检查用户是否已点赞该评论
+func IsUserLikedComment(commentID uint, userID uint) (bool, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s%d", CommentLikeSetKey, commentID)
+
+	// SISMEMBER like:comment:<commentID> userID
+	return rdb.SIsMember(ctx, key, fmt.Sprintf("%d", userID)).Result()
+}
+
+// AddUserLikeComment 添加用户评论点赞记录
+// 返回：是否成功添加（false表示已存在）、当前点赞数、错误
+func AddUserLikeComment(commentID uint, userID uint) (bool, int64, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s%d", CommentLikeSetKey, commentID)
+
+	pipe := rdb.TxPipeline()
+	added := pipe.SAdd(ctx, key, fmt.Sprintf("%d", userID))
+	count := pipe.SCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, err
+	}
+	return added.Val() > 0, count.Val(), nil
+}
+
+// RemoveUserLikeComment 移除用户评论点赞记录
+// 返回：是否成功移除（false表示不存在）、当前点赞数、错误
+func RemoveUserLikeComment(commentID uint, userID uint) (bool, int64, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s%d", CommentLikeSetKey, commentID)
+
+	pipe := rdb.TxPipeline()
+	removed := pipe.SRem(ctx, key, fmt.Sprintf("%d", userID))
+	count := pipe.SCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, err
+	}
+	return removed.Val() > 0, count.Val(), nil
+}
+
+// GetUserLikedComments 批量查询用户点赞了哪些评论
+// 参数：用户ID、评论ID列表
+// 返回：已点赞的评论ID集合
+func GetUserLikedComments(userID uint, commentIDs []uint) (map[uint]bool, error) {
+	liked := make(map[uint]bool)
+	if userID == 0 || len(commentIDs) == 0 {
+		return liked, nil
+	}
+
+	ctx := context.Background()
+	member := fmt.Sprintf("%d", userID)
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.BoolCmd, len(commentIDs))
+	for i, id := range commentIDs {
+		cmds[i] = pipe.SIsMember(ctx, fmt.Sprintf("%s%d", CommentLikeSetKey, id), member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		if cmd.Val() {
+			liked[commentIDs[i]] = true
+		}
+	}
+	return liked, nil
+}
+
+// CommentLikeReadyKey 评论点赞集合已从 MySQL 建立的标记
+// 评论的最后一个点赞被取消后集合随之删除，无法按集合是否存在判断 Redis 数据是否丢失；标记不存在说明 Redis 被清空过，需要从 MySQL 重建
+const CommentLikeReadyKey = "like:comment:ready"
+
+// CommentLikeSetsReady 检查评论点赞集合是否已建立（Redis 数据丢失后标记不存在）
+func CommentLikeSetsReady() (bool, error) {
+	n, err := rdb.Exists(context.Background(), CommentLikeReadyKey).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// MarkCommentLikeSetsReady 从 MySQL 重建评论点赞集合后设置标记
+func MarkCommentLikeSetsReady() error {
+	return rdb.Set(context.Background(), CommentLikeReadyKey, "1", 0).Err()
+}
+
+// ReplaceCommentLikeState 用给定的点赞用户覆盖评论在 Redis 中的点赞集合
+func ReplaceCommentLikeState(commentID uint, userIDs []uint) error {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s%d", CommentLikeSetKey, commentID)
+
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(userIDs) > 0 {
+		members := make([]interface{}, 0, len(userIDs))
+		for _, userID := range userIDs {
+			members = append(members, fmt.Sprintf("%d", userID))
+		}
+		pipe.SAdd(ctx, key, members...)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
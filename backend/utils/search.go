@@ -0,0 +1,229 @@
+package utils
+
+// 视频搜索
+//
+// 搜索通过 Searcher 接口完成，默认实现 MySQLSearcher 使用 MySQL FULLTEXT 索引（ngram 分词，支持中文）：
+//   videos(title, description)  标题 + 描述，用于召回
+//   videos(title)               标题单独加权
+//   users(username)             按上传者用户名召回
+// 另外关键词中的每个词（去掉 #）与话题名精确匹配，命中话题的视频同样召回。
+// 相关度 = MATCH(标题, 描述) + MATCH(标题) + 2 * MATCH(用户名) + 3 * 命中的话题数，再按点赞数做对数加权：
+//   score = 相关度 * (1 + log10(1 + like_count) / 10)
+// 结果按 (score, id) 降序，score 放大 10^6 取整后作为游标中的分数（见 cursor.go）。
+// ngram 默认按 2 个字符切分（ngram_token_size），单个字符的关键词匹配不到结果。
+// 以后接入外部搜索引擎时只需实现 Searcher 接口，游标格式由实现自行定义。
+
+import (
+	"backend/models"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SearchQuery 搜索条件
+type SearchQuery struct {
+	Keyword  string    // 关键词
+	Uploader string    // 上传者用户名（精确匹配），为空不限
+	From     time.Time // 发布时间下限（含），零值不限
+	To       time.Time // 发布时间上限（不含），零值不限
+	MinLikes uint      // 最少点赞数
+	Cursor   string    // 上一页返回的游标，第一页为空
+	Limit    int       // 每页数量
+}
+
+// SearchHit 一条搜索结果
+type SearchHit struct {
+	VideoID uint
+	Score   float64 // 排序分数（越大越靠前）
+}
+
+// Searcher 视频搜索引擎
+type Searcher interface {
+	// Search 按相关度降序返回一页结果（只包含已发布的视频）和下一页游标（为空表示没有更多）
+	Search(q SearchQuery) ([]SearchHit, string, error)
+}
+
+// MySQLSearcher 基于 MySQL FULLTEXT 索引的搜索实现
+type MySQLSearcher struct{}
+
+// searchScoreScale 分数放大倍数（取整后用于排序和游标）
+const searchScoreScale = 1000000
+
+// Search 实现 Searcher 接口
+func (MySQLSearcher) Search(q SearchQuery) ([]SearchHit, string, error) {
+	cursor, err := DecodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 1. 召回：标题/描述命中、上传者用户名命中（分别走各自的 FULLTEXT 索引），或话题名命中
+	where := []string{
+		`v.id IN (
+			SELECT id FROM videos WHERE MATCH(title, description) AGAINST (? IN NATURAL LANGUAGE MODE)
+			UNION
+			SELECT videos.id FROM videos JOIN users ON users.id = videos.user_id
+			WHERE MATCH(users.username) AGAINST (? IN NATURAL LANGUAGE MODE)
+			UNION
+			SELECT video_tags.video_id FROM video_tags JOIN tags ON tags.id = video_tags.tag_id
+			WHERE tags.name IN ?
+		)`,
+		"v.deleted_at IS NULL",
+		"v.status = ?",
+		"v.visibility = ?",
+	}
+	tagNames := searchTagNames(q.Keyword)
+	args := []interface{}{q.Keyword, q.Keyword, tagNames, models.VideoStatusPublished, models.VisibilityPublic}
+
+	// 2. 过滤条件
+	if q.Uploader != "" {
+		where = append(where, "u.username = ?")
+		args = append(args, q.Uploader)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "v.created_at >= ?")
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		where = append(where, "v.created_at < ?")
+		args = append(args, q.To)
+	}
+	if q.MinLikes > 0 {
+		where = append(where, "v.like_count >= ?")
+		args = append(args, q.MinLikes)
+	}
+
+	// 3. 计算分数（相关度按点赞数加权），按 (score, id) 降序取游标之后的一页
+	scoreExpr := fmt.Sprintf(`CAST(ROUND((
+			MATCH(v.title, v.description) AGAINST (? IN NATURAL LANGUAGE MODE)
+			+ MATCH(v.title) AGAINST (? IN NATURAL LANGUAGE MODE)
+			+ 2 * MATCH(u.username) AGAINST (? IN NATURAL LANGUAGE MODE)
+			+ 3 * (SELECT COUNT(*) FROM video_tags vt JOIN tags t ON t.id = vt.tag_id WHERE vt.video_id = v.id AND t.name IN ?)
+		) * (1 + LOG10(1 + v.like_count) / 10) * %d) AS SIGNED)`, searchScoreScale)
+	sql := fmt.Sprintf(`SELECT id, score FROM (
+		SELECT v.id, %s AS score
+		FROM videos v JOIN users u ON u.id = v.user_id
+		WHERE %s
+	) s`, scoreExpr, strings.Join(where, " AND "))
+	args = append([]interface{}{q.Keyword, q.Keyword, q.Keyword, tagNames}, args...)
+	if cursor != nil {
+		sql += " WHERE (score < ? OR (score = ? AND id < ?))"
+		args = append(args, cursor.Score, cursor.Score, cursor.ID)
+	}
+	sql += " ORDER BY score DESC, id DESC LIMIT ?"
+	args = append(args, q.Limit+1) // 多取一条判断是否还有下一页
+
+	var rows []struct {
+		ID    uint
+		Score int64
+	}
+	if err := db.Raw(sql, args...).Scan(&rows).Error; err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		last := rows[len(rows)-1]
+		nextCursor = EncodeScoreCursor(last.Score, last.ID)
+	}
+
+	hits := make([]SearchHit, len(rows))
+	for i, row := range rows {
+		hits[i] = SearchHit{VideoID: row.ID, Score: float64(row.Score) / searchScoreScale}
+	}
+	return hits, nextCursor, nil
+}
+
+// searchTagNames 关键词中可以作为话题名的词（按空白分隔，规范化后精确匹配话题）
+func searchTagNames(keyword string) []string {
+	names := MergeTags(strings.Fields(keyword))
+	if len(names) == 0 {
+		return []string{""} // IN () 不是合法的 SQL，空字符串不会匹配任何话题
+	}
+	return names
+}
+
+// SearchTerms 把关键词拆分为用于高亮的词（按空白分隔，去重，忽略大小写）
+func SearchTerms(keyword string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, f := range strings.Fields(keyword) {
+		t := strings.ToLower(strings.TrimLeft(f, "#"))
+		if t == "" {
+			continue
+		}
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// Highlight 用 <em></em> 标出 text 中出现的关键词（忽略大小写），其余内容做 HTML 转义
+// maxRunes > 0 时只截取第一个命中位置附近的 maxRunes 个字符作为摘要（前后被截断时加省略号）
+// 返回：高亮后的 HTML 片段、是否有命中
+func Highlight(text string, terms []string, maxRunes int) (string, bool) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	// 标记命中的字符
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		t := []rune(term)
+		if len(t) == 0 {
+			continue
+		}
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) != term {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+
+	// 截取摘要：命中位置前保留少量上下文
+	start, end := 0, len(runes)
+	if maxRunes > 0 && len(runes) > maxRunes {
+		if first > 0 {
+			start = max(first-maxRunes/4, 0)
+		}
+		end = min(start+maxRunes, len(runes))
+		start = max(end-maxRunes, 0)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	inMark := false
+	for i := start; i < end; i++ {
+		if marked[i] != inMark {
+			if marked[i] {
+				b.WriteString("<em>")
+			} else {
+				b.WriteString("</em>")
+			}
+			inMark = marked[i]
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+	}
+	if inMark {
+		b.WriteString("</em>")
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), first >= 0
+}
@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		terms    []string
+		maxRunes int
+		want     string
+		wantHit  bool
+	}{
+		{name: "忽略大小写", text: "Hello World", terms: []string{"world"}, want: "Hello <em>World</em>", wantHit: true},
+		{name: "没有命中", text: "Hello", terms: []string{"x"}, want: "Hello"},
+		{name: "中文", text: "今天去看猫咪视频", terms: []string{"猫咪"}, want: "今天去看<em>猫咪</em>视频", wantHit: true},
+		{name: "多处命中", text: "go and go", terms: []string{"go"}, want: "<em>go</em> and <em>go</em>", wantHit: true},
+		{name: "重叠的关键词合并", text: "abcd", terms: []string{"ab", "bc"}, want: "<em>abc</em>d", wantHit: true},
+		{name: "忽略空关键词", text: "abc", terms: []string{""}, want: "abc"},
+		{name: "未命中的内容转义", text: `<b>"x"</b>`, terms: nil, want: "&lt;b&gt;&#34;x&#34;&lt;/b&gt;"},
+		{name: "命中的内容转义", text: "<script>", terms: []string{"<script>"}, want: "<em>&lt;script&gt;</em>", wantHit: true},
+		{name: "关键词内的 em 标签原样转义", text: "a<em>b", terms: []string{"b"}, want: "a&lt;em&gt;<em>b</em>", wantHit: true},
+		{name: "命中位置附近截取摘要", text: "aaaaaaaaaaXbbbbbbbbbb", terms: []string{"x"}, maxRunes: 8, want: "…aa<em>X</em>bbbbb…", wantHit: true},
+		{name: "命中在开头", text: "Xbbbbbbbbb", terms: []string{"x"}, maxRunes: 4, want: "<em>X</em>bbb…", wantHit: true},
+		{name: "命中在末尾", text: "aaaaaaaaaX", terms: []string{"x"}, maxRunes: 4, want: "…aaa<em>X</em>", wantHit: true},
+		{name: "没有命中时从头截取", text: "abcdefgh", terms: []string{"x"}, maxRunes: 5, want: "abcde…"},
+		{name: "不超过长度不截取", text: "abc", terms: []string{"b"}, maxRunes: 5, want: "a<em>b</em>c", wantHit: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hit := Highlight(tt.text, tt.terms, tt.maxRunes)
+			if got != tt.want || hit != tt.wantHit {
+				t.Errorf("Highlight(%q) = (%q, %v), want (%q, %v)", tt.text, got, hit, tt.want, tt.wantHit)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package utils
+
+// 登录会话（多设备登录）
+//
+// 每次登录创建一个会话，访问令牌（JWT）中携带会话ID（sid），刷新令牌与会话绑定：
+//   session:<sid>             HASH  会话信息 + 当前刷新令牌的哈希，过期时间为 jwt.refresh_ttl，每次刷新顺延
+//   sessions:user:<username>  ZSET  用户的会话ID列表，score 为登录时间
+// 撤销会话即删除 session:<sid>，该会话签发的访问令牌立即失效。
+
+import (
+	"common/config"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis Key 前缀
+const (
+	SessionPrefix      = "session:"       // 会话信息 HASH 前缀
+	UserSessionsPrefix = "sessions:user:" // 用户会话列表 ZSET 前缀
+)
+
+// RefreshRaceWindow 刷新令牌轮换后，旧令牌在该时间内再次使用视为并发刷新（多个标签页同时刷新），不视为重放
+const RefreshRaceWindow = 10 * time.Second
+
+// 刷新令牌相关错误
+var (
+	ErrSessionNotFound     = errors.New("会话不存在或已失效")
+	ErrInvalidRefreshToken = errors.New("无效的刷新令牌")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，会话已撤销")
+	ErrRefreshRace         = errors.New("刷新令牌已被其他请求轮换")
+)
+
+// Session 登录会话
+type Session struct {
+	ID         string `json:"session_id"`  // 会话ID
+	Username   string `json:"-"`           // 所属用户
+	Device     string `json:"device"`      // 设备名称（客户端登录时提供，可为空）
+	UserAgent  string `json:"user_agent"`  // 登录时的 User-Agent
+	IP         string `json:"ip"`          // 登录时的 IP
+	CreatedAt  int64  `json:"created_at"`  // 登录时间（Unix 秒）
+	LastActive int64  `json:"last_active"` // 最近一次刷新令牌的时间（Unix 秒）
+}
+
+// rotateRefreshScript 原子地校验并轮换刷新令牌
+// KEYS[1] 会话key；ARGV: 旧令牌哈希、新令牌哈希、当前时间、会话有效期（毫秒）、并发刷新窗口（秒）
+// 返回：0 会话不存在；1 轮换成功；2 并发刷新；3 旧令牌重放（会话已删除）
+var rotateRefreshScript = redis.NewScript(`
+local cur = redis.call('HGET', KEYS[1], 'refresh_hash')
+if not cur then
+	return 0
+end
+if cur == ARGV[1] then
+	redis.call('HSET', KEYS[1], 'refresh_hash', ARGV[2], 'prev_refresh_hash', ARGV[1], 'rotated_at', ARGV[3], 'last_active', ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+	return 1
+end
+local prev = redis.call('HGET', KEYS[1], 'prev_refresh_hash')
+local rotatedAt = tonumber(redis.call('HGET', KEYS[1], 'rotated_at') or '0')
+if prev == ARGV[1] and tonumber(ARGV[3]) - rotatedAt <= tonumber(ARGV[5]) then
+	return 2
+end
+redis.call('DEL', KEYS[1])
+return 3
+`)
+
+func sessionKey(sessionID string) string {
+	return SessionPrefix + sessionID
+}
+
+func userSessionsKey(username string) string {
+	return UserSessionsPrefix + username
+}
+
+// randomToken 生成 n 字节的随机串（URL 安全的 base64）
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashRefreshSecret Redis 中只保存刷新令牌的哈希
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshToken 生成会话的刷新令牌，格式为 <sid>.<随机串>
+// 返回：刷新令牌、随机串的哈希
+func newRefreshToken(sessionID string) (string, string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return sessionID + "." + secret, hashRefreshSecret(secret), nil
+}
+
+// parseRefreshToken 拆分刷新令牌
+func parseRefreshToken(refreshToken string) (sessionID, secret string, ok bool) {
+	sessionID, secret, ok = strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return "", "", false
+	}
+	return sessionID, secret, true
+}
+
+// CreateSession 创建登录会话
+// 参数：会话信息（ID、CreatedAt、LastActive 由本函数填充）
+// 返回：刷新令牌、错误
+func CreateSession(s *Session) (string, error) {
+	ctx := context.Background()
+
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	refreshToken, refreshHash, err := newRefreshToken(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	s.ID = sessionID
+	s.CreatedAt = now.Unix()
+	s.LastActive = now.Unix()
+
+	ttl := config.Conf.JWT.RefreshTTL
+	key := sessionKey(sessionID)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"username":     s.Username,
+		"device":       s.Device,
+		"user_agent":   s.UserAgent,
+		"ip":           s.IP,
+		"created_at":   s.CreatedAt,
+		"last_active":  s.LastActive,
+		"refresh_hash": refreshHash,
+	})
+	pipe.Expire(ctx, key, ttl)
+	pipe.ZAdd(ctx, userSessionsKey(s.Username), redis.Z{Score: float64(s.CreatedAt), Member: sessionID})
+	// 会话列表的过期时间跟随最近创建的会话
+	pipe.Expire(ctx, userSessionsKey(s.Username), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// GetSession 获取会话信息
+// 返回：会话信息；会话不存在时返回 ErrSessionNotFound
+func GetSession(sessionID string) (*Session, error) {
+	ctx := context.Background()
+	fields, err := rdb.HGetAll(ctx, sessionKey(sessionID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	return sessionFromHash(sessionID, fields), nil
+}
+
+func sessionFromHash(sessionID string, fields map[string]string) *Session {
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	lastActive, _ := strconv.ParseInt(fields["last_active"], 10, 64)
+	return &Session{
+		ID:         sessionID,
+		Username:   fields["username"],
+		Device:     fields["device"],
+		UserAgent:  fields["user_agent"],
+		IP:         fields["ip"],
+		CreatedAt:  createdAt,
+		LastActive: lastActive,
+	}
+}
+
+// IsSessionActive 检查会话是否有效且属于该用户（AuthMiddleware 使用）
+func IsSessionActive(username, sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	ctx := context.Background()
+	owner, err := rdb.HGet(ctx, sessionKey(sessionID), "username").Result()
+	if err != nil {
+		return false
+	}
+	return owner == username
+}
+
+// RotateRefreshToken 使用刷新令牌换取新的刷新令牌（旧令牌作废）
+// 返回：会话信息、新的刷新令牌、错误
+// 旧令牌被重复使用（可能已泄露）时会撤销整个会话并返回 ErrRefreshTokenReused
+func RotateRefreshToken(refreshToken string) (*Session, string, error) {
+	sessionID, secret, ok := parseRefreshToken(refreshToken)
+	if !ok {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	session, err := GetSession(sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	newToken, newHash, err := newRefreshToken(sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ctx := context.Background()
+	now := time.Now().Unix()
+	result, err := rotateRefreshScript.Run(ctx, rdb, []string{sessionKey(sessionID)},
+		hashRefreshSecret(secret),
+		newHash,
+		now,
+		config.Conf.JWT.RefreshTTL.Milliseconds(),
+		int64(RefreshRaceWindow.Seconds()),
+	).Int()
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch result {
+	case 1:
+		session.LastActive = now
+		rdb.Expire(ctx, userSessionsKey(session.Username), config.Conf.JWT.RefreshTTL)
+		return session, newToken, nil
+	case 2:
+		return nil, "", ErrRefreshRace
+	case 3:
+		rdb.ZRem(ctx, userSessionsKey(session.Username), sessionID)
+		return nil, "", ErrRefreshTokenReused
+	default:
+		return nil, "", ErrSessionNotFound
+	}
+}
+
+// ListSessions 获取用户所有有效会话（按登录时间倒序），顺便清理已过期的会话ID
+func ListSessions(username string) ([]Session, error) {
+	ctx := context.Background()
+	listKey := userSessionsKey(username)
+
+	ids, err := rdb.ZRevRange(ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []Session{}, nil
+	}
+
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, sessionKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(ids))
+	expired := make([]interface{}, 0)
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 || fields["username"] != username {
+			expired = append(expired, ids[i])
+			continue
+		}
+		sessions = append(sessions, *sessionFromHash(ids[i], fields))
+	}
+	if len(expired) > 0 {
+		rdb.ZRem(ctx, listKey, expired...)
+	}
+	return sessions, nil
+}
+
+// DeleteSession 撤销用户的某个会话
+// 返回：是否删除成功（false 表示会话不存在或不属于该用户）、错误
+func DeleteSession(username, sessionID string) (bool, error) {
+	if !IsSessionActive(username, sessionID) {
+		return false, nil
+	}
+	ctx := context.Background()
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionID))
+	pipe.ZRem(ctx, userSessionsKey(username), sessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteAllSessions 撤销用户的所有会话
+// 参数：用户名、需要保留的会话ID（为空则全部撤销）
+// 返回：撤销的会话数、错误
+func DeleteAllSessions(username, keepSessionID string) (int, error) {
+	ctx := context.Background()
+	listKey := userSessionsKey(username)
+
+	ids, err := rdb.ZRange(ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	pipe := rdb.TxPipeline()
+	count := 0
+	for _, id := range ids {
+		if id == keepSessionID {
+			continue
+		}
+		pipe.Del(ctx, sessionKey(id))
+		pipe.ZRem(ctx, listKey, id)
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,266 @@
+package utils
+
+// 上传垃圾回收
+//
+// 1. 被放弃的单次上传（RunUploadSweeper 定时执行）
+//    GetUploadURL 在客户端上传前就创建了"上传中"的视频记录。创建超过 upload.abandon_after 仍未确认的记录（不含进行中的分片上传）：
+//      MinIO 中文件已存在  客户端上传成功但没有调用确认接口，校验文件后自动确认（与 ConfirmUpload 相同，进入转码流程），未通过校验的删除
+//      文件不存在          删除视频记录并写入清理任务（与删除视频相同，原因为 upload_abandoned）
+// 2. 孤儿文件（运维命令 storage orphans 手动执行）
+//    扫描存储桶，按文件名中的 UUID 找到所属视频：<UUID>.<扩展名>、<UUID>_cover.jpg 等在根目录，HLS 文件在 hls/<UUID>/ 下。
+//    所属视频不存在、已删除且清理已完成（如清理期间转码任务才上传的文件）、或在引入清理任务之前删除的文件为孤儿文件。
+//    文件名不是 UUID 格式的文件（如默认头像）不属于视频，不会被当作孤儿文件。
+
+import (
+	"backend/models"
+	"common/config"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	UploadSweepLockKey = "lock:upload:sweep" // 多实例只由一个实例清理
+	uploadSweepBatch   = 100                 // 每轮最多处理的视频数
+	orphanScanBatch    = 1000                // 孤儿文件扫描时每批查询的 UUID 数
+)
+
+// RunUploadSweeper 定时处理被放弃的单次上传（阻塞运行，需在 goroutine 中调用）
+func RunUploadSweeper() {
+	ticker := time.NewTicker(config.Conf.Upload.SweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		confirmed, deleted, err := sweepAbandonedUploads()
+		if err != nil {
+			log.Printf("清理被放弃的上传失败: %v", err)
+		}
+		if confirmed > 0 || deleted > 0 {
+			log.Printf("被放弃的上传：自动确认 %d 个，删除 %d 个", confirmed, deleted)
+		}
+	}
+}
+
+// sweepAbandonedUploads 处理一批超时未确认的上传
+// 返回：自动确认的数量、删除的数量、错误
+func sweepAbandonedUploads() (int, int, error) {
+	release, ok, err := TryLock(UploadSweepLockKey, 5*time.Minute)
+	if err != nil || !ok {
+		return 0, 0, err
+	}
+	defer release()
+
+	// 进行中的分片上传由 RunMultipartSweeper 按 upload.multipart_ttl 处理
+	var videos []models.Video
+	err = db.Select("id", "file_name", "file_size").
+		Where("status = ? AND created_at < ?", models.VideoStatusUploading, time.Now().Add(-config.Conf.Upload.AbandonAfter)).
+		Where("NOT EXISTS (SELECT 1 FROM multipart_uploads m WHERE m.video_id = videos.id AND m.status = ?)", models.MultipartStatusActive).
+		Order("id").
+		Limit(uploadSweepBatch).
+		Find(&videos).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	confirmed, deleted := 0, 0
+	for _, video := range videos {
+		exists, err := CheckFileExists(video.FileName)
+		if err != nil {
+			log.Printf("检查视频 %d 的文件失败: %v", video.ID, err)
+			continue
+		}
+
+		if exists {
+			// 声明的大小在创建时已按上传方式（单次/分片）校验过上限，这里按较大的分片上传上限兜底
+			err := VerifyUploadedFile(video.FileName, video.FileSize, int64(config.Conf.Upload.MaxSizeMB)<<20)
+			if errors.Is(err, ErrUploadRejected) {
+				log.Printf("视频 %d 的文件未通过校验，删除: %v", video.ID, err)
+				if removed, err := RejectVideoUpload(video, 0); err != nil {
+					log.Printf("删除未通过校验的视频 %d 失败: %v", video.ID, err)
+				} else if removed {
+					deleted++
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("校验视频 %d 的文件失败: %v", video.ID, err)
+				continue
+			}
+
+			videoURL, err := GenerateDownloadURL(video.FileName)
+			if err != nil {
+				log.Printf("生成视频 %d 的URL失败: %v", video.ID, err)
+				continue
+			}
+			updated, err := ConfirmVideoUpload(video.ID, videoURL, video.FileName)
+			if err != nil {
+				log.Printf("自动确认视频 %d 失败: %v", video.ID, err)
+				continue
+			}
+			if updated {
+				confirmed++
+			}
+			continue
+		}
+
+		removed, err := DeleteUploadingVideo(video, 0, models.PurgeReasonUploadAbandoned)
+		if err != nil {
+			log.Printf("删除被放弃的视频 %d 失败: %v", video.ID, err)
+			continue
+		}
+		if removed {
+			deleted++
+		}
+	}
+	return confirmed, deleted, nil
+}
+
+// OrphanObject 孤儿文件
+type OrphanObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// OrphanReport 孤儿文件扫描报告
+type OrphanReport struct {
+	Scanned     int            `json:"scanned"`      // 扫描的文件数
+	Skipped     int            `json:"skipped"`      // 跳过的文件数（不属于视频，或修改时间晚于 min_age）
+	Orphans     []OrphanObject `json:"orphans"`      // 孤儿文件
+	OrphanBytes int64          `json:"orphan_bytes"` // 孤儿文件总大小
+	Removed     int            `json:"removed"`      // 已删除的孤儿文件数（remove=true 时）
+}
+
+// ScanOrphanObjects 扫描存储桶中没有所属视频的文件
+// 参数：最小文件年龄（更新的文件跳过，避免误删正在上传、转码的文件）、是否删除孤儿文件
+func ScanOrphanObjects(minAge time.Duration, remove bool) (*OrphanReport, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	report := &OrphanReport{Orphans: []OrphanObject{}}
+	cutoff := time.Now().Add(-minAge)
+
+	// 按批检查：攒够一批 UUID 后查询所属视频
+	var batch []minio.ObjectInfo
+	batchIDs := make(map[string]bool)
+	check := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		owned, err := ownedFileIDs(batchIDs)
+		if err != nil {
+			return err
+		}
+		for _, obj := range batch {
+			if !owned[objectFileID(obj.Key)] {
+				report.Orphans = append(report.Orphans, OrphanObject{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+				report.OrphanBytes += obj.Size
+			}
+		}
+		batch = batch[:0]
+		batchIDs = make(map[string]bool)
+		return nil
+	}
+
+	for obj := range mc.ListObjects(ctx, MinioBucket, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		report.Scanned++
+
+		id := objectFileID(obj.Key)
+		if id == "" || obj.LastModified.After(cutoff) {
+			report.Skipped++
+			continue
+		}
+		batch = append(batch, obj)
+		batchIDs[id] = true
+		if len(batchIDs) >= orphanScanBatch {
+			if err := check(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := check(); err != nil {
+		return nil, err
+	}
+
+	if remove && len(report.Orphans) > 0 {
+		objects := make(chan minio.ObjectInfo, len(report.Orphans))
+		for _, o := range report.Orphans {
+			objects <- minio.ObjectInfo{Key: o.Key}
+		}
+		close(objects)
+		failed := 0
+		for rerr := range mc.RemoveObjects(ctx, MinioBucket, objects, minio.RemoveObjectsOptions{}) {
+			log.Printf("删除孤儿文件 %s 失败: %v", rerr.ObjectName, rerr.Err)
+			failed++
+		}
+		report.Removed = len(report.Orphans) - failed
+		if failed > 0 {
+			return report, errors.New("部分孤儿文件删除失败")
+		}
+	}
+	return report, nil
+}
+
+// objectFileID 文件所属视频的文件名 UUID，不是视频文件时返回空字符串
+// <UUID>.<扩展名>、<UUID>_cover.jpg、<UUID>_720p.mp4 等取开头的 UUID，hls/<UUID>/... 取第二段
+func objectFileID(key string) string {
+	name := key
+	if rest, ok := strings.CutPrefix(key, HLSPrefix); ok {
+		name, _, _ = strings.Cut(rest, "/")
+	} else if strings.Contains(key, "/") {
+		return ""
+	}
+	const uuidLen = 36
+	if len(name) < uuidLen {
+		return ""
+	}
+	id := name[:uuidLen]
+	if _, err := uuid.Parse(id); err != nil {
+		return ""
+	}
+	return id
+}
+
+// ownedFileIDs 查询哪些 UUID 有所属视频：视频未删除，或已删除但清理尚未完成（文件交给清理任务删除）
+// 没有清理记录的已删除视频（引入清理任务之前删除的）的文件同样视为孤儿文件
+// 文件名按前缀匹配（file_name LIKE '<UUID>%'，可以使用 file_name 索引做范围扫描；UUID 中没有 LIKE 通配符）
+func ownedFileIDs(ids map[string]bool) (map[string]bool, error) {
+	if len(ids) == 0 {
+		return map[string]bool{}, nil
+	}
+	conds := make([]string, 0, len(ids))
+	args := make([]interface{}, 0, len(ids))
+	for id := range ids {
+		conds = append(conds, "videos.file_name LIKE ?")
+		args = append(args, id+"%")
+	}
+
+	var rows []struct {
+		FileName string
+	}
+	err := db.Table("videos").
+		Select("videos.file_name").
+		Joins("LEFT JOIN video_purges p ON p.video_id = videos.id").
+		Where(strings.Join(conds, " OR "), args...).
+		Where("videos.deleted_at IS NULL OR p.status = ?", models.PurgeStatusPending).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if id := objectFileID(row.FileName); id != "" {
+			owned[id] = true
+		}
+	}
+	return owned, nil
+}
@@ -0,0 +1,276 @@
+package utils
+
+// 话题（#标签）
+//
+// 视频的话题来自上传时显式指定的列表和描述中的 #话题，统一规范化（去掉 #、转小写）后写入：
+//   tags        话题表，name 唯一
+//   video_tags  视频与话题的多对多关联表
+// 话题热度与视频热度共用 trending.go 中的分桶机制：视频每次互动的热度同时累加到它的每个话题上。
+// 视频的话题ID列表缓存在 Redis（video:tags:<videoID>），避免每次互动都查询 MySQL。
+
+import (
+	"backend/models"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 话题限制
+const (
+	MaxVideoTags = 10 // 每个视频最多的话题数
+	MaxTagRunes  = 32 // 话题名最大长度
+)
+
+// 话题排序方式
+const (
+	TagSortNewest = "newest" // 按发布时间倒序
+	TagSortHot    = "hot"    // 按点赞数倒序
+)
+
+const (
+	VideoTagsCachePrefix = "video:tags:" // 视频话题ID缓存前缀（逗号分隔，无话题时为空字符串）
+	videoTagsCacheTTL    = time.Hour
+)
+
+// hashtagPattern 描述中的 #话题（字母、数字、下划线，支持中文）
+var hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+// NormalizeTag 规范化话题名：去掉首尾空白和开头的 #，转小写
+// 返回：规范化后的话题名、是否有效（为空、过长或包含非法字符时无效）
+func NormalizeTag(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimLeft(strings.TrimSpace(name), "#"))
+	if name == "" || utf8.RuneCountInString(name) > MaxTagRunes {
+		return "", false
+	}
+	if hashtagPattern.FindString("#"+name) != "#"+name {
+		return "", false
+	}
+	return name, true
+}
+
+// ParseHashtags 解析文本中的 #话题（规范化后去重，保持出现顺序）
+func ParseHashtags(text string) []string {
+	var tags []string
+	for _, m := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tags = append(tags, m[1])
+	}
+	return MergeTags(tags)
+}
+
+// MergeTags 规范化并合并多组话题（去重、忽略无效话题，最多 MaxVideoTags 个）
+func MergeTags(groups ...[]string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, group := range groups {
+		for _, raw := range group {
+			name, ok := NormalizeTag(raw)
+			if !ok || seen[name] {
+				continue
+			}
+			if len(result) >= MaxVideoTags {
+				return result
+			}
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// CreateVideoWithTags 在一个事务中创建视频记录并关联话题（话题不存在时创建）
+func CreateVideoWithTags(video *models.Video, tagNames []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Create(video).Error; err != nil {
+			return err
+		}
+		return txSetVideoTags(tx, video.ID, tagNames)
+	})
+}
+
+// txSetVideoTags 关联视频与话题
+func txSetVideoTags(tx *gorm.DB, videoID uint, tagNames []string) error {
+	if len(tagNames) == 0 {
+		return nil
+	}
+
+	// 1. 创建不存在的话题（name 唯一，已存在的忽略）
+	tags := make([]models.Tag, len(tagNames))
+	for i, name := range tagNames {
+		tags[i] = models.Tag{Name: name}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return fmt.Errorf("创建话题失败: %v", err)
+	}
+
+	// 2. 查出所有话题ID（已存在的话题插入时拿不到ID）
+	var tagIDs []uint
+	if err := tx.Model(&models.Tag{}).Where("name IN ?", tagNames).Pluck("id", &tagIDs).Error; err != nil {
+		return fmt.Errorf("查询话题失败: %v", err)
+	}
+
+	// 3. 写入关联
+	links := make([]models.VideoTag, len(tagIDs))
+	for i, tagID := range tagIDs {
+		links[i] = models.VideoTag{VideoID: videoID, TagID: tagID}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+		return fmt.Errorf("关联话题失败: %v", err)
+	}
+	return nil
+}
+
+// GetVideoTagIDs 获取视频的话题ID列表（优先读取 Redis 缓存）
+func GetVideoTagIDs(videoID uint) ([]uint, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s%d", VideoTagsCachePrefix, videoID)
+
+	cached, err := rdb.Get(ctx, key).Result()
+	if err == nil {
+		return parseIDList(cached), nil
+	}
+	if err != redis.Nil {
+		return nil, err
+	}
+
+	var tagIDs []uint
+	if err := db.Model(&models.VideoTag{}).Where("video_id = ?", videoID).Pluck("tag_id", &tagIDs).Error; err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(tagIDs))
+	for i, id := range tagIDs {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	if err := rdb.Set(ctx, key, strings.Join(parts, ","), videoTagsCacheTTL).Err(); err != nil {
+		return nil, err
+	}
+	return tagIDs, nil
+}
+
+// parseIDList 解析逗号分隔的ID列表
+func parseIDList(s string) []uint {
+	if s == "" {
+		return nil
+	}
+	var ids []uint
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// GetVideoTagMap 批量查询视频的话题ID（重建话题热度时使用）
+// 返回：视频ID -> 话题ID列表
+func GetVideoTagMap(videoIDs []uint) (map[uint][]uint, error) {
+	result := make(map[uint][]uint)
+	if len(videoIDs) == 0 {
+		return result, nil
+	}
+	var links []models.VideoTag
+	if err := db.Where("video_id IN ?", videoIDs).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		result[link.VideoID] = append(result[link.VideoID], link.TagID)
+	}
+	return result, nil
+}
+
+// GetTagByName 按名称查询话题（名称需已规范化）
+func GetTagByName(name string) (*models.Tag, error) {
+	var tag models.Tag
+	if err := db.Where("name = ?", name).First(&tag).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// TagSummary 话题及其已发布的视频数
+type TagSummary struct {
+	ID         uint   `json:"id"`
+	Name       string `json:"name"`
+	VideoCount int64  `json:"video_count"` // 已发布的公开视频数
+}
+
+// publishedTagVideoCounts 统计话题下已发布的公开视频数的查询
+func publishedTagVideoCounts() *gorm.DB {
+	return db.Table("tags").
+		Select("tags.id, tags.name, COUNT(videos.id) AS video_count").
+		Joins("JOIN video_tags ON video_tags.tag_id = tags.id").
+		Joins("JOIN videos ON videos.id = video_tags.video_id AND videos.deleted_at IS NULL AND videos.status = ? AND videos.visibility = ?", models.VideoStatusPublished, models.VisibilityPublic).
+		Group("tags.id, tags.name")
+}
+
+// GetTagSummaries 批量查询话题及其视频数（按传入的ID顺序返回，没有已发布视频的话题跳过）
+func GetTagSummaries(tagIDs []uint) ([]TagSummary, error) {
+	if len(tagIDs) == 0 {
+		return []TagSummary{}, nil
+	}
+	var rows []TagSummary
+	if err := publishedTagVideoCounts().Where("tags.id IN ?", tagIDs).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]TagSummary, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row
+	}
+	result := make([]TagSummary, 0, len(rows))
+	for _, id := range tagIDs {
+		if row, ok := byID[id]; ok {
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
+
+// GetTopTagsByVideoCount 按已发布的视频数排序的话题
+func GetTopTagsByVideoCount(limit int) ([]TagSummary, error) {
+	var rows []TagSummary
+	err := publishedTagVideoCounts().Order("video_count DESC, tags.id DESC").Limit(limit).Scan(&rows).Error
+	return rows, err
+}
+
+// GetTagVideoList 获取话题下的视频列表（游标分页）
+// 参数：话题ID、排序方式（newest 按发布时间 / hot 按点赞数）、游标、每页数量
+// 返回：视频列表（只包含已发布的公开视频）、下一页游标（没有更多时为空）、错误
+func GetTagVideoList(tagID uint, sort string, cursor *Cursor, limit int) ([]VideoListItem, string, error) {
+	query := db.Model(&models.Video{}).
+		Joins("JOIN video_tags ON video_tags.video_id = videos.id AND video_tags.tag_id = ?", tagID).
+		Scopes(publicVideoScope)
+
+	if sort != TagSortHot {
+		videos, nextCursor, err := listVideos(query, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		return buildVideoListItems(videos), nextCursor, nil
+	}
+
+	var videos []models.Video
+	err := query.Scopes(scoreCursorScope("videos", "like_count", cursor)).
+		Preload("User").
+		Preload("Tags").
+		Order(scoreCursorOrder("videos", "like_count")).
+		Limit(limit + 1). // 多取一条判断是否还有下一页
+		Find(&videos).Error
+	if err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if len(videos) > limit {
+		videos = videos[:limit]
+		last := videos[len(videos)-1]
+		nextCursor = EncodeScoreCursor(int64(last.LikeCount), last.ID)
+	}
+	return buildVideoListItems(videos), nextCursor, nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"Golang", "golang", true},
+		{"  #Go_Lang ", "go_lang", true},
+		{"##旅行", "旅行", true},
+		{"vlog2024", "vlog2024", true},
+		{"", "", false},
+		{"#", "", false},
+		{"   ", "", false},
+		{"go lang", "", false},
+		{"go-lang", "", false},
+		{"go#lang", "", false},
+		{"<script>", "", false},
+		{strings.Repeat("a", MaxTagRunes), strings.Repeat("a", MaxTagRunes), true},
+		{strings.Repeat("a", MaxTagRunes+1), "", false},
+		{strings.Repeat("话", MaxTagRunes), strings.Repeat("话", MaxTagRunes), true},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeTag(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("NormalizeTag(%q) = (%q, %v), want (%q, %v)", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	many := make([]string, MaxVideoTags+5)
+	for i := range many {
+		many[i] = "tag" + strings.Repeat("x", i)
+	}
+
+	tests := []struct {
+		name   string
+		groups [][]string
+		want   []string
+	}{
+		{name: "空输入", groups: nil, want: nil},
+		{name: "规范化并保持顺序", groups: [][]string{{"#Go", "旅行"}}, want: []string{"go", "旅行"}},
+		{name: "多组之间去重", groups: [][]string{{"Go", "vlog"}, {"#go", "VLOG", "cat"}}, want: []string{"go", "vlog", "cat"}},
+		{name: "忽略无效话题", groups: [][]string{{"", "go lang", "ok"}}, want: []string{"ok"}},
+		{name: "最多 MaxVideoTags 个", groups: [][]string{many}, want: many[:MaxVideoTags]},
+		{name: "已满时重复话题不影响结果", groups: [][]string{many[:MaxVideoTags], {many[0]}}, want: many[:MaxVideoTags]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeTags(tt.groups...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package utils
+
+// 热门趋势（按时间衰减的热度排行）
+//
+// 每次互动按权重累加到当前小时的分桶：
+//   trend:bucket:<YYYYMMDDHH>  ZSET  member 为视频ID，score 为该小时内的互动热度，保留 8 天
+//   取消点赞、删除评论时从原互动所在小时的分桶中扣除（最多扣到0），不影响当前小时其他用户的互动
+//   trend:tag:bucket:<YYYYMMDDHH>  话题热度分桶，视频的互动同时累加到视频的每个话题上，结构和合并方式与视频分桶相同
+// 查询 24h / 7d 榜单时用 ZUNIONSTORE 合并最近 24 / 168 个分桶，每个分桶按距今的小时数做重力衰减：
+//   weight(age) = (2 / (age + 2)) ^ TrendingGravity    当前小时权重为 1，越早的互动权重越低
+//   trend:rank:24h / trend:rank:7d  ZSET  合并结果，缓存 trendingRankTTL 后重新计算
+// window=all 仍使用全部时间的点赞排行榜（rank:video:like）。
+// 分桶全部缺失（如 Redis 被清空）时，由 TrendingService 从 MySQL 重建最近 7 天的视频分桶和话题分桶。
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 热度榜单时间窗口
+const (
+	TrendingWindow24h = "24h"
+	TrendingWindow7d  = "7d"
+	TrendingWindowAll = "all" // 全部时间（按点赞总数）
+)
+
+// 互动权重
+const (
+	TrendingWeightLike    = 3.0 // 点赞
+	TrendingWeightComment = 5.0 // 评论（含回复）
+	TrendingWeightView    = 1.0 // 播放
+)
+
+// TrendingGravity 衰减指数，越大旧互动衰减越快
+const TrendingGravity = 1.5
+
+// Redis Key 前缀
+const (
+	TrendingBucketPrefix    = "trend:bucket:"     // 视频小时分桶 ZSET 前缀
+	TrendingRankPrefix      = "trend:rank:"       // 视频合并后的榜单 ZSET 前缀
+	TrendingTagBucketPrefix = "trend:tag:bucket:" // 话题小时分桶 ZSET 前缀（member 为话题ID）
+	TrendingTagRankPrefix   = "trend:tag:rank:"   // 话题合并后的榜单 ZSET 前缀
+)
+
+const (
+	trendingBucketLayout = "2006010215"       // 分桶 key 中的时间格式（本地时间，精确到小时）
+	trendingBucketTTL    = 8 * 24 * time.Hour // 分桶保留时间（比最长窗口多一天）
+	trendingRankTTL      = 5 * time.Minute    // 合并结果的缓存时间
+)
+
+// trendingWindowHours 各窗口合并的分桶数
+var trendingWindowHours = map[string]int{
+	TrendingWindow24h: 24,
+	TrendingWindow7d:  7 * 24,
+}
+
+// IsValidTrendingWindow 检查时间窗口参数
+func IsValidTrendingWindow(window string) bool {
+	_, ok := trendingWindowHours[window]
+	return ok || window == TrendingWindowAll
+}
+
+// trendingBoard 一个热度榜（视频榜、话题榜共用分桶、衰减合并和重建逻辑，只是 key 前缀不同）
+type trendingBoard struct {
+	bucketPrefix string
+	rankPrefix   string
+}
+
+var (
+	videoTrending = trendingBoard{bucketPrefix: TrendingBucketPrefix, rankPrefix: TrendingRankPrefix}
+	tagTrending   = trendingBoard{bucketPrefix: TrendingTagBucketPrefix, rankPrefix: TrendingTagRankPrefix}
+)
+
+// bucketKey 某个时间所在小时的分桶 key
+func (b trendingBoard) bucketKey(t time.Time) string {
+	return b.bucketPrefix + t.Format(trendingBucketLayout)
+}
+
+// recentBuckets 最近 hours 个小时的分桶 key（从当前小时往前）
+func (b trendingBoard) recentBuckets(now time.Time, hours int) []string {
+	keys := make([]string, hours)
+	for i := 0; i < hours; i++ {
+		keys[i] = b.bucketKey(now.Add(-time.Duration(i) * time.Hour))
+	}
+	return keys
+}
+
+// trendingDecay 距今 age 小时的分桶权重
+func trendingDecay(age int) float64 {
+	return math.Pow(2/float64(age+2), TrendingGravity)
+}
+
+// record 把热度增量累加到当前小时的分桶
+func (b trendingBoard) record(ids []uint, weight float64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	key := b.bucketKey(time.Now())
+	pipe := rdb.Pipeline()
+	for _, id := range ids {
+		pipe.ZIncrBy(ctx, key, weight, strconv.FormatUint(uint64(id), 10))
+	}
+	pipe.Expire(ctx, key, trendingBucketTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// retractScript 从分桶中扣除成员的热度，最多扣到0；分桶或成员不存在（如已过期）时不做修改
+// KEYS[1] 分桶，ARGV[1] 成员，ARGV[2] 扣除的热度
+var retractScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score then
+	return 0
+end
+redis.call('ZADD', KEYS[1], tostring(math.max(tonumber(score) - tonumber(ARGV[2]), 0)), ARGV[1])
+return 1
+`)
+
+// retract 撤销互动：从每次互动发生时所在小时的分桶中各扣除 weight 热度
+func (b trendingBoard) retract(ids []uint, at []time.Time, weight float64) error {
+	if len(ids) == 0 || len(at) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	pipe := rdb.Pipeline()
+	for _, t := range at {
+		key := b.bucketKey(t)
+		for _, id := range ids {
+			retractScript.Eval(ctx, pipe, []string{key}, strconv.FormatUint(uint64(id), 10), weight)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// top 获取窗口内按热度排在第 offset 名之后的 limit 个成员（只包含热度大于0的成员）
+func (b trendingBoard) top(window string, offset, limit int) ([]uint, error) {
+	hours, ok := trendingWindowHours[window]
+	if !ok {
+		return nil, fmt.Errorf("未知的时间窗口: %s", window)
+	}
+
+	ctx := context.Background()
+	rankKey := b.rankPrefix + window
+	exists, err := rdb.Exists(ctx, rankKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		if err := b.computeRank(ctx, rankKey, hours); err != nil {
+			return nil, err
+		}
+	}
+
+	members, err := rdb.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     rankKey,
+		Start:   "+inf",
+		Stop:    "(0",
+		ByScore: true,
+		Rev:     true,
+		Offset:  int64(offset),
+		Count:   int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// computeRank 合并最近 hours 个分桶（按距今时间衰减）生成榜单，并设置缓存时间
+func (b trendingBoard) computeRank(ctx context.Context, rankKey string, hours int) error {
+	keys := b.recentBuckets(time.Now(), hours)
+	weights := make([]float64, hours)
+	for age := range weights {
+		weights[age] = trendingDecay(age)
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.ZUnionStore(ctx, rankKey, &redis.ZStore{Keys: keys, Weights: weights, Aggregate: "SUM"})
+	pipe.Expire(ctx, rankKey, trendingRankTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// bucketsExist 最近 7 天是否存在任意分桶
+func (b trendingBoard) bucketsExist() (bool, error) {
+	keys := b.recentBuckets(time.Now(), trendingWindowHours[TrendingWindow7d])
+	n, err := rdb.Exists(context.Background(), keys...).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// rebuild 用给定热度重建分桶（先删除最近 7 天的分桶和合并结果）
+func (b trendingBoard) rebuild(scores []TrendingBucketScore) error {
+	ctx := context.Background()
+	now := time.Now()
+
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, b.recentBuckets(now, trendingWindowHours[TrendingWindow7d])...)
+	for window := range trendingWindowHours {
+		pipe.Del(ctx, b.rankPrefix+window)
+	}
+	for _, s := range scores {
+		key := b.bucketKey(s.Bucket)
+		pipe.ZIncrBy(ctx, key, s.Score, strconv.FormatUint(uint64(s.ID), 10))
+		// 分桶按所在小时计算剩余保留时间
+		pipe.Expire(ctx, key, time.Until(s.Bucket.Add(trendingBucketTTL)))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TrendingBucketScore 重建分桶时写入的一条热度
+type TrendingBucketScore struct {
+	ID     uint      // 视频ID 或 话题ID
+	Bucket time.Time // 所在小时
+	Score  float64
+}
+
+// RecordTrendingEvent 记录一次视频互动（累加到当前小时的分桶）
+// 参数：视频ID、热度增量（取消点赞、删除评论时为负数）
+func RecordTrendingEvent(videoID uint, weight float64) error {
+	return videoTrending.record([]uint{videoID}, weight)
+}
+
+// RecordTagTrendingEvent 记录一次带话题视频的互动（视频的每个话题都累加相同的热度）
+func RecordTagTrendingEvent(tagIDs []uint, weight float64) error {
+	return tagTrending.record(tagIDs, weight)
+}
+
+// RetractTrendingEvents 撤销视频互动（取消点赞、删除评论），每次互动从其发生时所在小时的分桶中扣除热度，最多扣到0
+// 参数：视频ID、每次互动发生的时间、每次互动的热度（正数）
+func RetractTrendingEvents(videoID uint, at []time.Time, weight float64) error {
+	return videoTrending.retract([]uint{videoID}, at, weight)
+}
+
+// RetractTagTrendingEvents 撤销带话题视频的互动（视频的每个话题都扣除相同的热度）
+func RetractTagTrendingEvents(tagIDs []uint, at []time.Time, weight float64) error {
+	return tagTrending.retract(tagIDs, at, weight)
+}
+
+// GetTrendingVideoIDs 获取热度榜中从第 offset 名开始的 limit 个视频
+// 榜单中可能有不公开、私密或已删除的视频，由调用方过滤
+// 参数：时间窗口（24h / 7d / all）、偏移量（从0开始）、数量限制
+// 返回：视频ID列表（按热度降序，只包含热度大于0的视频）
+func GetTrendingVideoIDs(window string, offset, limit int) ([]uint, error) {
+	if window == TrendingWindowAll {
+		return GetTopLikedVideos(offset, limit)
+	}
+	return videoTrending.top(window, offset, limit)
+}
+
+// GetTrendingTagIDs 获取 24h / 7d 热度最高的前 limit 个话题（window=all 由调用方按视频数排序）
+func GetTrendingTagIDs(window string, limit int) ([]uint, error) {
+	return tagTrending.top(window, 0, limit)
+}
+
+// TrendingBucketsExist 最近 7 天是否存在任意视频分桶（用于判断是否需要从 MySQL 重建）
+func TrendingBucketsExist() (bool, error) {
+	return videoTrending.bucketsExist()
+}
+
+// RebuildTrendingBuckets 用给定热度重建视频分桶和话题分桶
+func RebuildTrendingBuckets(videoScores, tagScores []TrendingBucketScore) error {
+	if err := videoTrending.rebuild(videoScores); err != nil {
+		return err
+	}
+	return tagTrending.rebuild(tagScores)
+}
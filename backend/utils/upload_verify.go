@@ -0,0 +1,284 @@
+package utils
+
+// 上传文件校验
+//
+// 预签名上传URL对 Content-Type 和 Content-Length 签名，客户端上传的大小与声明不一致时 MinIO 直接拒绝。
+// 确认上传（包括分片合并、超时自动确认）前再检查 MinIO 中的文件，不通过的文件和视频记录一并删除：
+//   大小  与上传时声明的大小一致，且不超过上限
+//   类型  文件头的魔数是允许的视频容器，且与扩展名一致（MP4/MOV、MKV/WebM、AVI）
+//   结构  快速解析容器头部：MP4 顶层 box 首尾相接且包含 moov，MKV/WebM 的 EBML 头 DocType 有效且后跟 Segment，AVI 的 RIFF 长度不超过文件大小且包含 hdrl
+// 只读取文件头和 box 头部（按 Range 读取），不下载整个文件；完整的解码校验由 worker 转码时的 ffprobe 完成。
+
+import (
+	"backend/models"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// 容器格式
+const (
+	containerMP4      = "MP4/MOV"
+	containerMatroska = "MKV/WebM"
+	containerAVI      = "AVI"
+)
+
+const (
+	sniffSize      = 4096 // 读取文件头的字节数（识别格式、解析 EBML/RIFF 头部）
+	maxProbedBoxes = 64   // MP4 最多检查的顶层 box 数（分片 MP4 的 moof/mdat 很多，moov 在它们之前）
+)
+
+// videoFormats 允许的扩展名对应的容器格式和 Content-Type（与 services.allowedVideoFormats 保持一致）
+var videoFormats = map[string]struct {
+	container   string
+	contentType string
+}{
+	".mp4":  {containerMP4, "video/mp4"},
+	".mov":  {containerMP4, "video/quicktime"},
+	".webm": {containerMatroska, "video/webm"},
+	".mkv":  {containerMatroska, "video/x-matroska"},
+	".avi":  {containerAVI, "video/x-msvideo"},
+}
+
+// mp4TopLevelBoxes 可以出现在 MP4/MOV 文件开头的 box 类型（旧版 QuickTime 文件没有 ftyp）
+var mp4TopLevelBoxes = map[string]bool{
+	"ftyp": true, "moov": true, "mdat": true, "free": true, "skip": true, "wide": true, "pnot": true,
+}
+
+// ErrUploadRejected 上传的文件未通过校验（需要重新上传）
+var ErrUploadRejected = errors.New("上传的文件未通过校验")
+
+// rejectUpload 生成未通过校验的错误，原因会返回给客户端
+func rejectUpload(format string, a ...interface{}) error {
+	return fmt.Errorf("%w：%s", ErrUploadRejected, fmt.Sprintf(format, a...))
+}
+
+// VideoContentType 视频文件的 Content-Type（按扩展名）
+func VideoContentType(fileName string) string {
+	if f, ok := videoFormats[strings.ToLower(filepath.Ext(fileName))]; ok {
+		return f.contentType
+	}
+	return "application/octet-stream"
+}
+
+// VerifyUploadedFile 校验 MinIO 中已上传的视频文件
+// 参数：文件名、上传时声明的文件大小（0 表示未记录，只检查上限）、允许的最大文件大小（字节）
+// 返回：未通过校验时返回包装了 ErrUploadRejected 的错误，其他错误（如 MinIO 不可用）不代表文件无效
+func VerifyUploadedFile(fileName string, declaredSize, maxSize int64) error {
+	obj, err := mc.GetObject(context.Background(), MinioBucket, fileName, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	// 1. 大小
+	info, err := obj.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size
+	switch {
+	case size == 0:
+		return rejectUpload("文件为空")
+	case declaredSize > 0 && size != declaredSize:
+		return rejectUpload("文件大小与声明不符（声明%d字节，实际%d字节）", declaredSize, size)
+	case size > maxSize:
+		return rejectUpload("文件大小超过限制（最大%dMB）", maxSize>>20)
+	}
+
+	// 2. 类型：按文件头识别容器格式
+	head := make([]byte, min(size, sniffSize))
+	if n, err := obj.ReadAt(head, 0); n < len(head) {
+		return err
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	container := sniffContainer(head)
+	if container == "" {
+		return rejectUpload("文件不是支持的视频格式")
+	}
+	if want := videoFormats[ext].container; container != want {
+		return rejectUpload("文件内容（%s）与扩展名（%s）不符", container, ext)
+	}
+
+	// 3. 结构
+	var reason string
+	switch container {
+	case containerMP4:
+		reason, err = probeMP4(obj, size)
+	case containerMatroska:
+		reason = probeMatroska(head)
+	case containerAVI:
+		reason = probeAVI(head, size)
+	}
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return rejectUpload("视频文件结构无效（%s）", reason)
+	}
+	return nil
+}
+
+// RejectVideoUpload 删除未通过校验的文件和视频记录（视频记录经清理任务删除，原因为 upload_rejected）
+// 参数：视频（需要 ID、FileName）、执行确认的用户ID（系统自动确认时为 0）
+// 返回：是否删除（期间已被确认或删除时返回 false）
+func RejectVideoUpload(video models.Video, userID uint) (bool, error) {
+	// 先删除文件释放空间，失败时由清理任务再次删除
+	if err := mc.RemoveObject(context.Background(), MinioBucket, video.FileName, minio.RemoveObjectOptions{}); err != nil {
+		log.Printf("删除未通过校验的文件 %s 失败: %v", video.FileName, err)
+	}
+	return DeleteUploadingVideo(video, userID, models.PurgeReasonUploadRejected)
+}
+
+// sniffContainer 按文件头的魔数识别容器格式，无法识别时返回空字符串
+func sniffContainer(head []byte) string {
+	switch {
+	case len(head) >= 8 && mp4TopLevelBoxes[string(head[4:8])]:
+		return containerMP4
+	case len(head) >= 4 && string(head[:4]) == "\x1a\x45\xdf\xa3":
+		return containerMatroska
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "AVI ":
+		return containerAVI
+	}
+	return ""
+}
+
+// probeMP4 依次读取 MP4 顶层 box 的头部：每个 box 大小有效且首尾相接到文件末尾，并且包含 moov
+// 返回：结构无效的原因（有效时为空）、读取错误
+func probeMP4(r io.ReaderAt, size int64) (string, error) {
+	var hdr [16]byte
+	hasMoov := false
+	offset := int64(0)
+	for i := 0; offset < size && i < maxProbedBoxes; i++ {
+		if size-offset < 8 {
+			return fmt.Sprintf("偏移 %d 处的 box 不完整", offset), nil
+		}
+		if n, err := r.ReadAt(hdr[:8], offset); n < 8 {
+			return "", err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(hdr[:4]))
+		boxType := string(hdr[4:8])
+		headerSize := int64(8)
+		switch boxSize {
+		case 0: // 延伸到文件末尾
+			boxSize = size - offset
+		case 1: // 64 位大小
+			if size-offset < 16 {
+				return fmt.Sprintf("偏移 %d 处的 box 不完整", offset), nil
+			}
+			if n, err := r.ReadAt(hdr[8:16], offset+8); n < 8 {
+				return "", err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerSize = 16
+		}
+		if !printableBoxType(boxType) || boxSize < headerSize || boxSize > size-offset {
+			return fmt.Sprintf("偏移 %d 处的 box 无效", offset), nil
+		}
+		if boxType == "moov" {
+			hasMoov = true
+		}
+		offset += boxSize
+	}
+	if !hasMoov {
+		return "缺少 moov，文件可能不完整", nil
+	}
+	return "", nil
+}
+
+// printableBoxType box 类型是否为 4 个可打印 ASCII 字符
+func printableBoxType(t string) bool {
+	for i := 0; i < len(t); i++ {
+		if t[i] < 0x20 || t[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// probeMatroska 解析 EBML 头：DocType 为 webm 或 matroska，头部之后是 Segment
+// 返回：结构无效的原因（有效时为空）
+func probeMatroska(head []byte) string {
+	const (
+		idDocType = 0x4282
+		idSegment = 0x18538067
+	)
+
+	pos := 4 // EBML 头 ID
+	headerSize, n := readVint(head[pos:], false)
+	if n == 0 || headerSize > uint64(len(head)-pos-n) {
+		return "EBML 头不完整"
+	}
+	pos += n
+	end := pos + int(headerSize)
+
+	docType := ""
+	for pos < end {
+		id, n := readVint(head[pos:end], true)
+		if n == 0 {
+			return "EBML 头无效"
+		}
+		pos += n
+		elemSize, n := readVint(head[pos:end], false)
+		if n == 0 || elemSize > uint64(end-pos-n) {
+			return "EBML 头无效"
+		}
+		pos += n
+		if id == idDocType {
+			docType = strings.TrimRight(string(head[pos:pos+int(elemSize)]), "\x00")
+		}
+		pos += int(elemSize)
+	}
+	if docType != "webm" && docType != "matroska" {
+		return fmt.Sprintf("不支持的 DocType %q", docType)
+	}
+	if id, _ := readVint(head[end:], true); id != idSegment {
+		return "缺少 Segment"
+	}
+	return ""
+}
+
+// readVint 读取 EBML 变长整数，返回值和占用的字节数（无效时字节数为 0）
+// keepMarker 为 true 时保留长度标记位（元素 ID 的写法），否则去掉（元素大小的写法）
+func readVint(b []byte, keepMarker bool) (uint64, int) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0
+	}
+	n := bits.LeadingZeros8(b[0]) + 1
+	if n > len(b) {
+		return 0, 0
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= 0xff >> n
+	}
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n
+}
+
+// probeAVI 检查 RIFF 头：RIFF 长度不超过文件大小，第一个块是 hdrl 列表
+// 大于 1GB 的 OpenDML AVI 后面还有 RIFF AVIX 块，因此只要求第一个 RIFF 块完整
+// 返回：结构无效的原因（有效时为空）
+func probeAVI(head []byte, size int64) string {
+	if len(head) < 24 {
+		return "AVI 头不完整"
+	}
+	riffSize := int64(binary.LittleEndian.Uint32(head[4:8]))
+	if riffSize+8 > size {
+		return "RIFF 长度超过文件大小，文件可能不完整"
+	}
+	if string(head[12:16]) != "LIST" || string(head[20:24]) != "hdrl" {
+		return "缺少 hdrl"
+	}
+	return ""
+}
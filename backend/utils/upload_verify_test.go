@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// box 构造一个 MP4 box（size 为 0 时按实际长度填写）
+func box(boxType string, payload int, size uint32) []byte {
+	b := make([]byte, 8+payload)
+	if size == 0 {
+		size = uint32(len(b))
+	}
+	binary.BigEndian.PutUint32(b[:4], size)
+	copy(b[4:8], boxType)
+	return b
+}
+
+// largeBox 构造一个使用 64 位大小的 box
+func largeBox(boxType string, payload int) []byte {
+	b := make([]byte, 16+payload)
+	binary.BigEndian.PutUint32(b[:4], 1)
+	copy(b[4:8], boxType)
+	binary.BigEndian.PutUint64(b[8:16], uint64(len(b)))
+	return b
+}
+
+func TestSniffContainer(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"MP4 ftyp", box("ftyp", 8, 0), containerMP4},
+		{"旧版 QuickTime 以 moov 开头", box("moov", 8, 0), containerMP4},
+		{"Matroska", []byte("\x1a\x45\xdf\xa3\x01\x00"), containerMatroska},
+		{"AVI", []byte("RIFF\x00\x00\x00\x00AVI LIST"), containerAVI},
+		{"WAV 不是视频", []byte("RIFF\x00\x00\x00\x00WAVEfmt "), ""},
+		{"PNG", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d"), ""},
+		{"未知 box 类型", box("abcd", 8, 0), ""},
+		{"太短", []byte("ftyp"), ""},
+		{"空文件", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffContainer(tt.head); got != tt.want {
+				t.Errorf("sniffContainer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeMP4(t *testing.T) {
+	join := func(boxes ...[]byte) []byte { return bytes.Join(boxes, nil) }
+	toEnd := box("mdat", 64, 0)
+	binary.BigEndian.PutUint32(toEnd[:4], 0)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantBad bool
+	}{
+		{"ftyp + moov + mdat", join(box("ftyp", 16, 0), box("moov", 32, 0), box("mdat", 64, 0)), false},
+		{"moov 在 mdat 之后", join(box("ftyp", 16, 0), box("mdat", 64, 0), box("moov", 32, 0)), false},
+		{"64 位大小的 mdat", join(box("ftyp", 16, 0), box("moov", 32, 0), largeBox("mdat", 64)), false},
+		{"大小为 0 的 mdat 延伸到文件末尾", join(box("ftyp", 16, 0), box("moov", 32, 0), toEnd), false},
+		{"缺少 moov", join(box("ftyp", 16, 0), box("mdat", 64, 0)), true},
+		{"截断的文件", join(box("ftyp", 16, 0), box("moov", 32, 0), box("mdat", 64, 0))[:60], true},
+		{"末尾残留不足一个 box 头", join(box("ftyp", 16, 0), box("moov", 32, 0), []byte{0, 0, 0}), true},
+		{"box 大小小于头部", join(box("ftyp", 16, 4), box("moov", 32, 0)), true},
+		{"box 类型不可打印", join(box("ftyp", 16, 0), box("mo\x00v", 32, 0)), true},
+		{"64 位大小的头不完整", join(box("ftyp", 16, 0), box("moov", 32, 0), largeBox("mdat", 0)[:12]), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := probeMP4(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("probeMP4() err = %v", err)
+			}
+			if (reason != "") != tt.wantBad {
+				t.Errorf("probeMP4() reason = %q, wantBad %v", reason, tt.wantBad)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package utils
+
+// 播放量统计
+//
+// 播放器上报观看事件（开始、进度心跳、看完），每个观看者（登录用户 u:<用户ID>，未登录为会话 s:<会话ID>）对每个视频维护一个观看状态：
+//   view:state:<videoID>:<viewer>  HASH  dur 视频时长（秒）、ratio 本次播放的最大完播比例；view.dedup_window 内没有新事件则过期
+// 状态不存在时的第一个事件计为一次新的播放；完播比例只增不减，增加的部分累加到完播比例之和。
+// 增量先在 Redis 中聚合：
+//   view:pending   HASH  v:<videoID> 新增播放次数，c:<videoID> 新增的完播比例之和
+// 定时任务（RunViewFlusher）把聚合结果改名为快照 view:flushing，写入发件箱（播放量落库队列）后删除快照；
+// 写入失败时快照保留到下一轮重试。每个快照带批次ID（flush_id），worker 按批次ID去重，重复投递不会重复累加。
+
+import (
+	"backend/models"
+	"common/config"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Redis Key
+const (
+	ViewStatePrefix  = "view:state:"     // 观看状态 HASH 前缀（view:state:<videoID>:<viewer>）
+	ViewPendingKey   = "view:pending"    // 待落库的播放增量
+	ViewFlushingKey  = "view:flushing"   // 正在落库的播放增量快照
+	ViewFlushLockKey = "lock:view:flush" // 多实例只由一个实例落库
+)
+
+const (
+	viewFlushIDField    = "flush_id"         // 快照中保存批次ID的字段
+	viewFlushChunkSize  = 500                // 每条落库任务最多包含的视频数
+	viewFlushRetention  = 7 * 24 * time.Hour // 已落库批次ID的保留时间
+	viewCleanupInterval = time.Hour          // 清理已落库批次ID的间隔
+)
+
+// recordWatchScript 原子地记录一次观看事件
+// KEYS[1] 观看状态，KEYS[2] 待落库增量
+// ARGV[1] 视频ID，ARGV[2] 视频时长（秒），ARGV[3] 观看进度（秒），ARGV[4] 是否看完（1/0），ARGV[5] 状态过期时间（毫秒）
+// 返回：1 计为新的播放，0 属于已有的播放
+var recordWatchScript = redis.NewScript(`
+local isNew = 0
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	isNew = 1
+	redis.call('HSET', KEYS[1], 'dur', ARGV[2], 'ratio', '0')
+	redis.call('HINCRBY', KEYS[2], 'v:' .. ARGV[1], 1)
+end
+local dur = tonumber(redis.call('HGET', KEYS[1], 'dur')) or 0
+local ratio = 0
+if ARGV[4] == '1' then
+	ratio = 1
+elseif dur > 0 then
+	ratio = math.min(math.max(tonumber(ARGV[3]) / dur, 0), 1)
+end
+local old = tonumber(redis.call('HGET', KEYS[1], 'ratio')) or 0
+if ratio > old then
+	redis.call('HSET', KEYS[1], 'ratio', tostring(ratio))
+	redis.call('HINCRBYFLOAT', KEYS[2], 'c:' .. ARGV[1], tostring(ratio - old))
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return isNew
+`)
+
+// viewStateKey 观看状态 key
+func viewStateKey(videoID uint, viewer string) string {
+	return fmt.Sprintf("%s%d:%s", ViewStatePrefix, videoID, viewer)
+}
+
+// WatchStateExists 观看者是否有进行中的播放（用于判断是否需要查询视频信息）
+func WatchStateExists(videoID uint, viewer string) (bool, error) {
+	n, err := rdb.Exists(context.Background(), viewStateKey(videoID, viewer)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RecordWatchEvent 记录一次观看事件
+// 参数：视频ID、观看者标识（u:<用户ID> 或 s:<会话ID>）、视频时长（秒，只在新的播放时使用）、观看进度（秒）、是否看完
+// 返回：是否计为一次新的播放、错误
+func RecordWatchEvent(videoID uint, viewer string, duration float64, position float64, completed bool) (bool, error) {
+	done := "0"
+	if completed {
+		done = "1"
+	}
+	isNew, err := recordWatchScript.Run(context.Background(), rdb,
+		[]string{viewStateKey(videoID, viewer), ViewPendingKey},
+		videoID,
+		strconv.FormatFloat(duration, 'f', -1, 64),
+		strconv.FormatFloat(position, 'f', -1, 64),
+		done,
+		config.Conf.View.DedupWindow.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	return isNew == 1, nil
+}
+
+// RunViewFlusher 定时把 Redis 中聚合的播放增量写入发件箱，并定期清理已落库的批次ID（阻塞运行，需在 goroutine 中调用）
+func RunViewFlusher() {
+	ticker := time.NewTicker(config.Conf.View.FlushInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+
+	for range ticker.C {
+		if err := flushViews(); err != nil {
+			log.Printf("播放量落库失败: %v", err)
+		}
+
+		if time.Since(lastCleanup) >= viewCleanupInterval {
+			lastCleanup = time.Now()
+			if err := purgeViewFlushes(); err != nil {
+				log.Printf("清理播放量批次记录失败: %v", err)
+			}
+		}
+	}
+}
+
+// flushViews 取出一批播放增量写入发件箱
+func flushViews() error {
+	release, ok, err := TryLock(ViewFlushLockKey, time.Minute)
+	if err != nil || !ok {
+		return err
+	}
+	defer release()
+
+	ctx := context.Background()
+
+	// 1. 上一轮写入失败的快照优先处理，否则把待落库增量改名为快照（改名是原子的，之后的新事件写入新的 view:pending）
+	exists, err := rdb.Exists(ctx, ViewFlushingKey).Result()
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		pending, err := rdb.Exists(ctx, ViewPendingKey).Result()
+		if err != nil || pending == 0 {
+			return err
+		}
+		if err := rdb.Rename(ctx, ViewPendingKey, ViewFlushingKey).Err(); err != nil {
+			return err
+		}
+	}
+	// 批次ID写在快照中，同一快照重试时使用相同的批次ID
+	if err := rdb.HSetNX(ctx, ViewFlushingKey, viewFlushIDField, uuid.NewString()).Err(); err != nil {
+		return err
+	}
+
+	// 2. 读取快照并写入发件箱
+	fields, err := rdb.HGetAll(ctx, ViewFlushingKey).Result()
+	if err != nil {
+		return err
+	}
+	tasks := buildViewTasks(fields)
+	if len(tasks) > 0 {
+		if err := EnqueueViewTasks(tasks); err != nil {
+			return err
+		}
+	}
+
+	// 3. 写入成功后删除快照（删除失败时下一轮会用相同的批次ID重复写入，由 worker 去重）
+	return rdb.Del(ctx, ViewFlushingKey).Err()
+}
+
+// buildViewTasks 把快照解析为落库任务（按视频ID排序，每 viewFlushChunkSize 个视频一条任务）
+func buildViewTasks(fields map[string]string) []ViewTask {
+	deltas := make(map[uint]*ViewDelta)
+	get := func(id uint) *ViewDelta {
+		d, ok := deltas[id]
+		if !ok {
+			d = &ViewDelta{VideoID: id}
+			deltas[id] = d
+		}
+		return d
+	}
+	for field, value := range fields {
+		kind, idStr, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch kind {
+		case "v":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err == nil {
+				get(uint(id)).Views = n
+			}
+		case "c":
+			f, err := strconv.ParseFloat(value, 64)
+			if err == nil {
+				get(uint(id)).Completion = f
+			}
+		}
+	}
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	videos := make([]ViewDelta, 0, len(deltas))
+	for _, d := range deltas {
+		videos = append(videos, *d)
+	}
+	sort.Slice(videos, func(i, j int) bool { return videos[i].VideoID < videos[j].VideoID })
+
+	flushID := fields[viewFlushIDField]
+	tasks := make([]ViewTask, 0, (len(videos)+viewFlushChunkSize-1)/viewFlushChunkSize)
+	for i := 0; i < len(videos); i += viewFlushChunkSize {
+		end := min(i+viewFlushChunkSize, len(videos))
+		tasks = append(tasks, ViewTask{
+			FlushID: fmt.Sprintf("%s-%d", flushID, i/viewFlushChunkSize),
+			Videos:  videos[i:end],
+		})
+	}
+	return tasks
+}
+
+// EnqueueViewTasks 在一个事务中写入一批播放量落库任务
+func EnqueueViewTasks(tasks []ViewTask) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, task := range tasks {
+			if err := enqueueOutbox(tx, QueueVideoViewName, task); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	NotifyOutbox()
+	return nil
+}
+
+// purgeViewFlushes 删除超过保留时间的已落库批次ID
+func purgeViewFlushes() error {
+	return db.Where("created_at < ?", time.Now().Add(-viewFlushRetention)).Delete(&models.ViewFlush{}).Error
+}
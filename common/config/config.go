@@ -0,0 +1,397 @@
+package config
+
+// 配置加载（backend 与 worker 共用）
+//
+// 加载顺序（后者覆盖前者）：
+//   1. 代码中的默认值（见 defaults）
+//   2. YAML 配置文件：环境变量 CWATCH_CONFIG 指定的路径，未指定时依次查找 ./config.yaml、../config.yaml
+//   3. 环境变量：字段上 env 标签指定的变量名，如 CWATCH_MYSQL_PASSWORD
+//
+// 配置文件示例见仓库根目录的 config.example.yaml。
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Conf 全局配置（Load 成功后可用）
+var Conf *Config
+
+// Config 全部配置
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	MySQL     MySQLConfig     `yaml:"mysql"`
+	Redis     RedisConfig     `yaml:"redis"`
+	RabbitMQ  RabbitMQConfig  `yaml:"rabbitmq"`
+	MinIO     MinIOConfig     `yaml:"minio"`
+	JWT       JWTConfig       `yaml:"jwt"`
+	Bloom     BloomConfig     `yaml:"bloom"`
+	Worker    WorkerConfig    `yaml:"worker"`
+	Reconcile ReconcileConfig `yaml:"reconcile"`
+	View      ViewConfig      `yaml:"view"`
+	Upload    UploadConfig    `yaml:"upload"`
+}
+
+// ServerConfig HTTP 服务配置
+type ServerConfig struct {
+	Addr      string `yaml:"addr" env:"CWATCH_SERVER_ADDR"`             // 监听地址
+	PublicURL string `yaml:"public_url" env:"CWATCH_SERVER_PUBLIC_URL"` // 客户端访问 backend 的地址（生成 HLS 播放列表URL），如 http://localhost:5000
+}
+
+// BaseURL 客户端访问 backend 的地址（不含末尾的 /）
+func (c ServerConfig) BaseURL() string {
+	return strings.TrimSuffix(c.PublicURL, "/")
+}
+
+// MySQLConfig MySQL 配置
+type MySQLConfig struct {
+	Host     string `yaml:"host" env:"CWATCH_MYSQL_HOST"`
+	Port     int    `yaml:"port" env:"CWATCH_MYSQL_PORT"`
+	Username string `yaml:"username" env:"CWATCH_MYSQL_USERNAME"`
+	Password string `yaml:"password" env:"CWATCH_MYSQL_PASSWORD"`
+	Database string `yaml:"database" env:"CWATCH_MYSQL_DATABASE"`
+}
+
+// DSN MySQL 连接字符串
+// 格式：用户名:密码@tcp(主机:端口)/数据库名?参数
+func (c MySQLConfig) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		c.Username, c.Password, c.Host, c.Port, c.Database)
+}
+
+// RedisConfig Redis 配置
+type RedisConfig struct {
+	Host     string `yaml:"host" env:"CWATCH_REDIS_HOST"`
+	Port     int    `yaml:"port" env:"CWATCH_REDIS_PORT"`
+	Password string `yaml:"password" env:"CWATCH_REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"CWATCH_REDIS_DB"`
+}
+
+// Addr Redis 地址
+func (c RedisConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// RabbitMQConfig RabbitMQ 配置
+type RabbitMQConfig struct {
+	Host     string `yaml:"host" env:"CWATCH_RABBITMQ_HOST"`
+	Port     int    `yaml:"port" env:"CWATCH_RABBITMQ_PORT"`
+	Username string `yaml:"username" env:"CWATCH_RABBITMQ_USERNAME"`
+	Password string `yaml:"password" env:"CWATCH_RABBITMQ_PASSWORD"`
+	// backend 生产者通道池大小（每个通道开启 publisher confirms）
+	ChannelPoolSize int `yaml:"channel_pool_size" env:"CWATCH_RABBITMQ_CHANNEL_POOL_SIZE"`
+	// 发布消息后等待 broker 确认的超时时间
+	PublishTimeout time.Duration `yaml:"publish_timeout" env:"CWATCH_RABBITMQ_PUBLISH_TIMEOUT"`
+	// 连接断开后重连的最长退避间隔（从 1s 开始翻倍）
+	ReconnectMaxBackoff time.Duration `yaml:"reconnect_max_backoff" env:"CWATCH_RABBITMQ_RECONNECT_MAX_BACKOFF"`
+}
+
+// URL RabbitMQ 连接地址
+func (c RabbitMQConfig) URL() string {
+	return fmt.Sprintf("amqp://%s:%s@%s:%d/", c.Username, c.Password, c.Host, c.Port)
+}
+
+// MinIOConfig MinIO 配置
+type MinIOConfig struct {
+	Host      string `yaml:"host" env:"CWATCH_MINIO_HOST"`
+	Port      int    `yaml:"port" env:"CWATCH_MINIO_PORT"`
+	AccessKey string `yaml:"access_key" env:"CWATCH_MINIO_ACCESS_KEY"`
+	SecretKey string `yaml:"secret_key" env:"CWATCH_MINIO_SECRET_KEY"`
+	UseSSL    bool   `yaml:"use_ssl" env:"CWATCH_MINIO_USE_SSL"`
+	// 对外访问地址（浏览器访问视频、封面使用），为空时使用 http(s)://host:port
+	PublicURL string `yaml:"public_url" env:"CWATCH_MINIO_PUBLIC_URL"`
+}
+
+// Endpoint MinIO 服务地址（主机:端口）
+func (c MinIOConfig) Endpoint() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// BaseURL 对象对外访问的基础地址，不带末尾斜杠
+func (c MinIOConfig) BaseURL() string {
+	if c.PublicURL != "" {
+		return strings.TrimSuffix(c.PublicURL, "/")
+	}
+	scheme := "http"
+	if c.UseSSL {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.Endpoint())
+}
+
+// JWTConfig JWT 与登录会话配置
+type JWTConfig struct {
+	Secret     string        `yaml:"secret" env:"CWATCH_JWT_SECRET"`           // 签名密钥，至少16个字符
+	TTL        time.Duration `yaml:"ttl" env:"CWATCH_JWT_TTL"`                 // 访问令牌有效期，如 15m
+	RefreshTTL time.Duration `yaml:"refresh_ttl" env:"CWATCH_JWT_REFRESH_TTL"` // 刷新令牌（登录会话）有效期，每次刷新后顺延
+}
+
+// BloomConfig 随机 Feed 去重布隆过滤器配置
+type BloomConfig struct {
+	// 每个用户每天的 bitmap 大小（bits），位越多误判率越低，但 Redis 内存占用更大
+	BitsM uint32 `yaml:"bits_m" env:"CWATCH_BLOOM_BITS_M"`
+	// hash 次数 k（一般 3~8）
+	HashK int `yaml:"hash_k" env:"CWATCH_BLOOM_HASH_K"`
+	// Redis key 前缀
+	KeyPrefix string `yaml:"key_prefix" env:"CWATCH_BLOOM_KEY_PREFIX"`
+}
+
+// WorkerConfig 消费者服务配置
+type WorkerConfig struct {
+	VideoConcurrency int           `yaml:"video_concurrency" env:"CWATCH_WORKER_VIDEO_CONCURRENCY"` // 视频处理并发数
+	LikeConcurrency  int           `yaml:"like_concurrency" env:"CWATCH_WORKER_LIKE_CONCURRENCY"`   // 点赞落库并发数
+	LikeBatchSize    int           `yaml:"like_batch_size" env:"CWATCH_WORKER_LIKE_BATCH_SIZE"`     // 点赞落库每批最多处理的消息数（同时作为预取数量）
+	LikeBatchWindow  time.Duration `yaml:"like_batch_window" env:"CWATCH_WORKER_LIKE_BATCH_WINDOW"` // 攒批最长等待时间（第一条消息到达后开始计时）
+	FFmpegPath       string        `yaml:"ffmpeg_path" env:"CWATCH_WORKER_FFMPEG_PATH"`             // ffmpeg 可执行文件
+	FFprobePath      string        `yaml:"ffprobe_path" env:"CWATCH_WORKER_FFPROBE_PATH"`           // ffprobe 可执行文件
+	TempDir          string        `yaml:"temp_dir" env:"CWATCH_WORKER_TEMP_DIR"`                   // 转码临时目录
+}
+
+// ReconcileConfig Redis 与 MySQL 点赞数据对账配置（backend）
+type ReconcileConfig struct {
+	Interval  time.Duration `yaml:"interval" env:"CWATCH_RECONCILE_INTERVAL"`     // 定时对账间隔，0 表示不定时对账
+	BatchSize int           `yaml:"batch_size" env:"CWATCH_RECONCILE_BATCH_SIZE"` // 每批比较的视频数
+}
+
+// ViewConfig 播放量统计配置（backend）
+type ViewConfig struct {
+	DedupWindow   time.Duration `yaml:"dedup_window" env:"CWATCH_VIEW_DEDUP_WINDOW"`     // 同一用户/会话在该时间内没有新的观看事件才会重新计一次播放
+	FlushInterval time.Duration `yaml:"flush_interval" env:"CWATCH_VIEW_FLUSH_INTERVAL"` // 把 Redis 中聚合的播放增量投递到 MQ 的间隔
+}
+
+// UploadConfig 上传配置：分片上传、被放弃的上传的清理和上传完成事件（backend）
+type UploadConfig struct {
+	PartSizeMB    int           `yaml:"part_size_mb" env:"CWATCH_UPLOAD_PART_SIZE_MB"`     // 分片大小（MB），最后一个分片可以更小
+	MaxSizeMB     int           `yaml:"max_size_mb" env:"CWATCH_UPLOAD_MAX_SIZE_MB"`       // 分片上传允许的最大文件大小（MB）
+	MultipartTTL  time.Duration `yaml:"multipart_ttl" env:"CWATCH_UPLOAD_MULTIPART_TTL"`   // 分片上传超过该时间未完成则视为放弃，自动中止并清理已上传的分片
+	AbandonAfter  time.Duration `yaml:"abandon_after" env:"CWATCH_UPLOAD_ABANDON_AFTER"`   // 单次上传的视频记录创建后超过该时间仍未确认：文件已上传则自动确认，否则删除
+	SweepInterval time.Duration `yaml:"sweep_interval" env:"CWATCH_UPLOAD_SWEEP_INTERVAL"` // 清理被放弃的上传的间隔
+
+	BucketNotifications bool `yaml:"bucket_notifications" env:"CWATCH_UPLOAD_BUCKET_NOTIFICATIONS"` // 订阅 MinIO 存储桶的上传完成事件，文件上传后自动确认（不依赖客户端调用确认接口）
+}
+
+// defaults 默认配置（连接地址、密码、JWT 密钥等没有默认值，必须配置）
+func defaults() *Config {
+	return &Config{
+		Server: ServerConfig{Addr: ":5000", PublicURL: "http://localhost:5000"},
+		MySQL: MySQLConfig{
+			Port:     3306,
+			Username: "root",
+			Database: "cwatch",
+		},
+		Redis: RedisConfig{Port: 6379},
+		RabbitMQ: RabbitMQConfig{
+			Port:                5672,
+			ChannelPoolSize:     8,
+			PublishTimeout:      5 * time.Second,
+			ReconnectMaxBackoff: 30 * time.Second,
+		},
+		MinIO: MinIOConfig{Port: 9000},
+		JWT:   JWTConfig{TTL: 15 * time.Minute, RefreshTTL: 30 * 24 * time.Hour},
+		Bloom: BloomConfig{
+			BitsM:     1_048_576, // 约 128KB/用户/天
+			HashK:     5,
+			KeyPrefix: "bf:randomfeed:",
+		},
+		Worker: WorkerConfig{
+			VideoConcurrency: 3,
+			LikeConcurrency:  2,
+			LikeBatchSize:    200,
+			LikeBatchWindow:  500 * time.Millisecond,
+			FFmpegPath:       "ffmpeg", // 默认从 PATH 查找
+			FFprobePath:      "ffprobe",
+			TempDir:          filepath.Join(os.TempDir(), "cwatch", "video_processing"),
+		},
+		Reconcile: ReconcileConfig{
+			Interval:  10 * time.Minute,
+			BatchSize: 500,
+		},
+		View: ViewConfig{
+			DedupWindow:   30 * time.Minute,
+			FlushInterval: 10 * time.Second,
+		},
+		Upload: UploadConfig{
+			PartSizeMB:    16,
+			MaxSizeMB:     4096,
+			MultipartTTL:  24 * time.Hour,
+			AbandonAfter:  time.Hour,
+			SweepInterval: 10 * time.Minute,
+
+			BucketNotifications: true,
+		},
+	}
+}
+
+// Load 加载配置并用 validate 校验（ValidateBackend 或 ValidateWorker，各自只校验用到的配置），成功后同时设置全局配置 Conf
+func Load(validate func(*Config) error) (*Config, error) {
+	cfg := defaults()
+
+	// 1. 配置文件
+	path, err := findConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %v", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+	}
+
+	// 2. 环境变量覆盖
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	// 3. 校验
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+
+	Conf = cfg
+	return cfg, nil
+}
+
+// findConfigFile 查找配置文件
+// CWATCH_CONFIG 指定的文件必须存在；未指定时找不到配置文件不算错误（可以全部使用环境变量）
+func findConfigFile() (string, error) {
+	if path := os.Getenv("CWATCH_CONFIG"); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("配置文件 %s 不存在: %v", path, err)
+		}
+		return path, nil
+	}
+	for _, path := range []string{"config.yaml", filepath.Join("..", "config.yaml")} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// validator 收集配置校验错误
+type validator struct {
+	errs []error
+}
+
+// required 必填项
+func (v *validator) required(value, name string) {
+	if strings.TrimSpace(value) == "" {
+		v.errs = append(v.errs, fmt.Errorf("缺少配置项 %s", name))
+	}
+}
+
+// positive 必须大于0的配置项
+func (v *validator) positive(value int, name string) {
+	if value <= 0 {
+		v.errs = append(v.errs, fmt.Errorf("配置项 %s 必须大于0", name))
+	}
+}
+
+// fail 记录一条校验错误
+func (v *validator) fail(msg string) {
+	v.errs = append(v.errs, errors.New(msg))
+}
+
+// validateCommon 校验 backend 和 worker 都使用的配置（MySQL、Redis、RabbitMQ、MinIO 连接）
+func (c *Config) validateCommon(v *validator) {
+	v.required(c.MySQL.Host, "mysql.host")
+	v.required(c.MySQL.Password, "mysql.password")
+	v.required(c.MySQL.Database, "mysql.database")
+	v.required(c.Redis.Host, "redis.host")
+	v.required(c.RabbitMQ.Host, "rabbitmq.host")
+	v.required(c.RabbitMQ.Username, "rabbitmq.username")
+	v.required(c.RabbitMQ.Password, "rabbitmq.password")
+	v.required(c.MinIO.Host, "minio.host")
+	v.required(c.MinIO.AccessKey, "minio.access_key")
+	v.required(c.MinIO.SecretKey, "minio.secret_key")
+
+	v.positive(c.MySQL.Port, "mysql.port")
+	v.positive(c.Redis.Port, "redis.port")
+	v.positive(c.RabbitMQ.Port, "rabbitmq.port")
+	v.positive(c.RabbitMQ.ChannelPoolSize, "rabbitmq.channel_pool_size")
+	if c.RabbitMQ.PublishTimeout <= 0 {
+		v.fail("配置项 rabbitmq.publish_timeout 必须大于0")
+	}
+	if c.RabbitMQ.ReconnectMaxBackoff < time.Second {
+		v.fail("配置项 rabbitmq.reconnect_max_backoff 不能小于1s")
+	}
+	v.positive(c.MinIO.Port, "minio.port")
+}
+
+// ValidateBackend 校验 backend 使用的配置（必填项和取值范围）
+func (c *Config) ValidateBackend() error {
+	v := &validator{}
+	c.validateCommon(v)
+
+	v.required(c.Server.PublicURL, "server.public_url")
+	if len(c.JWT.Secret) < 16 {
+		v.fail("配置项 jwt.secret 至少需要16个字符")
+	}
+	if c.JWT.TTL <= 0 {
+		v.fail("配置项 jwt.ttl 必须大于0")
+	}
+	if c.JWT.RefreshTTL <= c.JWT.TTL {
+		v.fail("配置项 jwt.refresh_ttl 必须大于 jwt.ttl")
+	}
+
+	v.positive(int(c.Bloom.BitsM), "bloom.bits_m")
+	v.positive(c.Bloom.HashK, "bloom.hash_k")
+	v.positive(c.Reconcile.BatchSize, "reconcile.batch_size")
+	if c.Reconcile.Interval < 0 {
+		v.fail("配置项 reconcile.interval 不能小于0")
+	}
+	if c.View.DedupWindow < time.Minute {
+		v.fail("配置项 view.dedup_window 不能小于1m")
+	}
+	if c.View.FlushInterval < time.Second {
+		v.fail("配置项 view.flush_interval 不能小于1s")
+	}
+	// S3 协议要求除最后一个外的分片不小于 5MB，且最多 10000 个分片
+	if c.Upload.PartSizeMB < 5 {
+		v.fail("配置项 upload.part_size_mb 不能小于5")
+	}
+	v.positive(c.Upload.MaxSizeMB, "upload.max_size_mb")
+	if c.Upload.PartSizeMB > 0 && c.Upload.MaxSizeMB > c.Upload.PartSizeMB*10000 {
+		v.fail("配置项 upload.max_size_mb 不能超过 upload.part_size_mb 的 10000 倍")
+	}
+	if c.Upload.MultipartTTL < time.Hour {
+		v.fail("配置项 upload.multipart_ttl 不能小于1h")
+	}
+	// 上传URL有效期为 15 分钟，过期前客户端仍可能在上传
+	if c.Upload.AbandonAfter < 15*time.Minute {
+		v.fail("配置项 upload.abandon_after 不能小于15m")
+	}
+	if c.Upload.SweepInterval < time.Minute {
+		v.fail("配置项 upload.sweep_interval 不能小于1m")
+	}
+
+	return errors.Join(v.errs...)
+}
+
+// ValidateWorker 校验 worker 使用的配置（不需要 JWT、server 等 backend 的配置）
+func (c *Config) ValidateWorker() error {
+	v := &validator{}
+	c.validateCommon(v)
+
+	v.required(c.Worker.FFmpegPath, "worker.ffmpeg_path")
+	v.required(c.Worker.FFprobePath, "worker.ffprobe_path")
+	v.required(c.Worker.TempDir, "worker.temp_dir")
+	v.positive(c.Worker.VideoConcurrency, "worker.video_concurrency")
+	v.positive(c.Worker.LikeConcurrency, "worker.like_concurrency")
+	v.positive(c.Worker.LikeBatchSize, "worker.like_batch_size")
+	if c.Worker.LikeBatchWindow <= 0 {
+		v.fail("配置项 worker.like_batch_window 必须大于0")
+	}
+
+	return errors.Join(v.errs...)
+}
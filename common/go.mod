@@ -0,0 +1,8 @@
+module common
+
+go 1.24.9
+
+require (
+	github.com/rabbitmq/amqp091-go v1.10.0
+	go.yaml.in/yaml/v3 v3.0.4
+)
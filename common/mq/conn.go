@@ -0,0 +1,290 @@
+package mq
+
+// 自动重连的 RabbitMQ 连接（backend 生产者与 worker 消费者共用）
+//
+// 连接通过 NotifyClose 监听断开，断开后按 1s、2s、4s…（最长 maxBackoff）退避重连，
+// 重连成功后重新声明拓扑（broker 重启后非持久化的状态需要重建），再唤醒等待中的使用方：
+//   - 生产者（Publisher）的通道随旧连接一起失效，下次发布时在新连接上重新创建；
+//   - 消费者（Consume）的 deliveries 通道关闭后等待重连，然后重新开始消费。
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrClosed 连接已被主动关闭
+var ErrClosed = errors.New("RabbitMQ 连接已关闭")
+
+// Connection 自动重连的 RabbitMQ 连接
+type Connection struct {
+	url        string
+	maxBackoff time.Duration
+	setup      func(ch *amqp.Channel) error // 每次连接成功后执行（声明拓扑）
+
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	ready  chan struct{} // 连接可用时关闭；断开后替换为新的未关闭通道
+	closed bool
+	done   chan struct{} // Close 时关闭
+}
+
+// Dial 建立连接，第一次连接失败直接返回错误（启动时尽早暴露配置问题）
+// 参数：连接地址、重连最长退避间隔、连接成功后的初始化（可为 nil）
+func Dial(url string, maxBackoff time.Duration, setup func(ch *amqp.Channel) error) (*Connection, error) {
+	c := &Connection{
+		url:        url,
+		maxBackoff: maxBackoff,
+		setup:      setup,
+		ready:      make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	c.setConn(conn)
+	return c, nil
+}
+
+// connect 建立一次连接并执行初始化
+func (c *Connection) connect() (*amqp.Connection, error) {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return nil, err
+	}
+	if c.setup != nil {
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		err = c.setup(ch)
+		ch.Close()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// setConn 切换到新连接，唤醒等待者并开始监听断开
+func (c *Connection) setConn(conn *amqp.Connection) {
+	c.mu.Lock()
+	if c.closed {
+		// 重连期间连接已被主动关闭
+		c.mu.Unlock()
+		conn.Close()
+		return
+	}
+	c.conn = conn
+	close(c.ready)
+	c.mu.Unlock()
+
+	closeCh := conn.NotifyClose(make(chan *amqp.Error, 1))
+	go c.watch(closeCh)
+}
+
+// watch 等待连接断开并重连
+func (c *Connection) watch(closeCh chan *amqp.Error) {
+	reason, ok := <-closeCh
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.conn = nil
+	c.ready = make(chan struct{})
+	c.mu.Unlock()
+
+	if ok {
+		log.Printf("RabbitMQ 连接断开: %v，开始重连", reason)
+	} else {
+		log.Println("RabbitMQ 连接断开，开始重连")
+	}
+
+	backoff := time.Second
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		conn, err := c.connect()
+		if err == nil {
+			log.Println("RabbitMQ 重连成功")
+			c.setConn(conn)
+			return
+		}
+		log.Printf("RabbitMQ 重连失败: %v，%v 后重试", err, backoff)
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// current 当前连接（断开期间为 nil）和连接可用信号
+func (c *Connection) current() (*amqp.Connection, <-chan struct{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, nil, ErrClosed
+	}
+	return c.conn, c.ready, nil
+}
+
+// Channel 在当前连接上打开一个通道；连接断开时等待重连，直到 ctx 结束
+func (c *Connection) Channel(ctx context.Context) (*amqp.Channel, error) {
+	for {
+		conn, ready, err := c.current()
+		if err != nil {
+			return nil, err
+		}
+		var retry <-chan time.Time
+		if conn != nil {
+			ch, err := conn.Channel()
+			if err == nil {
+				return ch, nil
+			}
+			if !conn.IsClosed() {
+				return nil, err
+			}
+			// 连接恰好在此时断开，ready 仍是旧信号，短暂等待 watch 切换状态后重新检查
+			ready, retry = nil, time.After(100*time.Millisecond)
+		}
+
+		select {
+		case <-ready:
+		case <-retry:
+		case <-c.done:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close 关闭连接，不再重连
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+// Consume 持续消费一个队列：打开通道、设置 QoS 并逐条交给 handle 处理，
+// 连接或通道断开后等待重连再重新消费，直到 ctx 结束或连接被关闭。
+// handle 负责 Ack/Nack（ch 为消息所在的通道，供 Retry/DeadLetter 使用）。
+// 参数：上下文、队列名称、预取数量、日志名称、消息处理函数
+func (c *Connection) Consume(ctx context.Context, queue string, prefetch int, name string, handle func(ch *amqp.Channel, d amqp.Delivery)) error {
+	return c.consume(ctx, queue, prefetch, name, func(ch *amqp.Channel, deliveries <-chan amqp.Delivery) {
+		for d := range deliveries {
+			handle(ch, d)
+		}
+	})
+}
+
+// ConsumeBatch 与 Consume 相同，但按批交给 handle 处理：
+// 攒满 batchSize 条，或第一条消息到达后经过 window 时间，就处理当前这一批（预取数量为 batchSize）。
+// handle 负责 Ack/Nack 批内的每条消息。
+func (c *Connection) ConsumeBatch(ctx context.Context, queue string, batchSize int, window time.Duration, name string, handle func(ch *amqp.Channel, batch []amqp.Delivery)) error {
+	return c.consume(ctx, queue, batchSize, name, func(ch *amqp.Channel, deliveries <-chan amqp.Delivery) {
+		for {
+			// 阻塞等待一批的第一条消息
+			d, ok := <-deliveries
+			if !ok {
+				return
+			}
+			batch := []amqp.Delivery{d}
+
+			timer := time.NewTimer(window)
+		collect:
+			for len(batch) < batchSize {
+				select {
+				case d, ok := <-deliveries:
+					if !ok {
+						break collect
+					}
+					batch = append(batch, d)
+				case <-timer.C:
+					break collect
+				}
+			}
+			timer.Stop()
+
+			// 通道已关闭时未确认的消息会被 broker 重新投递，这里仍交给 handle（Ack 会失败，消息不会丢）
+			handle(ch, batch)
+		}
+	})
+}
+
+// consume 消费循环：打开通道并开始消费，run 返回（deliveries 关闭）后等待重连再重新消费
+func (c *Connection) consume(ctx context.Context, queue string, prefetch int, name string, run func(ch *amqp.Channel, deliveries <-chan amqp.Delivery)) error {
+	for {
+		ch, err := c.Channel(ctx)
+		if err != nil {
+			return err
+		}
+
+		deliveries, err := c.startConsume(ch, queue, prefetch)
+		if err != nil {
+			ch.Close()
+			log.Printf("%s 开始消费失败: %v，1s 后重试", name, err)
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		log.Printf("%s 已启动，等待任务...", name)
+		stop := context.AfterFunc(ctx, func() { ch.Close() }) // ctx 结束时关闭通道以结束消费
+		run(ch, deliveries)
+		stop()
+		ch.Close()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("%s 消费通道已关闭，等待重连", name)
+	}
+}
+
+// startConsume 设置 QoS、开启 confirm 模式（Retry/DeadLetter 在消费通道上发布并等待确认）并开始消费
+func (c *Connection) startConsume(ch *amqp.Channel, queue string, prefetch int) (<-chan amqp.Delivery, error) {
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+	return ch.Consume(
+		queue,
+		"",    // consumer tag
+		false, // autoAck: 手动确认
+		false, // exclusive
+		false, // noLocal
+		false, // noWait
+		nil,
+	)
+}
@@ -0,0 +1,107 @@
+package mq
+
+// 死信队列的查看与重新投递
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetterMessage 死信队列中的一条消息
+type DeadLetterMessage struct {
+	Queue      string    `json:"queue"`       // 原业务队列
+	Body       string    `json:"body"`        // 消息内容（JSON 任务）
+	RetryCount int       `json:"retry_count"` // 已重试次数
+	LastError  string    `json:"last_error"`  // 最近一次失败原因
+	FailedAt   time.Time `json:"failed_at"`   // 进入死信队列的时间
+}
+
+// PeekDeadLetters 查看死信队列中最多 limit 条消息（不会移除消息）
+func PeekDeadLetters(ch *amqp.Channel, queue string, limit int) ([]DeadLetterMessage, error) {
+	if _, ok := Policies[queue]; !ok {
+		return nil, fmt.Errorf("未知队列: %s", queue)
+	}
+
+	result := make([]DeadLetterMessage, 0, limit)
+	var lastTag uint64
+	for len(result) < limit {
+		d, ok, err := ch.Get(DeadLetterQueue(queue), false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break // 队列已空
+		}
+		lastTag = d.DeliveryTag
+		result = append(result, toDeadLetterMessage(d, queue))
+	}
+
+	// 全部放回死信队列（multiple=true 一次性 Nack 之前取出的所有消息）
+	if lastTag != 0 {
+		if err := ch.Nack(lastTag, true, true); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Redrive 将死信队列中最多 limit 条消息重新投递回业务队列（重试次数清零）
+// 返回：重新投递的消息数量
+func Redrive(ch *amqp.Channel, queue string, limit int) (int, error) {
+	if _, ok := Policies[queue]; !ok {
+		return 0, fmt.Errorf("未知队列: %s", queue)
+	}
+
+	// 重新投递的消息等 broker 确认后才从死信队列中 Ack
+	if err := ch.Confirm(false); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for count < limit {
+		d, ok, err := ch.Get(DeadLetterQueue(queue), false)
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			break
+		}
+
+		headers := cleanHeaders(d.Headers)
+		delete(headers, HeaderRetryCount)
+		delete(headers, HeaderLastError)
+		delete(headers, HeaderOriginalQueue)
+		delete(headers, HeaderFailedAt)
+
+		if err := publish(ch, "", queue, d, headers); err != nil {
+			_ = d.Nack(false, true)
+			return count, err
+		}
+		if err := d.Ack(false); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// toDeadLetterMessage 从消息头提取死信信息
+func toDeadLetterMessage(d amqp.Delivery, queue string) DeadLetterMessage {
+	msg := DeadLetterMessage{
+		Queue:      queue,
+		Body:       string(d.Body),
+		RetryCount: RetryCount(d.Headers),
+	}
+	if s, ok := d.Headers[HeaderLastError].(string); ok {
+		msg.LastError = s
+	} else {
+		// 由 broker 自动死信的消息（Nack requeue=false）没有失败原因
+		msg.LastError = "rejected"
+	}
+	if ts, ok := d.Headers[HeaderFailedAt].(int64); ok {
+		msg.FailedAt = time.Unix(ts, 0)
+	}
+	return msg
+}
@@ -0,0 +1,138 @@
+package mq
+
+// 带 publisher confirms 的生产者
+//
+// amqp.Channel 不能被多个 goroutine 同时用于发布（确认序号会错乱），
+// Publisher 维护一个 confirm 模式的通道池：每次发布从池中取出一个通道独占使用，
+// 等到 broker 确认后再放回；通道出错或确认超时则丢弃，下次按需在当前连接上重新创建。
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrNack broker 未确认消息（nack，或通道在确认前关闭）
+var ErrNack = errors.New("broker 未确认消息")
+
+// Message 待发布的消息
+type Message struct {
+	Exchange   string          // 交换机，空字符串为默认交换机
+	Key        string          // routing key（默认交换机下为队列名称）
+	Publishing amqp.Publishing // 消息属性和内容
+}
+
+// Publisher 带通道池和 publisher confirms 的生产者（并发安全）
+type Publisher struct {
+	conn    *Connection
+	pool    chan *amqp.Channel
+	timeout time.Duration
+}
+
+// NewPublisher 创建生产者
+// 参数：连接、通道池大小、等待 broker 确认的超时时间
+func NewPublisher(conn *Connection, poolSize int, timeout time.Duration) *Publisher {
+	return &Publisher{
+		conn:    conn,
+		pool:    make(chan *amqp.Channel, poolSize),
+		timeout: timeout,
+	}
+}
+
+// acquire 从池中取出一个可用通道，池空时新建（连接断开时等待重连，直到 ctx 结束）
+func (p *Publisher) acquire(ctx context.Context) (*amqp.Channel, error) {
+	for {
+		select {
+		case ch := <-p.pool:
+			if !ch.IsClosed() {
+				return ch, nil
+			}
+			// 旧连接上的通道，丢弃
+			continue
+		default:
+		}
+
+		ch, err := p.conn.Channel(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := ch.Confirm(false); err != nil {
+			ch.Close()
+			return nil, err
+		}
+		return ch, nil
+	}
+}
+
+// release 归还通道；池已满或通道不再可靠时关闭
+func (p *Publisher) release(ch *amqp.Channel, healthy bool) {
+	if healthy && !ch.IsClosed() {
+		select {
+		case p.pool <- ch:
+			return
+		default:
+		}
+	}
+	ch.Close()
+}
+
+// Publish 发布一条消息并等待 broker 确认
+func (p *Publisher) Publish(ctx context.Context, msg Message) error {
+	return p.PublishBatch(ctx, []Message{msg})[0]
+}
+
+// PublishBatch 在同一个通道上依次发布一批消息（保持顺序），再统一等待 broker 确认
+// 返回：与 msgs 一一对应的结果（nil 表示 broker 已确认）
+func (p *Publisher) PublishBatch(ctx context.Context, msgs []Message) []error {
+	results := make([]error, len(msgs))
+	if len(msgs) == 0 {
+		return results
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	ch, err := p.acquire(ctx)
+	if err != nil {
+		for i := range results {
+			results[i] = err
+		}
+		return results
+	}
+
+	confirms := make([]*amqp.DeferredConfirmation, len(msgs))
+	for i, msg := range msgs {
+		confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, msg.Exchange, msg.Key, false, false, msg.Publishing)
+		if err != nil {
+			// 通道已不可用，本批剩余消息都不再尝试
+			for j := i; j < len(msgs); j++ {
+				results[j] = err
+			}
+			break
+		}
+		confirms[i] = confirm
+	}
+
+	healthy := true
+	for i, confirm := range confirms {
+		if confirm == nil {
+			healthy = false
+			continue
+		}
+		acked, err := confirm.WaitContext(ctx)
+		switch {
+		case err != nil:
+			results[i] = fmt.Errorf("等待 broker 确认超时: %w", err)
+			healthy = false
+		case !acked:
+			results[i] = ErrNack
+		}
+	}
+
+	// 确认超时的通道可能还会收到迟到的确认，不再复用
+	p.release(ch, healthy)
+	return results
+}
@@ -0,0 +1,136 @@
+package mq
+
+// 消费失败的重试与死信处理
+//
+// 重试和死信消息在消费通道上重新发布，等 broker 确认（publisher confirms）后才 Ack 原消息：
+// 消费通道在开始消费时开启 confirm 模式（见 Connection.startConsume），
+// 发布失败、被 nack 或确认超时都 Nack 原消息并重新入队，消息最多重复、不会丢失。
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// 消息头
+const (
+	HeaderRetryCount    = "x-retry-count"    // 已重试次数
+	HeaderLastError     = "x-last-error"     // 最近一次失败原因
+	HeaderOriginalQueue = "x-original-queue" // 原业务队列
+	HeaderFailedAt      = "x-failed-at"      // 进入死信队列的时间（Unix 秒）
+)
+
+// maxErrorLength 写入消息头的错误信息最大长度（按字符）
+const maxErrorLength = 1000
+
+// RetryCount 从消息头读取已重试次数
+func RetryCount(headers amqp.Table) int {
+	switch v := headers[HeaderRetryCount].(type) {
+	case int:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// Retry 处理一条消费失败的消息
+// 未超过重试次数时投递到对应的延迟重试队列；否则投递到死信队列。
+// broker 确认投递后 Ack 原消息；投递失败则 Nack 并重新入队，保证消息不丢。
+// 返回：消息是否进入了死信队列
+func Retry(ch *amqp.Channel, d amqp.Delivery, queue string, cause error) (bool, error) {
+	policy := Policies[queue]
+	n := RetryCount(d.Headers) + 1
+	if n > policy.MaxRetries {
+		return true, DeadLetter(ch, d, queue, cause)
+	}
+
+	headers := cleanHeaders(d.Headers)
+	headers[HeaderRetryCount] = int32(n)
+	headers[HeaderLastError] = truncate(cause.Error())
+
+	if err := publish(ch, "", RetryQueue(queue, n), d, headers); err != nil {
+		_ = d.Nack(false, true)
+		return false, err
+	}
+	return false, d.Ack(false)
+}
+
+// DeadLetter 将消息直接投递到死信队列（用于无法解析等不可重试的消息）
+func DeadLetter(ch *amqp.Channel, d amqp.Delivery, queue string, cause error) error {
+	headers := cleanHeaders(d.Headers)
+	headers[HeaderRetryCount] = int32(RetryCount(d.Headers))
+	headers[HeaderLastError] = truncate(cause.Error())
+	headers[HeaderOriginalQueue] = queue
+	headers[HeaderFailedAt] = time.Now().Unix()
+
+	if err := publish(ch, DeadLetterExchange, DeadLetterQueue(queue), d, headers); err != nil {
+		_ = d.Nack(false, true)
+		return err
+	}
+	return d.Ack(false)
+}
+
+// publishTimeout 重新发布消息并等待 broker 确认的超时时间
+const publishTimeout = 5 * time.Second
+
+// ErrNoConfirm 通道未开启 confirm 模式，无法确认消息已被 broker 接收
+var ErrNoConfirm = errors.New("通道未开启 publisher confirms")
+
+// publish 以原消息的属性重新发布消息，并等待 broker 确认（ch 必须已开启 confirm 模式）
+func publish(ch *amqp.Channel, exchange, key string, d amqp.Delivery, headers amqp.Table) error {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, amqp.Publishing{
+		Headers:      headers,
+		DeliveryMode: amqp.Persistent,
+		ContentType:  d.ContentType,
+		MessageId:    d.MessageId,
+		Timestamp:    d.Timestamp,
+		Body:         d.Body,
+	})
+	if err != nil {
+		return err
+	}
+	if confirm == nil {
+		return ErrNoConfirm
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("等待 broker 确认超时: %w", err)
+	}
+	if !acked {
+		return ErrNack
+	}
+	return nil
+}
+
+// cleanHeaders 复制消息头，去掉 broker 维护的 x-death 系列字段
+func cleanHeaders(src amqp.Table) amqp.Table {
+	headers := amqp.Table{}
+	for k, v := range src {
+		if k == "x-death" || strings.HasPrefix(k, "x-first-death") || strings.HasPrefix(k, "x-last-death") {
+			continue
+		}
+		headers[k] = v
+	}
+	return headers
+}
+
+func truncate(s string) string {
+	if r := []rune(s); len(r) > maxErrorLength {
+		return string(r[:maxErrorLength])
+	}
+	return s
+}
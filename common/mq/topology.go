@@ -0,0 +1,139 @@
+package mq
+
+// RabbitMQ 拓扑定义（backend 生产者与 worker 消费者共用）
+//
+// 每个业务队列 <queue> 都会声明：
+//   <queue>            业务队列，消费失败 Nack(requeue=false) 时自动死信到 <queue>.dlq
+//   <queue>.retry.<n>  第 n 次重试的延迟队列（带 TTL，到期后通过默认交换机回到 <queue>）
+//   <queue>.dlq        死信队列，重试耗尽或无法解析的消息最终进入这里，等待人工排查和重新投递
+//
+// 注意：已存在的业务队列如果是旧版本（无 x-dead-letter-* 参数）声明的，
+// 重新声明会返回 PRECONDITION_FAILED，需要先在管理界面删除旧队列。
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// 队列和交换机名称
+const (
+	QueueVideoName        = "video_processing"        // 视频封面，转码处理 队列名称
+	QueueVideoLikeName    = "video_like_processing"   // 点赞处理队列
+	QueueCommentLikeName  = "comment_like_processing" // 评论点赞处理队列
+	QueueVideoViewName    = "video_view_processing"   // 播放量落库队列
+	QueueVideoCleanupName = "video_cleanup"           // 视频删除后的级联清理队列
+
+	DeadLetterExchange = "cwatch.dlx" // 死信交换机（direct）
+)
+
+// RetryPolicy 队列的重试策略
+// 第 n 次重试的延迟 = BaseDelay * 2^(n-1)
+type RetryPolicy struct {
+	MaxRetries int           // 最大重试次数，超过后进入死信队列
+	BaseDelay  time.Duration // 第一次重试的延迟
+}
+
+// Delay 第 n 次（从1开始）重试的延迟
+func (p RetryPolicy) Delay(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+	return p.BaseDelay << (n - 1)
+}
+
+// Policies 各业务队列的重试策略
+var Policies = map[string]RetryPolicy{
+	// 视频处理耗时长，失败多为 FFmpeg/存储问题，间隔拉长：30s, 60s, 120s
+	QueueVideoName: {MaxRetries: 3, BaseDelay: 30 * time.Second},
+	// 点赞落库失败多为数据库瞬时抖动，快速重试：1s, 2s, 4s, 8s, 16s
+	QueueVideoLikeName:   {MaxRetries: 5, BaseDelay: time.Second},
+	QueueCommentLikeName: {MaxRetries: 5, BaseDelay: time.Second},
+	// 播放量是按批聚合后的增量，同样快速重试
+	QueueVideoViewName: {MaxRetries: 5, BaseDelay: time.Second},
+	// 清理失败多为 MinIO/Redis 暂时不可用，间隔拉长：10s, 20s, 40s, 80s, 160s
+	QueueVideoCleanupName: {MaxRetries: 5, BaseDelay: 10 * time.Second},
+}
+
+// DeadLetterQueue 死信队列名称
+func DeadLetterQueue(queue string) string {
+	return queue + ".dlq"
+}
+
+// RetryQueue 第 n 次重试的延迟队列名称
+func RetryQueue(queue string, n int) string {
+	return fmt.Sprintf("%s.retry.%d", queue, n)
+}
+
+// DeclareTopology 声明所有业务队列、重试队列、死信交换机和死信队列（幂等）
+func DeclareTopology(ch *amqp.Channel) error {
+	// 死信交换机
+	if err := ch.ExchangeDeclare(
+		DeadLetterExchange, // 交换机名称
+		"direct",           // 类型：按 routing key 精确路由到对应的死信队列
+		true,               // durable: 持久化
+		false,              // autoDelete: 不自动删除
+		false,              // internal: 非内部交换机
+		false,              // noWait: 等待服务器确认
+		nil,                // arguments: 额外参数
+	); err != nil {
+		return fmt.Errorf("声明死信交换机失败: %v", err)
+	}
+
+	for queue, policy := range Policies {
+		if err := declareQueue(ch, queue, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declareQueue 声明一个业务队列及其重试队列、死信队列
+func declareQueue(ch *amqp.Channel, queue string, policy RetryPolicy) error {
+	dlq := DeadLetterQueue(queue)
+
+	// 1. 死信队列，并绑定到死信交换机
+	if _, err := ch.QueueDeclare(dlq, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("声明死信队列 %s 失败: %v", dlq, err)
+	}
+	if err := ch.QueueBind(dlq, dlq, DeadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("绑定死信队列 %s 失败: %v", dlq, err)
+	}
+
+	// 2. 业务队列：被拒绝（requeue=false）的消息自动进入死信队列
+	_, err := ch.QueueDeclare(
+		queue, // 队列名称
+		true,  // durable: 持久化队列
+		false, // autoDelete: 不自动删除
+		false, // exclusive: 非独占队列
+		false, // noWait: 等待服务器确认
+		amqp.Table{
+			"x-dead-letter-exchange":    DeadLetterExchange,
+			"x-dead-letter-routing-key": dlq,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("声明队列 %s 失败: %v", queue, err)
+	}
+
+	// 3. 重试延迟队列：消息 TTL 到期后通过默认交换机回到业务队列
+	for n := 1; n <= policy.MaxRetries; n++ {
+		_, err := ch.QueueDeclare(
+			RetryQueue(queue, n),
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				"x-message-ttl":             policy.Delay(n).Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queue,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("声明重试队列 %s 失败: %v", RetryQueue(queue, n), err)
+		}
+	}
+	return nil
+}
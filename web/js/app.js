@@ -42,6 +42,7 @@ const el = {
     commentList: document.getElementById("commentList"),
     commentInput: document.getElementById("commentInput"),
     commentSend: document.getElementById("commentSend"),
+    commentSort: document.getElementById("commentSort"),
     shareGrid: document.getElementById("shareGrid"),
     shareLink: document.getElementById("shareLink"),
     copyBtn: document.getElementById("copyBtn"),
@@ -74,6 +75,8 @@ const el = {
     uploadFileSize: document.getElementById("uploadFileSize"),
     uploadChangeFile: document.getElementById("uploadChangeFile"),
     uploadTitle: document.getElementById("uploadTitle"),
+    uploadDescription: document.getElementById("uploadDescription"),
+    uploadVisibility: document.getElementById("uploadVisibility"),
     uploadProgress: document.getElementById("uploadProgress"),
     uploadProgressFill: document.getElementById("uploadProgressFill"),
     uploadProgressText: document.getElementById("uploadProgressText"),
@@ -100,11 +103,11 @@ const state = {
     // 新增：上传状态
     uploadFile: null, // 当前选择的文件
     isUploading: false, // 是否正在上传
+    multipartVideoId: null, // 未完成的分片上传对应的视频ID（上传中断后再次点击上传时继续）
     // 新增：视频列表状态
     videoList: [], // 服务器视频列表
-    videoPage: 1, // 当前页码
+    videoCursor: "", // 下一页游标（服务器返回的 next_cursor）
     videoPageSize: 12, // 每页数量
-    videoTotal: 0, // 总数
     isLoadingVideos: false, // 是否正在加载
     hasMoreVideos: true, // 是否还有更多
     // 新增：全局静音状态
@@ -118,9 +121,13 @@ const state = {
     // =========================
     randomFeedLoading: false,
     randomFeedHasMore: true,
-    randomFeedNextPage: 1,
+    randomFeedNextCursor: "",
     randomFeedPageSize: 5,
-    randomFeedLoadMoreObserver: null
+    randomFeedLoadMoreObserver: null,
+
+    // 评论：排序方式（newest/hot）和当前回复的评论
+    commentSort: "newest",
+    replyTarget: null
 };
 
 /* =========================
@@ -232,6 +239,70 @@ function showConfirmDialog(title, message) {
     });
 }
 
+// ---- 访问令牌自动刷新 ----
+// 访问令牌有效期很短，过期后接口返回 401。这里统一拦截 fetch：
+// 带 Authorization 的请求返回 401 时，用刷新令牌换取新的访问令牌后重试一次。
+const API_BASE = "http://localhost:5000/api";
+const rawFetch = window.fetch.bind(window);
+let refreshPromise = null;
+
+// 保存登录/刷新返回的令牌
+function saveTokens(data){
+    localStorage.setItem("cwatchToken", data.token);
+    if (data.refresh_token) {
+        localStorage.setItem("cwatchRefreshToken", data.refresh_token);
+    }
+}
+
+// 用刷新令牌换取新的访问令牌（同一时间只发起一次刷新），返回新的访问令牌，失败返回 null
+function refreshAccessToken(){
+    if (refreshPromise) return refreshPromise;
+    const refreshToken = localStorage.getItem("cwatchRefreshToken");
+    if (!refreshToken) return Promise.resolve(null);
+
+    refreshPromise = (async () => {
+        try {
+            const res = await rawFetch(`${API_BASE}/token/refresh`, {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify({ refresh_token: refreshToken })
+            });
+            // 409：其他标签页刚刚刷新过，直接使用它保存的新令牌
+            if (res.status === 409) {
+                return localStorage.getItem("cwatchRefreshToken") !== refreshToken
+                    ? localStorage.getItem("cwatchToken")
+                    : null;
+            }
+            if (!res.ok) return null;
+            const data = await res.json();
+            saveTokens(data);
+            return data.token;
+        } catch (err) {
+            console.log("刷新令牌失败:", err);
+            return null;
+        } finally {
+            refreshPromise = null;
+        }
+    })();
+    return refreshPromise;
+}
+
+window.fetch = async (input, init = {}) => {
+    const res = await rawFetch(input, init);
+    const url = typeof input === "string" ? input : input.url;
+    const auth = init.headers && init.headers["Authorization"];
+    if (res.status !== 401 || !auth || !url.startsWith(API_BASE) || url.endsWith("/logout")) {
+        return res;
+    }
+
+    const token = await refreshAccessToken();
+    if (!token) return res;
+    return rawFetch(input, {
+        ...init,
+        headers: { ...init.headers, "Authorization": `Bearer ${token}` }
+    });
+};
+
 /* =========================
    4) Icons
 ========================= */
@@ -367,7 +438,7 @@ function openPlayerAt(index){
 ========================= */
 
 // 从服务器获取视频列表
-async function fetchVideoList(page = 1, append = false) {
+async function fetchVideoList(append = false) {
     if (state.isLoadingVideos) return;
     
     state.isLoadingVideos = true;
@@ -380,7 +451,8 @@ async function fetchVideoList(page = 1, append = false) {
             headers["Authorization"] = `Bearer ${token}`;
         }
         
-        const res = await fetch(`http://localhost:5000/api/videos?page=${page}&page_size=${state.videoPageSize}`, {
+        const cursor = append ? state.videoCursor : "";
+        const res = await fetch(`http://localhost:5000/api/videos?cursor=${encodeURIComponent(cursor)}&page_size=${state.videoPageSize}`, {
             headers: headers
         });
         
@@ -401,9 +473,12 @@ async function fetchVideoList(page = 1, append = false) {
                 src: v.url,
                 url_720p: v.url_720p,      // 720p视频URL
                 url_1080p: v.url_1080p,    // 1080p视频URL
+                hls_url: v.hls_url,          // HLS 主播放列表URL（自适应码率）
+                qualities: v.qualities || [],  // HLS 中实际可用的清晰度
                 title: v.title || "未命名视频",
                 author: `@${v.username || "用户"}`,
                 likes: v.likes || 0,
+                views: v.views || 0,
                 comments: v.comments || 0,
                 shares: 0,
                 thumbText: "▶",
@@ -422,9 +497,8 @@ async function fetchVideoList(page = 1, append = false) {
             state.videoList = serverVideos;
         }
         
-        state.videoPage = page;
-        state.videoTotal = data.total || 0;
-        state.hasMoreVideos = state.videoList.length < state.videoTotal;
+        state.videoCursor = data.next_cursor || "";
+        state.hasMoreVideos = !!data.next_cursor;
         
         // 更新全局数据源（只使用服务器数据）
         DATA.videos = state.videoList;
@@ -489,7 +563,7 @@ function saveLikedVideoToStorage(videoId, isLiked) {
 // 加载更多视频
 async function loadMoreVideos() {
     if (!state.hasMoreVideos || state.isLoadingVideos) return;
-    await fetchVideoList(state.videoPage + 1, true);
+    await fetchVideoList(true);
 }
 
 // 渲染预览页的视频缩略图网格
@@ -560,7 +634,7 @@ function createPreviewCard(videoData, index) {
       <div class="preview-card__meta">
         <div class="preview-card__title">${escapeHtml(videoData.title)}</div>
         <div class="preview-card__info">
-          <div class="preview-card__author">${escapeHtml(videoData.author)} · ${formatCount(videoData.likes)} 赞</div>
+          <div class="preview-card__author">${escapeHtml(videoData.author)} · ${formatCount(videoData.likes)} 赞 · ${formatCount(videoData.views || 0)} 播放</div>
           ${formattedDate ? `<div class="preview-card__date">${escapeHtml(formattedDate)}</div>` : ''}
         </div>
       </div>
@@ -603,9 +677,12 @@ function mapServerVideoToFront(v) {
         src: v.url,
         url_720p: v.url_720p,
         url_1080p: v.url_1080p,
+        hls_url: v.hls_url,          // HLS 主播放列表URL（自适应码率）
+        qualities: v.qualities || [],  // HLS 中实际可用的清晰度
         title: v.title || "未命名视频",
         author: `@${v.username || "用户"}`,
         likes: v.likes || 0,
+        views: v.views || 0,
         comments: v.comments || 0,
         shares: 0,
         thumbText: "▶",
@@ -661,7 +738,7 @@ async function loadRandomFeedBatch(init) {
 
     state.randomFeedLoading = true;
     try {
-        const body = init ? { init: true } : { init: false, page: state.randomFeedNextPage };
+        const body = init ? { init: true } : { init: false, cursor: state.randomFeedNextCursor };
 
         const res = await fetch("http://localhost:5000/api/random-feed/next", {
             method: "POST",
@@ -683,7 +760,7 @@ async function loadRandomFeedBatch(init) {
         console.log("[RandomFeed] response", {
             init: !!init,
             videos: serverVideos.length,
-            next_page: data.next_page,
+            next_cursor: data.next_cursor,
             has_more: data.has_more,
             first_id: serverVideos[0] ? serverVideos[0].serverId : null,
         });
@@ -692,7 +769,7 @@ async function loadRandomFeedBatch(init) {
             toast("随机 Feed 暂无可用视频（可能是已看过过多）");
         }
 
-        state.randomFeedNextPage = data.next_page || 1;
+        state.randomFeedNextCursor = data.next_cursor || "";
         state.randomFeedHasMore = !!data.has_more;
 
         if (init) {
@@ -718,7 +795,7 @@ async function startRandomFeedModule() {
     // 重置 feed 与随机 feed 状态
     state.randomFeedLoading = false;
     state.randomFeedHasMore = true;
-    state.randomFeedNextPage = 1;
+    state.randomFeedNextCursor = "";
     state.randomFeedPageSize = 3;
 
     state.currentIndex = -1;
@@ -841,6 +918,9 @@ function createFeedItem(videoData, index){
     const cardEl = $(".video-card", item);
     const videoEl = $(".video-media", item);
 
+    // 有 HLS 播放列表时优先使用自适应码率播放
+    attachHls(videoEl, videoData);
+
     // 点击视频区域：播放/暂停（不影响进度条/按钮）
     cardEl.addEventListener("click", (e) => {
         if (e.target.closest(".video-actions")) return;
@@ -901,6 +981,7 @@ function createFeedItem(videoData, index){
     });
 
     setupProgress(item, videoEl);
+    setupWatchTracking(videoEl, videoData);
     setupGestures(item, cardEl, videoData);
     
     // 初始化声音按钮图标状态和视频静音状态
@@ -937,10 +1018,13 @@ function createFeedItem(videoData, index){
         });
     }
     
-    // 根据视频数据设置可用的清晰度选项
+    // 根据视频数据设置可用的清晰度选项（HLS 视频按服务端返回的 qualities 判断）
     if (qualityMenu) {
+        const has1080p = videoData.hls_url ? videoData.qualities.includes('1080p') : !!videoData.url_1080p;
+        const has720p = videoData.hls_url ? videoData.qualities.includes('720p') : !!videoData.url_720p;
+
         // 如果没有1080p，禁用该选项
-        if (!videoData.url_1080p) {
+        if (!has1080p) {
             const item1080p = $('[data-quality="1080p"]', qualityMenu);
             if (item1080p) {
                 item1080p.classList.add('video-quality-menu__item--disabled');
@@ -950,7 +1034,7 @@ function createFeedItem(videoData, index){
         }
         
         // 如果没有720p，禁用该选项
-        if (!videoData.url_720p) {
+        if (!has720p) {
             const item720p = $('[data-quality="720p"]', qualityMenu);
             if (item720p) {
                 item720p.classList.add('video-quality-menu__item--disabled');
@@ -1252,6 +1336,76 @@ function likeWithAnimation(feedItemEl, videoData, showAnimation = true){
 /* =========================
    10) Progress + Seek
 ========================= */
+
+// ---- 播放统计：上报观看事件（开始播放、进度心跳、播放到结尾） ----
+// 后端按用户（未登录按会话）去重计算播放量和完播率
+const WATCH_HEARTBEAT_MS = 15000;
+
+// 播放器会话ID（同一标签页内不变，未登录时用于去重）
+function getWatchSessionId(){
+    let sid = sessionStorage.getItem("cwatchWatchSession");
+    if (!sid) {
+        sid = window.crypto && crypto.randomUUID
+            ? crypto.randomUUID()
+            : `${Date.now()}-${Math.random().toString(36).slice(2)}`;
+        sessionStorage.setItem("cwatchWatchSession", sid);
+    }
+    return sid;
+}
+
+function reportWatchEvent(videoData, event, position){
+    if (!videoData || !videoData.serverId) return;
+    const headers = { "Content-Type": "application/json" };
+    const token = localStorage.getItem("cwatchToken");
+    if (token) {
+        headers["Authorization"] = `Bearer ${token}`;
+    }
+    fetch(`${API_BASE}/video/${videoData.serverId}/watch`, {
+        method: "POST",
+        headers: headers,
+        body: JSON.stringify({
+            event: event,
+            session_id: getWatchSessionId(),
+            position: Math.max(0, position || 0),
+        }),
+        keepalive: true, // 切换页面时也尽量发出
+    }).catch(() => {});
+}
+
+function setupWatchTracking(videoEl, videoData){
+    let started = false;
+    let completed = false;
+    let lastBeat = 0;
+
+    videoEl.addEventListener("playing", () => {
+        if (started) return;
+        started = true;
+        lastBeat = Date.now();
+        reportWatchEvent(videoData, "start", videoEl.currentTime);
+    });
+
+    videoEl.addEventListener("timeupdate", () => {
+        if (!started) return;
+        const dur = videoEl.duration || 0;
+        // 视频循环播放，不会触发 ended，接近结尾时上报看完
+        if (!completed && dur && videoEl.currentTime >= dur - 0.5) {
+            completed = true;
+            reportWatchEvent(videoData, "complete", dur);
+            return;
+        }
+        if (Date.now() - lastBeat >= WATCH_HEARTBEAT_MS) {
+            lastBeat = Date.now();
+            reportWatchEvent(videoData, "progress", videoEl.currentTime);
+        }
+    });
+
+    videoEl.addEventListener("pause", () => {
+        if (started && !completed) {
+            lastBeat = Date.now();
+            reportWatchEvent(videoData, "progress", videoEl.currentTime);
+        }
+    });
+}
 function setupProgress(feedItemEl, videoEl){
     const bar = $("[data-progress-bar]", feedItemEl);
     const fill = $("[data-progress-fill]", feedItemEl);
@@ -1353,10 +1507,54 @@ function toggleQualityMenu(feedItemEl) {
     }
 }
 
+// 使用 HLS 播放视频
+// Safari 原生支持 HLS；其他浏览器通过 hls.js（MSE）播放
+function attachHls(videoEl, videoData) {
+    if (!videoData.hls_url) return;
+
+    if (window.Hls && Hls.isSupported()) {
+        const hls = new Hls();
+        hls.loadSource(videoData.hls_url);
+        hls.attachMedia(videoEl);
+        videoEl._hls = hls;
+    } else if (videoEl.canPlayType("application/vnd.apple.mpegurl")) {
+        videoEl.src = videoData.hls_url;
+    }
+}
+
 // 切换视频清晰度
 function switchVideoQuality(feedItemEl, quality, videoData) {
     const videoEl = $('.video-media', feedItemEl);
     if (!videoEl) return;
+
+    // HLS 播放：直接切换码率档位（-1 为自动），不需要更换视频源
+    const hls = videoEl._hls;
+    if (hls && quality !== 'original') {
+        let level = -1;
+        if (quality !== 'auto') {
+            const height = parseInt(quality, 10);
+            level = hls.levels.findIndex(l => l.height === height);
+            if (level < 0) {
+                toast(`${quality} 清晰度暂未生成`);
+                return;
+            }
+        }
+        hls.currentLevel = level;
+
+        const label = quality === 'auto' ? '自动' : quality;
+        const qualityLabelEl = $('[data-quality-label]', feedItemEl);
+        if (qualityLabelEl) {
+            qualityLabelEl.textContent = label;
+        }
+        const menu = $('[data-quality-menu]', feedItemEl);
+        if (menu) {
+            $all('.video-quality-menu__item', menu).forEach(item => {
+                item.classList.toggle('video-quality-menu__item--active', item.dataset.quality === quality);
+            });
+        }
+        toast(`已切换到 ${label}`);
+        return;
+    }
     
     // 保存当前播放状态
     const currentTime = videoEl.currentTime;
@@ -1403,6 +1601,12 @@ function switchVideoQuality(feedItemEl, quality, videoData) {
         return;
     }
     
+    // 从 HLS 切换到原画：先停止 hls.js，再直接播放原视频
+    if (hls) {
+        hls.destroy();
+        videoEl._hls = null;
+    }
+
     // 切换视频源
     videoEl.src = newSrc;
     videoEl.currentTime = currentTime;
@@ -1528,13 +1732,38 @@ $all("[data-sheet-close]").forEach(btn => btn.addEventListener("click", closeShe
 
 function openCommentSheet(videoData){
     state.currentVideoData = videoData;
+    clearReplyTarget();
     // 从后端获取评论列表
     fetchComments(videoData);
     openSheet("comment");
 }
 
-// 从后端获取评论列表
-async function fetchComments(videoData) {
+// 评论请求头（登录后带上 token，后端会返回 is_liked）
+function commentAuthHeaders(){
+    const token = localStorage.getItem("cwatchToken");
+    return token ? { "Authorization": `Bearer ${token}` } : {};
+}
+
+// 转换后端评论格式为前端格式
+function mapCommentItem(c){
+    return {
+        id: c.id,
+        name: c.username,
+        text: c.content,
+        time: c.created_at,
+        user_id: c.user_id,
+        avatar_url: c.avatar_url,
+        root_id: c.root_id || 0,
+        reply_to: c.reply_to_username || "",
+        reply_count: c.reply_count || 0,
+        likes: c.likes || 0,
+        is_liked: !!c.is_liked
+    };
+}
+
+// 从后端获取评论列表（一级评论，回复点击后再加载）
+// append 为 true 时加载下一页（使用上一页返回的 next_cursor）
+async function fetchComments(videoData, append = false) {
     // 获取视频ID
     let videoId;
     if (videoData.serverId) {
@@ -1547,23 +1776,19 @@ async function fetchComments(videoData) {
     }
     
     try {
-        const res = await fetch(`http://localhost:5000/api/video/${videoId}/comments`);
+        const cursor = append ? (videoData.commentCursor || "") : "";
+        const res = await fetch(`http://localhost:5000/api/video/${videoId}/comments?sort=${state.commentSort}&cursor=${encodeURIComponent(cursor)}`, {
+            headers: commentAuthHeaders()
+        });
         
         if (!res.ok) {
             throw new Error("获取评论失败");
         }
         
         const data = await res.json();
-        
-        // 转换后端评论格式为前端格式
-        videoData.commentItems = (data.comments || []).map(c => ({
-            id: c.id,
-            name: c.username,
-            text: c.content,
-            time: c.created_at,
-            user_id: c.user_id,
-            avatar_url: c.avatar_url
-        }));
+        const items = (data.comments || []).map(mapCommentItem);
+        videoData.commentItems = append ? [...(videoData.commentItems || []), ...items] : items;
+        videoData.commentCursor = data.next_cursor || "";
         
         // 渲染评论列表
         renderComments(videoData);
@@ -1577,6 +1802,53 @@ async function fetchComments(videoData) {
     }
 }
 
+// 创建单条评论节点（一级评论和回复共用）
+function createCommentNode(c, videoData){
+    const node = document.createElement("div");
+    node.className = c.root_id ? "comment comment--reply" : "comment";
+    node.dataset.commentId = c.id;
+    
+    // 头像显示：如果有头像URL则显示图片，否则显示首字母
+    let avatarContent;
+    if (c.avatar_url && c.avatar_url.trim() !== '') {
+        avatarContent = `<img src="${escapeHtml(c.avatar_url)}" alt="头像" style="width: 100%; height: 100%; object-fit: cover; border-radius: 50%;">`;
+    } else {
+        avatarContent = escapeHtml((c.name || "U").slice(0,1).toUpperCase());
+    }
+    
+    // 判断是否是当前用户的评论
+    const isOwnComment = state.currentUser && c.user_id === state.currentUser.id;
+    const deleteButton = isOwnComment ? `<span class="comment__delete">删除</span>` : '';
+    const replyTo = c.reply_to ? `<span class="comment__reply-to">回复 @${escapeHtml(c.reply_to)}：</span>` : '';
+    const moreReplies = !c.root_id && c.reply_count > 0
+        ? `<button class="comment__more">展开 ${c.reply_count} 条回复</button>`
+        : '';
+    
+    node.innerHTML = `
+      <div class="comment__avatar">${avatarContent}</div>
+      <div class="comment__content">
+        <div class="comment__name">${escapeHtml(c.name)}</div>
+        <div class="comment__text">${replyTo}${escapeHtml(c.text)}</div>
+        <div class="comment__meta">
+          <span>${escapeHtml(c.time)}</span>
+          <span class="comment__reply">回复</span>
+          <span class="comment__like ${c.is_liked ? "is-liked" : ""}">♥ <em>${formatCount(c.likes)}</em></span>
+          ${deleteButton}
+        </div>
+        <div class="comment__replies"></div>
+        ${moreReplies}
+      </div>
+    `;
+    
+    $(".comment__reply", node).addEventListener("click", () => setReplyTarget(c));
+    $(".comment__like", node).addEventListener("click", (e) => toggleCommentLike(c, e.currentTarget));
+    const del = $(".comment__delete", node);
+    if (del) del.addEventListener("click", () => deleteComment(c.id, videoData));
+    const more = $(".comment__more", node);
+    if (more) more.addEventListener("click", () => loadReplies(c, node, videoData));
+    return node;
+}
+
 function renderComments(videoData){
     el.commentList.innerHTML = "";
     const items = (videoData.commentItems || []).slice();
@@ -1591,46 +1863,97 @@ function renderComments(videoData){
         return;
     }
 
-    items.forEach(c => {
-        const node = document.createElement("div");
-        node.className = "comment";
-        node.dataset.commentId = c.id;
+    items.forEach(c => el.commentList.appendChild(createCommentNode(c, videoData)));
+
+    // 还有下一页时显示“加载更多”
+    if (videoData.commentCursor) {
+        const more = document.createElement("button");
+        more.className = "comment__more comment-list__more";
+        more.textContent = "加载更多评论";
+        more.addEventListener("click", () => fetchComments(videoData, true));
+        el.commentList.appendChild(more);
+    }
+}
+
+// 加载一级评论下的回复（每次加载一页，直到加载完）
+async function loadReplies(comment, node, videoData){
+    const container = $(".comment__replies", node);
+    const more = $(".comment__more", node);
+    const cursor = comment.replyCursor || "";
+    
+    try {
+        const res = await fetch(`http://localhost:5000/api/comment/${comment.id}/replies?cursor=${encodeURIComponent(cursor)}&page_size=10`, {
+            headers: commentAuthHeaders()
+        });
+        if (!res.ok) throw new Error("获取回复失败");
+        const data = await res.json();
+        (data.replies || []).map(mapCommentItem).forEach(r => {
+            container.appendChild(createCommentNode(r, videoData));
+        });
         
-        // 头像显示：如果有头像URL则显示图片，否则显示首字母
-        let avatarContent;
-        if (c.avatar_url && c.avatar_url.trim() !== '') {
-            avatarContent = `<img src="${escapeHtml(c.avatar_url)}" alt="头像" style="width: 100%; height: 100%; object-fit: cover; border-radius: 50%;">`;
+        comment.replyCursor = data.next_cursor || "";
+        const remaining = comment.reply_count - container.children.length;
+        if (comment.replyCursor && remaining > 0) {
+            more.textContent = `展开更多回复（${remaining}）`;
         } else {
-            avatarContent = escapeHtml((c.name || "U").slice(0,1).toUpperCase());
+            more.remove();
         }
-        
-        // 判断是否是当前用户的评论
-        const isOwnComment = state.currentUser && c.user_id === state.currentUser.id;
-        const deleteButton = isOwnComment ? `<span class="comment__delete" data-comment-id="${c.id}">删除</span>` : '';
-        
-        node.innerHTML = `
-      <div class="comment__avatar">${avatarContent}</div>
-      <div class="comment__content">
-        <div class="comment__name">${escapeHtml(c.name)}</div>
-        <div class="comment__text">${escapeHtml(c.text)}</div>
-        <div class="comment__meta">
-          <span>${escapeHtml(c.time)}</span>
-          ${deleteButton}
-        </div>
-      </div>
-    `;
-        el.commentList.appendChild(node);
-    });
+    } catch (err) {
+        console.error("获取回复失败:", err);
+        toast("获取回复失败");
+    }
+}
+
+// 设置回复对象（发送时带上 parent_id）
+function setReplyTarget(comment){
+    state.replyTarget = { id: comment.id, name: comment.name };
+    el.commentInput.placeholder = `回复 @${comment.name}…`;
+    el.commentInput.focus();
+}
+
+function clearReplyTarget(){
+    state.replyTarget = null;
+    el.commentInput.placeholder = "说点什么…";
+}
+
+// 切换评论点赞状态
+async function toggleCommentLike(comment, likeEl){
+    const token = localStorage.getItem("cwatchToken");
+    if (!token) {
+        toast("请先登录");
+        closeSheets();
+        showAuthPage();
+        return;
+    }
     
-    // 绑定删除按钮事件
-    $all('.comment__delete', el.commentList).forEach(btn => {
-        btn.addEventListener('click', async (e) => {
-            const commentId = parseInt(e.target.dataset.commentId);
-            await deleteComment(commentId, videoData);
+    try {
+        const res = await fetch(`http://localhost:5000/api/comment/${comment.id}/toggle-like`, {
+            method: "POST",
+            headers: { "Authorization": `Bearer ${token}` }
         });
-    });
+        const data = await res.json();
+        if (!res.ok) throw new Error(data.error || "操作失败");
+        
+        comment.is_liked = data.is_liked;
+        comment.likes = data.like_count;
+        likeEl.classList.toggle("is-liked", data.is_liked);
+        $("em", likeEl).textContent = formatCount(data.like_count);
+    } catch (err) {
+        console.error("评论点赞失败:", err);
+        toast(err.message || "操作失败");
+    }
 }
 
+// 切换评论排序（最新 / 最热）
+$all("[data-sort]", el.commentSort).forEach(btn => {
+    btn.addEventListener("click", () => {
+        if (state.commentSort === btn.dataset.sort) return;
+        state.commentSort = btn.dataset.sort;
+        $all("[data-sort]", el.commentSort).forEach(b => b.classList.toggle("is-active", b === btn));
+        if (state.currentVideoData) fetchComments(state.currentVideoData);
+    });
+});
+
 // 发送评论
 el.commentSend.addEventListener("click", async () => {
     const text = el.commentInput.value.trim();
@@ -1663,7 +1986,8 @@ el.commentSend.addEventListener("click", async () => {
                 "Authorization": `Bearer ${token}`
             },
             body: JSON.stringify({
-                content: text
+                content: text,
+                parent_id: state.replyTarget ? state.replyTarget.id : 0
             })
         });
         
@@ -1676,6 +2000,7 @@ el.commentSend.addEventListener("click", async () => {
         
         // 清空输入框
         el.commentInput.value = "";
+        clearReplyTarget();
         
         // 重新获取评论列表
         await fetchComments(state.currentVideoData);
@@ -1719,13 +2044,14 @@ async function deleteComment(commentId, videoData) {
             throw new Error(data.error || "删除失败");
         }
         
+        const result = await res.json();
         toast("删除成功");
         
         // 重新获取评论列表
         await fetchComments(videoData);
         
-        // 更新评论数（减1）
-        videoData.comments = Math.max(0, (videoData.comments || 0) - 1);
+        // 更新评论数（删除一级评论时其下的回复也会被删除）
+        videoData.comments = result.comment_count;
         updateVideoCommentCount(videoData.id, videoData.comments);
         
     } catch (err) {
@@ -1813,7 +2139,7 @@ function bindGlobalEvents(){
     // Sidebar 点击事件
     el.navExplore?.addEventListener("click", async () => {
         // 重新加载所有视频
-        await fetchVideoList(1, false);
+        await fetchVideoList(false);
         showPage("preview");
         setNavActive(el.navExplore);
         
@@ -1849,7 +2175,7 @@ function bindGlobalEvents(){
         
         try {
             const token = localStorage.getItem("cwatchToken");
-            const res = await fetch(`http://localhost:5000/api/user/${userId}/videos?page=1&page_size=100`, {
+            const res = await fetch(`http://localhost:5000/api/user/${userId}/videos?page_size=50`, {
                 headers: {
                     "Authorization": `Bearer ${token}`
                 }
@@ -1868,9 +2194,12 @@ function bindGlobalEvents(){
                 src: v.url,
                 url_720p: v.url_720p,
                 url_1080p: v.url_1080p,
+                hls_url: v.hls_url,          // HLS 主播放列表URL（自适应码率）
+                qualities: v.qualities || [],  // HLS 中实际可用的清晰度
                 title: v.title || "未命名视频",
                 author: `@${v.username || "用户"}`,
                 likes: v.likes || 0,
+                views: v.views || 0,
                 comments: v.comments || 0,
                 shares: 0,
                 thumbText: "▶",
@@ -1946,10 +2275,9 @@ function bindGlobalEvents(){
                     headers["Authorization"] = `Bearer ${token}`;
                 }
                 
-                const res = await fetch("http://localhost:5000/api/videos/hot", {
-                    method: "POST",
-                    headers: headers,
-                    body: JSON.stringify({ limit: 50 })
+                const res = await fetch("http://localhost:5000/api/videos/hot?window=24h&limit=50", {
+                    method: "GET",
+                    headers: headers
                 });
                 
                 if (!res.ok) {
@@ -1965,9 +2293,12 @@ function bindGlobalEvents(){
                     src: v.url,
                     url_720p: v.url_720p,
                     url_1080p: v.url_1080p,
+                    hls_url: v.hls_url,          // HLS 主播放列表URL（自适应码率）
+                    qualities: v.qualities || [],  // HLS 中实际可用的清晰度
                     title: v.title || "未命名视频",
                     author: `@${v.username || "用户"}`,
                     likes: v.likes || 0,
+                    views: v.views || 0,
                     comments: v.comments || 0,
                     shares: 0,
                     thumbText: "▶",
@@ -1991,7 +2322,7 @@ function bindGlobalEvents(){
                 const pageTitle = document.querySelector('.page__title');
                 const pageSubtitle = document.querySelector('.page__subtitle');
                 if (pageTitle) pageTitle.textContent = "🔥 热门视频";
-                if (pageSubtitle) pageSubtitle.textContent = `按点赞数排序 · 共 ${hotVideos.length} 个视频`;
+                if (pageSubtitle) pageSubtitle.textContent = `24 小时热度排序 · 共 ${hotVideos.length} 个视频`;
                 
                 // 隐藏管理按钮（如果存在）
                 const pageActions = document.getElementById("pageActions");
@@ -2077,7 +2408,7 @@ async function init(){
 async function initAppWithVideo(videoId) {
     // 先加载视频列表
     if (!state.previewRendered) {
-        await fetchVideoList(1, false);
+        await fetchVideoList(false);
         state.previewRendered = true;
         setupScrollLoadMore();
     }
@@ -2180,6 +2511,7 @@ async function checkLoginStatus(){
         // 验证失败，清除本地存储
         console.log("登录状态验证失败:", err.message);
         localStorage.removeItem("cwatchToken");
+        localStorage.removeItem("cwatchRefreshToken");
         localStorage.removeItem("cwatchUser");
         state.isLoggedIn = false;
         state.currentUser = null;
@@ -2213,7 +2545,7 @@ async function initApp(){
     // 只在第一次初始化时加载视频和绑定事件
     if (!state.previewRendered) {
         // 从服务器获取视频列表
-        await fetchVideoList(1, false);
+        await fetchVideoList(false);
         state.previewRendered = true;
         
         // 绑定滚动加载更多
@@ -2364,8 +2696,8 @@ el.loginForm.addEventListener("submit", async (e) => {
             throw new Error(data.error || "登录失败");
         }
         
-        // 登录成功，保存 token
-        localStorage.setItem("cwatchToken", data.token);
+        // 登录成功，保存访问令牌和刷新令牌
+        saveTokens(data);
         
         // 调用获取用户信息接口，获取完整的用户信息（包括头像）
         try {
@@ -2521,6 +2853,8 @@ function showUserInfoModal() {
     const username = document.getElementById('userInfoUsername');
     const userId = document.getElementById('userInfoId');
     const createdAt = document.getElementById('userInfoCreatedAt');
+    const following = document.getElementById('userInfoFollowing');
+    const followers = document.getElementById('userInfoFollowers');
     
     // 设置头像
     avatar.innerHTML = '';
@@ -2537,6 +2871,8 @@ function showUserInfoModal() {
     // 设置用户信息
     username.textContent = state.currentUser.username || '-';
     userId.textContent = state.currentUser.id || '-';
+    following.textContent = formatCount(state.currentUser.following_count);
+    followers.textContent = formatCount(state.currentUser.follower_count);
     
     // 格式化注册时间
     if (state.currentUser.created_at) {
@@ -2613,11 +2949,12 @@ el.dropdownLogout.addEventListener("click", async () => {
     state.isLoggedIn = false;
     state.currentUser = null;
     localStorage.removeItem("cwatchToken");
+    localStorage.removeItem("cwatchRefreshToken");
     localStorage.removeItem("cwatchUser");
     
     // 重置视频列表和状态
     state.videoList = [];
-    state.videoPage = 1;
+    state.videoCursor = "";
     state.hasMoreVideos = true;
     state.previewRendered = false;
     DATA.videos = [];
@@ -2695,17 +3032,32 @@ function closeUploadModal() {
 
 // 重置上传状态
 function resetUploadState() {
+    abandonMultipartUpload();
     state.uploadFile = null;
     state.isUploading = false;
     el.uploadDropzone.hidden = false;
     el.uploadFileInfo.hidden = true;
     el.uploadProgress.hidden = true;
     el.uploadTitle.value = "";
+    el.uploadDescription.value = "";
+    el.uploadVisibility.value = "public";
     el.uploadSubmit.disabled = true;
     el.uploadProgressFill.style.width = "0%";
     el.uploadVideoPreview.src = "";
 }
 
+// 放弃未完成的分片上传（删除已上传的分片和视频记录）
+function abandonMultipartUpload() {
+    const videoId = state.multipartVideoId;
+    state.multipartVideoId = null;
+    const token = localStorage.getItem("cwatchToken");
+    if (!videoId || !token) return;
+    fetch(`http://localhost:5000/api/video/multipart/${videoId}`, {
+        method: "DELETE",
+        headers: { "Authorization": `Bearer ${token}` }
+    }).catch(() => {});
+}
+
 // 格式化文件大小
 function formatFileSize(bytes) {
     if (bytes < 1024) return bytes + " B";
@@ -2723,12 +3075,13 @@ function handleFileSelect(file) {
         return;
     }
     
-    // 验证文件大小（500MB）
-    if (file.size > 500 * 1024 * 1024) {
-        toast("文件大小超过限制（最大500MB）");
+    // 验证文件大小（超过 64MB 使用分片上传，最大 4GB）
+    if (file.size > MULTIPART_MAX_SIZE) {
+        toast("文件大小超过限制（最大4GB）");
         return;
     }
     
+    abandonMultipartUpload();
     state.uploadFile = file;
     
     // 显示文件信息
@@ -2750,6 +3103,10 @@ function handleFileSelect(file) {
     el.uploadSubmit.disabled = false;
 }
 
+// 超过该大小的文件使用分片上传（与后端 upload.max_size_mb 保持一致）
+const MULTIPART_THRESHOLD = 64 * 1024 * 1024;
+const MULTIPART_MAX_SIZE = 4096 * 1024 * 1024;
+
 // 上传视频
 async function uploadVideo() {
     if (!state.uploadFile || state.isUploading) return;
@@ -2768,70 +3125,10 @@ async function uploadVideo() {
     el.uploadProgressText.textContent = "正在获取上传凭证...";
     
     try {
-        // 1. 获取上传URL
-        const urlRes = await fetch("http://localhost:5000/api/video/upload-url", {
-            method: "POST",
-            headers: {
-                "Content-Type": "application/json",
-                "Authorization": `Bearer ${token}`
-            },
-            body: JSON.stringify({
-                filename: state.uploadFile.name,
-                filesize: state.uploadFile.size,
-                title: el.uploadTitle.value || state.uploadFile.name
-            })
-        });
-        
-        if (!urlRes.ok) {
-            const data = await urlRes.json();
-            throw new Error(data.error || "获取上传凭证失败");
-        }
-        
-        const { upload_url, video_id } = await urlRes.json();
-        
-        // 2. 上传文件到 MinIO
-        el.uploadProgressText.textContent = "正在上传视频...";
-        
-        const xhr = new XMLHttpRequest();
-        
-        // 监听上传进度
-        xhr.upload.addEventListener("progress", (e) => {
-            if (e.lengthComputable) {
-                const percent = Math.round((e.loaded / e.total) * 100);
-                el.uploadProgressFill.style.width = percent + "%";
-                el.uploadProgressText.textContent = `正在上传... ${percent}%`;
-            }
-        });
-        
-        // 上传完成
-        await new Promise((resolve, reject) => {
-            xhr.onload = () => {
-                if (xhr.status >= 200 && xhr.status < 300) {
-                    resolve();
-                } else {
-                    reject(new Error("上传失败"));
-                }
-            };
-            xhr.onerror = () => reject(new Error("网络错误"));
-            xhr.open("PUT", upload_url);
-            xhr.send(state.uploadFile);
-        });
-        
-        // 3. 通知后端上传完成
-        el.uploadProgressText.textContent = "正在确认上传...";
-        
-        const confirmRes = await fetch("http://localhost:5000/api/video/upload-complete", {
-            method: "POST",
-            headers: {
-                "Content-Type": "application/json",
-                "Authorization": `Bearer ${token}`
-            },
-            body: JSON.stringify({ video_id })
-        });
-        
-        if (!confirmRes.ok) {
-            const data = await confirmRes.json();
-            throw new Error(data.error || "确认上传失败");
+        if (state.uploadFile.size > MULTIPART_THRESHOLD) {
+            await uploadMultipart(token);
+        } else {
+            await uploadSingle(token);
         }
         
         // 上传成功
@@ -2847,20 +3144,202 @@ async function uploadVideo() {
             closeUploadModal();
             // 重新加载视频列表
             state.previewRendered = false;
-            state.videoPage = 1;
+            state.videoCursor = "";
             state.hasMoreVideos = true;
-            await fetchVideoList(1, false);
+            await fetchVideoList(false);
             state.previewRendered = true;
         }, 1500);
         
     } catch (err) {
         toast(err.message || "上传失败");
         el.uploadProgressText.textContent = "上传失败：" + err.message;
+        if (state.multipartVideoId) {
+            el.uploadProgressText.textContent += "（再次点击上传可继续）";
+        }
         state.isUploading = false;
         el.uploadSubmit.disabled = false;
     }
 }
 
+// 单次上传：一个预签名URL上传整个文件
+async function uploadSingle(token) {
+    // 1. 获取上传URL
+    const urlRes = await fetch("http://localhost:5000/api/video/upload-url", {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/json",
+            "Authorization": `Bearer ${token}`
+        },
+        body: JSON.stringify({
+            filename: state.uploadFile.name,
+            filesize: state.uploadFile.size,
+            title: el.uploadTitle.value || state.uploadFile.name,
+            description: el.uploadDescription.value,
+            visibility: el.uploadVisibility.value
+        })
+    });
+    
+    if (!urlRes.ok) {
+        const data = await urlRes.json();
+        throw new Error(data.error || "获取上传凭证失败");
+    }
+    
+    const { upload_url, upload_headers, video_id } = await urlRes.json();
+    
+    // 2. 上传文件到 MinIO
+    el.uploadProgressText.textContent = "正在上传视频...";
+    
+    const xhr = new XMLHttpRequest();
+    
+    // 监听上传进度
+    xhr.upload.addEventListener("progress", (e) => {
+        if (e.lengthComputable) {
+            const percent = Math.round((e.loaded / e.total) * 100);
+            el.uploadProgressFill.style.width = percent + "%";
+            el.uploadProgressText.textContent = `正在上传... ${percent}%`;
+        }
+    });
+    
+    // 上传完成
+    await new Promise((resolve, reject) => {
+        xhr.onload = () => {
+            if (xhr.status >= 200 && xhr.status < 300) {
+                resolve();
+            } else {
+                reject(new Error("上传失败"));
+            }
+        };
+        xhr.onerror = () => reject(new Error("网络错误"));
+        xhr.open("PUT", upload_url);
+        // Content-Type 参与了签名，必须与后端返回的一致（不能使用浏览器按文件推断的类型）
+        for (const [name, value] of Object.entries(upload_headers || {})) {
+            xhr.setRequestHeader(name, value);
+        }
+        xhr.send(state.uploadFile);
+    });
+    
+    // 3. 通知后端上传完成
+    el.uploadProgressText.textContent = "正在确认上传...";
+    
+    const confirmRes = await fetch("http://localhost:5000/api/video/upload-complete", {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/json",
+            "Authorization": `Bearer ${token}`
+        },
+        body: JSON.stringify({ video_id })
+    });
+    
+    if (!confirmRes.ok) {
+        const data = await confirmRes.json();
+        throw new Error(data.error || "确认上传失败");
+    }
+}
+
+// 分片上传：文件按 part_size 切片逐个上传，中断后查询已完成的分片继续上传
+async function uploadMultipart(token) {
+    const file = state.uploadFile;
+    const headers = {
+        "Content-Type": "application/json",
+        "Authorization": `Bearer ${token}`
+    };
+    
+    // 1. 上次上传中断时查询进度继续上传，否则发起新的分片上传
+    let session = null;
+    if (state.multipartVideoId) {
+        el.uploadProgressText.textContent = "正在恢复上传...";
+        const res = await fetch(`http://localhost:5000/api/video/multipart/${state.multipartVideoId}`, { headers });
+        if (res.ok) {
+            session = await res.json();
+        } else {
+            state.multipartVideoId = null;
+        }
+    }
+    if (!session) {
+        const res = await fetch("http://localhost:5000/api/video/multipart", {
+            method: "POST",
+            headers,
+            body: JSON.stringify({
+                filename: file.name,
+                filesize: file.size,
+                title: el.uploadTitle.value || file.name,
+                description: el.uploadDescription.value,
+                visibility: el.uploadVisibility.value
+            })
+        });
+        if (!res.ok) {
+            const data = await res.json();
+            throw new Error(data.error || "获取上传凭证失败");
+        }
+        session = await res.json();
+        state.multipartVideoId = session.video_id;
+    }
+    
+    // 2. 逐个上传未完成的分片（单个分片失败时重试），进度按已上传的字节数计算
+    const partRange = (n) => {
+        const start = (n - 1) * session.part_size;
+        return [start, Math.min(start + session.part_size, file.size)];
+    };
+    let uploadedBytes = session.uploaded_parts.reduce((sum, n) => {
+        const [start, end] = partRange(n);
+        return sum + end - start;
+    }, 0);
+    const showProgress = (bytes) => {
+        const percent = Math.round((bytes / file.size) * 100);
+        el.uploadProgressFill.style.width = percent + "%";
+        el.uploadProgressText.textContent = `正在上传... ${percent}%`;
+    };
+    showProgress(uploadedBytes);
+    
+    for (const part of session.parts) {
+        const [start, end] = partRange(part.part_number);
+        await putPartWithRetry(part.upload_url, file.slice(start, end), (loaded) => showProgress(uploadedBytes + loaded));
+        uploadedBytes += end - start;
+    }
+    
+    // 3. 通知后端合并分片
+    el.uploadProgressText.textContent = "正在合并分片...";
+    const res = await fetch(`http://localhost:5000/api/video/multipart/${session.video_id}/complete`, {
+        method: "POST",
+        headers
+    });
+    if (!res.ok) {
+        const data = await res.json();
+        throw new Error(data.error || "确认上传失败");
+    }
+    state.multipartVideoId = null;
+}
+
+// 上传一个分片，失败时最多重试 3 次（间隔递增）
+async function putPartWithRetry(url, blob, onProgress) {
+    const maxAttempts = 4;
+    for (let attempt = 1; ; attempt++) {
+        try {
+            await new Promise((resolve, reject) => {
+                const xhr = new XMLHttpRequest();
+                xhr.upload.addEventListener("progress", (e) => {
+                    if (e.lengthComputable) onProgress(e.loaded);
+                });
+                xhr.onload = () => {
+                    if (xhr.status >= 200 && xhr.status < 300) {
+                        resolve();
+                    } else {
+                        reject(new Error("分片上传失败"));
+                    }
+                };
+                xhr.onerror = () => reject(new Error("网络错误"));
+                xhr.open("PUT", url);
+                xhr.send(blob);
+            });
+            return;
+        } catch (err) {
+            if (attempt >= maxAttempts) throw err;
+            onProgress(0);
+            await new Promise((resolve) => setTimeout(resolve, attempt * 1000));
+        }
+    }
+}
+
 // 绑定上传相关事件
 el.navUpload.addEventListener("click", () => {
     setNavActive(el.navUpload);
@@ -3143,7 +3622,7 @@ async function batchDeleteVideos() {
         const userId = state.currentUser?.id;
         if (userId) {
             const token = localStorage.getItem("cwatchToken");
-            const res = await fetch(`http://localhost:5000/api/user/${userId}/videos?page=1&page_size=100`, {
+            const res = await fetch(`http://localhost:5000/api/user/${userId}/videos?page_size=50`, {
                 headers: {
                     "Authorization": `Bearer ${token}`
                 }
@@ -3157,9 +3636,12 @@ async function batchDeleteVideos() {
                     src: v.url,
                     url_720p: v.url_720p,
                     url_1080p: v.url_1080p,
+                    hls_url: v.hls_url,          // HLS 主播放列表URL（自适应码率）
+                    qualities: v.qualities || [],  // HLS 中实际可用的清晰度
                     title: v.title || "未命名视频",
                     author: `@${v.username || "用户"}`,
                     likes: v.likes || 0,
+                    views: v.views || 0,
                     comments: v.comments || 0,
                     shares: 0,
                     thumbText: "▶",
@@ -0,0 +1,314 @@
+package main
+
+// 视频删除后的级联清理
+//
+// backend 删除视频时软删除视频记录，并在同一事务中写入清理记录（video_purges）和清理任务（经发件箱投递）。
+// worker 依次清理：
+//   MinIO  原视频及同前缀的派生文件（封面 _cover.jpg、旧版 _720p.mp4/_1080p.mp4）、HLS 目录 hls/<文件名>/、未完成的分片上传
+//   Redis  点赞排行榜和点赞用户集合、评论计数、热度分桶和榜单缓存（同时从话题分桶中扣除该视频的热度）、话题缓存、待落库的播放增量、评论点赞用户集合
+//   MySQL  评论、评论点赞、点赞、话题关联、分片上传会话（视频记录本身保留为软删除状态）
+// 每一步都是幂等的，任一步失败整条任务延迟重试；全部完成后在同一事务中把清理记录标记为已完成，并记录删除的数量。
+
+import (
+	"common/mq"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 清理状态（与 backend/models 保持一致）
+const (
+	PurgeStatusPending   = 0 // 待清理
+	PurgeStatusCompleted = 1 // 已清理
+)
+
+// Redis Key（与 backend/utils 保持一致）
+const (
+	VideoLikeRankKey     = "rank:video:like"    // 视频点赞排行榜 ZSET
+	VideoLikeSetKey      = "like:video:"        // 视频点赞用户集合 SET 前缀
+	VideoCommentRankKey  = "rank:video:comment" // 视频评论计数 ZSET
+	CommentLikeSetKey    = "like:comment:"      // 评论点赞用户集合 SET 前缀
+	VideoTagsCachePrefix = "video:tags:"        // 视频话题ID缓存前缀
+	TrendingBucketPrefix = "trend:bucket:"      // 视频热度小时分桶 ZSET 前缀
+	TrendingRankPrefix   = "trend:rank:"        // 视频热度榜单缓存 ZSET 前缀
+	ViewPendingKey       = "view:pending"       // 待落库的播放增量 HASH
+
+	TrendingTagBucketPrefix = "trend:tag:bucket:" // 话题热度小时分桶 ZSET 前缀（后缀与视频分桶相同）
+)
+
+// removeBucketScript 从一个小时的视频分桶中删除视频，并从同一小时的话题分桶中扣除该视频的热度（最多扣到0）
+// 视频已不在分桶中（如重试的任务已处理过这个分桶）时不做修改，保证重试不会重复扣除
+// KEYS[1] 视频分桶，KEYS[2] 话题分桶，ARGV[1] 视频ID，ARGV[2..] 视频的话题ID
+var removeBucketScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+for i = 2, #ARGV do
+	local tagScore = redis.call('ZSCORE', KEYS[2], ARGV[i])
+	if tagScore then
+		redis.call('ZADD', KEYS[2], tostring(math.max(tonumber(tagScore) - tonumber(score), 0)), ARGV[i])
+	end
+end
+return 1
+`)
+
+// VideoCleanupTask 视频清理任务结构
+type VideoCleanupTask struct {
+	VideoID  uint   `json:"video_id"`
+	FileName string `json:"file_name"`
+}
+
+// cleanupResult 一次清理删除的数量（写入清理记录用于审计）
+type cleanupResult struct {
+	objects int   // 删除的 MinIO 对象数
+	rows    int64 // 删除的关联记录数
+}
+
+// startCleanupConsumer	============视频清理的消费者==============
+func startCleanupConsumer(conn *mq.Connection) {
+	log.Println("视频清理 Consumer 启动中...")
+
+	// 删除视频是低频操作，单个 worker 即可；连接断开后自动等待重连并重新消费
+	name := "Cleanup Worker"
+	err := conn.Consume(context.Background(), QueueVideoCleanupName, 1, name, handleCleanupDelivery)
+	log.Printf("%s 退出: %v", name, err)
+}
+
+// handleCleanupDelivery 处理一条视频清理任务消息
+func handleCleanupDelivery(ch *amqp.Channel, d amqp.Delivery) {
+	var task VideoCleanupTask
+	if err := json.Unmarshal(d.Body, &task); err != nil || task.VideoID == 0 {
+		if err == nil {
+			err = errors.New("缺少 video_id")
+		}
+		log.Printf("Cleanup Worker 解析失败: %v", err)
+		// 无效消息直接进入死信队列
+		if err := mq.DeadLetter(ch, d, QueueVideoCleanupName, err); err != nil {
+			log.Printf("Cleanup Worker 投递死信失败: %v", err)
+		}
+		return
+	}
+
+	if err := processCleanupTask(task); err != nil {
+		log.Printf("Cleanup Worker 清理失败（已重试 %d 次）: VideoID=%d, Error=%v", mq.RetryCount(d.Headers), task.VideoID, err)
+		if rerr := recordCleanupFailure(task.VideoID, err); rerr != nil {
+			log.Printf("Cleanup Worker 记录失败原因出错: VideoID=%d, Error=%v", task.VideoID, rerr)
+		}
+		// 延迟重试；重试耗尽或不可重试（如视频未被删除）则进入死信队列
+		var rerr error
+		if isPermanent(err) {
+			rerr = mq.DeadLetter(ch, d, QueueVideoCleanupName, err)
+		} else {
+			_, rerr = mq.Retry(ch, d, QueueVideoCleanupName, err)
+		}
+		if rerr != nil {
+			log.Printf("Cleanup Worker 投递重试消息失败: %v", rerr)
+		}
+		return
+	}
+
+	_ = d.Ack(false)
+}
+
+// processCleanupTask 清理一个已删除视频的文件、缓存和关联记录
+func processCleanupTask(task VideoCleanupTask) error {
+	// 1. 已清理完成的任务（发件箱至少一次投递）直接忽略
+	var purge struct {
+		Status int
+	}
+	err := db.Table("video_purges").Select("status").Where("video_id = ?", task.VideoID).Take(&purge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return permanent(errors.New("清理记录不存在"))
+		}
+		return fmt.Errorf("查询清理记录失败: %v", err)
+	}
+	if purge.Status == PurgeStatusCompleted {
+		log.Printf("视频已清理，忽略重复消息: VideoID=%d", task.VideoID)
+		return nil
+	}
+
+	// 2. 只清理已删除的视频
+	var deleted int64
+	err = db.Table("videos").Where("id = ? AND deleted_at IS NOT NULL", task.VideoID).Count(&deleted).Error
+	if err != nil {
+		return fmt.Errorf("查询视频失败: %v", err)
+	}
+	if deleted == 0 {
+		return permanent(errors.New("视频不存在或未被删除"))
+	}
+
+	// 3. MinIO 文件
+	var result cleanupResult
+	result.objects, err = removeVideoObjects(task.FileName)
+	if err != nil {
+		return fmt.Errorf("删除视频文件失败: %v", err)
+	}
+
+	// 4. Redis 排行榜和缓存（评论点赞集合需要评论ID、话题分桶需要话题ID，必须在删除关联记录之前清理）
+	var commentIDs, tagIDs []uint
+	if err := db.Table("comments").Where("video_id = ?", task.VideoID).Pluck("id", &commentIDs).Error; err != nil {
+		return fmt.Errorf("查询评论失败: %v", err)
+	}
+	if err := db.Table("video_tags").Where("video_id = ?", task.VideoID).Pluck("tag_id", &tagIDs).Error; err != nil {
+		return fmt.Errorf("查询话题失败: %v", err)
+	}
+	if err := removeVideoRedisKeys(task.VideoID, commentIDs, tagIDs); err != nil {
+		return fmt.Errorf("删除 Redis 数据失败: %v", err)
+	}
+
+	// 5. MySQL 关联记录，并在同一事务中标记清理完成
+	err = db.Transaction(func(tx *gorm.DB) error {
+		deletes := []struct {
+			sql  string
+			args []interface{}
+		}{
+			{"DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM comments WHERE video_id = ?)", []interface{}{task.VideoID}},
+			{"DELETE FROM comments WHERE video_id = ?", []interface{}{task.VideoID}},
+			{"DELETE FROM likes WHERE video_id = ?", []interface{}{task.VideoID}},
+			{"DELETE FROM video_tags WHERE video_id = ?", []interface{}{task.VideoID}},
+			{"DELETE FROM multipart_uploads WHERE video_id = ?", []interface{}{task.VideoID}},
+		}
+		for _, d := range deletes {
+			res := tx.Exec(d.sql, d.args...)
+			if res.Error != nil {
+				return res.Error
+			}
+			result.rows += res.RowsAffected
+		}
+
+		return tx.Table("video_purges").
+			Where("video_id = ?", task.VideoID).
+			Updates(map[string]interface{}{
+				"status":          PurgeStatusCompleted,
+				"attempts":        gorm.Expr("attempts + 1"),
+				"last_error":      "",
+				"objects_removed": result.objects,
+				"rows_removed":    result.rows,
+				"completed_at":    time.Now(),
+			}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("删除关联记录失败: %v", err)
+	}
+
+	log.Printf("视频清理完成: VideoID=%d, Objects=%d, Rows=%d", task.VideoID, result.objects, result.rows)
+	return nil
+}
+
+// removeVideoObjects 删除视频在 MinIO 中的所有文件，返回删除的对象数
+// 原视频文件名为 <UUID>.<扩展名>，派生文件均以 <UUID> 为前缀，HLS 文件在 hls/<UUID>/ 下
+func removeVideoObjects(fileName string) (int, error) {
+	base := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if base == "" {
+		return 0, nil // 没有文件名的视频（前缀为空会匹配整个存储桶）
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 1. 未完成的分片上传（MinIO 删除已上传的分片）
+	if err := minioClient.RemoveIncompleteUpload(ctx, MinioBucket, fileName); err != nil {
+		return 0, fmt.Errorf("中止分片上传失败: %v", err)
+	}
+
+	// 2. 列出所有文件
+	var keys []string
+	for _, prefix := range []string{base, HLSPrefix + base + "/"} {
+		for obj := range minioClient.ListObjects(ctx, MinioBucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if obj.Err != nil {
+				return 0, obj.Err
+			}
+			keys = append(keys, obj.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	// 3. 批量删除
+	objects := make(chan minio.ObjectInfo, len(keys))
+	for _, key := range keys {
+		objects <- minio.ObjectInfo{Key: key}
+	}
+	close(objects)
+	var err error
+	for rerr := range minioClient.RemoveObjects(ctx, MinioBucket, objects, minio.RemoveObjectsOptions{}) {
+		if err == nil {
+			err = fmt.Errorf("删除 %s 失败: %v", rerr.ObjectName, rerr.Err)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// removeVideoRedisKeys 删除视频在 Redis 中的排行榜成员、缓存和评论点赞集合，并从话题分桶中扣除视频的热度
+func removeVideoRedisKeys(videoID uint, commentIDs, tagIDs []uint) error {
+	ctx := context.Background()
+	member := strconv.FormatUint(uint64(videoID), 10)
+
+	pipe := rdb.Pipeline()
+	pipe.ZRem(ctx, VideoLikeRankKey, member)
+	pipe.ZRem(ctx, VideoCommentRankKey, member)
+	pipe.Del(ctx, VideoLikeSetKey+member, VideoTagsCachePrefix+member)
+	pipe.HDel(ctx, ViewPendingKey, "v:"+member, "c:"+member)
+	for _, id := range commentIDs {
+		pipe.Del(ctx, CommentLikeSetKey+strconv.FormatUint(uint64(id), 10))
+	}
+
+	// 热度分桶（最多 8 天 × 24 个）按前缀扫描：视频在每个分桶中的热度都是按当时的话题累加到话题分桶的，
+	// 按视频当前的话题扣除（话题修改过时可能扣得不准，最多扣到0，过期后随分桶一起消失）；
+	// 话题榜单缓存 trend:tag:rank:* 不修改，最多 5 分钟后按新的分桶重新计算
+	tagArgs := make([]interface{}, 0, len(tagIDs)+1)
+	tagArgs = append(tagArgs, member)
+	for _, id := range tagIDs {
+		tagArgs = append(tagArgs, strconv.FormatUint(uint64(id), 10))
+	}
+	iter := rdb.Scan(ctx, 0, TrendingBucketPrefix+"*", 200).Iterator()
+	for iter.Next(ctx) {
+		tagBucket := TrendingTagBucketPrefix + strings.TrimPrefix(iter.Val(), TrendingBucketPrefix)
+		removeBucketScript.Eval(ctx, pipe, []string{iter.Val(), tagBucket}, tagArgs...)
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	iter = rdb.Scan(ctx, 0, TrendingRankPrefix+"*", 200).Iterator()
+	for iter.Next(ctx) {
+		pipe.ZRem(ctx, iter.Val(), member)
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// recordCleanupFailure 记录清理失败的次数和原因
+func recordCleanupFailure(videoID uint, cause error) error {
+	reason := cause.Error()
+	if r := []rune(reason); len(r) > 500 {
+		reason = string(r[:500])
+	}
+	return db.Table("video_purges").
+		Where("video_id = ? AND status = ?", videoID, PurgeStatusPending).
+		Updates(map[string]interface{}{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": reason,
+		}).Error
+}
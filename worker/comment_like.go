@@ -0,0 +1,143 @@
+package main
+
+// 评论点赞落库（与视频点赞相同：backend 先写 Redis，再通过 MQ 异步写 MySQL）
+
+import (
+	"common/config"
+	"common/mq"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+)
+
+// CommentLikeTask 评论点赞处理任务结构
+type CommentLikeTask struct {
+	CommentID uint  `json:"comment_id"`
+	UserID    uint  `json:"user_id"`
+	Delta     int   `json:"delta"` // +1 点赞；-1 取消
+	TS        int64 `json:"ts"`    // TS: 事件时间（time.Now().UnixMilli() 毫秒时间戳；旧消息为秒）
+}
+
+// startCommentLikeConsumer	============评论点赞处理的消费者==============
+func startCommentLikeConsumer(conn *mq.Connection) {
+	log.Println("评论点赞 Consumer 启动中...")
+
+	workerCount := config.Conf.Worker.LikeConcurrency
+
+	for i := 0; i < workerCount; i++ {
+		go func(workerID int) {
+			// 每个 worker 一次只拿一条未确认消息；连接断开后自动等待重连并重新消费
+			name := fmt.Sprintf("CommentLike Worker %d", workerID)
+			err := conn.Consume(context.Background(), QueueCommentLikeName, 1, name, func(ch *amqp.Channel, d amqp.Delivery) {
+				handleCommentLikeDelivery(workerID, ch, d)
+			})
+			log.Printf("%s 退出: %v", name, err)
+		}(i)
+	}
+
+	// 阻塞，防止函数返回
+	select {}
+}
+
+// handleCommentLikeDelivery 处理一条评论点赞任务消息
+func handleCommentLikeDelivery(workerID int, ch *amqp.Channel, d amqp.Delivery) {
+	var task CommentLikeTask
+	if err := json.Unmarshal(d.Body, &task); err != nil {
+		log.Printf("CommentLike Worker %d 解析失败: %v", workerID, err)
+		// 无效消息直接进入死信队列
+		if err := mq.DeadLetter(ch, d, QueueCommentLikeName, err); err != nil {
+			log.Printf("CommentLike Worker %d 投递死信失败: %v", workerID, err)
+		}
+		return
+	}
+
+	if err := processCommentLike(task); err != nil {
+		log.Printf("CommentLike Worker %d 处理失败（已重试 %d 次）: %v", workerID, mq.RetryCount(d.Headers), err)
+		// 延迟重试，重试耗尽则进入死信队列
+		if _, err := mq.Retry(ch, d, QueueCommentLikeName, err); err != nil {
+			log.Printf("CommentLike Worker %d 投递重试消息失败: %v", workerID, err)
+		}
+		return
+	}
+
+	_ = d.Ack(false)
+}
+
+// upsertCommentLikeStateSQL 写入评论点赞关系的状态和最后落库的事件时间（与 upsertLikeStateSQL 相同）
+const upsertCommentLikeStateSQL = `INSERT INTO comment_likes(user_id, comment_id, created_at, updated_at, deleted_at, last_ts)
+VALUES (?, ?, NOW(), NOW(), IF(?, NULL, NOW()), ?)
+ON DUPLICATE KEY UPDATE
+updated_at = IF((deleted_at IS NULL) = (VALUES(deleted_at) IS NULL), updated_at, NOW()),
+deleted_at = IF((deleted_at IS NULL) = (VALUES(deleted_at) IS NULL), deleted_at, VALUES(deleted_at)),
+last_ts = VALUES(last_ts)`
+
+// processCommentLike 在一个事务中更新 comment_likes 表和 comments.like_count
+// 与视频点赞相同，比记录中 last_ts 更早的消息（重试、重复投递的旧消息）直接丢弃，不会覆盖之后的操作
+func processCommentLike(task CommentLikeTask) error {
+	if task.Delta == 0 {
+		return nil
+	}
+	want := task.Delta > 0
+	ts := eventMillis(task.TS)
+
+	// appliedDelta：本次真正需要应用到 comments.like_count 的变化（只可能 -1/0/+1）
+	appliedDelta := 0
+	stale := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 1) 锁定点赞关系的记录（不存在时通过唯一索引的间隙锁），读取当前状态和 last_ts
+		var rows []struct {
+			Alive  bool
+			LastTS int64 `gorm:"column:last_ts"`
+		}
+		err := tx.Raw(
+			"SELECT deleted_at IS NULL AS alive, last_ts FROM comment_likes WHERE user_id = ? AND comment_id = ? FOR UPDATE",
+			task.UserID,
+			task.CommentID,
+		).Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("查询评论点赞记录失败: %v", err)
+		}
+		var alive bool
+		if len(rows) > 0 {
+			if rows[0].LastTS > ts {
+				stale = true
+				return nil
+			}
+			alive = rows[0].Alive
+		}
+
+		// 2) 写入状态和 last_ts（取消点赞的关系没有记录时也插入一条已软删除的记录）
+		if err := tx.Exec(upsertCommentLikeStateSQL, task.UserID, task.CommentID, want, ts).Error; err != nil {
+			return fmt.Errorf("写入评论点赞记录失败: %v", err)
+		}
+		switch {
+		case want && !alive:
+			appliedDelta = 1
+		case !want && alive:
+			appliedDelta = -1
+		}
+
+		// 3) 点赞状态变化时更新 comments.like_count
+		if appliedDelta != 0 {
+			err := tx.Exec(
+				"UPDATE comments SET like_count = GREATEST(CAST(like_count AS SIGNED) + ?, 0) WHERE id = ?",
+				appliedDelta,
+				task.CommentID,
+			).Error
+			if err != nil {
+				return fmt.Errorf("更新评论点赞数失败: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("评论点赞任务处理完成: CommentID=%d, Delta=%d, AppliedDelta=%d, Stale=%t", task.CommentID, task.Delta, appliedDelta, stale)
+	return nil
+}
@@ -1,27 +0,0 @@
-package config
-
-const (
-    // MySQL 配置
-    MySQLUsername = "root"
-    MySQLPassword = "mysql030303"
-    MySQLHost     = "101.132.25.34"
-    MySQLPort     = "3306"
-    MySQLDatabase = "cwatch"
-    
-    // Redis 配置
-    RedisPassword = "redis030303"
-    RedisHost     = "101.132.25.34"
-    RedisPort     = "6379"
-    
-    // RabbitMQ 配置
-    RabbitMQUsername = "admin"
-    RabbitMQPassword = "rabbitmq030303"
-    RabbitMQHost     = "101.132.25.34"
-    RabbitMQPort     = "5672"
-    
-    // MinIO 配置
-    MinIOAccessKey = "minioadmin"
-    MinIOSecretKey = "minio030303"
-    MinIOHost      = "101.132.25.34"
-    MinIOPort      = "9000"
-)
\ No newline at end of file
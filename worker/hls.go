@@ -0,0 +1,183 @@
+package main
+
+// HLS 自适应码率打包
+
+import (
+	"common/config"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// HLS 配置
+const (
+	HLSPrefix          = "hls/"        // MinIO 中 HLS 文件的前缀：hls/<视频文件名>/...
+	HLSMasterPlaylist  = "master.m3u8" // 主播放列表文件名
+	HLSSegmentDuration = 4             // 切片时长（秒）
+)
+
+// rendition HLS 的一档清晰度
+type rendition struct {
+	Name         string // 清晰度名称，同时作为子目录名
+	ShortSide    int    // 输出短边长度（横屏为高度，竖屏为宽度，另一边按比例自动计算）
+	VideoBitrate int    // 视频码率（kbps）
+	AudioBitrate int    // 音频码率（kbps）
+}
+
+// hlsLadder 完整的清晰度阶梯（从低到高），实际生成哪些档位由 buildLadder 根据源视频决定
+var hlsLadder = []rendition{
+	{Name: "360p", ShortSide: 360, VideoBitrate: 800, AudioBitrate: 96},
+	{Name: "720p", ShortSide: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "1080p", ShortSide: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+}
+
+// buildLadder 根据源视频信息选择要生成的清晰度
+// - 只生成不高于源分辨率的档位（不做放大）；源分辨率低于最低档时，按源分辨率生成一档（名称为实际分辨率）
+// - 高帧率（>30fps）视频码率提高 50%
+// - 码率不超过源视频码率（源视频码率已知时）
+func buildLadder(meta *VideoMeta) []rendition {
+	ladder := make([]rendition, 0, len(hlsLadder))
+	for _, r := range hlsLadder {
+		if r.ShortSide <= meta.ShortSide() {
+			ladder = append(ladder, r)
+		}
+	}
+	if len(ladder) == 0 {
+		r := hlsLadder[0]
+		// libx264 要求宽高为偶数；名称按实际输出的短边（如 240p），不能沿用最低档的名称
+		r.ShortSide = meta.ShortSide() &^ 1
+		r.Name = fmt.Sprintf("%dp", r.ShortSide)
+		ladder = append(ladder, r)
+	}
+
+	for i := range ladder {
+		if meta.FrameRate > 30 {
+			ladder[i].VideoBitrate = ladder[i].VideoBitrate * 3 / 2
+		}
+		if meta.Bitrate > 0 && ladder[i].VideoBitrate > meta.Bitrate {
+			ladder[i].VideoBitrate = meta.Bitrate
+		}
+	}
+	return ladder
+}
+
+// renditionNames 清晰度名称列表，如 ["360p", "720p"]
+func renditionNames(ladder []rendition) []string {
+	names := make([]string, 0, len(ladder))
+	for _, r := range ladder {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// transcodeHLS 使用 FFmpeg 一次性生成所有清晰度的 HLS 切片和主播放列表
+// 输出目录结构：
+//
+//	outputDir/master.m3u8
+//	outputDir/<name>/index.m3u8
+//	outputDir/<name>/seg_000.ts ...
+func transcodeHLS(inputPath, outputDir string, ladder []rendition, meta *VideoMeta) error {
+	// 1. 用 split 把视频流复制成多路，每路按短边缩放到对应清晰度
+	var filter strings.Builder
+	fmt.Fprintf(&filter, "[0:v]split=%d", len(ladder))
+	for i := range ladder {
+		fmt.Fprintf(&filter, "[v%d]", i)
+	}
+	for i, r := range ladder {
+		if meta.Portrait() {
+			fmt.Fprintf(&filter, ";[v%d]scale=%d:-2[v%dout]", i, r.ShortSide, i)
+		} else {
+			fmt.Fprintf(&filter, ";[v%d]scale=-2:%d[v%dout]", i, r.ShortSide, i)
+		}
+	}
+
+	args := []string{"-y", "-i", inputPath, "-filter_complex", filter.String()}
+
+	// 2. 每一路视频（以及音频）的编码参数
+	streamMap := make([]string, 0, len(ladder))
+	// 峰值码率为目标码率的 1.07 倍，缓冲区为 1.5 倍
+	for i, r := range ladder {
+		args = append(args,
+			"-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-c:v:%d", i), "libx264",
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+		)
+		if meta.HasAudio {
+			args = append(args,
+				"-map", "0:a:0",
+				fmt.Sprintf("-c:a:%d", i), "aac",
+				fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", r.AudioBitrate),
+			)
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,a:%d,name:%s", i, i, r.Name))
+		} else {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,name:%s", i, r.Name))
+		}
+	}
+
+	// 3. HLS 封装参数
+	// -force_key_frames: 每个切片边界强制关键帧，保证各清晰度切片对齐，便于无缝切换
+	// -hls_playlist_type vod: 点播模式，播放列表包含全部切片
+	args = append(args,
+		"-preset", "medium",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", HLSSegmentDuration),
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%d", HLSSegmentDuration),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_filename", filepath.Join(outputDir, "%v", "seg_%03d.ts"),
+		"-master_pl_name", HLSMasterPlaylist,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(outputDir, "%v", "index.m3u8"),
+	)
+
+	cmd := exec.Command(config.Conf.Worker.FFmpegPath, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("FFmpeg HLS 转码失败: %v, 输出: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// uploadHLSToMinIO 上传 HLS 目录下的所有文件到 MinIO
+// 参数：本地目录、对象前缀（如 hls/<视频文件名>/）
+// 返回：主播放列表的访问URL
+func uploadHLSToMinIO(localDir, prefix string) (string, error) {
+	err := filepath.WalkDir(localDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return err
+		}
+		objectName := prefix + filepath.ToSlash(rel)
+
+		if _, err := uploadToMinIO(path, objectName, hlsContentType(path)); err != nil {
+			return fmt.Errorf("上传 %s 失败: %v", objectName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return objectURL(prefix + HLSMasterPlaylist), nil
+}
+
+// hlsContentType 根据扩展名返回 HLS 文件的 Content-Type
+func hlsContentType(path string) string {
+	switch filepath.Ext(path) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildLadder(t *testing.T) {
+	tests := []struct {
+		name string
+		meta VideoMeta
+		want []rendition
+	}{
+		{
+			name: "1080p 横屏生成全部档位",
+			meta: VideoMeta{Width: 1920, Height: 1080, FrameRate: 30},
+			want: hlsLadder,
+		},
+		{
+			name: "竖屏按短边计算",
+			meta: VideoMeta{Width: 720, Height: 1280, FrameRate: 30},
+			want: hlsLadder[:2],
+		},
+		{
+			name: "不放大到高于源分辨率",
+			meta: VideoMeta{Width: 1280, Height: 719, FrameRate: 25},
+			want: hlsLadder[:1],
+		},
+		{
+			name: "低于最低档按源分辨率生成并以实际短边命名",
+			meta: VideoMeta{Width: 427, Height: 241, FrameRate: 25},
+			want: []rendition{{Name: "240p", ShortSide: 240, VideoBitrate: 800, AudioBitrate: 96}},
+		},
+		{
+			name: "高帧率码率提高 50%",
+			meta: VideoMeta{Width: 640, Height: 360, FrameRate: 60},
+			want: []rendition{{Name: "360p", ShortSide: 360, VideoBitrate: 1200, AudioBitrate: 96}},
+		},
+		{
+			name: "码率不超过源码率",
+			meta: VideoMeta{Width: 1280, Height: 720, FrameRate: 30, Bitrate: 1000},
+			want: []rendition{
+				{Name: "360p", ShortSide: 360, VideoBitrate: 800, AudioBitrate: 96},
+				{Name: "720p", ShortSide: 720, VideoBitrate: 1000, AudioBitrate: 128},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildLadder(&tt.meta)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildLadder() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if hlsLadder[0].VideoBitrate != 800 {
+		t.Errorf("buildLadder 修改了 hlsLadder: %+v", hlsLadder)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+// 点赞批量落库
+//
+// 点赞消息按批消费（攒满 worker.like_batch_size 条或等待 worker.like_batch_window），每批：
+//  1. 按 (用户, 视频) 合并为最终状态：TS（毫秒）大的消息为准，TS 相同时以发件箱序号大的为准；
+//  2. 在一个事务中锁定这些点赞关系的记录，丢弃比记录中 last_ts 更早的消息（重试、重复投递的旧消息不会覆盖新状态），
+//     其余关系写入最终状态和 last_ts，并按视频聚合更新 like_count；
+//  3. 事务提交后才 Ack 整批消息。
+// 批量事务失败（如并发批次死锁）时退回逐条处理（processLike），只有处理失败的消息进入重试，避免一条异常消息拖垮整批。
+
+import (
+	"common/config"
+	"common/mq"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+)
+
+// upsertLikeStateSQL 写入点赞关系的状态和最后落库的事件时间（依赖 (user_id, video_id) 唯一索引），%s 为 VALUES 列表
+// 取消点赞的关系没有记录时也插入一条已软删除的记录，用来记住事件时间，之后才到达的更早的点赞消息会被丢弃；
+// updated_at 只在点赞状态变化时更新（热度按它统计点赞时间）
+const upsertLikeStateSQL = `INSERT INTO likes(user_id, video_id, created_at, updated_at, deleted_at, last_ts) VALUES %s
+ON DUPLICATE KEY UPDATE
+updated_at = IF((deleted_at IS NULL) = (VALUES(deleted_at) IS NULL), updated_at, NOW()),
+deleted_at = IF((deleted_at IS NULL) = (VALUES(deleted_at) IS NULL), deleted_at, VALUES(deleted_at)),
+last_ts = VALUES(last_ts)`
+
+// likeKey 点赞关系
+type likeKey struct {
+	UserID  uint
+	VideoID uint
+}
+
+// likeEvent 一条待落库的点赞消息
+type likeEvent struct {
+	task     LikeTask
+	delivery amqp.Delivery
+}
+
+// likeState 点赞关系的最终状态
+type likeState struct {
+	liked bool
+	ts    int64 // 决定该状态的消息的事件时间（毫秒）
+}
+
+// eventMillis 点赞消息的事件时间（毫秒）；旧版本 backend 写入的 TS 是秒，换算为毫秒
+func eventMillis(ts int64) int64 {
+	if ts < 1e12 {
+		return ts * 1000
+	}
+	return ts
+}
+
+// eventTime 消息的事件时间（毫秒）
+func (e likeEvent) eventTime() int64 {
+	return eventMillis(e.task.TS)
+}
+
+// outboxSeq 消息在发件箱中的序号（MessageId 为 outbox-<id>），无法解析时为 0
+func (e likeEvent) outboxSeq() uint64 {
+	seq, _ := strconv.ParseUint(strings.TrimPrefix(e.delivery.MessageId, "outbox-"), 10, 64)
+	return seq
+}
+
+// before e 是否早于 o：先比较事件时间，相同时比较发件箱序号（发件箱按写入顺序分配序号）
+func (e likeEvent) before(o likeEvent) bool {
+	if e.eventTime() != o.eventTime() {
+		return e.eventTime() < o.eventTime()
+	}
+	return e.outboxSeq() < o.outboxSeq()
+}
+
+// startLikeConsumer	============点赞处理的消费者==============
+func startLikeConsumer(conn *mq.Connection) {
+	log.Println("点赞 Consumer 启动中...")
+
+	cfg := config.Conf.Worker
+	for i := 0; i < cfg.LikeConcurrency; i++ {
+		go func(workerID int) {
+			// 按批消费；连接断开后自动等待重连并重新消费
+			name := fmt.Sprintf("Like Worker %d", workerID)
+			err := conn.ConsumeBatch(context.Background(), QueueVideoLikeName, cfg.LikeBatchSize, cfg.LikeBatchWindow, name,
+				func(ch *amqp.Channel, batch []amqp.Delivery) {
+					handleLikeBatch(workerID, ch, batch)
+				})
+			log.Printf("%s 退出: %v", name, err)
+		}(i)
+	}
+
+	// 阻塞，防止函数返回
+	select {}
+}
+
+// handleLikeBatch 处理一批点赞消息
+func handleLikeBatch(workerID int, ch *amqp.Channel, batch []amqp.Delivery) {
+	events := make([]likeEvent, 0, len(batch))
+	for _, d := range batch {
+		var task LikeTask
+		if err := json.Unmarshal(d.Body, &task); err != nil {
+			log.Printf("Like Worker %d 解析失败: %v", workerID, err)
+			// 无效消息直接进入死信队列
+			if err := mq.DeadLetter(ch, d, QueueVideoLikeName, err); err != nil {
+				log.Printf("Like Worker %d 投递死信失败: %v", workerID, err)
+			}
+			continue
+		}
+		events = append(events, likeEvent{task: task, delivery: d})
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	final := coalesceLikes(events)
+	applied, err := applyLikeBatch(final)
+	if err != nil {
+		log.Printf("Like Worker %d 批量落库失败，改为逐条处理: Count=%d, Error=%v", workerID, len(events), err)
+		for _, e := range events {
+			handleLikeEvent(workerID, ch, e)
+		}
+		return
+	}
+
+	for _, e := range events {
+		_ = e.delivery.Ack(false)
+	}
+	log.Printf("Like Worker %d 批量完成: Messages=%d, Pairs=%d, Inserted=%d, Deleted=%d, Stale=%d",
+		workerID, len(events), len(final), applied.inserted, applied.deleted, applied.stale)
+}
+
+// handleLikeEvent 逐条处理一条点赞消息（批量失败时的退路）
+func handleLikeEvent(workerID int, ch *amqp.Channel, e likeEvent) {
+	if err := processLike(e); err != nil {
+		log.Printf("Like Worker %d 处理失败（已重试 %d 次）: %v", workerID, mq.RetryCount(e.delivery.Headers), err)
+		// 延迟重试，重试耗尽则进入死信队列
+		if _, err := mq.Retry(ch, e.delivery, QueueVideoLikeName, err); err != nil {
+			log.Printf("Like Worker %d 投递重试消息失败: %v", workerID, err)
+		}
+		return
+	}
+	_ = e.delivery.Ack(false)
+}
+
+// coalesceLikes 按 (用户, 视频) 合并消息，返回每个点赞关系的最终状态
+func coalesceLikes(events []likeEvent) map[likeKey]likeState {
+	latest := make(map[likeKey]likeEvent, len(events))
+	for _, e := range events {
+		key := likeKey{UserID: e.task.UserID, VideoID: e.task.VideoID}
+		if prev, ok := latest[key]; ok && e.before(prev) {
+			continue
+		}
+		latest[key] = e
+	}
+
+	final := make(map[likeKey]likeState, len(latest))
+	for key, e := range latest {
+		if e.task.Delta == 0 {
+			continue
+		}
+		final[key] = likeState{liked: e.task.Delta > 0, ts: e.eventTime()}
+	}
+	return final
+}
+
+// likeBatchResult 批量落库的结果
+type likeBatchResult struct {
+	inserted int
+	deleted  int
+	stale    int // 比已落库状态更早、被丢弃的点赞关系数
+}
+
+// applyLikeBatch 在一个事务中把点赞关系的最终状态写入 likes 表，并按视频聚合更新 videos.like_count
+func applyLikeBatch(final map[likeKey]likeState) (likeBatchResult, error) {
+	var result likeBatchResult
+	if len(final) == 0 {
+		return result, nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 1) 已删除的视频不再落库
+		videoIDs := make([]uint, 0, len(final))
+		seen := make(map[uint]bool)
+		for key := range final {
+			if !seen[key.VideoID] {
+				seen[key.VideoID] = true
+				videoIDs = append(videoIDs, key.VideoID)
+			}
+		}
+		var existingVideos []uint
+		if err := tx.Raw("SELECT id FROM videos WHERE id IN ? AND deleted_at IS NULL", videoIDs).
+			Scan(&existingVideos).Error; err != nil {
+			return fmt.Errorf("查询视频失败: %v", err)
+		}
+		alive := make(map[uint]bool, len(existingVideos))
+		for _, id := range existingVideos {
+			alive[id] = true
+		}
+
+		keys := make([]likeKey, 0, len(final))
+		for key := range final {
+			if alive[key.VideoID] {
+				keys = append(keys, key)
+			} else {
+				log.Printf("警告: 视频不存在，忽略点赞 VideoID=%d, UserID=%d", key.VideoID, key.UserID)
+			}
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		// 2) 查出这些点赞关系的当前状态（锁定已有记录）
+		rows, err := txGetLikeRows(tx, keys)
+		if err != nil {
+			return fmt.Errorf("查询点赞记录失败: %v", err)
+		}
+
+		toWrite := make([]likeKey, 0, len(keys))
+		deltas := make(map[uint]int)
+		for _, key := range keys {
+			want, row := final[key], rows[key]
+			if row.LastTS > want.ts {
+				// 已落库的状态来自更晚的操作（本条是重试或重复投递的旧消息）
+				result.stale++
+				continue
+			}
+			toWrite = append(toWrite, key)
+			switch {
+			case want.liked && !row.Alive:
+				result.inserted++
+				deltas[key.VideoID]++
+			case !want.liked && row.Alive:
+				result.deleted++
+				deltas[key.VideoID]--
+			}
+		}
+
+		// 3) 批量写入状态和 last_ts（已软删除的记录恢复，取消的点赞软删除）
+		if len(toWrite) > 0 {
+			placeholders := make([]string, len(toWrite))
+			args := make([]interface{}, 0, len(toWrite)*4)
+			for i, key := range toWrite {
+				placeholders[i] = "(?, ?, NOW(), NOW(), IF(?, NULL, NOW()), ?)"
+				args = append(args, key.UserID, key.VideoID, final[key].liked, final[key].ts)
+			}
+			if err := tx.Exec(fmt.Sprintf(upsertLikeStateSQL, strings.Join(placeholders, ", ")), args...).Error; err != nil {
+				return fmt.Errorf("写入点赞记录失败: %v", err)
+			}
+		}
+
+		// 4) 按视频聚合更新 like_count（每个视频一条 UPDATE）
+		for videoID, delta := range deltas {
+			if delta == 0 {
+				continue
+			}
+			if err := tx.Exec(
+				"UPDATE videos SET like_count = GREATEST(CAST(like_count AS SIGNED) + ?, 0) WHERE id = ?",
+				delta,
+				videoID,
+			).Error; err != nil {
+				return fmt.Errorf("更新 MySQL 失败: %v", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return likeBatchResult{}, err
+	}
+	return result, nil
+}
+
+// likeRow likes 表中一个点赞关系的记录（没有记录时为零值）
+type likeRow struct {
+	Alive  bool  // 是否处于已点赞状态
+	LastTS int64 // 最后落库的事件时间（毫秒）
+}
+
+// txGetLikeRows 查询点赞关系的当前记录
+// FOR UPDATE 同时锁定已软删除的记录和（通过唯一索引的间隙锁）尚不存在的记录，
+// 并发处理同一关系的另一个批次会等待本事务提交后再读取，不会重复计数，也不会用旧消息覆盖新状态
+func txGetLikeRows(tx *gorm.DB, keys []likeKey) (map[likeKey]likeRow, error) {
+	placeholders, args := likePairArgs(keys, "(?, ?)")
+	var rows []struct {
+		UserID  uint
+		VideoID uint
+		Alive   bool
+		LastTS  int64 `gorm:"column:last_ts"`
+	}
+	err := tx.Raw(
+		"SELECT user_id, video_id, deleted_at IS NULL AS alive, last_ts FROM likes WHERE (user_id, video_id) IN ("+placeholders+") FOR UPDATE",
+		args...,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[likeKey]likeRow, len(rows))
+	for _, row := range rows {
+		result[likeKey{UserID: row.UserID, VideoID: row.VideoID}] = likeRow{Alive: row.Alive, LastTS: row.LastTS}
+	}
+	return result, nil
+}
+
+// likePairArgs 为一组点赞关系生成 SQL 占位符和参数（每个关系使用 tuple 模板，前两个占位符为 user_id、video_id）
+func likePairArgs(keys []likeKey, tuple string) (string, []interface{}) {
+	parts := make([]string, len(keys))
+	args := make([]interface{}, 0, len(keys)*2)
+	for i, key := range keys {
+		parts[i] = tuple
+		args = append(args, key.UserID, key.VideoID)
+	}
+	return strings.Join(parts, ", "), args
+}
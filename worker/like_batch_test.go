@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ev 构造一条点赞消息（seq 为 0 表示没有 outbox 序号）
+func ev(userID, videoID uint, delta int, ts int64, seq uint64) likeEvent {
+	e := likeEvent{task: LikeTask{UserID: userID, VideoID: videoID, Delta: delta, TS: ts}}
+	if seq > 0 {
+		e.delivery = amqp.Delivery{MessageId: fmt.Sprintf("outbox-%d", seq)}
+	}
+	return e
+}
+
+func TestEventMillis(t *testing.T) {
+	tests := []struct {
+		name string
+		ts   int64
+		want int64
+	}{
+		{"毫秒原样返回", 1_700_000_000_123, 1_700_000_000_123},
+		{"旧消息的秒转为毫秒", 1_700_000_000, 1_700_000_000_000},
+		{"零值", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventMillis(tt.ts); got != tt.want {
+				t.Errorf("eventMillis(%d) = %d, want %d", tt.ts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLikeEventBefore(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b likeEvent
+		want bool
+	}{
+		{"事件时间更早", ev(1, 1, 1, 1_700_000_000_100, 9), ev(1, 1, -1, 1_700_000_000_200, 1), true},
+		{"事件时间更晚", ev(1, 1, 1, 1_700_000_000_200, 1), ev(1, 1, -1, 1_700_000_000_100, 9), false},
+		{"同一毫秒按 outbox 序号", ev(1, 1, 1, 1_700_000_000_100, 3), ev(1, 1, -1, 1_700_000_000_100, 4), true},
+		{"同一毫秒序号更大", ev(1, 1, 1, 1_700_000_000_100, 4), ev(1, 1, -1, 1_700_000_000_100, 3), false},
+		{"秒级旧消息与毫秒消息比较", ev(1, 1, 1, 1_700_000_000, 0), ev(1, 1, -1, 1_700_000_000_500, 0), true},
+		{"完全相同不算更早", ev(1, 1, 1, 1_700_000_000_100, 3), ev(1, 1, 1, 1_700_000_000_100, 3), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.before(tt.b); got != tt.want {
+				t.Errorf("before() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoalesceLikes(t *testing.T) {
+	k := likeKey{UserID: 1, VideoID: 10}
+	tests := []struct {
+		name   string
+		events []likeEvent
+		want   map[likeKey]likeState
+	}{
+		{
+			name:   "空批次",
+			events: nil,
+			want:   map[likeKey]likeState{},
+		},
+		{
+			name:   "先赞后取消以最后一条为准",
+			events: []likeEvent{ev(1, 10, 1, 1_000_000_000_100, 1), ev(1, 10, -1, 1_000_000_000_200, 2)},
+			want:   map[likeKey]likeState{k: {liked: false, ts: 1_000_000_000_200}},
+		},
+		{
+			name:   "乱序到达按事件时间取最新",
+			events: []likeEvent{ev(1, 10, 1, 1_000_000_000_300, 2), ev(1, 10, -1, 1_000_000_000_200, 1)},
+			want:   map[likeKey]likeState{k: {liked: true, ts: 1_000_000_000_300}},
+		},
+		{
+			name:   "同一毫秒按 outbox 序号取最新",
+			events: []likeEvent{ev(1, 10, -1, 1_000_000_000_100, 6), ev(1, 10, 1, 1_000_000_000_100, 5)},
+			want:   map[likeKey]likeState{k: {liked: false, ts: 1_000_000_000_100}},
+		},
+		{
+			name:   "秒级旧消息换算为毫秒",
+			events: []likeEvent{ev(1, 10, 1, 1_000_000_000, 0)},
+			want:   map[likeKey]likeState{k: {liked: true, ts: 1_000_000_000_000}},
+		},
+		{
+			name:   "最终 Delta 为 0 的消息跳过",
+			events: []likeEvent{ev(1, 10, 1, 1_000_000_000_100, 1), ev(1, 10, 0, 1_000_000_000_200, 2)},
+			want:   map[likeKey]likeState{},
+		},
+		{
+			name: "不同点赞关系互不影响",
+			events: []likeEvent{
+				ev(1, 10, 1, 1_000_000_000_100, 1),
+				ev(2, 10, 1, 1_000_000_000_100, 2),
+				ev(2, 10, -1, 1_000_000_000_150, 3),
+			},
+			want: map[likeKey]likeState{
+				k:                        {liked: true, ts: 1_000_000_000_100},
+				{UserID: 2, VideoID: 10}: {liked: false, ts: 1_000_000_000_150},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := coalesceLikes(tt.events)
+			if len(got) != len(tt.want) {
+				t.Fatalf("coalesceLikes() = %v, want %v", got, tt.want)
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("coalesceLikes()[%v] = %+v, want %+v", key, got[key], want)
+				}
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ package main
 // RabbitMQ 消费者
 
 import (
-	"worker/config"
+	"common/config"
+	"common/mq"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -13,24 +15,34 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 // 配置常量
 const (
-	// RabbitMQ 配置
-	QueueVideoName = "video_processing"
-	QueueVideoLikeName = "video_like_processing"   // 新增：点赞处理队列
+	// RabbitMQ 配置（队列拓扑与 backend 共用 common/mq 中的定义）
+	QueueVideoName        = mq.QueueVideoName
+	QueueVideoLikeName    = mq.QueueVideoLikeName
+	QueueCommentLikeName  = mq.QueueCommentLikeName
+	QueueVideoViewName    = mq.QueueVideoViewName
+	QueueVideoCleanupName = mq.QueueVideoCleanupName
 
 	// MinIO 配置
 	MinioBucket = "cwatch"
+)
 
-	// FFmpeg 配置（Windows路径）
-	FFmpegPath = "E:/soft/ffmpeg-8.0.1-essentials_build/bin/ffmpeg.exe"
+// 视频状态常量（与 backend/models 保持一致）
+const (
+	VideoStatusUploaded   = 1 // 上传完成
+	VideoStatusProcessing = 2 // 转码中
+	VideoStatusPublished  = 3 // 已发布
+	VideoStatusFailed     = 4 // 处理失败
 )
 
 // VideoTask 视频处理任务结构
@@ -44,18 +56,24 @@ type LikeTask struct {
 	VideoID uint  `json:"video_id"`
 	UserID  uint  `json:"user_id"`
 	Delta   int   `json:"delta"` // +1 点赞；-1 取消
-	TS      int64 `json:"ts"`	// TS: time.Now().Unix() 时间戳
+	TS      int64 `json:"ts"`	// TS: 事件时间（time.Now().UnixMilli() 毫秒时间戳；旧消息为秒）
 }
 
 // 全局变量
 var (
 	db          *gorm.DB
 	minioClient *minio.Client
+	rdb         *redis.Client
 )
 
 func main() {
 	log.Println("视频处理 Worker 启动中...")
 
+	// 加载配置（配置文件 + 环境变量），FFmpeg 路径、临时目录、并发数等均来自配置
+	if _, err := config.Load((*config.Config).ValidateWorker); err != nil {
+		log.Fatal("加载配置失败:\n", err)
+	}
+
 	// 初始化数据库连接
 	if err := initMySQL(); err != nil {
 		log.Fatal("MySQL 连接失败:", err)
@@ -68,14 +86,14 @@ func main() {
 	}
 	log.Println("MinIO 连接成功")
 
-	// 连接到 RabbitMQ
-	rabbitMQURL := fmt.Sprintf("amqp://%s:%s@%s:%s/",
-		config.RabbitMQUsername,
-		config.RabbitMQPassword,
-		config.RabbitMQHost,
-		config.RabbitMQPort)
-	
-	conn, err := amqp.Dial(rabbitMQURL)
+	// 初始化 Redis 连接（清理已删除视频的排行榜和缓存）
+	if err := initRedis(); err != nil {
+		log.Fatal("Redis 连接失败:", err)
+	}
+	log.Println("Redis 连接成功")
+
+	// 连接到 RabbitMQ（断线后自动重连，每次连接成功后声明业务队列、重试队列和死信队列，与 backend 声明的拓扑一致）
+	conn, err := mq.Dial(config.Conf.RabbitMQ.URL(), config.Conf.RabbitMQ.ReconnectMaxBackoff, mq.DeclareTopology)
 	if err != nil {
 		log.Fatal("RabbitMQ 连接失败:", err)
 	}
@@ -91,288 +109,92 @@ func main() {
 
 	go startLikeConsumer(conn)  // 处理点赞消费者
 
-	<-forever
-}
+	go startCommentLikeConsumer(conn) // 处理评论点赞消费者
 
-// startVideoConsumer	=============视频处理的消费者==============	
-func startVideoConsumer(conn *amqp.Connection) {
-    log.Println("视频 Consumer 启动中...")
-
-    workerCount := 3
-
-    for i := 0; i < workerCount; i++ {
-        go func(workerID int) {
-            ch, err := conn.Channel()
-            if err != nil {
-                log.Printf("Worker %d 创建通道失败: %v", workerID, err)
-                return
-            }
-            defer ch.Close()
-
-            // 声明队列（建议所有 worker 都声明一遍，幂等）
-            q, err := ch.QueueDeclare(
-                QueueVideoName,
-                true,
-                false,
-                false,
-                false,
-                nil,
-            )
-            if err != nil {
-                log.Printf("Worker %d 声明队列失败: %v", workerID, err)
-                return
-            }
-
-            // 每个 worker 一次只拿一条未确认消息
-            if err := ch.Qos(1, 0, false); err != nil {
-                log.Printf("Worker %d 设置 QoS 失败: %v", workerID, err)
-                return
-            }
-
-            msgs, err := ch.Consume(
-                q.Name,
-                "",    // consumer tag
-                false, // autoAck
-                false,
-                false,
-                false,
-                nil,
-            )
-            if err != nil {
-                log.Printf("Worker %d 开始消费失败: %v", workerID, err)
-                return
-            }
-
-            log.Printf("Video Worker %d 已启动，等待任务...", workerID)
-
-            for d := range msgs {
-                var task VideoTask
-                if err := json.Unmarshal(d.Body, &task); err != nil {
-                    log.Printf("Worker %d 解析失败: %v", workerID, err)
-                    _ = d.Nack(false, false) // 丢弃（也可改成 true 重新入队）
-                    continue
-                }
-
-                if err := processVideo(task); err != nil {	// 处理视频任务
-                    log.Printf("Worker %d 处理失败: %v", workerID, err)
-                    _ = d.Nack(false, true) // 重新入队
-                    continue
-                }
-
-                _ = d.Ack(false)
-                log.Printf("Worker %d 完成: VideoID=%d", workerID, task.VideoID)
-            }
-
-            log.Printf("Worker %d msgs channel closed, 退出", workerID)
-        }(i)
-    }
-
-    // 关键：阻塞，防止函数返回； 用channel阻塞也可以
-    select {}
-}
+	go startViewConsumer(conn) // 处理播放量落库消费者
+
+	go startCleanupConsumer(conn) // 处理视频删除后的级联清理消费者
 
+	<-forever
+}
 
-// startLikeConsumer	============点赞处理的消费者==============
-func startLikeConsumer(conn *amqp.Connection) {
-	log.Println("点赞 Consumer 启动中...")
+// startVideoConsumer	=============视频处理的消费者==============
+func startVideoConsumer(conn *mq.Connection) {
+	log.Println("视频 Consumer 启动中...")
 
-	workerCount := 2 // 点赞处理相对简单，2个worker足够
+	workerCount := config.Conf.Worker.VideoConcurrency
 
 	for i := 0; i < workerCount; i++ {
 		go func(workerID int) {
-			ch, err := conn.Channel()
-			if err != nil {
-				log.Printf("Like Worker %d 创建通道失败: %v", workerID, err)
-				return
-			}
-			defer ch.Close()
-
-			// 声明队列（幂等操作）
-			q, err := ch.QueueDeclare(
-				QueueVideoLikeName,
-				true,  // durable: 持久化队列
-				false, // autoDelete: 不自动删除
-				false, // exclusive: 非独占队列
-				false, // noWait: 不等待服务器确认
-				nil,   // arguments: 额外参数
-			)
-			if err != nil {
-				log.Printf("Like Worker %d 声明队列失败: %v", workerID, err)
-				return
-			}
-
-			// 每个 worker 一次只拿一条未确认消息
-			if err := ch.Qos(1, 0, false); err != nil {
-				log.Printf("Like Worker %d 设置 QoS 失败: %v", workerID, err)
-				return
-			}
-
-			msgs, err := ch.Consume(
-				q.Name,
-				"",    // consumer tag
-				false, // autoAck: 手动确认
-				false,
-				false,
-				false,
-				nil,
-			)
-			if err != nil {
-				log.Printf("Like Worker %d 开始消费失败: %v", workerID, err)
-				return
-			}
-
-			log.Printf("Like Worker %d 已启动，等待任务...", workerID)
-
-			for d := range msgs {
-				var task LikeTask
-				if err := json.Unmarshal(d.Body, &task); err != nil {
-					log.Printf("Like Worker %d 解析失败: %v", workerID, err)
-					_ = d.Nack(false, false) // 丢弃无效消息
-					continue
-				}
-
-				if err := processLike(task); err != nil { // 处理点赞任务
-					log.Printf("Like Worker %d 处理失败: %v", workerID, err)
-					_ = d.Nack(false, true) // 重新入队
-					continue
-				}
-
-				_ = d.Ack(false)
-				log.Printf("Like Worker %d 完成: VideoID=%d, Delta=%d", workerID, task.VideoID, task.Delta)
-			}
-
-			log.Printf("Like Worker %d msgs channel closed, 退出", workerID)
+			// 每个 worker 一次只拿一条未确认消息；连接断开后自动等待重连并重新消费
+			name := fmt.Sprintf("Video Worker %d", workerID)
+			err := conn.Consume(context.Background(), QueueVideoName, 1, name, func(ch *amqp.Channel, d amqp.Delivery) {
+				handleVideoDelivery(workerID, ch, d)
+			})
+			log.Printf("%s 退出: %v", name, err)
 		}(i)
 	}
 
-	// 阻塞，防止函数返回
+	// 关键：阻塞，防止函数返回； 用channel阻塞也可以
 	select {}
 }
 
-
-func processLike(task LikeTask) error {
-	log.Printf("开始处理点赞任务: VideoID=%d, UserID=%d, Delta=%d", task.VideoID, task.UserID, task.Delta)
-
-	// 开启事务，确保 videos 表和 likes 表的操作原子性
-	tx := db.Begin()
-	if tx.Error != nil {
-		return fmt.Errorf("开启事务失败: %v", tx.Error)
-	}
-	defer func() {	// 防止程序panic意外终止而没有回滚导致数据库状态不一致
-		if r := recover(); r != nil {
-			tx.Rollback()
+// handleVideoDelivery 处理一条视频任务消息
+func handleVideoDelivery(workerID int, ch *amqp.Channel, d amqp.Delivery) {
+	var task VideoTask
+	if err := json.Unmarshal(d.Body, &task); err != nil {
+		log.Printf("Worker %d 解析失败: %v", workerID, err)
+		// 无法解析的消息重试也没有意义，直接进入死信队列
+		if err := mq.DeadLetter(ch, d, QueueVideoName, err); err != nil {
+			log.Printf("Worker %d 投递死信失败: %v", workerID, err)
 		}
-	}()
-
-	// appliedDelta：本次真正需要应用到 videos.like_count 的变化（只可能 -1/0/+1）
-	appliedDelta := 0
-
-	// 1) 先更新 likes 表（通过查询判断是否需要插入/删除）
-	if task.Delta > 0 {
-		// 点赞：如果不存在记录才插入，存在则幂等不操作
-		exists, err := TxGetByUseridAndVideoid(tx, task.UserID, task.VideoID)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("查询点赞记录失败: %v", err)
-		}
-
-		// if !exists {
-		// 	like := Like{
-		// 		UserID:  task.UserID,
-		// 		VideoID: task.VideoID,
-		// 	}
-		// 	if err := tx.Create(&like).Error; err != nil {
-		// 		tx.Rollback()
-		// 		return fmt.Errorf("插入点赞记录失败: %v", err)
-		// 	}
-		// 	appliedDelta = 1
-		// }
-		if !exists {
-			res := tx.Exec(
-				"INSERT INTO likes(user_id, video_id, created_at, updated_at) VALUES (?, ?, NOW(), NOW())",
-				task.UserID,
-				task.VideoID,
-			)
-
-			if res.Error != nil {
-				tx.Rollback()
-				return fmt.Errorf("插入点赞记录失败: %v", res.Error)
-			}
+		return
+	}
 
-			if res.RowsAffected > 0 {
-				appliedDelta = 1
-			}
+	if err := handleVideoTask(task); err != nil { // 处理视频任务
+		log.Printf("Worker %d 处理失败（已重试 %d 次）: %v", workerID, mq.RetryCount(d.Headers), err)
+		// 延迟重试；重试耗尽或不可重试（如文件损坏）则进入死信队列，并将视频标记为处理失败
+		var deadLettered bool
+		var rerr error
+		if isPermanent(err) {
+			deadLettered, rerr = true, mq.DeadLetter(ch, d, QueueVideoName, err)
+		} else {
+			deadLettered, rerr = mq.Retry(ch, d, QueueVideoName, err)
 		}
-
-
-	} else if task.Delta < 0 {
-		// 取消点赞：如果存在记录才删除，不存在则幂等不操作
-		exists, err := TxGetByUseridAndVideoid(tx, task.UserID, task.VideoID)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("查询点赞记录失败: %v", err)
+		if rerr != nil {
+			log.Printf("Worker %d 投递重试消息失败: %v", workerID, rerr)
+			return
 		}
-
-		if exists {
-			// res := tx.Where("user_id = ? AND video_id = ?", task.UserID, task.VideoID).Delete(&Like{})
-			res := tx.Exec(
-				"UPDATE likes SET deleted_at = NOW() WHERE user_id = ? AND video_id = ? AND deleted_at IS NULL",
-				task.UserID,
-				task.VideoID,
-			)
-			if res.Error != nil {
-				tx.Rollback()
-				return fmt.Errorf("删除点赞记录失败: %v", res.Error)
-			}
-
-			// - 正常情况下应当 RowsAffected > 0
-			// - 如果 RowsAffected == 0（并发导致刚被删），就当幂等不改计数
-			if res.RowsAffected > 0 {
-				appliedDelta = -1
+		if deadLettered {
+			if ferr := markVideoFailed(task.VideoID, err.Error()); ferr != nil {
+				log.Printf("Worker %d 标记视频处理失败出错: VideoID=%d, Error=%v", workerID, task.VideoID, ferr)
 			}
 		}
+		return
 	}
 
-	// 2) 再更新 videos 表的 like_count（仅当 likes 实际发生变化时）
-	if appliedDelta != 0 {
-		result := tx.Exec(
-			"UPDATE videos SET like_count = GREATEST(CAST(like_count AS SIGNED) + ?, 0) WHERE id = ?",
-			appliedDelta,
-			task.VideoID,
-		)
-		if result.Error != nil {
-			tx.Rollback()
-			return fmt.Errorf("更新 MySQL 失败: %v", result.Error)
-		}
-		if result.RowsAffected == 0 {
-			tx.Rollback()
-			log.Printf("警告: 视频不存在或未更新 VideoID=%d", task.VideoID)
-			return nil
-		}
-	}
+	_ = d.Ack(false)
+	log.Printf("Worker %d 完成: VideoID=%d", workerID, task.VideoID)
+}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("提交事务失败: %v", err)
+// processLike 在一个事务中处理单条点赞消息（批量落库失败时逐条处理使用，见 like_batch.go）
+func processLike(e likeEvent) error {
+	task := e.task
+	log.Printf("开始处理点赞任务: VideoID=%d, UserID=%d, Delta=%d", task.VideoID, task.UserID, task.Delta)
+
+	applied, err := applyLikeBatch(coalesceLikes([]likeEvent{e}))
+	if err != nil {
+		return err
 	}
 
-	log.Printf("点赞任务处理完成: VideoID=%d, Delta=%d, AppliedDelta=%d", task.VideoID, task.Delta, appliedDelta)
+	log.Printf("点赞任务处理完成: VideoID=%d, Delta=%d, AppliedDelta=%d, Stale=%t",
+		task.VideoID, task.Delta, applied.inserted-applied.deleted, applied.stale > 0)
 	return nil
 }
 
-
-
 // initMySQL 初始化 MySQL 连接
 func initMySQL() error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		config.MySQLUsername,
-		config.MySQLPassword,
-		config.MySQLHost,
-		config.MySQLPort,
-		config.MySQLDatabase)
-	
-	conn, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	conn, err := gorm.Open(mysql.Open(config.Conf.MySQL.DSN()), &gorm.Config{})
 	if err != nil {
 		return err
 	}
@@ -382,11 +204,10 @@ func initMySQL() error {
 
 // initMinIO 初始化 MinIO 客户端
 func initMinIO() error {
-	minioEndpoint := fmt.Sprintf("%s:%s", config.MinIOHost, config.MinIOPort)
-	
-	client, err := minio.New(minioEndpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(config.MinIOAccessKey, config.MinIOSecretKey, ""),
-		Secure: false,
+	cfg := config.Conf.MinIO
+	client, err := minio.New(cfg.Endpoint(), &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
 	})
 	if err != nil {
 		return err
@@ -395,12 +216,63 @@ func initMinIO() error {
 	return nil
 }
 
-// processVideo 处理视频（生成封面 + 转码）
+// initRedis 初始化 Redis 连接
+func initRedis() error {
+	cfg := config.Conf.Redis
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr(),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return err
+	}
+	rdb = client
+	return nil
+}
+
+// handleVideoTask 处理视频任务并驱动视频状态流转
+// 上传完成 -> 转码中 -> 已发布；重试耗尽仍失败时由消费者标记为 处理失败
+func handleVideoTask(task VideoTask) error {
+	// 1. 标记为转码中（视频已被删除则跳过）
+	claimed, err := markVideoProcessing(task.VideoID)
+	if err != nil {
+		return fmt.Errorf("更新视频状态失败: %v", err)
+	}
+	if !claimed {
+		log.Printf("视频不存在或已删除，跳过处理: VideoID=%d", task.VideoID)
+		return nil
+	}
+
+	// 2. 生成封面、转码，成功后标记为已发布
+	return processVideo(task)
+}
+
+// permanentError 不可重试的错误（如文件损坏、没有视频流），重试也不会成功
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent 将错误标记为不可重试
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// isPermanent 判断错误是否不可重试
+func isPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// processVideo 处理视频（生成封面 + HLS 转码）
 func processVideo(task VideoTask) error {
 	log.Printf("开始处理视频: VideoID=%d, FileName=%s", task.VideoID, task.FileName)
 
 	// 1. 从 MinIO 下载视频到本地临时目录
-	tempDir := "E:/temp/video_processing"
+	tempDir := config.Conf.Worker.TempDir
 	
 	// 确保临时目录存在
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
@@ -415,21 +287,31 @@ func processVideo(task VideoTask) error {
 	}
 	defer os.Remove(videoPath) // 处理完成后删除临时文件
 
-	// 2. 使用 WaitGroup 并行处理封面和转码
+	// 2. 探测源视频信息，保存到视频记录，并据此选择要生成的清晰度（不放大低分辨率视频）
+	meta, err := probeVideo(videoPath)
+	if err != nil {
+		return err
+	}
+	if err := updateVideoMeta(task.VideoID, meta); err != nil {
+		return fmt.Errorf("保存视频元数据失败: %v", err)
+	}
+	ladder := buildLadder(meta)
+	log.Printf("视频信息: VideoID=%d, %dx%d, %.2ffps, %s, 音频=%v, 清晰度=%v",
+		task.VideoID, meta.Width, meta.Height, meta.FrameRate, meta.VideoCodec, meta.HasAudio, renditionNames(ladder))
+
+	// 3. 使用 WaitGroup 并行处理封面和 HLS 转码
 	var wg sync.WaitGroup
-	var coverErr, transcode720Err, transcode1080Err error
-	var coverURL, url720p, url1080p string
+	var coverErr, hlsErr error
+	var coverURL, hlsURL string
 
 	// 生成文件名
 	baseFilename := strings.TrimSuffix(task.FileName, filepath.Ext(task.FileName))
 	coverFilename := baseFilename + "_cover.jpg"
-	filename720p := baseFilename + "_720p.mp4"
-	filename1080p := baseFilename + "_1080p.mp4"
+	hlsPrefix := HLSPrefix + baseFilename + "/"
 
 	// 生成文件路径
 	coverPath := filepath.Join(tempDir, coverFilename)
-	videoPath720p := filepath.Join(tempDir, filename720p)
-	videoPath1080p := filepath.Join(tempDir, filename1080p)
+	hlsDir := filepath.Join(tempDir, baseFilename+"_hls")
 
 	// 并行任务1：生成封面
 	wg.Add(1)
@@ -438,7 +320,7 @@ func processVideo(task VideoTask) error {
 		log.Printf("开始生成封面: VideoID=%d", task.VideoID)
 		
 		// 生成封面
-		if err := generateCover(videoPath, coverPath); err != nil {
+		if err := generateCover(videoPath, coverPath, meta.Duration); err != nil {
 			coverErr = fmt.Errorf("生成封面失败: %v", err)
 			return
 		}
@@ -454,50 +336,27 @@ func processVideo(task VideoTask) error {
 		log.Printf("封面生成完成: VideoID=%d", task.VideoID)
 	}()
 
-	// 并行任务2：转码720p
+	// 并行任务2：HLS 多清晰度转码
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		log.Printf("开始转码720p: VideoID=%d", task.VideoID)
-		
-		// 转码720p
-		if err := transcodeVideo720p(videoPath, videoPath720p); err != nil {
-			transcode720Err = fmt.Errorf("转码720p失败: %v", err)
-			return
-		}
-		defer os.Remove(videoPath720p) // 上传后删除临时文件
-		
-		// 上传720p视频到 MinIO
-		url, err := uploadToMinIO(videoPath720p, filename720p, "video/mp4")
-		if err != nil {
-			transcode720Err = fmt.Errorf("上传720p视频失败: %v", err)
-			return
-		}
-		url720p = url
-		log.Printf("720p转码完成: VideoID=%d", task.VideoID)
-	}()
+		log.Printf("开始 HLS 转码: VideoID=%d", task.VideoID)
 
-	// 并行任务3：转码1080p
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		log.Printf("开始转码1080p: VideoID=%d", task.VideoID)
-		
-		// 转码1080p
-		if err := transcodeVideo1080p(videoPath, videoPath1080p); err != nil {
-			transcode1080Err = fmt.Errorf("转码1080p失败: %v", err)
+		// 转码为 HLS（所有清晰度 + 主播放列表）
+		if err := transcodeHLS(videoPath, hlsDir, ladder, meta); err != nil {
+			hlsErr = fmt.Errorf("HLS 转码失败: %v", err)
 			return
 		}
-		defer os.Remove(videoPath1080p) // 上传后删除临时文件
-		
-		// 上传1080p视频到 MinIO
-		url, err := uploadToMinIO(videoPath1080p, filename1080p, "video/mp4")
+		defer os.RemoveAll(hlsDir) // 上传后删除临时目录
+
+		// 上传切片和播放列表到 MinIO
+		url, err := uploadHLSToMinIO(hlsDir, hlsPrefix)
 		if err != nil {
-			transcode1080Err = fmt.Errorf("上传1080p视频失败: %v", err)
+			hlsErr = fmt.Errorf("上传 HLS 文件失败: %v", err)
 			return
 		}
-		url1080p = url
-		log.Printf("1080p转码完成: VideoID=%d", task.VideoID)
+		hlsURL = url
+		log.Printf("HLS 转码完成: VideoID=%d", task.VideoID)
 	}()
 
 	// 等待所有任务完成
@@ -507,15 +366,12 @@ func processVideo(task VideoTask) error {
 	if coverErr != nil {
 		return coverErr
 	}
-	if transcode720Err != nil {
-		return transcode720Err
-	}
-	if transcode1080Err != nil {
-		return transcode1080Err
+	if hlsErr != nil {
+		return hlsErr
 	}
 
-	// 3. 更新数据库中的封面URL和转码后的视频URL
-	err = updateVideoURLs(task.VideoID, coverURL, url720p, url1080p)
+	// 4. 更新数据库中的封面URL、HLS 主播放列表URL和实际生成的清晰度
+	err = updateVideoURLs(task.VideoID, coverURL, hlsURL, renditionNames(ladder))
 	if err != nil {
 		return fmt.Errorf("更新数据库失败: %v", err)
 	}
@@ -532,17 +388,22 @@ func downloadFromMinIO(filename, localPath string) error {
 }
 
 // generateCover 使用 FFmpeg 生成视频封面
-// 从视频的第1秒截取一帧作为封面
-func generateCover(videoPath, coverPath string) error {
+// 从视频的第1秒截取一帧作为封面（不足2秒的视频取第一帧）
+func generateCover(videoPath, coverPath string, duration float64) error {
+	seek := "00:00:01"
+	if duration < 2 {
+		seek = "00:00:00"
+	}
+
 	// FFmpeg 命令：从视频第1秒截取一帧
 	// -i: 输入文件
 	// -ss: 指定时间点（秒）
 	// -vframes 1: 只截取1帧
 	// -q:v 2: 设置图片质量（1-31，数字越小质量越高）
 	cmd := exec.Command(
-		FFmpegPath,
+		config.Conf.Worker.FFmpegPath,
 		"-i", videoPath,
-		"-ss", "00:00:01",
+		"-ss", seek,
 		"-vframes", "1",
 		"-q:v", "2",
 		coverPath,
@@ -557,72 +418,6 @@ func generateCover(videoPath, coverPath string) error {
 	return nil
 }
 
-// transcodeVideo720p 转码视频为720p
-func transcodeVideo720p(inputPath, outputPath string) error {
-	// FFmpeg 转码命令
-	// -i: 输入文件
-	// -vf "scale=-2:720": 缩放到720p，宽度自动计算（保持宽高比）
-	// -c:v libx264: 使用H.264编码器
-	// -preset medium: 编码速度预设（medium平衡速度和质量）
-	// -crf 23: 恒定质量模式（18-28，数字越小质量越高）
-	// -b:v 3000k: 视频比特率3Mbps
-	// -c:a aac: 音频编码器AAC
-	// -b:a 128k: 音频比特率128kbps
-	cmd := exec.Command(   // 创建命令不执行
-		FFmpegPath,
-		"-i", inputPath,
-		"-vf", "scale=-2:720",
-		"-c:v", "libx264",
-		"-preset", "medium",
-		"-crf", "23",
-		"-b:v", "3000k",
-		"-c:a", "aac",
-		"-b:a", "128k",
-		outputPath,
-	)
-
-	// 执行命令
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("FFmpeg 720p转码失败: %v, 输出: %s", err, string(output))
-	}
-
-	return nil
-}
-
-// transcodeVideo1080p 转码视频为1080p
-func transcodeVideo1080p(inputPath, outputPath string) error {
-	// FFmpeg 转码命令
-	// -i: 输入文件
-	// -vf "scale=-2:1080": 缩放到1080p，宽度自动计算（保持宽高比）
-	// -c:v libx264: 使用H.264编码器
-	// -preset medium: 编码速度预设
-	// -crf 23: 恒定质量模式
-	// -b:v 5000k: 视频比特率5Mbps
-	// -c:a aac: 音频编码器AAC
-	// -b:a 192k: 音频比特率192kbps
-	cmd := exec.Command(
-		FFmpegPath,
-		"-i", inputPath,
-		"-vf", "scale=-2:1080",
-		"-c:v", "libx264",
-		"-preset", "medium",
-		"-crf", "23",
-		"-b:v", "5000k",
-		"-c:a", "aac",
-		"-b:a", "192k",
-		outputPath,
-	)
-
-	// 执行命令
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("FFmpeg 1080p转码失败: %v, 输出: %s", err, string(output))
-	}
-
-	return nil
-}
-
 // uploadToMinIO 上传文件到 MinIO，返回访问url
 func uploadToMinIO(localPath, filename, contentType string) (string, error) {
 	ctx := context.Background()
@@ -636,17 +431,23 @@ func uploadToMinIO(localPath, filename, contentType string) (string, error) {
 	}
 
 	// 生成永久访问URL
-	minioEndpoint := fmt.Sprintf("%s:%s", config.MinIOHost, config.MinIOPort)
-	fileURL := fmt.Sprintf("http://%s/%s/%s", minioEndpoint, MinioBucket, filename)
-	return fileURL, nil
+	return objectURL(filename), nil
+}
+
+// objectURL 生成对象的永久访问URL
+func objectURL(objectName string) string {
+	return fmt.Sprintf("%s/%s/%s", config.Conf.MinIO.BaseURL(), MinioBucket, objectName)
 }
 
-// updateVideoURLs 更新视频的封面URL和转码后的视频URL
-func updateVideoURLs(videoID uint, coverURL, url720p, url1080p string) error {
+// updateVideoURLs 更新视频的封面URL、HLS 主播放列表URL和清晰度列表，并将视频标记为已发布
+func updateVideoURLs(videoID uint, coverURL, hlsURL string, renditions []string) error {
 	updates := map[string]interface{}{
-		"cover_url":  coverURL,
-		"url720p":   url720p,
-		"url1080p":  url1080p,
+		"cover_url":   coverURL,
+		"hls_url":     hlsURL,
+		"renditions":  strings.Join(renditions, ","),
+		"status":      VideoStatusPublished,
+		"fail_reason": "",
+		"updated_at":  time.Now(),
 	}
 	
 	result := db.Table("videos").Where("id = ?", videoID).Updates(updates)
@@ -658,20 +459,50 @@ func updateVideoURLs(videoID uint, coverURL, url720p, url1080p string) error {
 	return nil
 }
 
-// 保证事务一致性的mysql数据库查询结果
-func TxGetByUseridAndVideoid(dbConn *gorm.DB, userid uint, videoid uint) (bool, error) {
-	var exist int
-
-	err := dbConn.Raw(
-		"SELECT 1 FROM likes WHERE user_id = ? AND video_id = ? AND deleted_at IS NULL LIMIT 1",
-		userid,
-		videoid,
-	).Scan(&exist).Error
+// updateVideoMeta 保存 ffprobe 探测到的视频元数据
+func updateVideoMeta(videoID uint, meta *VideoMeta) error {
+	return db.Table("videos").
+		Where("id = ?", videoID).
+		Updates(map[string]interface{}{
+			"width":       meta.Width,
+			"height":      meta.Height,
+			"duration":    meta.Duration,
+			"video_codec": meta.VideoCodec,
+			"frame_rate":  meta.FrameRate,
+			"rotation":    meta.Rotation,
+			"has_audio":   meta.HasAudio,
+			"updated_at":  time.Now(),
+		}).Error
+}
 
-	if err != nil {
-		log.Printf("查询点赞记录失败: %v", err)
-		return false, err
+// markVideoProcessing 将视频标记为转码中
+// 返回：视频是否存在（未被删除）
+func markVideoProcessing(videoID uint) (bool, error) {
+	result := db.Table("videos").
+		Where("id = ? AND deleted_at IS NULL", videoID).
+		Updates(map[string]interface{}{
+			"status":      VideoStatusProcessing,
+			"fail_reason": "",
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
 	}
+	return result.RowsAffected > 0, nil
+}
 
-	return exist == 1, nil
+// markVideoFailed 将视频标记为处理失败，并记录失败原因
+func markVideoFailed(videoID uint, reason string) error {
+	// fail_reason 列长度为 512，过长的 FFmpeg 输出按字符截断保存
+	if r := []rune(reason); len(r) > 500 {
+		reason = string(r[:500])
+	}
+	return db.Table("videos").
+		Where("id = ?", videoID).
+		Updates(map[string]interface{}{
+			"status":      VideoStatusFailed,
+			"fail_reason": reason,
+			"updated_at":  time.Now(),
+		}).Error
 }
+
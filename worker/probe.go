@@ -0,0 +1,141 @@
+package main
+
+// 使用 ffprobe 探测源视频信息
+
+import (
+	"common/config"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// VideoMeta 源视频元数据
+type VideoMeta struct {
+	Width      int     // 显示宽度（已按旋转角度交换宽高）
+	Height     int     // 显示高度
+	Duration   float64 // 时长（秒）
+	VideoCodec string  // 视频编码，如 h264、hevc
+	FrameRate  float64 // 帧率
+	Rotation   int     // 旋转角度（0/90/180/270）
+	HasAudio   bool    // 是否包含音频流
+	Bitrate    int     // 总码率（kbps），未知为0
+}
+
+// ShortSide 短边长度（清晰度按短边计算，竖屏 1080x1920 也算 1080p）
+func (m VideoMeta) ShortSide() int {
+	if m.Width < m.Height {
+		return m.Width
+	}
+	return m.Height
+}
+
+// Portrait 是否竖屏
+func (m VideoMeta) Portrait() bool {
+	return m.Width < m.Height
+}
+
+// ffprobeOutput ffprobe -print_format json 的输出（只保留用到的字段）
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// probeVideo 使用 ffprobe 探测视频元数据
+func probeVideo(videoPath string) (*VideoMeta, error) {
+	cmd := exec.Command(
+		config.Conf.Worker.FFprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_streams",
+		"-show_format",
+		videoPath,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, permanent(fmt.Errorf("ffprobe 执行失败（文件可能已损坏）: %v", err))
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("解析 ffprobe 输出失败: %v", err)
+	}
+
+	meta := &VideoMeta{}
+	foundVideo := false
+	for _, st := range probe.Streams {
+		switch st.CodecType {
+		case "video":
+			if foundVideo {
+				continue // 只取第一路视频流
+			}
+			foundVideo = true
+			meta.VideoCodec = st.CodecName
+			meta.Width, meta.Height = st.Width, st.Height
+			meta.FrameRate = parseFrameRate(st.AvgFrameRate)
+			if meta.FrameRate == 0 {
+				meta.FrameRate = parseFrameRate(st.RFrameRate)
+			}
+
+			// 旋转角度：新版 FFmpeg 在 side_data 的 displaymatrix 中，旧版在 tags.rotate 中
+			rotation := 0.0
+			if r, ok := st.Tags["rotate"]; ok {
+				rotation, _ = strconv.ParseFloat(r, 64)
+			}
+			for _, sd := range st.SideDataList {
+				if sd.Rotation != 0 {
+					rotation = sd.Rotation
+				}
+			}
+			meta.Rotation = ((int(math.Round(rotation))%360 + 360) % 360)
+		case "audio":
+			meta.HasAudio = true
+		}
+	}
+	if !foundVideo || meta.Width == 0 || meta.Height == 0 {
+		return nil, permanent(fmt.Errorf("文件中没有可用的视频流"))
+	}
+
+	// FFmpeg 转码时会按旋转角度自动旋转画面，这里记录显示尺寸
+	if meta.Rotation == 90 || meta.Rotation == 270 {
+		meta.Width, meta.Height = meta.Height, meta.Width
+	}
+
+	meta.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	if bps, err := strconv.Atoi(probe.Format.BitRate); err == nil {
+		meta.Bitrate = bps / 1000
+	}
+
+	return meta, nil
+}
+
+// parseFrameRate 解析 "30000/1001" 形式的帧率
+func parseFrameRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return math.Round(n/d*100) / 100
+}
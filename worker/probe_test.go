@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestParseFrameRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"30/1", 30},
+		{"30000/1001", 29.97},
+		{"60000/1001", 59.94},
+		{"25", 25},
+		{"0/0", 0},
+		{"", 0},
+		{"abc/1", 0},
+	}
+	for _, tt := range tests {
+		if got := parseFrameRate(tt.in); got != tt.want {
+			t.Errorf("parseFrameRate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+// 播放量落库（backend 在 Redis 中聚合播放增量，定时经发件箱投递，每条消息为一批视频的增量）
+
+import (
+	"common/mq"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+)
+
+// ViewTask 播放量落库任务结构
+type ViewTask struct {
+	FlushID string      `json:"flush_id"` // 批次ID，用于去重
+	Videos  []ViewDelta `json:"videos"`
+}
+
+// ViewDelta 单个视频的播放增量
+type ViewDelta struct {
+	VideoID    uint    `json:"video_id"`
+	Views      int64   `json:"views"`      // 新增播放次数
+	Completion float64 `json:"completion"` // 新增的完播比例之和
+}
+
+// startViewConsumer	============播放量落库的消费者==============
+func startViewConsumer(conn *mq.Connection) {
+	log.Println("播放量 Consumer 启动中...")
+
+	// 每条消息已经是聚合后的一批增量，单个 worker 即可；连接断开后自动等待重连并重新消费
+	name := "View Worker"
+	err := conn.Consume(context.Background(), QueueVideoViewName, 1, name, handleViewDelivery)
+	log.Printf("%s 退出: %v", name, err)
+}
+
+// handleViewDelivery 处理一条播放量落库任务消息
+func handleViewDelivery(ch *amqp.Channel, d amqp.Delivery) {
+	var task ViewTask
+	if err := json.Unmarshal(d.Body, &task); err != nil || task.FlushID == "" {
+		if err == nil {
+			err = errors.New("缺少 flush_id")
+		}
+		log.Printf("View Worker 解析失败: %v", err)
+		// 无效消息直接进入死信队列
+		if err := mq.DeadLetter(ch, d, QueueVideoViewName, err); err != nil {
+			log.Printf("View Worker 投递死信失败: %v", err)
+		}
+		return
+	}
+
+	if err := processViewTask(task); err != nil {
+		log.Printf("View Worker 处理失败（已重试 %d 次）: %v", mq.RetryCount(d.Headers), err)
+		// 延迟重试，重试耗尽则进入死信队列
+		if _, err := mq.Retry(ch, d, QueueVideoViewName, err); err != nil {
+			log.Printf("View Worker 投递重试消息失败: %v", err)
+		}
+		return
+	}
+
+	_ = d.Ack(false)
+}
+
+// processViewTask 在一个事务中记录批次ID并累加 videos.view_count、completion_sum
+// 批次ID已存在说明这批增量已经落库过（发件箱至少一次投递），直接忽略
+func processViewTask(task ViewTask) error {
+	applied := true
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec("INSERT IGNORE INTO view_flushes(flush_id, created_at) VALUES (?, NOW())", task.FlushID)
+		if res.Error != nil {
+			return fmt.Errorf("记录批次失败: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			applied = false
+			return nil
+		}
+
+		for _, v := range task.Videos {
+			if v.Views == 0 && v.Completion == 0 {
+				continue
+			}
+			if err := tx.Exec(
+				"UPDATE videos SET view_count = view_count + ?, completion_sum = completion_sum + ? WHERE id = ?",
+				v.Views,
+				v.Completion,
+				v.VideoID,
+			).Error; err != nil {
+				return fmt.Errorf("更新播放量失败: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if applied {
+		log.Printf("播放量落库完成: FlushID=%s, Videos=%d", task.FlushID, len(task.Videos))
+	} else {
+		log.Printf("播放量批次已落库，忽略重复消息: FlushID=%s", task.FlushID)
+	}
+	return nil
+}